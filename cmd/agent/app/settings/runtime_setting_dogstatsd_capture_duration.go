@@ -8,6 +8,8 @@ package settings
 import (
 	"fmt"
 	"time"
+
+	"github.com/DataDog/datadog-agent/pkg/config/settings"
 )
 
 // DsdCaptureDurationRuntimeSetting wraps operations to change the duration, in seconds, of traffic captures
@@ -23,6 +25,11 @@ func (l DsdCaptureDurationRuntimeSetting) Hidden() bool {
 	return false
 }
 
+// Type returns the type of the values of the runtime setting
+func (l DsdCaptureDurationRuntimeSetting) Type() settings.SettingType {
+	return settings.DurationType
+}
+
 // Name returns the name of the runtime setting
 func (l DsdCaptureDurationRuntimeSetting) Name() string {
 	return string(l)
@@ -27,6 +27,11 @@ func (s DsdStatsRuntimeSetting) Hidden() bool {
 	return false
 }
 
+// Type returns the type of the values of the runtime setting
+func (s DsdStatsRuntimeSetting) Type() settings.SettingType {
+	return settings.BoolType
+}
+
 // Name returns the name of the runtime setting
 func (s DsdStatsRuntimeSetting) Name() string {
 	return string(s)
@@ -1,17 +1,117 @@
 package api
 
 import (
+	"crypto/subtle"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+
 	"github.com/DataDog/datadog-agent/cmd/system-probe/config"
+	"github.com/DataDog/datadog-agent/pkg/config/settings"
 	settingshttp "github.com/DataDog/datadog-agent/pkg/config/settings/http"
 	"github.com/gorilla/mux"
+	"golang.org/x/time/rate"
 )
 
+// settingsEvents streams the changes of the runtime settings to the /config/events subscribers of all the routers.
+// It is registered once since the change listeners of the settings are never removed.
+var settingsEvents = newConfigEvents()
+
+func init() {
+	settings.AddChangeListener(settingsEvents.publish)
+}
+
 // setupConfigHandlers adds the specific handlers for /config endpoints
-func setupConfigHandlers(r *mux.Router) *mux.Router {
+func setupConfigHandlers(r *mux.Router, authToken string, cfg *config.Config) *mux.Router {
+	r.Use(authTokenMiddleware(authToken))
+	r.Use(readOnlyMiddleware(cfg.ConfigAPIReadOnly))
+	r.Use(mutationRateLimitMiddleware(cfg.ConfigAPIMutationsPerSecond, cfg.ConfigAPIMutationsBurst))
 	r.HandleFunc("/", settingshttp.Server.GetFull(config.Namespace)).Methods("GET")
+	r.HandleFunc("/", settingshttp.Server.SetValues).Methods("PATCH")
 	r.HandleFunc("/list-runtime", settingshttp.Server.ListConfigurable).Methods("GET")
+	r.HandleFunc("/list-runtime/detailed", settingshttp.Server.ListDetailed).Methods("GET")
+	r.HandleFunc("/dump", settingshttp.Server.Dump(config.Namespace)).Methods("GET")
+	r.HandleFunc("/diff", settingshttp.Server.Diff).Methods("GET")
+	r.Handle("/events", settingsEvents).Methods("GET")
+	r.HandleFunc("/batch", settingshttp.Server.SetBatch).Methods("POST")
 	r.HandleFunc("/{setting}", settingshttp.Server.GetValue).Methods("GET")
 	r.HandleFunc("/{setting}", settingshttp.Server.SetValue).Methods("POST")
+	r.HandleFunc("/{setting}", settingshttp.Server.DeleteValue).Methods("DELETE")
+	r.HandleFunc("/{setting}/reset", settingshttp.Server.ResetValue).Methods("POST")
 
 	return r
 }
+
+// authTokenMiddleware rejects the requests that don't carry the given bearer token with a 401
+func authTokenMiddleware(authToken string) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			auth := r.Header.Get("Authorization")
+			if !strings.HasPrefix(auth, "Bearer ") {
+				w.Header().Set("WWW-Authenticate", `Bearer realm="Datadog System Probe"`)
+				http.Error(w, "no session token provided", http.StatusUnauthorized)
+				return
+			}
+			if authToken == "" || subtle.ConstantTimeCompare([]byte(strings.TrimPrefix(auth, "Bearer ")), []byte(authToken)) != 1 {
+				w.Header().Set("WWW-Authenticate", `Bearer realm="Datadog System Probe" error="invalid_token"`)
+				http.Error(w, "invalid session token", http.StatusUnauthorized)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// isMutation returns true for the requests which may change the settings, i.e. all but GET and HEAD
+func isMutation(r *http.Request) bool {
+	return r.Method != http.MethodGet && r.Method != http.MethodHead
+}
+
+// readOnlyMiddleware rejects the requests which may change the settings with a 403 when readOnly is set
+func readOnlyMiddleware(readOnly bool) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		if !readOnly {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if isMutation(r) {
+				http.Error(w, "the config API is read-only", http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// mutationRateLimitMiddleware rejects the requests changing the settings with a 429 past perSecond requests
+// per second, burst requests being allowed at once. The reads aren't limited.
+// The limit is global since the clients of the system-probe socket can't be told apart.
+func mutationRateLimitMiddleware(perSecond float64, burst int) mux.MiddlewareFunc {
+	if perSecond <= 0 {
+		return func(next http.Handler) http.Handler { return next }
+	}
+	if burst < 1 {
+		burst = 1
+	}
+	limiter := rate.NewLimiter(rate.Limit(perSecond), burst)
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !isMutation(r) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			reservation := limiter.Reserve()
+			if delay := reservation.Delay(); delay > 0 {
+				// the token is given back since the request isn't served
+				reservation.Cancel()
+				w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(delay.Seconds()))))
+				http.Error(w, "too many settings changes, retry later", http.StatusTooManyRequests)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,194 @@
+package api
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/DataDog/datadog-agent/cmd/system-probe/config"
+	ddconfig "github.com/DataDog/datadog-agent/pkg/config"
+	"github.com/DataDog/datadog-agent/pkg/config/settings"
+)
+
+func TestAuthTokenMiddleware(t *testing.T) {
+	r := mux.NewRouter()
+	r.Use(authTokenMiddleware("0123456789abcdef0123456789abcdef"))
+	r.HandleFunc("/list-runtime", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}).Methods("GET")
+
+	for _, tc := range []struct {
+		name   string
+		auth   string
+		status int
+	}{
+		{name: "valid token", auth: "Bearer 0123456789abcdef0123456789abcdef", status: http.StatusOK},
+		{name: "missing token", auth: "", status: http.StatusUnauthorized},
+		{name: "bad token", auth: "Bearer fedcba9876543210fedcba9876543210", status: http.StatusUnauthorized},
+		{name: "bad scheme", auth: "Basic 0123456789abcdef0123456789abcdef", status: http.StatusUnauthorized},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/list-runtime", nil)
+			if tc.auth != "" {
+				req.Header.Set("Authorization", tc.auth)
+			}
+			rec := httptest.NewRecorder()
+			r.ServeHTTP(rec, req)
+			assert.Equal(t, tc.status, rec.Code)
+			if tc.status == http.StatusUnauthorized {
+				assert.NotEmpty(t, rec.Header().Get("WWW-Authenticate"))
+			}
+		})
+	}
+}
+
+func TestAuthTokenMiddlewareEmptyToken(t *testing.T) {
+	r := mux.NewRouter()
+	r.Use(authTokenMiddleware(""))
+	r.HandleFunc("/list-runtime", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}).Methods("GET")
+
+	req := httptest.NewRequest("GET", "/list-runtime", nil)
+	req.Header.Set("Authorization", "Bearer ")
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+}
+
+func TestConfigHandlerMissingAuthToken(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dd-test-")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir) // clean up
+	mockConfig := ddconfig.Mock()
+	mockConfig.Set("auth_token_file_path", filepath.Join(dir, "auth_token"))
+
+	r := configHandler(&config.Config{})
+	for _, auth := range []string{"", "Bearer ", "Bearer " + testAuthToken} {
+		req := httptest.NewRequest("GET", "/list-runtime", nil)
+		req.Header.Set("Authorization", auth)
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+		assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	}
+}
+
+func TestConfigBatchRoute(t *testing.T) {
+	r := setupConfigHandlers(mux.NewRouter(), testAuthToken, &config.Config{})
+
+	// the batch isn't handled as the change of a setting named batch
+	req := httptest.NewRequest("POST", "/batch", strings.NewReader(`{"settings": {"events_test": "batched"}}`))
+	req.Header.Set("Authorization", "Bearer "+testAuthToken)
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	value, err := settings.GetRuntimeSetting("events_test")
+	assert.NoError(t, err)
+	assert.Equal(t, "batched", value)
+}
+
+func TestMutationRateLimitMiddleware(t *testing.T) {
+	r := mux.NewRouter()
+	r.Use(mutationRateLimitMiddleware(0.5, 2))
+	r.HandleFunc("/{setting}", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}).Methods("GET", "POST")
+
+	do := func(method string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, httptest.NewRequest(method, "/log_level", nil))
+		return rec
+	}
+
+	// the burst is allowed, then the changes are rejected until a token is available
+	assert.Equal(t, http.StatusOK, do("POST").Code)
+	assert.Equal(t, http.StatusOK, do("POST").Code)
+	for i := 0; i < 5; i++ {
+		rec := do("POST")
+		assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+		assert.Equal(t, "2", rec.Header().Get("Retry-After"))
+	}
+
+	// the reads aren't limited
+	for i := 0; i < 10; i++ {
+		assert.Equal(t, http.StatusOK, do("GET").Code)
+	}
+}
+
+func TestMutationRateLimitMiddlewareDisabled(t *testing.T) {
+	r := mux.NewRouter()
+	r.Use(mutationRateLimitMiddleware(0, 0))
+	r.HandleFunc("/{setting}", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}).Methods("POST")
+
+	for i := 0; i < 100; i++ {
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, httptest.NewRequest("POST", "/log_level", nil))
+		assert.Equal(t, http.StatusOK, rec.Code)
+	}
+}
+
+func TestConfigReadOnly(t *testing.T) {
+	r := setupConfigHandlers(mux.NewRouter(), testAuthToken, &config.Config{ConfigAPIReadOnly: true})
+	require.NoError(t, settings.SetRuntimeSetting("events_test", "before"))
+
+	do := func(method, target, contentType, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+testAuthToken)
+		if contentType != "" {
+			req.Header.Set("Content-Type", contentType)
+		}
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+		return rec
+	}
+
+	for _, tc := range []struct {
+		method, target, contentType, body string
+	}{
+		{"POST", "/events_test", "application/x-www-form-urlencoded", "value=changed"},
+		{"POST", "/events_test/reset", "", ""},
+		{"POST", "/batch", "application/json", `{"settings": {"events_test": "changed"}}`},
+		{"PATCH", "/", "application/json", `{"events_test": "changed"}`},
+		{"DELETE", "/events_test", "", ""},
+	} {
+		rec := do(tc.method, tc.target, tc.contentType, tc.body)
+		assert.Equal(t, http.StatusForbidden, rec.Code, "%s %s", tc.method, tc.target)
+	}
+
+	value, err := settings.GetRuntimeSetting("events_test")
+	require.NoError(t, err)
+	assert.Equal(t, "before", value)
+
+	for _, target := range []string{"/events_test", "/list-runtime", "/list-runtime/detailed"} {
+		assert.Equal(t, http.StatusOK, do("GET", target, "", "").Code, target)
+	}
+
+	// the token is still required
+	req := httptest.NewRequest("GET", "/events_test", nil)
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+}
+
+func TestConfigDiffRoute(t *testing.T) {
+	r := setupConfigHandlers(mux.NewRouter(), testAuthToken, &config.Config{})
+	require.NoError(t, settings.SetRuntimeSetting("events_test", "diffed"))
+
+	req := httptest.NewRequest("GET", "/diff", nil)
+	req.Header.Set("Authorization", "Bearer "+testAuthToken)
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"value":"diffed"`)
+}
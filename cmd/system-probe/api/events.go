@@ -0,0 +1,93 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/DataDog/datadog-agent/pkg/util/log"
+)
+
+// subscriberBufferSize is the number of events buffered for a subscriber, events are dropped for slow subscribers
+const subscriberBufferSize = 16
+
+// settingEvent is the event sent to the subscribers when a runtime setting is changed
+type settingEvent struct {
+	Setting string      `json:"setting"`
+	Value   interface{} `json:"value"`
+}
+
+// configEvents streams the changes of the runtime settings to its subscribers as Server-Sent Events
+type configEvents struct {
+	mu          sync.Mutex
+	subscribers map[chan settingEvent]struct{}
+}
+
+func newConfigEvents() *configEvents {
+	return &configEvents{
+		subscribers: make(map[chan settingEvent]struct{}),
+	}
+}
+
+func (e *configEvents) subscribe() chan settingEvent {
+	ch := make(chan settingEvent, subscriberBufferSize)
+	e.mu.Lock()
+	e.subscribers[ch] = struct{}{}
+	e.mu.Unlock()
+	return ch
+}
+
+func (e *configEvents) unsubscribe(ch chan settingEvent) {
+	e.mu.Lock()
+	delete(e.subscribers, ch)
+	e.mu.Unlock()
+}
+
+// publish sends the new value of a setting to all the subscribers, it is a settings.ChangeListener
+func (e *configEvents) publish(setting string, value interface{}) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for ch := range e.subscribers {
+		select {
+		case ch <- settingEvent{Setting: setting, Value: value}:
+		default:
+			log.Warnf("Dropping the change event of setting %s for a slow subscriber", setting)
+		}
+	}
+}
+
+// ServeHTTP streams the events until the client disconnects
+func (e *configEvents) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming is not supported", http.StatusInternalServerError)
+		return
+	}
+
+	ch := e.subscribe()
+	defer e.unsubscribe(ch)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case event := <-ch:
+			data, err := json.Marshal(event)
+			if err != nil {
+				log.Errorf("Unable to marshal the change event of setting %s: %s", event.Setting, err)
+				continue
+			}
+			if _, err := fmt.Fprintf(w, "event: setting\ndata: %s\n\n", data); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package api
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/DataDog/datadog-agent/cmd/system-probe/config"
+	"github.com/DataDog/datadog-agent/pkg/config/settings"
+)
+
+const testAuthToken = "0123456789abcdef0123456789abcdef"
+
+// eventsTestSetting is a runtime setting holding a string
+type eventsTestSetting struct {
+	value string
+}
+
+func (t *eventsTestSetting) Name() string {
+	return "events_test"
+}
+
+func (t *eventsTestSetting) Description() string {
+	return "test setting"
+}
+
+func (t *eventsTestSetting) Get() (interface{}, error) {
+	return t.value, nil
+}
+
+func (t *eventsTestSetting) Set(v interface{}) error {
+	t.value = v.(string)
+	return nil
+}
+
+func (t *eventsTestSetting) Hidden() bool {
+	return false
+}
+
+func init() {
+	_ = settings.RegisterRuntimeSetting(&eventsTestSetting{})
+}
+
+func subscribeEvents(ctx context.Context, t *testing.T, serverURL string) *bufio.Scanner {
+	req, err := http.NewRequest("GET", serverURL+"/events", nil)
+	require.NoError(t, err)
+	req.Header.Set("Authorization", "Bearer "+testAuthToken)
+	resp, err := http.DefaultClient.Do(req.WithContext(ctx))
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+	t.Cleanup(func() { resp.Body.Close() })
+	return bufio.NewScanner(resp.Body)
+}
+
+func readEvent(t *testing.T, scanner *bufio.Scanner) []string {
+	var lines []string
+	for scanner.Scan() {
+		if scanner.Text() == "" {
+			return lines
+		}
+		lines = append(lines, scanner.Text())
+	}
+	require.NoError(t, scanner.Err())
+	return lines
+}
+
+func TestConfigEvents(t *testing.T) {
+	server := httptest.NewServer(setupConfigHandlers(mux.NewRouter(), testAuthToken, &config.Config{}))
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	first := subscribeEvents(ctx, t, server.URL)
+	second := subscribeEvents(ctx, t, server.URL)
+
+	req, err := http.NewRequest("POST", server.URL+"/events_test", strings.NewReader(url.Values{"value": {"changed"}}.Encode()))
+	require.NoError(t, err)
+	req.Header.Set("Authorization", "Bearer "+testAuthToken)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	expected := []string{"event: setting", `data: {"setting":"events_test","value":"changed"}`}
+	assert.Equal(t, expected, readEvent(t, first))
+	assert.Equal(t, expected, readEvent(t, second))
+}
+
+func TestConfigEventsDisconnect(t *testing.T) {
+	events := newConfigEvents()
+	r := mux.NewRouter()
+	r.Use(authTokenMiddleware(testAuthToken))
+	r.Handle("/events", events)
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	subscribeEvents(ctx, t, server.URL)
+	events.mu.Lock()
+	assert.Len(t, events.subscribers, 1)
+	events.mu.Unlock()
+
+	cancel()
+	assert.Eventually(t, func() bool {
+		events.mu.Lock()
+		defer events.mu.Unlock()
+		return len(events.subscribers) == 0
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// publishing without subscribers doesn't block
+	events.publish("events_test", "value")
+}
@@ -8,6 +8,7 @@ import (
 	"github.com/DataDog/datadog-agent/cmd/system-probe/config"
 	"github.com/DataDog/datadog-agent/cmd/system-probe/modules"
 	"github.com/DataDog/datadog-agent/cmd/system-probe/utils"
+	"github.com/DataDog/datadog-agent/pkg/api/security"
 	"github.com/DataDog/datadog-agent/pkg/process/net"
 	"github.com/DataDog/datadog-agent/pkg/util/log"
 	gorilla "github.com/gorilla/mux"
@@ -32,8 +33,7 @@ func StartServer(cfg *config.Config) error {
 		utils.WriteAsJSON(w, stats)
 	})
 
-	configMux := gorilla.NewRouter()
-	mux.Handle("/config/", http.StripPrefix("/config", setupConfigHandlers(configMux)))
+	mux.Handle("/config/", http.StripPrefix("/config", configHandler(cfg)))
 
 	go func() {
 		err = http.Serve(conn.GetListener(), mux)
@@ -44,3 +44,14 @@ func StartServer(cfg *config.Config) error {
 
 	return nil
 }
+
+// configHandler returns the handler of the config endpoints. Since they're protected by the auth token,
+// they all reply with a 401 when it can't be loaded, while the modules are still served.
+func configHandler(cfg *config.Config) http.Handler {
+	authToken, err := security.FetchAuthToken()
+	if err != nil {
+		log.Errorf("Unable to load the auth token protecting the config endpoints, they are disabled: %s", err)
+		authToken = ""
+	}
+	return setupConfigHandlers(gorilla.NewRouter(), authToken, cfg)
+}
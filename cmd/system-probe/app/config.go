@@ -10,6 +10,7 @@ import (
 
 	"github.com/DataDog/datadog-agent/cmd/system-probe/api"
 	"github.com/DataDog/datadog-agent/cmd/system-probe/config"
+	"github.com/DataDog/datadog-agent/pkg/api/util"
 	ddconfig "github.com/DataDog/datadog-agent/pkg/config"
 	"github.com/DataDog/datadog-agent/pkg/config/settings"
 	settingshttp "github.com/DataDog/datadog-agent/pkg/config/settings/http"
@@ -109,6 +110,10 @@ func getSettingsClient() (settings.Client, error) {
 	if err != nil {
 		return nil, err
 	}
+	// the config endpoints of the system-probe require the auth token
+	if err := util.SetAuthToken(); err != nil {
+		return nil, fmt.Errorf("unable to load the auth token: %v", err)
+	}
 	hc := api.GetClient(cfg.SocketAddress)
 	return settingshttp.NewClient(hc, "http://localhost/config", "system-probe"), nil
 }
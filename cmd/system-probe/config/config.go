@@ -55,6 +55,13 @@ type Config struct {
 	LogLevel  string
 	DebugPort int
 
+	// ConfigAPIReadOnly makes the config API refuse the changes of the runtime settings
+	ConfigAPIReadOnly bool
+	// ConfigAPIMutationsPerSecond limits the rate of the requests changing the runtime settings
+	// through the config API, 0 disables the limit. ConfigAPIMutationsBurst requests are allowed at once.
+	ConfigAPIMutationsPerSecond float64
+	ConfigAPIMutationsBurst     int
+
 	StatsdHost string
 	StatsdPort int
 
@@ -136,6 +143,10 @@ func load(configPath string) (*Config, error) {
 		LogLevel:  cfg.GetString(key(spNS, "log_level")),
 		DebugPort: cfg.GetInt(key(spNS, "debug_port")),
 
+		ConfigAPIReadOnly:           cfg.GetBool(key(spNS, "config_api_read_only")),
+		ConfigAPIMutationsPerSecond: cfg.GetFloat64(key(spNS, "config_api.mutations_per_second")),
+		ConfigAPIMutationsBurst:     cfg.GetInt(key(spNS, "config_api.mutations_burst")),
+
 		StatsdHost: aconfig.GetBindHost(),
 		StatsdPort: cfg.GetInt("dogstatsd_port"),
 
@@ -63,6 +63,10 @@ func setupAPM(config Config) {
 	config.BindEnv("apm_config.log_file", "DD_APM_LOG_FILE")                                             //nolint:errcheck
 	config.BindEnv("apm_config.max_events_per_second", "DD_APM_MAX_EPS", "DD_MAX_EPS")                   //nolint:errcheck
 	config.BindEnv("apm_config.max_traces_per_second", "DD_APM_MAX_TPS", "DD_MAX_TPS")                   //nolint:errcheck
+	config.BindEnv("apm_config.service_ttl", "DD_APM_SERVICE_TTL")                                       //nolint:errcheck
+	config.BindEnv("apm_config.default_service_rate_key", "DD_APM_DEFAULT_SERVICE_RATE_KEY")             //nolint:errcheck
+	config.BindEnv("apm_config.max_catalog_services", "DD_APM_MAX_CATALOG_SERVICES")                     //nolint:errcheck
+	config.BindEnv("apm_config.case_insensitive_services", "DD_APM_CASE_INSENSITIVE_SERVICES")           //nolint:errcheck
 	config.BindEnv("apm_config.max_memory", "DD_APM_MAX_MEMORY")                                         //nolint:errcheck
 	config.BindEnv("apm_config.max_cpu_percent", "DD_APM_MAX_CPU_PERCENT")                               //nolint:errcheck
 	config.BindEnv("apm_config.env", "DD_APM_ENV")                                                       //nolint:errcheck
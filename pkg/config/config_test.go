@@ -739,6 +739,33 @@ func TestSanitizeAPIKeyConfig(t *testing.T) {
 	assert.Equal(t, "foo", config.GetString("api_key"))
 }
 
+func TestValidateAPIKey(t *testing.T) {
+	for _, key := range []string{"0123456789abcdef0123456789abcdef", "ABCDEF0123456789abcdef0123456789", " 0123456789abcdef0123456789abcdef\n"} {
+		assert.NoError(t, ValidateAPIKey(key), key)
+	}
+
+	assert.EqualError(t, ValidateAPIKey(""), "missing api_key")
+	assert.EqualError(t, ValidateAPIKey(" \n\t"), "missing api_key")
+	for _, key := range []string{
+		"foo",
+		"0123456789abcdef0123456789abcde",
+		"0123456789abcdef0123456789abcdef0",
+		`"0123456789abcdef0123456789abcdef"`,
+		"api_key: 0123456789abcdef0123456789abcdef",
+		"0123456789abcdef 0123456789abcdef",
+	} {
+		assert.Error(t, ValidateAPIKey(key), key)
+	}
+	assert.EqualError(t, ValidateAPIKey("foo"), "invalid api_key: it should be 32 characters long, got 3")
+	for _, key := range []string{
+		"0123456789abcdef0123456789abcdeg",
+		"0123456789abcdef\n123456789abcdef",
+		"0123456789abcdef0123456789abcdé",
+	} {
+		assert.EqualError(t, ValidateAPIKey(key), "invalid api_key: it should only contain hexadecimal digits", key)
+	}
+}
+
 // TestSecretBackendWithMultipleEndpoints tests an edge case of `viper.AllSettings()` when a config
 // key includes the key delimiter. Affects the config package when both secrets and multiple
 // endpoints are configured.
@@ -0,0 +1,64 @@
+package http
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/DataDog/datadog-agent/pkg/util/log"
+)
+
+const redactedValue = "********"
+
+// sensitiveKeySuffixes are the endings of the names of the settings holding secrets
+var sensitiveKeySuffixes = []string{"api_key", "app_key", "token", "password", "passwd", "pwd", "secret"}
+
+func isSensitiveKey(key string) bool {
+	key = strings.ToLower(key)
+	for _, suffix := range sensitiveKeySuffixes {
+		if strings.HasSuffix(key, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// redactSettings returns a copy of the settings with the values of the sensitive keys redacted,
+// and the credentials found in the other values scrubbed. The maps of the copy have string keys so that it can be marshalled to JSON.
+func redactSettings(v interface{}) interface{} {
+	switch value := v.(type) {
+	case map[string]interface{}:
+		redacted := make(map[string]interface{}, len(value))
+		for k, item := range value {
+			redacted[k] = redactSetting(k, item)
+		}
+		return redacted
+	case map[interface{}]interface{}:
+		redacted := make(map[string]interface{}, len(value))
+		for k, item := range value {
+			key := fmt.Sprintf("%v", k)
+			redacted[key] = redactSetting(key, item)
+		}
+		return redacted
+	case []interface{}:
+		redacted := make([]interface{}, len(value))
+		for i, item := range value {
+			redacted[i] = redactSettings(item)
+		}
+		return redacted
+	case string:
+		scrubbed, err := log.CredentialsCleanerBytes([]byte(value))
+		if err != nil {
+			return redactedValue
+		}
+		return string(scrubbed)
+	default:
+		return v
+	}
+}
+
+func redactSetting(key string, value interface{}) interface{} {
+	if isSensitiveKey(key) && value != nil && value != "" {
+		return redactedValue
+	}
+	return redactSettings(value)
+}
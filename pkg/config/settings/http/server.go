@@ -2,8 +2,15 @@ package http
 
 import (
 	"encoding/json"
+	"fmt"
+	"hash/fnv"
 	"html"
 	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
 
 	ddconfig "github.com/DataDog/datadog-agent/pkg/config"
 	"github.com/DataDog/datadog-agent/pkg/config/settings"
@@ -15,30 +22,80 @@ import (
 // Server offers functions that implement the standard runtime settings HTTP API
 var Server = struct {
 	GetFull          func(string) http.HandlerFunc
+	Dump             func(string) http.HandlerFunc
 	GetValue         http.HandlerFunc
 	SetValue         http.HandlerFunc
+	SetValues        http.HandlerFunc
+	SetBatch         http.HandlerFunc
+	ResetValue       http.HandlerFunc
+	DeleteValue      http.HandlerFunc
 	ListConfigurable http.HandlerFunc
+	ListDetailed     http.HandlerFunc
+	Diff             http.HandlerFunc
 }{
 	GetFull:          getFullConfig,
+	Dump:             dumpConfig,
 	GetValue:         getConfigValue,
 	SetValue:         setConfigValue,
+	SetValues:        setConfigValues,
+	SetBatch:         setConfigBatch,
+	ResetValue:       resetConfigValue,
+	DeleteValue:      deleteConfigValue,
 	ListConfigurable: listConfigurableSettings,
+	ListDetailed:     listConfigurableSettingsDetails,
+	Diff:             diffConfigurableSettings,
+}
+
+// settingResult is the result of the change of a setting by setConfigValues
+type settingResult struct {
+	Value interface{} `json:"value,omitempty"`
+	Error string      `json:"error,omitempty"`
+}
+
+// settingDiff compares the current value of a setting with the value it had before being changed at runtime
+type settingDiff struct {
+	Default    interface{} `json:"default"`
+	Value      interface{} `json:"value"`
+	Overridden bool        `json:"overridden"`
+}
+
+// settingsBatch is the body of the requests handled by setConfigBatch
+type settingsBatch struct {
+	Settings map[string]interface{} `json:"settings"`
+}
+
+// batchFailure is the response of setConfigBatch when a setting couldn't be changed, see changeSettings
+type batchFailure struct {
+	Setting string `json:"setting"`
+	Error   string `json:"error"`
+	// NotRestored lists the settings left with their new value by the rollback
+	NotRestored []string `json:"not_restored,omitempty"`
+}
+
+// settingChange is the result of the change of a setting by setConfigValue
+type settingChange struct {
+	Setting  string      `json:"setting"`
+	OldValue interface{} `json:"old_value"`
+	NewValue interface{} `json:"new_value"`
+}
+
+// namespaceSettings returns the settings of a namespace, or all the settings if the namespace is empty
+func namespaceSettings(namespace string) interface{} {
+	allSettings := ddconfig.Datadog.AllSettings()
+	if namespace == "" {
+		return allSettings
+	}
+	for k, v := range allSettings {
+		if k == namespace {
+			return v
+		}
+	}
+	return nil
 }
 
 func getFullConfig(namespace string) http.HandlerFunc {
 	return func(w http.ResponseWriter, _ *http.Request) {
-		var nsSettings interface{}
-		allSettings := ddconfig.Datadog.AllSettings()
-		if namespace != "" {
-			for k, v := range allSettings {
-				if k == namespace {
-					nsSettings = v
-					break
-				}
-			}
-		} else {
-			nsSettings = allSettings
-		}
+		nsSettings := namespaceSettings(namespace)
 
 		runtimeConfig, err := yaml.Marshal(nsSettings)
 		if err != nil {
@@ -60,6 +117,45 @@ func getFullConfig(namespace string) http.HandlerFunc {
 	}
 }
 
+// dumpConfig serializes the settings of a namespace with their secrets redacted,
+// as JSON by default or as YAML with the format=yaml query parameter.
+func dumpConfig(namespace string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		format := r.URL.Query().Get("format")
+		if format == "" {
+			format = "json"
+		}
+		if format != "json" && format != "yaml" {
+			body, _ := json.Marshal(map[string]string{"error": fmt.Sprintf("unsupported format %s, valid formats are: json, yaml", format)})
+			http.Error(w, string(body), http.StatusBadRequest)
+			return
+		}
+
+		redacted := redactSettings(namespaceSettings(namespace))
+
+		var body []byte
+		var err error
+		if format == "yaml" {
+			body, err = yaml.Marshal(redacted)
+		} else {
+			body, err = json.Marshal(redacted)
+		}
+		if err != nil {
+			log.Errorf("Unable to marshal config dump: %s", err)
+			body, _ := json.Marshal(map[string]string{"error": err.Error()})
+			http.Error(w, string(body), http.StatusInternalServerError)
+			return
+		}
+
+		if format == "yaml" {
+			w.Header().Set("Content-Type", "application/x-yaml")
+		} else {
+			w.Header().Set("Content-Type", "application/json")
+		}
+		_, _ = w.Write(body)
+	}
+}
+
 func listConfigurableSettings(w http.ResponseWriter, _ *http.Request) {
 	configurableSettings := make(map[string]settings.RuntimeSettingResponse)
 	for name, setting := range settings.RuntimeSettings() {
@@ -78,6 +174,58 @@ func listConfigurableSettings(w http.ResponseWriter, _ *http.Request) {
 	_, _ = w.Write(body)
 }
 
+// listConfigurableSettingsDetails lists the runtime configurable settings with their type, value and default
+func listConfigurableSettingsDetails(w http.ResponseWriter, _ *http.Request) {
+	details := make(map[string]settings.RuntimeSettingDetails)
+	for name := range settings.RuntimeSettings() {
+		d, err := settings.GetRuntimeSettingDetails(name)
+		if err != nil {
+			log.Errorf("Unable to get the details of runtime setting %s: %s", name, err)
+			body, _ := json.Marshal(map[string]string{"error": err.Error()})
+			http.Error(w, string(body), http.StatusInternalServerError)
+			return
+		}
+		details[name] = d
+	}
+	body, err := json.Marshal(details)
+	if err != nil {
+		log.Errorf("Unable to marshal runtime configurable settings details response: %s", err)
+		body, _ := json.Marshal(map[string]string{"error": err.Error()})
+		http.Error(w, string(body), http.StatusInternalServerError)
+		return
+	}
+	_, _ = w.Write(body)
+}
+
+// diffConfigurableSettings lists the runtime configurable settings with their default and current values,
+// the settings whose value differs from their default are overridden
+func diffConfigurableSettings(w http.ResponseWriter, _ *http.Request) {
+	diff := make(map[string]settingDiff)
+	for name := range settings.RuntimeSettings() {
+		d, err := settings.GetRuntimeSettingDetails(name)
+		if err != nil {
+			log.Errorf("Unable to get the details of runtime setting %s: %s", name, err)
+			body, _ := json.Marshal(map[string]string{"error": err.Error()})
+			http.Error(w, string(body), http.StatusInternalServerError)
+			return
+		}
+		diff[name] = settingDiff{
+			Default:    d.Default,
+			Value:      d.Value,
+			Overridden: !reflect.DeepEqual(d.Default, d.Value),
+		}
+	}
+	body, err := json.Marshal(diff)
+	if err != nil {
+		log.Errorf("Unable to marshal runtime configurable settings diff response: %s", err)
+		body, _ := json.Marshal(map[string]string{"error": err.Error()})
+		http.Error(w, string(body), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(body)
+}
+
 func getConfigValue(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	setting := vars["setting"]
@@ -101,9 +249,40 @@ func getConfigValue(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, string(body), http.StatusInternalServerError)
 		return
 	}
+	w.Header().Set("ETag", valueETag(val))
 	_, _ = w.Write(body)
 }
 
+// conditionalSetLock serializes the changes made with an If-Match header, so that the value
+// can't change between the check of the ETag and the change
+var conditionalSetLock sync.Mutex
+
+// valueETag returns the entity tag of the value of a setting, returned by getConfigValue and
+// expected in the If-Match header of setConfigValue
+func valueETag(value interface{}) string {
+	h := fnv.New64a()
+	b, err := json.Marshal(value)
+	if err != nil {
+		b = []byte(fmt.Sprintf("%#v", value))
+	}
+	_, _ = h.Write(b)
+	return fmt.Sprintf(`"%016x"`, h.Sum64())
+}
+
+// etagMatches returns true if the If-Match header lists the entity tag of the value, or is *
+func etagMatches(ifMatch string, value interface{}) bool {
+	etag := valueETag(value)
+	for _, candidate := range strings.Split(ifMatch, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// setConfigValue changes a setting. If the request has an If-Match header, the setting is only
+// changed if its value still has one of the listed entity tags, a 412 is returned otherwise.
 func setConfigValue(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	setting := vars["setting"]
@@ -111,7 +290,64 @@ func setConfigValue(w http.ResponseWriter, r *http.Request) {
 	_ = r.ParseForm()
 	value := html.UnescapeString(r.Form.Get("value"))
 
-	if err := settings.SetRuntimeSetting(setting, value); err != nil {
+	if err := settings.ValidateRuntimeSettingValue(setting, value); err != nil {
+		body, _ := json.Marshal(map[string]string{"error": err.Error()})
+		http.Error(w, string(body), http.StatusBadRequest)
+		return
+	}
+
+	ifMatch := r.Header.Get("If-Match")
+	if ifMatch != "" {
+		conditionalSetLock.Lock()
+		defer conditionalSetLock.Unlock()
+	}
+
+	oldValue, err := settings.GetRuntimeSetting(setting)
+	if err == nil && ifMatch != "" && !etagMatches(ifMatch, oldValue) {
+		w.Header().Set("ETag", valueETag(oldValue))
+		body, _ := json.Marshal(map[string]string{"error": fmt.Sprintf("setting %s was changed since it was read", setting)})
+		http.Error(w, string(body), http.StatusPreconditionFailed)
+		return
+	}
+	if err == nil {
+		err = settings.SetRuntimeSetting(setting, value)
+	}
+	var newValue interface{}
+	if err == nil {
+		newValue, err = settings.GetRuntimeSetting(setting)
+	}
+	if err != nil {
+		body, _ := json.Marshal(map[string]string{"error": err.Error()})
+		switch err.(type) {
+		case *settings.SettingNotFoundError:
+			http.Error(w, string(body), http.StatusBadRequest)
+		default:
+			http.Error(w, string(body), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	// the previous value is returned so that the change can be rolled back
+	body, err := json.Marshal(settingChange{Setting: setting, OldValue: oldValue, NewValue: newValue})
+	if err != nil {
+		log.Errorf("Unable to marshal runtime setting change response: %s", err)
+		body, _ := json.Marshal(map[string]string{"error": err.Error()})
+		http.Error(w, string(body), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", valueETag(newValue))
+	_, _ = w.Write(body)
+}
+
+// resetConfigValue restores the value a setting had before it was changed at runtime
+func resetConfigValue(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	setting := vars["setting"]
+	log.Infof("Got a request to reset a setting: %s", setting)
+
+	val, err := settings.ResetRuntimeSetting(setting)
+	if err != nil {
 		body, _ := json.Marshal(map[string]string{"error": err.Error()})
 		switch err.(type) {
 		case *settings.SettingNotFoundError:
@@ -121,4 +357,180 @@ func setConfigValue(w http.ResponseWriter, r *http.Request) {
 		}
 		return
 	}
+	body, err := json.Marshal(map[string]interface{}{"value": val})
+	if err != nil {
+		log.Errorf("Unable to marshal runtime setting value response: %s", err)
+		body, _ := json.Marshal(map[string]string{"error": err.Error()})
+		http.Error(w, string(body), http.StatusInternalServerError)
+		return
+	}
+	_, _ = w.Write(body)
+}
+
+// deleteConfigValue drops the runtime override of a setting, restoring the value it had before it was
+// changed at runtime. A 404 is returned if the setting isn't runtime configurable.
+func deleteConfigValue(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	setting := vars["setting"]
+	log.Infof("Got a request to delete the runtime override of a setting: %s", setting)
+
+	val, err := settings.ResetRuntimeSetting(setting)
+	if err != nil {
+		body, _ := json.Marshal(map[string]string{"error": err.Error()})
+		switch err.(type) {
+		case *settings.SettingNotFoundError:
+			http.Error(w, string(body), http.StatusNotFound)
+		default:
+			http.Error(w, string(body), http.StatusInternalServerError)
+		}
+		return
+	}
+	body, err := json.Marshal(map[string]interface{}{"value": val})
+	if err != nil {
+		log.Errorf("Unable to marshal runtime setting value response: %s", err)
+		body, _ := json.Marshal(map[string]string{"error": err.Error()})
+		http.Error(w, string(body), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("ETag", valueETag(val))
+	_, _ = w.Write(body)
+}
+
+// changeSettings transactionally changes several settings from values decoded from JSON: the values are
+// all validated before anything is changed, and if a setting can't be changed the settings already
+// changed are restored to their previous value. It returns the new values of the settings, or the
+// failure and the status to reply with: a 400 when a setting rejects its value, unless a setting
+// already changed couldn't be restored.
+func changeSettings(values map[string]interface{}) (map[string]interface{}, *batchFailure, int) {
+	// the settings are set with strings, like the ones posted to setConfigValue
+	names := make([]string, 0, len(values))
+	strValues := make(map[string]interface{}, len(values))
+	for setting, value := range values {
+		strValues[setting] = settingValueString(value)
+		names = append(names, setting)
+	}
+	sort.Strings(names)
+	for _, setting := range names {
+		if err := settings.ValidateRuntimeSettingValue(setting, strValues[setting].(string)); err != nil {
+			return nil, &batchFailure{Setting: setting, Error: err.Error()}, http.StatusBadRequest
+		}
+	}
+
+	if errs := settings.SetRuntimeSettings(strValues); errs != nil {
+		failure := &batchFailure{}
+		for _, setting := range names {
+			err, ok := errs[setting]
+			if !ok {
+				continue
+			}
+			if _, ok := err.(*settings.RestoreError); ok {
+				failure.NotRestored = append(failure.NotRestored, setting)
+			} else if failure.Setting == "" {
+				failure.Setting, failure.Error = setting, err.Error()
+			}
+		}
+		if len(failure.NotRestored) > 0 {
+			log.Errorf("Unable to roll back the settings after %s failed, settings left changed: %s", failure.Setting, strings.Join(failure.NotRestored, ", "))
+			return nil, failure, http.StatusInternalServerError
+		}
+		return nil, failure, http.StatusBadRequest
+	}
+
+	changed := make(map[string]interface{}, len(names))
+	for _, setting := range names {
+		value, err := settings.GetRuntimeSetting(setting)
+		if err != nil {
+			return nil, &batchFailure{Setting: setting, Error: err.Error()}, http.StatusInternalServerError
+		}
+		changed[setting] = value
+	}
+	return changed, nil, http.StatusOK
+}
+
+// setConfigValues changes several settings at once from a JSON object of setting names to values,
+// either all of them are changed or none. The whole object is rejected with a 400 when a setting is
+// unknown or rejects its value, and a 500 is returned when a setting couldn't be restored.
+func setConfigValues(w http.ResponseWriter, r *http.Request) {
+	var values map[string]interface{}
+	if err := json.NewDecoder(r.Body).Decode(&values); err != nil {
+		body, _ := json.Marshal(map[string]string{"error": fmt.Sprintf("invalid settings: %s", err)})
+		http.Error(w, string(body), http.StatusBadRequest)
+		return
+	}
+	log.Infof("Got a request to change %d settings", len(values))
+
+	changed, failure, status := changeSettings(values)
+	results := make(map[string]settingResult, len(values))
+	for setting := range values {
+		if failure != nil {
+			results[setting] = settingResult{Error: "not changed"}
+			continue
+		}
+		results[setting] = settingResult{Value: changed[setting]}
+	}
+	if failure != nil {
+		for _, setting := range failure.NotRestored {
+			results[setting] = settingResult{Error: "not restored"}
+		}
+		results[failure.Setting] = settingResult{Error: failure.Error}
+	}
+
+	body, err := json.Marshal(results)
+	if err != nil {
+		log.Errorf("Unable to marshal runtime settings response: %s", err)
+		body, _ := json.Marshal(map[string]string{"error": err.Error()})
+		http.Error(w, string(body), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_, _ = w.Write(body)
+}
+
+// setConfigBatch applies a batch of settings, posted as {"settings": {"name": value, ...}}, transactionally
+// like setConfigValues. If a setting can't be changed, the failing setting is returned with a 400 once the
+// settings already changed are restored, or with a 500 listing the settings which couldn't be restored.
+func setConfigBatch(w http.ResponseWriter, r *http.Request) {
+	var batch settingsBatch
+	if err := json.NewDecoder(r.Body).Decode(&batch); err != nil {
+		body, _ := json.Marshal(map[string]string{"error": fmt.Sprintf("invalid settings batch: %s", err)})
+		http.Error(w, string(body), http.StatusBadRequest)
+		return
+	}
+	log.Infof("Got a request to apply a batch of %d settings", len(batch.Settings))
+
+	changed, failure, status := changeSettings(batch.Settings)
+	if failure != nil {
+		writeBatchFailure(w, *failure, status)
+		return
+	}
+	body, err := json.Marshal(settingsBatch{Settings: changed})
+	if err != nil {
+		log.Errorf("Unable to marshal runtime settings batch response: %s", err)
+		body, _ := json.Marshal(map[string]string{"error": err.Error()})
+		http.Error(w, string(body), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(body)
+}
+
+// settingValueString converts a value decoded from JSON to the string runtime settings are set with.
+// Numbers are formatted without exponent, e.g. 1000000 rather than 1e+06.
+func settingValueString(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	default:
+		return fmt.Sprintf("%v", v)
+	}
+}
+
+func writeBatchFailure(w http.ResponseWriter, failure batchFailure, status int) {
+	body, _ := json.Marshal(failure)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_, _ = w.Write(body)
 }
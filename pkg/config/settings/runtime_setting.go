@@ -8,10 +8,19 @@ package settings
 import (
 	"errors"
 	"fmt"
+	"sort"
+	"sync"
 )
 
 var runtimeSettings = make(map[string]RuntimeSetting)
 
+// originalValues holds the values of the settings before they were first changed at runtime,
+// they are restored by ResetRuntimeSetting.
+var (
+	originalValues     = make(map[string]interface{})
+	originalValuesLock sync.Mutex
+)
+
 // SettingNotFoundError is used to warn about non existing/not registered runtime setting
 type SettingNotFoundError struct {
 	name string
@@ -23,10 +32,39 @@ type RuntimeSettingResponse struct {
 	Hidden      bool
 }
 
+// ChangeListener is called with the new value of a setting after it was changed at runtime
+type ChangeListener func(setting string, value interface{})
+
+var (
+	changeListeners     []ChangeListener
+	changeListenersLock sync.Mutex
+)
+
+// RuntimeSettingDetails is used to communicate the details of a setting
+type RuntimeSettingDetails struct {
+	Description string
+	Hidden      bool
+	// Type is the declared type of the values of the setting, or the Go type of its value
+	Type  string
+	Value interface{}
+	// Default is the value the setting had before being changed at runtime
+	Default interface{}
+}
+
 func (e *SettingNotFoundError) Error() string {
 	return fmt.Sprintf("setting %s not found", e.name)
 }
 
+// RestoreError is returned by SetRuntimeSettings for the settings whose previous value couldn't be
+// restored after another setting failed to change
+type RestoreError struct {
+	err error
+}
+
+func (e *RestoreError) Error() string {
+	return fmt.Sprintf("unable to restore the previous value: %s", e.err)
+}
+
 // RuntimeSetting represents a setting that can be changed and read at runtime.
 type RuntimeSetting interface {
 	Get() (interface{}, error)
@@ -45,6 +83,31 @@ func RegisterRuntimeSetting(setting RuntimeSetting) error {
 	return nil
 }
 
+// AddChangeListener registers a listener notified of every change of a runtime setting
+func AddChangeListener(listener ChangeListener) {
+	changeListenersLock.Lock()
+	defer changeListenersLock.Unlock()
+	changeListeners = append(changeListeners, listener)
+}
+
+// notifyChange calls the change listeners with the current value of a setting
+func notifyChange(setting string) {
+	changeListenersLock.Lock()
+	listeners := changeListeners
+	changeListenersLock.Unlock()
+	if len(listeners) == 0 {
+		return
+	}
+
+	value, err := runtimeSettings[setting].Get()
+	if err != nil {
+		return
+	}
+	for _, listener := range listeners {
+		listener(setting, value)
+	}
+}
+
 // RuntimeSettings returns all runtime configurable settings
 func RuntimeSettings() map[string]RuntimeSetting {
 	return runtimeSettings
@@ -55,9 +118,107 @@ func SetRuntimeSetting(setting string, value interface{}) error {
 	if _, ok := runtimeSettings[setting]; !ok {
 		return &SettingNotFoundError{name: setting}
 	}
+	if err := saveOriginalValue(setting); err != nil {
+		return err
+	}
 	if err := runtimeSettings[setting].Set(value); err != nil {
 		return err
 	}
+	notifyChange(setting)
+	return nil
+}
+
+// saveOriginalValue keeps the current value of a setting if it has not been changed at runtime yet
+func saveOriginalValue(setting string) error {
+	originalValuesLock.Lock()
+	defer originalValuesLock.Unlock()
+	if _, ok := originalValues[setting]; ok {
+		return nil
+	}
+	value, err := runtimeSettings[setting].Get()
+	if err != nil {
+		return err
+	}
+	originalValues[setting] = value
+	return nil
+}
+
+// ResetRuntimeSetting restores the value a runtime configurable setting had before it was
+// changed at runtime, and returns the restored value.
+// The setting is left untouched if it has not been changed at runtime.
+func ResetRuntimeSetting(setting string) (interface{}, error) {
+	if _, ok := runtimeSettings[setting]; !ok {
+		return nil, &SettingNotFoundError{name: setting}
+	}
+
+	originalValuesLock.Lock()
+	original, ok := originalValues[setting]
+	originalValuesLock.Unlock()
+	if ok {
+		if err := runtimeSettings[setting].Set(original); err != nil {
+			return nil, err
+		}
+		originalValuesLock.Lock()
+		delete(originalValues, setting)
+		originalValuesLock.Unlock()
+		notifyChange(setting)
+	}
+	return runtimeSettings[setting].Get()
+}
+
+// SetRuntimeSettings changes the value of several runtime configurable settings at once.
+// Either all the settings are changed or none: nothing is changed if one of them isn't
+// registered, and the settings already changed are restored if one of them fails, the
+// settings which couldn't be restored are reported with a RestoreError.
+// It returns the errors by setting, nil if all the settings were changed.
+func SetRuntimeSettings(values map[string]interface{}) map[string]error {
+	errs := make(map[string]error)
+	for setting := range values {
+		if _, ok := runtimeSettings[setting]; !ok {
+			errs[setting] = &SettingNotFoundError{name: setting}
+		}
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+
+	names := make([]string, 0, len(values))
+	for setting := range values {
+		names = append(names, setting)
+	}
+	sort.Strings(names)
+
+	previous := make(map[string]interface{}, len(values))
+	for _, setting := range names {
+		value, err := runtimeSettings[setting].Get()
+		if err != nil {
+			errs[setting] = err
+			return errs
+		}
+		previous[setting] = value
+	}
+	for _, setting := range names {
+		if err := saveOriginalValue(setting); err != nil {
+			errs[setting] = err
+			return errs
+		}
+	}
+
+	for i, setting := range names {
+		if err := runtimeSettings[setting].Set(values[setting]); err != nil {
+			errs[setting] = err
+			// restore the settings already changed
+			for j := i - 1; j >= 0; j-- {
+				if err := runtimeSettings[names[j]].Set(previous[names[j]]); err != nil {
+					errs[names[j]] = &RestoreError{err: err}
+				}
+			}
+			return errs
+		}
+	}
+	for _, setting := range names {
+		notifyChange(setting)
+	}
 	return nil
 }
 
@@ -73,6 +234,37 @@ func GetRuntimeSetting(setting string) (interface{}, error) {
 	return value, nil
 }
 
+// GetRuntimeSettingDetails returns the details of a runtime configurable setting
+func GetRuntimeSettingDetails(setting string) (RuntimeSettingDetails, error) {
+	if _, ok := runtimeSettings[setting]; !ok {
+		return RuntimeSettingDetails{}, &SettingNotFoundError{name: setting}
+	}
+	value, err := runtimeSettings[setting].Get()
+	if err != nil {
+		return RuntimeSettingDetails{}, err
+	}
+
+	originalValuesLock.Lock()
+	defaultValue, ok := originalValues[setting]
+	originalValuesLock.Unlock()
+	if !ok {
+		defaultValue = value
+	}
+
+	typ := fmt.Sprintf("%T", value)
+	if typed, ok := runtimeSettings[setting].(TypedRuntimeSetting); ok {
+		typ = string(typed.Type())
+	}
+
+	return RuntimeSettingDetails{
+		Description: runtimeSettings[setting].Description(),
+		Hidden:      runtimeSettings[setting].Hidden(),
+		Type:        typ,
+		Value:       value,
+		Default:     defaultValue,
+	}, nil
+}
+
 // GetBool returns the bool value contained in value.
 // If value is a bool, returns its value
 // If value is a string, it converts "true" to true and "false" to false.
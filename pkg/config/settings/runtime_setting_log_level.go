@@ -25,6 +25,11 @@ func (l LogLevelRuntimeSetting) Hidden() bool {
 	return false
 }
 
+// Type returns the type of the values of the runtime setting
+func (l LogLevelRuntimeSetting) Type() SettingType {
+	return StringType
+}
+
 // Name returns the name of the runtime setting
 func (l LogLevelRuntimeSetting) Name() string {
 	return "log_level"
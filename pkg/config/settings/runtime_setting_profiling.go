@@ -26,6 +26,11 @@ func (l ProfilingRuntimeSetting) Hidden() bool {
 	return true
 }
 
+// Type returns the type of the values of the runtime setting
+func (l ProfilingRuntimeSetting) Type() SettingType {
+	return BoolType
+}
+
 // Name returns the name of the runtime setting
 func (l ProfilingRuntimeSetting) Name() string {
 	return string(l)
@@ -0,0 +1,69 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016-present Datadog, Inc.
+
+package settings
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// SettingType is the type of the values of a runtime setting
+type SettingType string
+
+// Types of the values of the runtime settings
+const (
+	StringType   SettingType = "string"
+	IntType      SettingType = "int"
+	BoolType     SettingType = "bool"
+	DurationType SettingType = "time.Duration"
+)
+
+// TypedRuntimeSetting is implemented by the runtime settings declaring the type of their values,
+// the values received as strings are validated against this type before being set.
+type TypedRuntimeSetting interface {
+	RuntimeSetting
+	Type() SettingType
+}
+
+// InvalidValueError is returned when a value can't be converted to the type of a setting
+type InvalidValueError struct {
+	name     string
+	value    string
+	expected string
+}
+
+func (e *InvalidValueError) Error() string {
+	return fmt.Sprintf("invalid value %q for setting %s: expected %s", e.value, e.name, e.expected)
+}
+
+// ValidateRuntimeSettingValue checks that a value received as a string can be converted to the type
+// of a runtime configurable setting. The values of the settings not declaring their type are not checked.
+func ValidateRuntimeSettingValue(setting string, value string) error {
+	if _, ok := runtimeSettings[setting]; !ok {
+		return &SettingNotFoundError{name: setting}
+	}
+	typed, ok := runtimeSettings[setting].(TypedRuntimeSetting)
+	if !ok {
+		return nil
+	}
+
+	switch typed.Type() {
+	case IntType:
+		if _, err := strconv.Atoi(value); err != nil {
+			return &InvalidValueError{name: setting, value: value, expected: "an integer"}
+		}
+	case BoolType:
+		if _, err := GetBool(value); err != nil {
+			return &InvalidValueError{name: setting, value: value, expected: "true or false"}
+		}
+	case DurationType:
+		if _, err := time.ParseDuration(value); err != nil {
+			return &InvalidValueError{name: setting, value: value, expected: "a duration such as 30s or 5m"}
+		}
+	}
+	return nil
+}
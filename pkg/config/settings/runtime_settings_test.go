@@ -6,6 +6,7 @@
 package settings
 
 import (
+	"fmt"
 	"strings"
 	"testing"
 
@@ -47,6 +48,8 @@ func setupConf() config.Config {
 
 func cleanRuntimeSetting() {
 	runtimeSettings = make(map[string]RuntimeSetting)
+	originalValues = make(map[string]interface{})
+	changeListeners = nil
 }
 
 func TestRuntimeSettings(t *testing.T) {
@@ -120,3 +123,130 @@ func TestProfiling(t *testing.T) {
 	err = ll.Set("on")
 	assert.NotNil(t, err)
 }
+
+type runtimeTestNamedSetting struct {
+	name  string
+	value interface{}
+	// invalid is a value rejected by Set
+	invalid interface{}
+}
+
+func (t *runtimeTestNamedSetting) Name() string {
+	return t.name
+}
+
+func (t *runtimeTestNamedSetting) Description() string {
+	return "desc"
+}
+
+func (t *runtimeTestNamedSetting) Get() (interface{}, error) {
+	return t.value, nil
+}
+
+func (t *runtimeTestNamedSetting) Set(v interface{}) error {
+	if v == t.invalid {
+		return fmt.Errorf("invalid value %v", v)
+	}
+	t.value = v
+	return nil
+}
+
+func (t *runtimeTestNamedSetting) Hidden() bool {
+	return false
+}
+
+func TestSetRuntimeSettings(t *testing.T) {
+	cleanRuntimeSetting()
+	first := &runtimeTestNamedSetting{name: "first", value: 1, invalid: -1}
+	second := &runtimeTestNamedSetting{name: "second", value: 2, invalid: -1}
+	assert.Nil(t, RegisterRuntimeSetting(first))
+	assert.Nil(t, RegisterRuntimeSetting(second))
+
+	errs := SetRuntimeSettings(map[string]interface{}{"first": 10, "second": 20})
+	assert.Nil(t, errs)
+	assert.Equal(t, 10, first.value)
+	assert.Equal(t, 20, second.value)
+
+	// nothing changes when a setting is unknown
+	errs = SetRuntimeSettings(map[string]interface{}{"first": 100, "unknown": 0})
+	assert.Len(t, errs, 1)
+	assert.IsType(t, &SettingNotFoundError{}, errs["unknown"])
+	assert.Equal(t, 10, first.value)
+
+	// the settings already changed are restored when one fails
+	errs = SetRuntimeSettings(map[string]interface{}{"first": 100, "second": -1})
+	assert.Len(t, errs, 1)
+	assert.EqualError(t, errs["second"], "invalid value -1")
+	assert.Equal(t, 10, first.value)
+	assert.Equal(t, 20, second.value)
+}
+
+func TestResetRuntimeSetting(t *testing.T) {
+	cleanRuntimeSetting()
+	first := &runtimeTestNamedSetting{name: "first", value: 1, invalid: -1}
+	second := &runtimeTestNamedSetting{name: "second", value: 2, invalid: -1}
+	assert.Nil(t, RegisterRuntimeSetting(first))
+	assert.Nil(t, RegisterRuntimeSetting(second))
+
+	assert.Nil(t, SetRuntimeSetting("first", 10))
+	assert.Nil(t, SetRuntimeSetting("first", 100))
+	assert.Nil(t, SetRuntimeSettings(map[string]interface{}{"second": 20}))
+
+	// the value before the first change is restored
+	v, err := ResetRuntimeSetting("first")
+	assert.Nil(t, err)
+	assert.Equal(t, 1, v)
+	assert.Equal(t, 1, first.value)
+
+	v, err = ResetRuntimeSetting("second")
+	assert.Nil(t, err)
+	assert.Equal(t, 2, v)
+
+	// a setting not changed at runtime is left untouched
+	second.value = 3
+	v, err = ResetRuntimeSetting("second")
+	assert.Nil(t, err)
+	assert.Equal(t, 3, v)
+
+	_, err = ResetRuntimeSetting("unknown")
+	assert.IsType(t, &SettingNotFoundError{}, err)
+}
+
+func TestGetRuntimeSettingDetails(t *testing.T) {
+	cleanRuntimeSetting()
+	runtimeSetting := runtimeTestSetting{1}
+	assert.Nil(t, RegisterRuntimeSetting(&runtimeSetting))
+
+	details, err := GetRuntimeSettingDetails("name")
+	assert.Nil(t, err)
+	assert.Equal(t, RuntimeSettingDetails{Description: "desc", Type: "int", Value: 1, Default: 1}, details)
+
+	assert.Nil(t, SetRuntimeSetting("name", 2))
+	details, err = GetRuntimeSettingDetails("name")
+	assert.Nil(t, err)
+	assert.Equal(t, 2, details.Value)
+	assert.Equal(t, 1, details.Default)
+
+	_, err = GetRuntimeSettingDetails("unknown")
+	assert.IsType(t, &SettingNotFoundError{}, err)
+}
+
+func TestChangeListener(t *testing.T) {
+	cleanRuntimeSetting()
+	first := &runtimeTestNamedSetting{name: "first", value: 1, invalid: -1}
+	assert.Nil(t, RegisterRuntimeSetting(first))
+
+	var changes []interface{}
+	AddChangeListener(func(setting string, value interface{}) {
+		if setting == "first" {
+			changes = append(changes, value)
+		}
+	})
+
+	assert.Nil(t, SetRuntimeSetting("first", 10))
+	assert.NotNil(t, SetRuntimeSetting("first", -1))
+	assert.Nil(t, SetRuntimeSettings(map[string]interface{}{"first": 20}))
+	_, err := ResetRuntimeSetting("first")
+	assert.Nil(t, err)
+	assert.Equal(t, []interface{}{10, 20, 1}, changes)
+}
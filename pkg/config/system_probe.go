@@ -1,7 +1,10 @@
 package config
 
 import (
+	"encoding/json"
 	"strings"
+
+	"github.com/DataDog/datadog-agent/pkg/util/log"
 )
 
 const (
@@ -17,6 +20,8 @@ const (
 	defaultRuntimeCompilerOutputDir = "/var/tmp/datadog-agent/system-probe/build"
 
 	defaultOffsetThreshold = 400
+
+	defaultHTTPBufferSize = 25
 )
 
 func isSystemProbeConfigInit(cfg Config) bool {
@@ -45,6 +50,12 @@ func InitSystemProbeConfig(cfg Config) {
 	cfg.BindEnvAndSetDefault(join(spNS, "log_level"), "info", "DD_LOG_LEVEL", "LOG_LEVEL")
 	cfg.BindEnvAndSetDefault(join(spNS, "debug_port"), 0)
 
+	// the config API refuses the changes of the runtime settings when read-only
+	cfg.BindEnvAndSetDefault(join(spNS, "config_api_read_only"), false, "DD_SYSTEM_PROBE_CONFIG_API_READ_ONLY")
+	// rate limit of the requests changing the runtime settings through the config API, 0 disables it
+	cfg.BindEnvAndSetDefault(join(spNS, "config_api.mutations_per_second"), 10.0, "DD_SYSTEM_PROBE_CONFIG_API_MUTATIONS_PER_SECOND")
+	cfg.BindEnvAndSetDefault(join(spNS, "config_api.mutations_burst"), 20, "DD_SYSTEM_PROBE_CONFIG_API_MUTATIONS_BURST")
+
 	cfg.BindEnvAndSetDefault(join(spNS, "dogstatsd_host"), "127.0.0.1")
 	cfg.BindEnvAndSetDefault(join(spNS, "dogstatsd_port"), 8125)
 
@@ -95,6 +106,25 @@ func InitSystemProbeConfig(cfg Config) {
 
 	// network_config namespace only
 	cfg.BindEnvAndSetDefault(join(netNS, "enable_http_monitoring"), false, "DD_SYSTEM_PROBE_NETWORK_ENABLE_HTTP_MONITORING")
+	cfg.BindEnvAndSetDefault(join(netNS, "enable_https_monitoring"), false, "DD_SYSTEM_PROBE_NETWORK_ENABLE_HTTPS_MONITORING")
+	cfg.BindEnvAndSetDefault(join(netNS, "libssl_path"), "", "DD_SYSTEM_PROBE_NETWORK_LIBSSL_PATH")
+	cfg.BindEnvAndSetDefault(join(netNS, "http_buffer_size"), defaultHTTPBufferSize, "DD_SYSTEM_PROBE_NETWORK_HTTP_BUFFER_SIZE")
+	cfg.BindEnvAndSetDefault(join(netNS, "http_flush_interval_in_s"), 30, "DD_SYSTEM_PROBE_NETWORK_HTTP_FLUSH_INTERVAL_IN_S")
+	cfg.BindEnvAndSetDefault(join(netNS, "http_batch_compression"), "", "DD_SYSTEM_PROBE_NETWORK_HTTP_BATCH_COMPRESSION")
+	cfg.BindEnvAndSetDefault(join(netNS, "http_direction"), "", "DD_SYSTEM_PROBE_NETWORK_HTTP_DIRECTION")
+	cfg.BindEnvAndSetDefault(join(netNS, "http_max_tracked_connections"), 0, "DD_SYSTEM_PROBE_NETWORK_HTTP_MAX_TRACKED_CONNECTIONS")
+	cfg.BindEnvAndSetDefault(join(netNS, "http_captured_headers"), []string{}, "DD_SYSTEM_PROBE_NETWORK_HTTP_CAPTURED_HEADERS")
+	cfg.BindEnvAndSetDefault(join(netNS, "http_allowed_ports"), []string{}, "DD_SYSTEM_PROBE_NETWORK_HTTP_ALLOWED_PORTS")
+	cfg.BindEnvAndSetDefault(join(netNS, "http_denied_ports"), []string{}, "DD_SYSTEM_PROBE_NETWORK_HTTP_DENIED_PORTS")
+	cfg.SetKnown(join(netNS, "http_replace_rules"))
+	_ = cfg.BindEnv(join(netNS, "http_replace_rules"), "DD_SYSTEM_PROBE_NETWORK_HTTP_REPLACE_RULES")
+	cfg.SetEnvKeyTransformer(join(netNS, "http_replace_rules"), func(in string) interface{} {
+		var out []map[string]string
+		if err := json.Unmarshal([]byte(in), &out); err != nil {
+			log.Warnf(`%q can not be parsed: %v`, join(netNS, "http_replace_rules"), err)
+		}
+		return out
+	})
 	cfg.BindEnvAndSetDefault(join(netNS, "enable_gateway_lookup"), false, "DD_SYSTEM_PROBE_NETWORK_ENABLE_GATEWAY_LOOKUP")
 
 	// windows config
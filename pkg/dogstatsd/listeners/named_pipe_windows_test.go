@@ -123,7 +123,7 @@ type namedPipeListenerTest struct {
 
 func newNamedPipeListenerTest(t *testing.T) namedPipeListenerTest {
 	pool := packets.NewPool(maxPipeMessageCount)
-	poolManager := packets.NewPoolManager(pool)
+	poolManager := packets.NewPoolManager(pool, 2)
 	packetOut := make(chan packets.Packets, maxPipeMessageCount)
 	packetManager := packets.NewPacketManager(10, maxPipeMessageCount, 10*time.Millisecond, packetOut, poolManager)
 
@@ -22,7 +22,7 @@ import (
 
 var (
 	packetPoolUDP        = packets.NewPool(config.Datadog.GetInt("dogstatsd_buffer_size"))
-	packetPoolManagerUDP = packets.NewPoolManager(packetPoolUDP)
+	packetPoolManagerUDP = packets.NewPoolManager(packetPoolUDP, 2)
 )
 
 func TestNewUDPListener(t *testing.T) {
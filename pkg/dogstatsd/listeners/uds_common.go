@@ -115,13 +115,16 @@ func NewUDSListener(packetOut chan packets.Packets, sharedPacketPoolManager *pac
 	// Init the oob buffer pool if origin detection is enabled
 	if originDetection {
 
+		// the pool hands out pointers so that the listener and the traffic capture
+		// put the same object, see PoolManager
 		pool := &sync.Pool{
 			New: func() interface{} {
-				return make([]byte, getUDSAncillarySize())
+				oob := make([]byte, getUDSAncillarySize())
+				return &oob
 			},
 		}
 
-		listener.oobPoolManager = packets.NewPoolManager(pool)
+		listener.oobPoolManager = packets.NewPoolManager(pool, 2)
 		if listener.trafficCapture != nil {
 			err = listener.trafficCapture.Writer.RegisterOOBPoolManager(listener.oobPoolManager)
 			if err != nil {
@@ -156,7 +159,8 @@ func (l *UDSListener) Listen() {
 
 		if l.OriginDetection {
 			// Read datagram + credentials in ancilary data
-			oob := l.oobPoolManager.Get().([]byte)
+			oobBuf := l.oobPoolManager.Get().(*[]byte)
+			oob := *oobBuf
 			var oobn int
 
 			t2 = time.Now()
@@ -170,7 +174,13 @@ func (l *UDSListener) Listen() {
 			container, taggingErr := processUDSOrigin(oob[:oobn])
 
 			if capBuff != nil {
-				capBuff.Oob = &oob
+				if err != nil {
+					// nothing was read, the buffers are still put by the capture
+					n, oobn = 0, 0
+				}
+				capBuff.Pb.Timestamp = time.Now().Unix()
+				capBuff.Buff = packet
+				capBuff.Oob = oobBuf
 				capBuff.Pb.AncillarySize = int32(oobn)
 				capBuff.Pb.Ancillary = oob[:oobn] // or oob[:oobn] ?
 				capBuff.Pb.PayloadSize = int32(n)
@@ -185,7 +195,7 @@ func (l *UDSListener) Listen() {
 				packet.Origin = container
 			}
 			// Return the buffer back to the pool for reuse
-			l.oobPoolManager.Put(oob)
+			l.oobPoolManager.Put(oobBuf)
 		} else {
 			t2 = time.Now()
 			tlmListener.Observe(float64(t2.Sub(t1).Nanoseconds()), "uds")
@@ -25,7 +25,7 @@ import (
 
 var (
 	packetPoolUDS        = packets.NewPool(config.Datadog.GetInt("dogstatsd_buffer_size"))
-	packetPoolManagerUDS = packets.NewPoolManager(packetPoolUDS)
+	packetPoolManagerUDS = packets.NewPoolManager(packetPoolUDS, 2)
 )
 
 func testFileExistsNewUDSListener(t *testing.T, socketPath string) {
@@ -13,14 +13,20 @@ package listeners
 
 import (
 	"io/ioutil"
+	"net"
 	"os"
 	"path/filepath"
+	"strconv"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 
 	"github.com/DataDog/datadog-agent/pkg/config"
 	"github.com/DataDog/datadog-agent/pkg/dogstatsd/packets"
+	"github.com/DataDog/datadog-agent/pkg/dogstatsd/replay"
+	"github.com/DataDog/datadog-agent/pkg/util/cache"
 	"golang.org/x/sys/unix"
 )
 
@@ -35,7 +41,7 @@ func TestUDSPassCred(t *testing.T) {
 	mockConfig.Set("dogstatsd_origin_detection", true)
 
 	pool := packets.NewPool(512)
-	poolManager := packets.NewPoolManager(pool)
+	poolManager := packets.NewPoolManager(pool, 2)
 	s, err := NewUDSListener(nil, poolManager, nil)
 	defer s.Stop()
 
@@ -51,3 +57,62 @@ func TestUDSPassCred(t *testing.T) {
 	assert.Nil(t, err)
 	assert.Equal(t, enabled, 1)
 }
+
+func TestUDSOriginDetectionCapture(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dd-test-")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir) // clean up
+	socketPath := filepath.Join(dir, "dsd.socket")
+
+	mockConfig := config.Mock()
+	mockConfig.Set("dogstatsd_socket", socketPath)
+	mockConfig.Set("dogstatsd_origin_detection", true)
+	mockConfig.Set("dogstatsd_capture_path", dir)
+
+	// no container runtime is available to resolve the origin of the test process
+	key := cache.BuildAgentKey(pidToEntityCacheKeyPrefix, strconv.Itoa(os.Getpid()))
+	cache.Cache.Set(key, packets.NoOrigin, pidToEntityCacheDuration)
+	defer cache.Cache.Delete(key)
+
+	capture, err := replay.NewTrafficCapture()
+	require.Nil(t, err)
+
+	packetsChannel := make(chan packets.Packets, 10)
+	poolManager := packets.NewPoolManager(packets.NewPool(512), 2)
+	s, err := NewUDSListener(packetsChannel, poolManager, capture)
+	require.Nil(t, err)
+	defer s.Stop()
+
+	require.Nil(t, capture.Start(time.Minute))
+	require.Eventually(t, capture.IsOngoing, time.Second, 10*time.Millisecond)
+	defer capture.Stop()
+	go s.Listen()
+
+	conn, err := net.Dial("unixgram", socketPath)
+	require.Nil(t, err)
+	defer conn.Close()
+	for i := 0; i < 3; i++ {
+		_, err = conn.Write([]byte("daemon:666|g|#sometag1:somevalue1"))
+		require.Nil(t, err)
+	}
+
+	// the server is the other reference holder of the packets
+	for received := 0; received < 3; {
+		select {
+		case ps := <-packetsChannel:
+			for _, packet := range ps {
+				poolManager.Put(packet)
+				received++
+			}
+		case <-time.After(2 * time.Second):
+			require.FailNow(t, "Timeout on receive channel")
+		}
+	}
+
+	// the packets and their oob buffers are returned once put by both the listener and the capture
+	assert.Eventually(t, func() bool {
+		return poolManager.Count() == 0 && s.oobPoolManager.Count() == 0 &&
+			s.oobPoolManager.Stats().Returned == 3
+	}, 2*time.Second, 10*time.Millisecond)
+	assert.Equal(t, int64(3), poolManager.Stats().Returned)
+}
@@ -15,7 +15,7 @@ func buildPacketAssembler() (*Assembler, chan Packets) {
 	out := make(chan Packets, 16)
 	psb := NewBuffer(1, 1*time.Hour, out)
 	pp := NewPool(sampleBatchSize)
-	pb := NewAssembler(100*time.Millisecond, psb, NewPoolManager(pp), UDP)
+	pb := NewAssembler(100*time.Millisecond, psb, NewPoolManager(pp, 2), UDP)
 	return pb, out
 }
 
@@ -6,8 +6,14 @@
 package packets
 
 import (
+	"container/list"
+	"context"
+	"fmt"
 	"sync"
 	"sync/atomic"
+	"time"
+
+	"github.com/DataDog/datadog-agent/pkg/util/log"
 )
 
 type genericPool interface {
@@ -15,56 +21,271 @@ type genericPool interface {
 	Put(x interface{})
 }
 
+// PoolManagerStats holds the counters of a PoolManager, pending objects are the ones
+// put by some but not all of their reference holders.
+type PoolManagerStats struct {
+	// Gets is the number of objects retrieved from the pool
+	Gets int64
+	// Puts is the number of Put calls, including the ones accounted while waiting for other reference holders
+	Puts int64
+	// Returned is the number of objects actually returned to the pool
+	Returned int64
+	// PassthruTransitions is the number of times the passthru mode was enabled or disabled
+	PassthruTransitions int64
+	// Evicted is the number of objects that stopped being accounted because the tracking cap was reached
+	Evicted int64
+	// LatePuts is the number of Put calls of objects already evicted
+	LatePuts int64
+	// Pending is the number of objects currently accounted
+	Pending int64
+}
+
+// PoolRefInfo describes an object accounted by a PoolManager, e.g. to find out which objects are leaking.
+type PoolRefInfo struct {
+	// Type is the Go type of the object
+	Type string
+	// Age is how long ago the first reference holder put the object
+	Age time.Duration
+	// Count is the number of reference holders that put the object
+	Count int
+}
+
+// poolRef accounts the reference holders that put an object.
+type poolRef struct {
+	// the object returned to the pool
+	obj   interface{}
+	count int32
+	// when the first reference holder put the object
+	added time.Time
+	// set when the first reference holder returned the object in the automatic passthru
+	// mode, the other ones are only accounted so that it isn't returned again
+	returned bool
+
+	// position in the tracking order, guarded by the PoolManager orderLock
+	elem *list.Element
+	done bool
+}
+
 // PoolManager helps manage sync pools so multiple references to the same pool objects may be held.
+// Objects are tracked by identity, so all the reference holders must put the very value handed out
+// by the pool. Pools should hold pointers (e.g. *[]byte rather than []byte, like the UDS oob buffers
+// pool) so that distinct objects sharing a backing array are accounted independently. Byte slices
+// are still tracked by their data pointer and length, see byteSliceKey.
 type PoolManager struct {
+	// telemetry, kept first for the 64-bit alignment required by atomic operations
+	gets                int64
+	puts                int64
+	returned            int64
+	passthruTransitions int64
+	evicted             int64
+	latePuts            int64
+	// number of accounted objects
+	pending int64
+
 	pool genericPool
 	refs sync.Map
+	// number of reference holders putting each object
+	n int32
+
+	// maximum number of accounted objects, 0 means unlimited
+	maxTracked int
+	// accounted objects, oldest first, only maintained when maxTracked is set
+	order     *list.List
+	orderLock sync.Mutex
+	// evicted objects still waiting for some of their reference holders, oldest first, so that
+	// their late Puts aren't accounted as new objects. Guarded by orderLock, at most maxTracked.
+	tombstones     map[interface{}]*poolRef
+	tombstoneOrder *list.List
+
+	// the passthru mode is automatically enabled once highWater objects are accounted, and disabled
+	// again once no more than lowWater objects are accounted. A zero highWater disables it.
+	highWater int64
+	lowWater  int64
+	// set while the passthru mode was automatically enabled
+	autoPassthru int32
+
+	// now returns the current time, mocked in tests
+	now func() time.Time
+
+	// OnReturn, when set, is called with every object right before it's returned to the
+	// underlying pool, e.g. to scrub its content. It's called without holding the PoolManager
+	// locks and must be set before the PoolManager is used.
+	OnReturn func(x interface{})
 
 	passthru int32
 
 	sync.RWMutex
 }
 
-// NewPoolManager creates a PoolManager to manage the underlying genericPool.
-func NewPoolManager(gp genericPool) *PoolManager {
-	return &PoolManager{
-		pool:     gp,
-		passthru: int32(1),
+// PoolManagerOption configures a PoolManager created by NewPoolManager.
+type PoolManagerOption func(p *PoolManager)
+
+// WithMaxTracked caps the number of objects accounted at once to maxTracked: past that the oldest
+// accounted object is evicted. A zero maxTracked, the default, means unlimited.
+func WithMaxTracked(maxTracked int) PoolManagerOption {
+	return func(p *PoolManager) {
+		p.maxTracked = maxTracked
 	}
 }
 
+// WithWatermarks enables the passthru mode once highWater objects are accounted, e.g. because a
+// consumer is stalled, and disables it once they are down to lowWater, which must be lower.
+// The objects accounted meanwhile keep waiting for their reference holders while the other ones are
+// returned as soon as put by their first reference holder, trading the references guarantee for a
+// bounded memory usage.
+// A zero highWater, the default, disables it.
+func WithWatermarks(highWater int, lowWater int) PoolManagerOption {
+	return func(p *PoolManager) {
+		p.highWater = int64(highWater)
+		p.lowWater = int64(lowWater)
+	}
+}
+
+// NewPoolManager creates a PoolManager to manage the underlying genericPool, whose objects
+// are each held by n references when not in passthru mode.
+func NewPoolManager(gp genericPool, n int, opts ...PoolManagerOption) *PoolManager {
+	p := &PoolManager{
+		pool:  gp,
+		n:     int32(n),
+		order: list.New(),
+		// tombstones are only kept when maxTracked is set
+		tombstones:     make(map[interface{}]*poolRef),
+		tombstoneOrder: list.New(),
+		now:            time.Now,
+		passthru:       int32(1),
+	}
+	for _, opt := range opts {
+		opt(p)
+	}
+	return p
+}
+
 // Get gets an object from the pool.
 func (p *PoolManager) Get() interface{} {
+	atomic.AddInt64(&p.gets, 1)
 	return p.pool.Get()
 }
 
 // Put declares intent to return an object to the pool. In passthru mode the object is immediately
-// returned to the pool, otherwise we wait until the object is put by all (only 2 currently supported)
-// reference holders before actually returning it to the object pool.
+// returned to the pool, otherwise we wait until the object is put by all the n reference holders
+// before actually returning it to the object pool.
 func (p *PoolManager) Put(x interface{}) {
+	atomic.AddInt64(&p.puts, 1)
 
-	if p.IsPassthru() {
-		p.pool.Put(x)
+	passthru := p.IsPassthru()
+	if p.n <= 1 || (passthru && atomic.LoadInt32(&p.autoPassthru) == 0) {
+		p.returnToPool(x)
 		return
 	}
 
 	// This lock is not to guard the map, it's here to
-	// avoid adding items to the map while flushing.
+	// avoid adding items to the map while flushing:
+	// the map operations alone can't prevent an object
+	// accounted during a Flush from being returned twice.
 	p.RLock()
+	reclaimed := p.account(x, !passthru)
+	// relatively hot path so not deferred
+	p.RUnlock()
 
-	// TODO: use LoadAndDelete when go 1.15 is introduced
-	_, loaded := p.refs.Load(x)
-	if loaded {
-		// reference exists, put back.
-		p.refs.Delete(x)
-		p.pool.Put(x)
-	} else {
-		// reference does not exist, account.
-		p.refs.Store(x, struct{}{})
+	if reclaimed {
+		p.returnToPool(x)
 	}
+	p.checkWatermarks()
+}
 
-	// relatively hot path so not deferred
+// PutAll puts a batch of objects, it's equivalent to calling Put on each of them but only
+// takes the lock once.
+func (p *PoolManager) PutAll(objs []interface{}) {
+	atomic.AddInt64(&p.puts, int64(len(objs)))
+
+	passthru := p.IsPassthru()
+	if p.n <= 1 || (passthru && atomic.LoadInt32(&p.autoPassthru) == 0) {
+		for _, x := range objs {
+			p.returnToPool(x)
+		}
+		return
+	}
+
+	var reclaimed []interface{}
+	p.RLock()
+	for _, x := range objs {
+		if p.account(x, !passthru) {
+			reclaimed = append(reclaimed, x)
+		}
+	}
 	p.RUnlock()
+
+	for _, x := range reclaimed {
+		p.returnToPool(x)
+	}
+	p.checkWatermarks()
+}
+
+// byteSliceKey identifies a byte slice in the accounting, slices can't be map keys.
+// The same buffer matches whatever the slice header it's put with, while slices of
+// different lengths sharing a backing array are accounted independently.
+type byteSliceKey struct {
+	data *byte
+	len  int
+}
+
+// refKey returns the key accounting x
+func refKey(x interface{}) interface{} {
+	if b, ok := x.([]byte); ok {
+		key := byteSliceKey{len: len(b)}
+		if cap(b) > 0 {
+			key.data = &b[:cap(b)][0]
+		}
+		return key
+	}
+	return x
+}
+
+// account accounts a reference holder putting x, and returns true if x must be returned to the
+// pool, i.e. it was the last one. When add is false, i.e. in the automatic passthru mode, the first
+// reference holder putting an object not accounted yet returns it right away, the other ones are
+// still accounted until the n-th so that it isn't returned again.
+// The read lock must be held.
+func (p *PoolManager) account(x interface{}, add bool) bool {
+	key := refKey(x)
+	// the counter is only allocated by the first reference holder
+	v, loaded := p.refs.Load(key)
+	created := false
+	if !loaded {
+		if p.maxTracked > 0 {
+			if reclaimed, late := p.latePut(key); late {
+				return reclaimed
+			}
+		}
+		v, loaded = p.refs.LoadOrStore(key, &poolRef{obj: x, added: p.now(), returned: !add})
+		if !loaded {
+			created = true
+			// returned objects aren't pending
+			if add {
+				atomic.AddInt64(&p.pending, 1)
+			}
+			if p.maxTracked > 0 {
+				p.track(key, v.(*poolRef))
+			}
+		}
+	}
+	ref := v.(*poolRef)
+	if atomic.AddInt32(&ref.count, 1) != p.n {
+		return created && ref.returned
+	}
+
+	// last reference, put back.
+	if _, loaded := p.refs.LoadAndDelete(key); !loaded {
+		// the object was evicted or flushed meanwhile
+		return p.maxTracked > 0 && p.removeTombstone(key, ref) && !ref.returned
+	}
+	if !ref.returned {
+		atomic.AddInt64(&p.pending, -1)
+	}
+	if p.maxTracked > 0 {
+		p.untrack(ref)
+	}
+	return !ref.returned
 }
 
 // IsPassthru returns a boolean telling us if the PoolManager is in passthru mode or not.
@@ -72,40 +293,273 @@ func (p *PoolManager) IsPassthru() bool {
 	return atomic.LoadInt32(&(p.passthru)) != 0
 }
 
+// checkWatermarks enables or disables the automatic passthru mode according to the number of accounted objects.
+func (p *PoolManager) checkWatermarks() {
+	if p.highWater <= 0 {
+		return
+	}
+
+	pending := atomic.LoadInt64(&p.pending)
+	if pending >= p.highWater && atomic.CompareAndSwapInt32(&p.passthru, 0, 1) {
+		atomic.StoreInt32(&p.autoPassthru, 1)
+		atomic.AddInt64(&p.passthruTransitions, 1)
+		log.Warnf("%d pool objects are waiting for their reference holders, enabling passthru mode until they are down to %d", pending, p.lowWater)
+	} else if pending <= p.lowWater && atomic.CompareAndSwapInt32(&p.autoPassthru, 1, 0) {
+		atomic.StoreInt32(&p.passthru, 0)
+		atomic.AddInt64(&p.passthruTransitions, 1)
+		log.Infof("%d pool objects are waiting for their reference holders, disabling passthru mode", pending)
+	}
+}
+
 // SetPassthru sets the passthru mode to the specified value. It will flush the sccounting before
 // enabling passthru mode.
 func (p *PoolManager) SetPassthru(b bool) {
+	// the passthru mode is now set explicitly
+	atomic.StoreInt32(&p.autoPassthru, 0)
 	if b {
-		atomic.StoreInt32(&(p.passthru), 1)
+		if atomic.SwapInt32(&(p.passthru), 1) == 0 {
+			atomic.AddInt64(&p.passthruTransitions, 1)
+		}
 		p.Flush()
-	} else {
-		atomic.StoreInt32(&(p.passthru), 0)
+	} else if atomic.SwapInt32(&(p.passthru), 0) != 0 {
+		atomic.AddInt64(&p.passthruTransitions, 1)
 	}
 }
 
-// Count returns the number of elements accounted by the PoolManager.
+// Count returns the number of elements accounted by the PoolManager, i.e. put by some but not all
+// of their reference holders.
 func (p *PoolManager) Count() int {
 	p.RLock()
 	defer p.RUnlock()
 
 	size := 0
 	p.refs.Range(func(k, v interface{}) bool {
-		size++
+		if !v.(*poolRef).returned {
+			size++
+		}
 		return true
 	})
 
 	return size
 }
 
+// PendingSnapshot returns the objects accounted by the PoolManager, i.e. put by some but not all
+// of their reference holders. The Puts are blocked while it's taken so that the snapshot is consistent.
+func (p *PoolManager) PendingSnapshot() []PoolRefInfo {
+	p.Lock()
+	defer p.Unlock()
+
+	now := p.now()
+	var snapshot []PoolRefInfo
+	p.refs.Range(func(k, v interface{}) bool {
+		ref := v.(*poolRef)
+		if ref.returned {
+			return true
+		}
+		snapshot = append(snapshot, PoolRefInfo{
+			Type:  fmt.Sprintf("%T", ref.obj),
+			Age:   now.Sub(ref.added),
+			Count: int(atomic.LoadInt32(&ref.count)),
+		})
+		return true
+	})
+
+	return snapshot
+}
+
+// StaleRefs returns the number of accounted objects first put more than olderThan ago
+// and still waiting for some of their reference holders, e.g. because of a stuck consumer.
+func (p *PoolManager) StaleRefs(olderThan time.Duration) int {
+	p.RLock()
+	defer p.RUnlock()
+
+	now := p.now()
+	stale := 0
+	p.refs.Range(func(k, v interface{}) bool {
+		if ref := v.(*poolRef); !ref.returned && now.Sub(ref.added) > olderThan {
+			stale++
+		}
+		return true
+	})
+
+	return stale
+}
+
+// LogStaleRefs logs a warning when some accounted objects are older than olderThan,
+// and returns their number.
+func (p *PoolManager) LogStaleRefs(olderThan time.Duration) int {
+	stale := p.StaleRefs(olderThan)
+	if stale > 0 {
+		log.Warnf("%d pool objects have been waiting for more than %s for their reference holders, a consumer may be stuck", stale, olderThan)
+	}
+	return stale
+}
+
+// flushCheckInterval is the number of objects flushed between two checks of the FlushContext cancellation
+const flushCheckInterval = 64
+
 // Flush flushes all objects back to the object pool, and stops tracking any pending objects.
 func (p *PoolManager) Flush() {
+	p.FlushContext(context.Background())
+}
+
+// FlushContext flushes the objects back to the object pool like Flush, but stops early when ctx is
+// done, e.g. not to block the Puts for too long on shutdown. The objects that weren't flushed are
+// still accounted. It returns the number of flushed objects.
+func (p *PoolManager) FlushContext(ctx context.Context) int {
 	p.Lock()
-	defer p.Unlock()
 
+	var flushed []interface{}
+	i := 0
 	p.refs.Range(func(k, v interface{}) bool {
-		p.pool.Put(k)
-		p.refs.Delete(k)
+		if i%flushCheckInterval == 0 && ctx.Err() != nil {
+			return false
+		}
+		i++
+
+		if _, loaded := p.refs.LoadAndDelete(k); loaded {
+			ref := v.(*poolRef)
+			if p.maxTracked > 0 {
+				p.untrack(ref)
+			}
+			// already returned in the automatic passthru mode
+			if !ref.returned {
+				atomic.AddInt64(&p.pending, -1)
+				flushed = append(flushed, ref.obj)
+			}
+		}
 		return true
 	})
+	if ctx.Err() == nil {
+		// the evicted objects aren't tracked anymore either
+		p.clearTombstones()
+	}
+
+	p.Unlock()
+
+	// returned without holding the lock, OnReturn may use the PoolManager
+	for _, x := range flushed {
+		p.returnToPool(x)
+	}
+	return len(flushed)
+}
+
+// Stats returns the counters of the PoolManager, e.g. to detect objects that are never
+// put by all their reference holders.
+func (p *PoolManager) Stats() PoolManagerStats {
+	return PoolManagerStats{
+		Gets:                atomic.LoadInt64(&p.gets),
+		Puts:                atomic.LoadInt64(&p.puts),
+		Returned:            atomic.LoadInt64(&p.returned),
+		PassthruTransitions: atomic.LoadInt64(&p.passthruTransitions),
+		Evicted:             atomic.LoadInt64(&p.evicted),
+		LatePuts:            atomic.LoadInt64(&p.latePuts),
+		Pending:             int64(p.Count()),
+	}
+}
 
+func (p *PoolManager) returnToPool(x interface{}) {
+	atomic.AddInt64(&p.returned, 1)
+	if p.OnReturn != nil {
+		p.OnReturn(x)
+	}
+	p.pool.Put(x)
+}
+
+// track appends a newly accounted object to the tracking order and evicts the oldest
+// accounted objects past maxTracked. Evicted objects aren't returned to the pool: their
+// remaining reference holders may still be using them. They're kept as tombstones instead,
+// and returned once put by all their reference holders unless the tombstone is dropped first.
+func (p *PoolManager) track(key interface{}, ref *poolRef) {
+	p.orderLock.Lock()
+	defer p.orderLock.Unlock()
+
+	// the last reference holder put the object in the meantime
+	if ref.done {
+		return
+	}
+	ref.elem = p.order.PushBack(key)
+
+	for p.order.Len() > p.maxTracked {
+		oldest := p.order.Front()
+		p.order.Remove(oldest)
+		if v, loaded := p.refs.LoadAndDelete(oldest.Value); loaded {
+			ref := v.(*poolRef)
+			p.addTombstone(oldest.Value, ref)
+			if !ref.returned {
+				atomic.AddInt64(&p.pending, -1)
+			}
+			atomic.AddInt64(&p.evicted, 1)
+		}
+	}
+}
+
+// addTombstone keeps an evicted object, dropping the oldest tombstones past maxTracked.
+// The orderLock must be held.
+func (p *PoolManager) addTombstone(key interface{}, ref *poolRef) {
+	ref.elem = p.tombstoneOrder.PushBack(key)
+	p.tombstones[key] = ref
+
+	for p.tombstoneOrder.Len() > p.maxTracked {
+		oldest := p.tombstoneOrder.Front()
+		p.tombstoneOrder.Remove(oldest)
+		p.tombstones[oldest.Value].elem = nil
+		delete(p.tombstones, oldest.Value)
+	}
+}
+
+// latePut accounts a reference holder putting an evicted object. It returns false if the object
+// isn't evicted, and whether it was the last reference holder and the object must be returned.
+func (p *PoolManager) latePut(key interface{}) (reclaimed bool, late bool) {
+	p.orderLock.Lock()
+	defer p.orderLock.Unlock()
+
+	ref, ok := p.tombstones[key]
+	if !ok {
+		return false, false
+	}
+	atomic.AddInt64(&p.latePuts, 1)
+	if atomic.AddInt32(&ref.count, 1) != p.n {
+		return false, true
+	}
+	p.tombstoneOrder.Remove(ref.elem)
+	ref.elem = nil
+	delete(p.tombstones, key)
+	return !ref.returned, true
+}
+
+// removeTombstone removes the tombstone of an object put by its last reference holder, and returns
+// false if it was flushed or dropped meanwhile.
+func (p *PoolManager) removeTombstone(key interface{}, ref *poolRef) bool {
+	p.orderLock.Lock()
+	defer p.orderLock.Unlock()
+
+	if p.tombstones[key] != ref {
+		return false
+	}
+	p.tombstoneOrder.Remove(ref.elem)
+	ref.elem = nil
+	delete(p.tombstones, key)
+	return true
+}
+
+// clearTombstones stops tracking the evicted objects.
+func (p *PoolManager) clearTombstones() {
+	p.orderLock.Lock()
+	defer p.orderLock.Unlock()
+
+	p.tombstones = make(map[interface{}]*poolRef)
+	p.tombstoneOrder.Init()
+}
+
+// untrack removes an object put by all its reference holders from the tracking order.
+func (p *PoolManager) untrack(ref *poolRef) {
+	p.orderLock.Lock()
+	defer p.orderLock.Unlock()
+
+	ref.done = true
+	if ref.elem != nil {
+		p.order.Remove(ref.elem)
+		ref.elem = nil
+	}
 }
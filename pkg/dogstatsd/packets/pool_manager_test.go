@@ -1,9 +1,13 @@
 package packets
 
 import (
+	"context"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func countPoolSize(p *PoolManager) int {
@@ -21,7 +25,7 @@ func countPoolSize(p *PoolManager) int {
 func TestPoolManager(t *testing.T) {
 
 	pool := NewPool(1024)
-	manager := NewPoolManager(pool)
+	manager := NewPoolManager(pool, 2)
 
 	// passthru mode by default
 	assert.True(t, manager.IsPassthru())
@@ -49,3 +53,577 @@ func TestPoolManager(t *testing.T) {
 	assert.Equal(t, 0, countPoolSize(manager))
 
 }
+
+// countingPool counts the objects put back in the pool
+type countingPool struct {
+	genericPool
+	puts int
+}
+
+func (p *countingPool) Put(x interface{}) {
+	p.puts++
+	p.genericPool.Put(x)
+}
+
+func TestPoolManagerNReferences(t *testing.T) {
+
+	pool := &countingPool{genericPool: NewPool(1024)}
+	manager := NewPoolManager(pool, 3)
+	manager.SetPassthru(false)
+
+	packet := manager.Get()
+	manager.Put(packet)
+	manager.Put(packet)
+	// early puts don't return the buffer to the pool
+	assert.Equal(t, 0, pool.puts)
+	assert.Equal(t, 1, manager.Count())
+
+	// the third put does
+	manager.Put(packet)
+	assert.Equal(t, 1, pool.puts)
+	assert.Equal(t, 0, manager.Count())
+
+	// pending references are flushed
+	for i := 0; i < 10; i++ {
+		packet = manager.Get()
+		manager.Put(packet)
+		manager.Put(packet)
+	}
+	assert.Equal(t, 10, manager.Count())
+	assert.Equal(t, 1, pool.puts)
+	manager.Flush()
+	assert.Equal(t, 0, manager.Count())
+	assert.Equal(t, 11, pool.puts)
+}
+
+func TestPoolManagerSingleReference(t *testing.T) {
+
+	pool := &countingPool{genericPool: NewPool(1024)}
+	manager := NewPoolManager(pool, 1)
+	manager.SetPassthru(false)
+
+	packet := manager.Get()
+	manager.Put(packet)
+	assert.Equal(t, 1, pool.puts)
+	assert.Equal(t, 0, manager.Count())
+}
+
+func TestPoolManagerStats(t *testing.T) {
+
+	manager := NewPoolManager(NewPool(1024), 2)
+	assert.Equal(t, PoolManagerStats{}, manager.Stats())
+
+	// passthru mode by default
+	packet := manager.Get()
+	manager.Put(packet)
+	assert.Equal(t, PoolManagerStats{Gets: 1, Puts: 1, Returned: 1}, manager.Stats())
+
+	// setting the current mode isn't a transition
+	manager.SetPassthru(true)
+	assert.Equal(t, int64(0), manager.Stats().PassthruTransitions)
+
+	manager.SetPassthru(false)
+	packet = manager.Get()
+	manager.Put(packet)
+	assert.Equal(t, PoolManagerStats{Gets: 2, Puts: 2, Returned: 1, PassthruTransitions: 1, Pending: 1}, manager.Stats())
+	manager.Put(packet)
+	assert.Equal(t, PoolManagerStats{Gets: 2, Puts: 3, Returned: 2, PassthruTransitions: 1}, manager.Stats())
+
+	// objects put by a single reference holder are pending until flushed
+	for i := 0; i < 10; i++ {
+		manager.Put(manager.Get())
+	}
+	assert.Equal(t, PoolManagerStats{Gets: 12, Puts: 13, Returned: 2, PassthruTransitions: 1, Pending: 10}, manager.Stats())
+
+	// enabling passthru mode flushes the pending objects
+	manager.SetPassthru(true)
+	assert.Equal(t, PoolManagerStats{Gets: 12, Puts: 13, Returned: 12, PassthruTransitions: 2}, manager.Stats())
+}
+
+// returnsPool records how many times each object is returned to the pool
+type returnsPool struct {
+	sync.Mutex
+	returns map[interface{}]int
+}
+
+func (p *returnsPool) Get() interface{} {
+	return new([]byte)
+}
+
+func (p *returnsPool) Put(x interface{}) {
+	p.Lock()
+	defer p.Unlock()
+	p.returns[x]++
+}
+
+func TestPoolManagerConcurrentPuts(t *testing.T) {
+
+	const holders = 4
+	const objects = 1000
+
+	pool := &returnsPool{returns: make(map[interface{}]int)}
+	manager := NewPoolManager(pool, holders)
+	manager.SetPassthru(false)
+
+	packets := make([]interface{}, objects)
+	for i := range packets {
+		packets[i] = manager.Get()
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < holders; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for _, packet := range packets {
+				manager.Put(packet)
+			}
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, 0, manager.Count())
+	assert.Len(t, pool.returns, objects)
+	for _, packet := range packets {
+		assert.Equal(t, 1, pool.returns[packet])
+	}
+}
+
+func TestPoolManagerMaxTracked(t *testing.T) {
+
+	pool := &returnsPool{returns: make(map[interface{}]int)}
+	manager := NewPoolManager(pool, 2, WithMaxTracked(10))
+	manager.SetPassthru(false)
+
+	packets := make([]interface{}, 100)
+	for i := range packets {
+		packets[i] = manager.Get()
+		manager.Put(packets[i])
+		assert.LessOrEqual(t, manager.Count(), 10)
+	}
+	assert.Equal(t, 10, manager.Count())
+	assert.Equal(t, 10, manager.order.Len())
+
+	// the oldest objects are dropped, not returned to the pool
+	stats := manager.Stats()
+	assert.Equal(t, int64(90), stats.Evicted)
+	assert.Equal(t, int64(0), stats.Returned)
+
+	// the most recent objects are still accounted
+	for _, packet := range packets[90:] {
+		manager.Put(packet)
+	}
+	assert.Equal(t, 0, manager.Count())
+	assert.Equal(t, 0, manager.order.Len())
+	assert.Len(t, pool.returns, 10)
+	for _, packet := range packets[90:] {
+		assert.Equal(t, 1, pool.returns[packet])
+	}
+	assert.Equal(t, int64(90), manager.Stats().Evicted)
+}
+
+func TestPoolManagerLatePuts(t *testing.T) {
+
+	pool := &returnsPool{returns: make(map[interface{}]int)}
+	manager := NewPoolManager(pool, 3, WithMaxTracked(2))
+	manager.SetPassthru(false)
+
+	packets := make([]interface{}, 5)
+	for i := range packets {
+		packets[i] = manager.Get()
+		manager.Put(packets[i])
+	}
+	assert.Equal(t, int64(3), manager.Stats().Evicted)
+	assert.Equal(t, 2, manager.Count())
+
+	// the late Puts of evicted objects are counted rather than accounted as new objects,
+	// and the object is returned once put by all its reference holders
+	manager.Put(packets[2])
+	assert.Equal(t, 2, manager.Count())
+	assert.Empty(t, pool.returns)
+	manager.Put(packets[2])
+	assert.Equal(t, 2, manager.Count())
+	assert.Equal(t, map[interface{}]int{packets[2]: 1}, pool.returns)
+	assert.Equal(t, int64(2), manager.Stats().LatePuts)
+
+	// at most maxTracked tombstones are kept, the oldest evicted object isn't tracked anymore
+	manager.Put(packets[0])
+	assert.Equal(t, 2, manager.Count())
+	assert.Equal(t, int64(4), manager.Stats().Evicted)
+	assert.Equal(t, int64(2), manager.Stats().LatePuts)
+
+	// flushed tombstones aren't returned, and stop counting late Puts
+	manager.Flush()
+	assert.Equal(t, map[interface{}]int{packets[0]: 1, packets[2]: 1, packets[4]: 1}, pool.returns)
+	manager.Put(packets[3])
+	assert.Equal(t, 1, manager.Count())
+	assert.Equal(t, int64(2), manager.Stats().LatePuts)
+}
+
+func TestPoolManagerUnlimited(t *testing.T) {
+
+	pool := &returnsPool{returns: make(map[interface{}]int)}
+	manager := NewPoolManager(pool, 2)
+	manager.SetPassthru(false)
+
+	for i := 0; i < 100; i++ {
+		manager.Put(manager.Get())
+	}
+	assert.Equal(t, 100, manager.Count())
+	assert.Equal(t, int64(0), manager.Stats().Evicted)
+}
+
+func TestPoolManagerStaleRefs(t *testing.T) {
+
+	now := time.Now()
+	manager := NewPoolManager(&returnsPool{returns: make(map[interface{}]int)}, 2)
+	manager.now = func() time.Time { return now }
+	manager.SetPassthru(false)
+
+	for i := 0; i < 5; i++ {
+		manager.Put(manager.Get())
+	}
+	assert.Equal(t, 0, manager.StaleRefs(time.Minute))
+
+	now = now.Add(30 * time.Second)
+	packet := manager.Get()
+	manager.Put(packet)
+	for i := 0; i < 3; i++ {
+		manager.Put(manager.Get())
+	}
+	assert.Equal(t, 0, manager.StaleRefs(time.Minute))
+	assert.Equal(t, 5, manager.StaleRefs(10*time.Second))
+
+	now = now.Add(45 * time.Second)
+	assert.Equal(t, 5, manager.StaleRefs(time.Minute))
+	assert.Equal(t, 9, manager.LogStaleRefs(10*time.Second))
+
+	// objects put by all their reference holders aren't accounted anymore
+	manager.Put(packet)
+	assert.Equal(t, 8, manager.StaleRefs(10*time.Second))
+
+	manager.Flush()
+	assert.Equal(t, 0, manager.LogStaleRefs(0))
+}
+
+func TestPoolManagerSharedBackingArray(t *testing.T) {
+
+	pool := &returnsPool{returns: make(map[interface{}]int)}
+	manager := NewPoolManager(pool, 2)
+	manager.SetPassthru(false)
+
+	// two distinct buffers sharing the same backing array
+	backing := make([]byte, 1024)
+	first := &backing
+	second := new([]byte)
+	*second = backing[:512]
+
+	manager.Put(first)
+	manager.Put(second)
+	assert.Equal(t, 2, manager.Count())
+
+	manager.Put(first)
+	assert.Equal(t, 1, manager.Count())
+	assert.Equal(t, map[interface{}]int{first: 1}, pool.returns)
+
+	manager.Put(second)
+	assert.Equal(t, 0, manager.Count())
+	assert.Equal(t, map[interface{}]int{first: 1, second: 1}, pool.returns)
+}
+
+func TestPoolManagerOnReturn(t *testing.T) {
+
+	pool := &returnsPool{returns: make(map[interface{}]int)}
+	manager := NewPoolManager(pool, 2)
+	reclaimed := make(map[interface{}]int)
+	manager.OnReturn = func(x interface{}) {
+		reclaimed[x]++
+		// the callback may use the manager
+		manager.Count()
+	}
+
+	// passthru mode
+	packet := manager.Get()
+	manager.Put(packet)
+	assert.Equal(t, map[interface{}]int{packet: 1}, reclaimed)
+
+	// matched by all the reference holders
+	manager.SetPassthru(false)
+	matched := manager.Get()
+	manager.Put(matched)
+	assert.Equal(t, 0, reclaimed[matched])
+	manager.Put(matched)
+	assert.Equal(t, 1, reclaimed[matched])
+
+	// flushed
+	pending := make([]interface{}, 10)
+	for i := range pending {
+		pending[i] = manager.Get()
+		manager.Put(pending[i])
+	}
+	manager.SetPassthru(true)
+	assert.Len(t, reclaimed, 12)
+	for x, count := range reclaimed {
+		assert.Equal(t, 1, count)
+		assert.Equal(t, 1, pool.returns[x])
+	}
+}
+
+func TestPoolManagerPutAll(t *testing.T) {
+
+	objs := make([]interface{}, 20)
+	for i := range objs {
+		objs[i] = new([]byte)
+	}
+
+	putPool := &returnsPool{returns: make(map[interface{}]int)}
+	put := NewPoolManager(putPool, 2)
+	put.SetPassthru(false)
+	putAllPool := &returnsPool{returns: make(map[interface{}]int)}
+	putAll := NewPoolManager(putAllPool, 2)
+	putAll.SetPassthru(false)
+
+	// every object is put once, then the first half a second time
+	batches := [][]interface{}{objs, objs[:10]}
+	for _, batch := range batches {
+		for _, x := range batch {
+			put.Put(x)
+		}
+		putAll.PutAll(batch)
+
+		assert.Equal(t, put.Count(), putAll.Count())
+		assert.Equal(t, putPool.returns, putAllPool.returns)
+	}
+	assert.Equal(t, 10, putAll.Count())
+	assert.Len(t, putAllPool.returns, 10)
+	assert.Equal(t, put.Stats(), putAll.Stats())
+
+	// passthru mode
+	put.SetPassthru(true)
+	putAll.SetPassthru(true)
+	for _, x := range objs {
+		put.Put(x)
+	}
+	putAll.PutAll(objs)
+	assert.Equal(t, putPool.returns, putAllPool.returns)
+	assert.Equal(t, put.Stats(), putAll.Stats())
+}
+
+func TestPoolManagerWatermarks(t *testing.T) {
+
+	pool := &returnsPool{returns: make(map[interface{}]int)}
+	manager := NewPoolManager(pool, 2, WithWatermarks(10, 5))
+	manager.SetPassthru(false)
+
+	pending := make([]interface{}, 10)
+	for i := range pending[:9] {
+		pending[i] = manager.Get()
+		manager.Put(pending[i])
+	}
+	assert.False(t, manager.IsPassthru())
+
+	// crossing the high-water mark enables the passthru mode without flushing
+	pending[9] = manager.Get()
+	manager.Put(pending[9])
+	assert.True(t, manager.IsPassthru())
+	assert.Equal(t, 10, manager.Count())
+	assert.Equal(t, int64(2), manager.Stats().PassthruTransitions)
+
+	// new objects are returned right away, and only once
+	returned := manager.Stats().Returned
+	packet := manager.Get()
+	manager.Put(packet)
+	assert.Equal(t, 1, pool.returns[packet])
+	assert.Equal(t, returned+1, manager.Stats().Returned)
+	manager.Put(packet)
+	assert.Equal(t, 1, pool.returns[packet])
+	assert.Equal(t, returned+1, manager.Stats().Returned)
+	assert.Equal(t, 10, manager.Count())
+
+	// an object put by its other reference holder once the passthru mode is disabled
+	straddling := manager.Get()
+	manager.Put(straddling)
+	assert.Equal(t, 1, pool.returns[straddling])
+
+	// the accounted objects are still returned once all their reference holders put them
+	for _, x := range pending[:4] {
+		manager.Put(x)
+		assert.Equal(t, 1, pool.returns[x])
+	}
+	assert.Equal(t, 6, manager.Count())
+	assert.True(t, manager.IsPassthru())
+
+	// reaching the low-water mark disables the passthru mode
+	manager.Put(pending[4])
+	assert.Equal(t, 5, manager.Count())
+	assert.False(t, manager.IsPassthru())
+	assert.Equal(t, int64(3), manager.Stats().PassthruTransitions)
+
+	returned = manager.Stats().Returned
+	manager.Put(straddling)
+	assert.Equal(t, 1, pool.returns[straddling])
+	assert.Equal(t, returned, manager.Stats().Returned)
+
+	packet = manager.Get()
+	manager.Put(packet)
+	assert.Equal(t, 0, pool.returns[packet])
+	assert.Equal(t, 6, manager.Count())
+
+	for _, x := range append(pending[5:], packet) {
+		manager.Put(x)
+		assert.Equal(t, 1, pool.returns[x])
+	}
+	assert.Equal(t, 0, manager.Count())
+	assert.Equal(t, int64(0), manager.Stats().Pending)
+
+	// the objects returned in passthru mode aren't accounted anymore either
+	manager.refs.Range(func(k, v interface{}) bool {
+		t.Errorf("%v is still accounted", k)
+		return true
+	})
+}
+
+func TestPoolManagerWatermarksExplicitPassthru(t *testing.T) {
+
+	manager := NewPoolManager(&returnsPool{returns: make(map[interface{}]int)}, 2, WithWatermarks(2, 1))
+	manager.SetPassthru(false)
+	manager.Put(manager.Get())
+	manager.Put(manager.Get())
+	assert.True(t, manager.IsPassthru())
+
+	// an explicitly set passthru mode isn't disabled by the low-water mark
+	manager.SetPassthru(true)
+	assert.Equal(t, 0, manager.Count())
+	manager.Put(manager.Get())
+	assert.True(t, manager.IsPassthru())
+	assert.Equal(t, 0, manager.Count())
+}
+
+func TestPoolManagerPendingSnapshot(t *testing.T) {
+
+	now := time.Now()
+	manager := NewPoolManager(&returnsPool{returns: make(map[interface{}]int)}, 3)
+	manager.now = func() time.Time { return now }
+	manager.SetPassthru(false)
+	assert.Empty(t, manager.PendingSnapshot())
+
+	packet := &Packet{}
+	manager.Put(packet)
+	manager.Put(packet)
+	now = now.Add(10 * time.Second)
+	manager.Put(new([]byte))
+	now = now.Add(5 * time.Second)
+
+	assert.ElementsMatch(t, []PoolRefInfo{
+		{Type: "*packets.Packet", Age: 15 * time.Second, Count: 2},
+		{Type: "*[]uint8", Age: 5 * time.Second, Count: 1},
+	}, manager.PendingSnapshot())
+
+	// objects put by all their reference holders aren't accounted anymore
+	manager.Put(packet)
+	assert.Equal(t, []PoolRefInfo{{Type: "*[]uint8", Age: 5 * time.Second, Count: 1}}, manager.PendingSnapshot())
+}
+
+// byteSlicePool records the byte slices put back in the pool
+type byteSlicePool struct {
+	puts [][]byte
+}
+
+func (p *byteSlicePool) Get() interface{} {
+	return make([]byte, 64)
+}
+
+func (p *byteSlicePool) Put(x interface{}) {
+	p.puts = append(p.puts, x.([]byte))
+}
+
+func TestPoolManagerByteSlices(t *testing.T) {
+
+	pool := &byteSlicePool{}
+	manager := NewPoolManager(pool, 2)
+	manager.SetPassthru(false)
+
+	// the same buffer put by both reference holders, through distinct slice headers
+	buf := manager.Get().([]byte)
+	held := buf
+	manager.Put(buf)
+	assert.Equal(t, 1, manager.Count())
+	manager.Put(held)
+	assert.Equal(t, 0, manager.Count())
+	require.Len(t, pool.puts, 1)
+	assert.Equal(t, &buf[0], &pool.puts[0][0])
+
+	// distinct buffers are accounted independently
+	first := manager.Get().([]byte)
+	second := manager.Get().([]byte)
+	manager.Put(first)
+	manager.Put(second)
+	assert.Equal(t, 2, manager.Count())
+	manager.Put(first)
+	assert.Equal(t, 1, manager.Count())
+	require.Len(t, pool.puts, 2)
+	assert.Equal(t, &first[0], &pool.puts[1][0])
+	manager.Put(second)
+	assert.Equal(t, 0, manager.Count())
+	require.Len(t, pool.puts, 3)
+	assert.Equal(t, &second[0], &pool.puts[2][0])
+
+	// slices of a shared backing array with different lengths too
+	backing := manager.Get().([]byte)
+	manager.Put(backing)
+	manager.Put(backing[:32])
+	assert.Equal(t, 2, manager.Count())
+
+	// the pending buffers are returned on flush
+	manager.Flush()
+	assert.Equal(t, 0, manager.Count())
+	assert.Len(t, pool.puts, 5)
+}
+
+// cancelledContext is cancelled once its cancellation was checked checks times
+type cancelledContext struct {
+	context.Context
+	checks int
+}
+
+func (c *cancelledContext) Err() error {
+	if c.checks == 0 {
+		return context.Canceled
+	}
+	c.checks--
+	return nil
+}
+
+func TestPoolManagerFlushContext(t *testing.T) {
+
+	pool := &returnsPool{returns: make(map[interface{}]int)}
+	manager := NewPoolManager(pool, 2, WithMaxTracked(1000))
+	manager.SetPassthru(false)
+
+	for i := 0; i < 200; i++ {
+		manager.Put(manager.Get())
+	}
+
+	// cancelled after flushing 2 chunks
+	flushed := manager.FlushContext(&cancelledContext{Context: context.Background(), checks: 2})
+	assert.Equal(t, 2*flushCheckInterval, flushed)
+	assert.Len(t, pool.returns, flushed)
+	assert.Equal(t, 200-flushed, manager.Count())
+	assert.Equal(t, 200-flushed, manager.order.Len())
+	assert.Equal(t, int64(200-flushed), manager.Stats().Pending)
+
+	// already cancelled
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.Equal(t, 0, manager.FlushContext(ctx))
+	assert.Equal(t, 200-flushed, manager.Count())
+
+	// the remaining objects are still accounted and flushed once
+	assert.Equal(t, 200-flushed, manager.FlushContext(context.Background()))
+	assert.Equal(t, 0, manager.Count())
+	assert.Equal(t, 0, manager.order.Len())
+	assert.Len(t, pool.returns, 200)
+	for _, count := range pool.returns {
+		assert.Equal(t, 1, count)
+	}
+}
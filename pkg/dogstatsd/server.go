@@ -203,9 +203,10 @@ func NewServer(aggregator *aggregator.BufferedAggregator, extraTags []string) (*
 	}
 
 	// sharedPacketPool is used by the packet assembler to retrieve already allocated
-	// buffer in order to avoid allocation. The packets are pushed back by the server.
+	// buffer in order to avoid allocation. The packets are pushed back by the server,
+	// and by the traffic capture writer when it is enabled.
 	sharedPacketPool := packets.NewPool(config.Datadog.GetInt("dogstatsd_buffer_size"))
-	sharedPacketPoolManager := packets.NewPoolManager(sharedPacketPool)
+	sharedPacketPoolManager := packets.NewPoolManager(sharedPacketPool, 2)
 
 	udsListenerRunning := false
 
@@ -8,6 +8,8 @@ package http
 import (
 	"bytes"
 	"compress/gzip"
+
+	"github.com/klauspost/compress/zstd"
 )
 
 // ContentEncoding encodes the payload
@@ -71,3 +73,32 @@ func (c *GzipContentEncoding) encode(payload []byte) ([]byte, error) {
 	}
 	return compressedPayload.Bytes(), nil
 }
+
+// ZstdContentEncoding encodes the payload using zstd algorithm
+type ZstdContentEncoding struct {
+	level int
+	// the encoder is shared by all the payloads, EncodeAll can be called concurrently
+	encoder *zstd.Encoder
+	err     error
+}
+
+// NewZstdContentEncoding creates a new Zstd content type
+func NewZstdContentEncoding(level int) *ZstdContentEncoding {
+	encoder, err := zstd.NewWriter(nil, zstd.WithEncoderLevel(zstd.EncoderLevelFromZstd(level)))
+	return &ZstdContentEncoding{
+		level:   level,
+		encoder: encoder,
+		err:     err,
+	}
+}
+
+func (c *ZstdContentEncoding) name() string {
+	return "zstd"
+}
+
+func (c *ZstdContentEncoding) encode(payload []byte) ([]byte, error) {
+	if c.err != nil {
+		return nil, c.err
+	}
+	return c.encoder.EncodeAll(payload, nil), nil
+}
@@ -8,8 +8,11 @@ package http
 import (
 	"bytes"
 	"compress/gzip"
+	"fmt"
+	"sync"
 	"testing"
 
+	"github.com/klauspost/compress/zstd"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -42,6 +45,48 @@ func TestGzipContentEncodingName(t *testing.T) {
 	assert.Equal(t, NewGzipContentEncoding(gzip.BestCompression).name(), "gzip")
 }
 
+func TestZstdContentEncoding(t *testing.T) {
+	payload := []byte("my payload")
+
+	encodedPayload, err := NewZstdContentEncoding(6).encode(payload)
+	assert.Nil(t, err)
+
+	decoder, err := zstd.NewReader(nil)
+	assert.Nil(t, err)
+	defer decoder.Close()
+	decompressedPayload, err := decoder.DecodeAll(encodedPayload, nil)
+	assert.Nil(t, err)
+
+	assert.Equal(t, payload, decompressedPayload)
+}
+
+func TestZstdContentEncodingConcurrent(t *testing.T) {
+	encoding := NewZstdContentEncoding(6)
+	decoder, err := zstd.NewReader(nil)
+	assert.Nil(t, err)
+	defer decoder.Close()
+
+	// the encoder is shared by the payloads encoded concurrently
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			payload := []byte(fmt.Sprintf("my payload %d", i))
+			encodedPayload, err := encoding.encode(payload)
+			assert.Nil(t, err)
+			decompressedPayload, err := decoder.DecodeAll(encodedPayload, nil)
+			assert.Nil(t, err)
+			assert.Equal(t, payload, decompressedPayload)
+		}(i)
+	}
+	wg.Wait()
+}
+
+func TestZstdContentEncodingName(t *testing.T) {
+	assert.Equal(t, NewZstdContentEncoding(6).name(), "zstd")
+}
+
 func decompress(payload []byte) ([]byte, error) {
 	reader, err := gzip.NewReader(bytes.NewReader(payload))
 	if err != nil {
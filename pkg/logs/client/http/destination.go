@@ -37,7 +37,7 @@ var emptyPayload []byte
 
 // Destination sends a payload over HTTP.
 type Destination struct {
-	url                 string
+	endpoint            config.Endpoint
 	contentType         string
 	host                string
 	contentEncoding     ContentEncoding
@@ -62,10 +62,10 @@ func newDestination(endpoint config.Endpoint, contentType string, destinationsCo
 	}
 	return &Destination{
 		host:                endpoint.Host,
-		url:                 buildURL(endpoint),
+		endpoint:            endpoint,
 		contentType:         contentType,
 		contentEncoding:     buildContentEncoding(endpoint),
-		client:              httputils.NewResetClient(endpoint.ConnectionResetInterval, httpClientFactory(timeout)),
+		client:              httputils.NewResetClient(endpoint.ConnectionResetInterval, httpClientFactory(endpoint, timeout)),
 		destinationsContext: destinationsContext,
 		climit:              make(chan struct{}, maxConcurrentBackgroundSends),
 	}
@@ -97,7 +97,8 @@ func (d *Destination) Send(payload []byte) (err error) {
 	metrics.BytesSent.Add(int64(len(payload)))
 	metrics.EncodedBytesSent.Add(int64(len(encodedPayload)))
 
-	req, err := http.NewRequest("POST", d.url, bytes.NewReader(encodedPayload))
+	// the url is built on every send so that a rotated API key is picked up.
+	req, err := http.NewRequest("POST", buildURL(d.endpoint), bytes.NewReader(encodedPayload))
 	if err != nil {
 		// the request could not be built,
 		// this can happen when the method or the url are valid.
@@ -171,12 +172,24 @@ func (d *Destination) sendInBackground(payloadChan chan []byte) {
 	}()
 }
 
-func httpClientFactory(timeout time.Duration) func() *http.Client {
+func httpClientFactory(endpoint config.Endpoint, timeout time.Duration) func() *http.Client {
 	return func() *http.Client {
+		// reusing core agent HTTP transport to benefit from proxy settings.
+		transport := httputils.CreateHTTPTransport()
+		// the certificate is loaded every time the client is reset so that it can be rotated on disk.
+		if certs, err := endpoint.ClientCertificates(); err != nil {
+			log.Errorf("Could not load the client certificate for %s: %v", endpoint.Host, err)
+		} else if certs != nil {
+			transport.TLSClientConfig.Certificates = certs
+		}
+		if rootCAs, err := endpoint.RootCAs(); err != nil {
+			log.Errorf("Could not load the CA certificates for %s: %v", endpoint.Host, err)
+		} else if rootCAs != nil {
+			transport.TLSClientConfig.RootCAs = rootCAs
+		}
 		return &http.Client{
-			Timeout: timeout,
-			// reusing core agent HTTP transport to benefit from proxy settings.
-			Transport: httputils.CreateHTTPTransport(),
+			Timeout:   timeout,
+			Transport: transport,
 		}
 	}
 }
@@ -195,11 +208,14 @@ func buildURL(endpoint config.Endpoint) string {
 	} else {
 		address = endpoint.Host
 	}
-	return fmt.Sprintf("%v://%v/v1/input/%v", scheme, address, endpoint.APIKey)
+	return fmt.Sprintf("%v://%v/v1/input/%v", scheme, address, endpoint.GetAPIKey())
 }
 
 func buildContentEncoding(endpoint config.Endpoint) ContentEncoding {
 	if endpoint.UseCompression {
+		if endpoint.CompressionKind == config.ZstdCompressionKind {
+			return NewZstdContentEncoding(endpoint.CompressionLevel)
+		}
 		return NewGzipContentEncoding(endpoint.CompressionLevel)
 	}
 	return IdentityContentType
@@ -213,7 +229,7 @@ func CheckConnectivity(endpoint config.Endpoint) config.HTTPConnectivity {
 	defer ctx.Stop()
 	// Lower the timeout to 5s because HTTP connectivity test is done synchronously during the agent bootstrap sequence
 	destination := newDestination(endpoint, JSONContentType, ctx, time.Second*5, 0)
-	log.Infof("Sending HTTP connectivity request to %s...", destination.url)
+	log.Infof("Sending HTTP connectivity request to %s...", buildURL(destination.endpoint))
 	err := destination.Send(emptyPayload)
 	if err != nil {
 		log.Warnf("HTTP connectivity failure: %v", err)
@@ -82,6 +82,21 @@ func TestBuildURLShouldReturnAddressWithPortWhenDefined(t *testing.T) {
 	assert.Equal(t, "http://foo:1234/v1/input/bar", url)
 }
 
+func TestBuildContentEncodingShouldFollowCompressionKind(t *testing.T) {
+	assert.Equal(t, IdentityContentType, buildContentEncoding(config.Endpoint{
+		UseCompression:  false,
+		CompressionKind: config.ZstdCompressionKind,
+	}))
+	assert.Equal(t, "gzip", buildContentEncoding(config.Endpoint{
+		UseCompression:  true,
+		CompressionKind: config.GzipCompressionKind,
+	}).name())
+	assert.Equal(t, "zstd", buildContentEncoding(config.Endpoint{
+		UseCompression:  true,
+		CompressionKind: config.ZstdCompressionKind,
+	}).name())
+}
+
 func TestDestinationSend200(t *testing.T) {
 	server := NewHTTPServerTest(200)
 	err := server.destination.Send([]byte("yo"))
@@ -17,8 +17,6 @@ import (
 	"sync"
 	"time"
 
-	"golang.org/x/net/proxy"
-
 	"github.com/DataDog/datadog-agent/pkg/logs/config"
 	"github.com/DataDog/datadog-agent/pkg/logs/status"
 	"github.com/DataDog/datadog-agent/pkg/util/log"
@@ -59,6 +57,8 @@ func (cm *ConnectionManager) NewConnection(ctx context.Context) (net.Conn, error
 	cm.firstConn.Do(func() {
 		if cm.endpoint.ProxyAddress != "" {
 			log.Infof("Connecting to the backend: %v, via socks5: %v, with SSL: %v", cm.address(), cm.endpoint.ProxyAddress, cm.endpoint.UseSSL)
+		} else if cm.endpoint.ConnectProxyAddress != "" {
+			log.Infof("Connecting to the backend: %v, via HTTP CONNECT proxy: %v, with SSL: %v", cm.address(), config.RedactProxyURL(cm.endpoint.ConnectProxyAddress), cm.endpoint.UseSSL)
 		} else {
 			log.Infof("Connecting to the backend: %v, with SSL: %v", cm.address(), cm.endpoint.UseSSL)
 		}
@@ -85,22 +85,10 @@ func (cm *ConnectionManager) NewConnection(ctx context.Context) (net.Conn, error
 			// Continue.
 		}
 
+		dctx, cancel := context.WithTimeout(ctx, connectionTimeout)
+		defer cancel()
 		var conn net.Conn
-		if cm.endpoint.ProxyAddress != "" {
-			var dialer proxy.Dialer
-			dialer, err = proxy.SOCKS5("tcp", cm.endpoint.ProxyAddress, nil, proxy.Direct)
-			if err != nil {
-				log.Warn(err)
-				continue
-			}
-			// TODO: handle timeouts with ctx.
-			conn, err = dialer.Dial("tcp", cm.address())
-		} else {
-			var dialer net.Dialer
-			dctx, cancel := context.WithTimeout(ctx, connectionTimeout)
-			defer cancel()
-			conn, err = dialer.DialContext(dctx, "tcp", cm.address())
-		}
+		conn, err = cm.endpoint.DialContext(dctx)
 		if err != nil {
 			log.Warn(err)
 			continue
@@ -108,9 +96,14 @@ func (cm *ConnectionManager) NewConnection(ctx context.Context) (net.Conn, error
 		log.Debugf("connected to %v", cm.address())
 
 		if cm.endpoint.UseSSL {
-			sslConn := tls.Client(conn, &tls.Config{
-				ServerName: cm.endpoint.Host,
-			})
+			var tlsConfig *tls.Config
+			tlsConfig, err = cm.endpoint.TLSConfig()
+			if err != nil {
+				log.Warn(err)
+				conn.Close()
+				continue
+			}
+			sslConn := tls.Client(conn, tlsConfig)
 			err = cm.handshakeWithTimeout(sslConn, connectionTimeout)
 			if err != nil {
 				log.Warn(err)
@@ -141,9 +134,20 @@ func (cm *ConnectionManager) handshakeWithTimeout(conn *tls.Conn, timeout time.D
 
 // address returns the address of the server to send logs to.
 func (cm *ConnectionManager) address() string {
+	if cm.endpoint.Transport == config.TransportUnix {
+		return cm.endpoint.SocketPath
+	}
 	return net.JoinHostPort(cm.endpoint.Host, strconv.Itoa(cm.endpoint.Port))
 }
 
+// network returns the network used to connect to the server.
+func (cm *ConnectionManager) network() string {
+	if cm.endpoint.Transport == config.TransportUnix {
+		return "unix"
+	}
+	return "tcp"
+}
+
 // ShouldReset returns whether the connection should be reset, depending on the endpoint's config
 // and the passed connection creation time.
 func (cm *ConnectionManager) ShouldReset(connCreationTime time.Time) bool {
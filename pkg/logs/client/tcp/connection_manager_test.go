@@ -7,6 +7,7 @@ package tcp
 
 import (
 	"net"
+	"path/filepath"
 	"sync"
 	"testing"
 	"time"
@@ -33,6 +34,28 @@ func TestAddress(t *testing.T) {
 	assert.Equal(t, "foo:1234", connManager.address())
 }
 
+func TestAddressWithUnixSocket(t *testing.T) {
+	connManager := NewConnectionManager(config.Endpoint{Transport: config.TransportUnix, SocketPath: "/var/run/foo.sock"})
+	assert.Equal(t, "/var/run/foo.sock", connManager.address())
+	assert.Equal(t, "unix", connManager.network())
+}
+
+func TestNewConnectionWithUnixSocket(t *testing.T) {
+	socketPath := filepath.Join(t.TempDir(), "intake.sock")
+	l, err := net.Listen("unix", socketPath)
+	assert.NoError(t, err)
+	defer l.Close()
+	destinationsCtx := client.NewDestinationsContext()
+
+	connManager := NewConnectionManager(config.Endpoint{Transport: config.TransportUnix, SocketPath: socketPath})
+	destinationsCtx.Start()
+	defer destinationsCtx.Stop()
+
+	conn, err := connManager.NewConnection(destinationsCtx.Context())
+	assert.NotNil(t, conn)
+	assert.NoError(t, err)
+}
+
 func TestNewConnection(t *testing.T) {
 	l := mock.NewMockLogsIntake(t)
 	defer l.Close()
@@ -58,6 +58,8 @@ func (d *Destination) Send(payload []byte) error {
 			return err
 		}
 		d.connCreationTime = time.Now()
+		// the API key is read again on every new connection so that a rotated key is picked up.
+		d.prefixer = newPrefixer(d.connManager.endpoint.GetAPIKey() + string(' '))
 	}
 
 	metrics.BytesSent.Add(int64(len(payload)))
@@ -9,9 +9,14 @@ import (
 	"encoding/json"
 	"fmt"
 	"net"
+	"os"
+	"reflect"
 	"strconv"
+	"strings"
 	"time"
 
+	"github.com/mitchellh/mapstructure"
+
 	coreConfig "github.com/DataDog/datadog-agent/pkg/config"
 	"github.com/DataDog/datadog-agent/pkg/snmp/traps"
 	"github.com/DataDog/datadog-agent/pkg/util/log"
@@ -29,6 +34,9 @@ const (
 	httpEndpointPrefix = "agent-http-intake.logs."
 )
 
+// unixSchemePrefix is the prefix of the logs_dd_url values pointing to a unix domain socket.
+const unixSchemePrefix = "unix://"
+
 // logs-intake endpoints depending on the site and environment.
 var logsEndpoints = map[string]int{
 	"agent-intake.logs.datadoghq.com": 10516,
@@ -102,17 +110,76 @@ func GlobalProcessingRules() ([]*ProcessingRule, error) {
 
 // BuildEndpoints returns the endpoints to send logs.
 func BuildEndpoints(httpConnectivity HTTPConnectivity) (*Endpoints, error) {
+	return ignoreAdditionalEndpointsError(BuildEndpointsStrict(httpConnectivity))
+}
+
+// BuildEndpointsStrict returns the endpoints to send logs.
+// When some additional endpoints can't be parsed, it returns the endpoints built from the valid ones along with an *AdditionalEndpointsError.
+func BuildEndpointsStrict(httpConnectivity HTTPConnectivity) (*Endpoints, error) {
+	endpoints, _, err := buildEndpointsWithReason(httpConnectivity)
+	return endpoints, err
+}
+
+// TransportReason explains why the endpoints use their transport.
+type TransportReason string
+
+// Reasons of the transport choice of the endpoints.
+const (
+	TransportReasonUnixSocket                 TransportReason = "unix-socket"
+	TransportReasonForceHTTP                  TransportReason = "force-http"
+	TransportReasonConnectivitySuccess        TransportReason = "connectivity-success"
+	TransportReasonForceTCP                   TransportReason = "force-tcp"
+	TransportReasonSocks5Set                  TransportReason = "socks5-set"
+	TransportReasonAdditionalEndpointsPresent TransportReason = "additional-endpoints-present"
+	TransportReasonConnectivityFailure        TransportReason = "connectivity-failure"
+)
+
+// BuildEndpointsWithReason behaves like BuildEndpoints and also returns the reason of the transport choice.
+func BuildEndpointsWithReason(httpConnectivity HTTPConnectivity) (*Endpoints, TransportReason, error) {
+	endpoints, reason, err := buildEndpointsWithReason(httpConnectivity)
+	endpoints, err = ignoreAdditionalEndpointsError(endpoints, err)
+	return endpoints, reason, err
+}
+
+func buildEndpointsWithReason(httpConnectivity HTTPConnectivity) (*Endpoints, TransportReason, error) {
 	coreConfig.SanitizeAPIKeyConfig(coreConfig.Datadog, "logs_config.api_key")
 	if coreConfig.Datadog.GetBool("logs_config.dev_mode_no_ssl") {
 		log.Warnf("Use of illegal configuration parameter, if you need to send your logs to a proxy, please use 'logs_config.logs_dd_url' and 'logs_config.logs_no_ssl' instead")
 	}
-	if isForceHTTPUse() || (bool(httpConnectivity) && !(isForceTCPUse() || isSocks5ProxySet() || hasAdditionalEndpoints())) {
-		return BuildHTTPEndpoints()
+	reason := transportReason(httpConnectivity)
+	switch reason {
+	case TransportReasonUnixSocket:
+		endpoints, err := buildUnixEndpoints()
+		return endpoints, reason, err
+	case TransportReasonForceHTTP, TransportReasonConnectivitySuccess:
+		endpoints, err := BuildHTTPEndpointsWithConfigStrict(logsConfigDefaultKeys, httpEndpointPrefix)
+		return endpoints, reason, err
+	}
+	log.Warnf("You are currently sending Logs to Datadog through TCP (either because logs_config.use_tcp or logs_config.socks5_proxy_address is set or the HTTP connectivity test has failed, reason: %s) "+
+		"To benefit from increased reliability and better network performances, "+
+		"we strongly encourage switching over to compressed HTTPS which is now the default protocol.", reason)
+	endpoints, err := buildTCPEndpoints()
+	return endpoints, reason, err
+}
+
+// transportReason returns the reason of the transport choice, the first matching one wins.
+func transportReason(httpConnectivity HTTPConnectivity) TransportReason {
+	switch {
+	case isUnixAddress(coreConfig.Datadog.GetString("logs_config.logs_dd_url")):
+		return TransportReasonUnixSocket
+	case isForceHTTPUse():
+		return TransportReasonForceHTTP
+	case isForceTCPUse():
+		return TransportReasonForceTCP
+	case isSocks5ProxySet():
+		return TransportReasonSocks5Set
+	case hasAdditionalEndpoints():
+		return TransportReasonAdditionalEndpointsPresent
+	case !bool(httpConnectivity):
+		return TransportReasonConnectivityFailure
+	default:
+		return TransportReasonConnectivitySuccess
 	}
-	log.Warn("You are currently sending Logs to Datadog through TCP (either because logs_config.use_tcp or logs_config.socks5_proxy_address is set or the HTTP connectivity test has failed) " +
-		"To benefit from increased reliability and better network performances, " +
-		"we strongly encourage switching over to compressed HTTPS which is now the default protocol.")
-	return buildTCPEndpoints()
 }
 
 // ExpectedTagsDuration returns a duration of the time expected tags will be submitted for.
@@ -138,23 +205,71 @@ func isForceHTTPUse() bool {
 }
 
 func hasAdditionalEndpoints() bool {
-	return len(getAdditionalEndpoints()) > 0
+	additionals, _ := getAdditionalEndpoints()
+	return len(additionals) > 0
+}
+
+func isUnixAddress(address string) bool {
+	return strings.HasPrefix(address, unixSchemePrefix)
+}
+
+// buildUnixEndpoints returns the endpoints to send logs to a local unix domain socket,
+// expects 'logs_config.logs_dd_url' to respect the format 'unix://<PATH>'.
+func buildUnixEndpoints() (*Endpoints, error) {
+	if hasAdditionalEndpoints() {
+		return nil, fmt.Errorf("logs_config.additional_endpoints can't be used when logs_dd_url is a unix socket")
+	}
+	if coreConfig.Datadog.Get(logsConfigDefaultKeys.MirrorEndpoints) != nil {
+		return nil, fmt.Errorf("logs_config.mirror_endpoints can't be used when logs_dd_url is a unix socket")
+	}
+	address, err := getURL(logsConfigDefaultKeys.ExpandEnv, "logs_dd_url", coreConfig.Datadog.GetString("logs_config.logs_dd_url"))
+	if err != nil {
+		return nil, err
+	}
+	socketPath := strings.TrimPrefix(address, unixSchemePrefix)
+	if socketPath == "" {
+		return nil, fmt.Errorf("could not parse logs_dd_url: missing unix socket path")
+	}
+	main := Endpoint{
+		APIKey:                  logsConfigDefaultKeys.GetAPIKey(),
+		configKeys:              &logsConfigDefaultKeys,
+		SocketPath:              socketPath,
+		Transport:               TransportUnix,
+		ConnectionResetInterval: connectionResetIntervalFromKey(coreConfig.Datadog, logsConfigDefaultKeys),
+	}
+	useProto := coreConfig.Datadog.GetBool("logs_config.dev_mode_use_proto")
+	return NewEndpoints(main, nil, useProto, false, 0, 0), nil
 }
 
 func buildTCPEndpoints() (*Endpoints, error) {
 	useProto := coreConfig.Datadog.GetBool("logs_config.dev_mode_use_proto")
 	proxyAddress := coreConfig.Datadog.GetString("logs_config.socks5_proxy_address")
+	connectProxyAddress := coreConfig.Datadog.GetString("logs_config.http_connect_proxy")
+	if proxyAddress != "" && connectProxyAddress != "" {
+		log.Warnf("Both logs_config.socks5_proxy_address and logs_config.http_connect_proxy are set: logs are sent through the SOCKS5 proxy %s and logs_config.http_connect_proxy is ignored", proxyAddress)
+		connectProxyAddress = ""
+	}
 	main := Endpoint{
-		APIKey:                  getLogsAPIKey(coreConfig.Datadog),
+		APIKey:                  logsConfigDefaultKeys.GetAPIKey(),
+		configKeys:              &logsConfigDefaultKeys,
+		Transport:               TransportTCP,
 		ProxyAddress:            proxyAddress,
-		ConnectionResetInterval: time.Duration(coreConfig.Datadog.GetInt("logs_config.connection_reset_interval")) * time.Second,
+		ProxyUser:               coreConfig.Datadog.GetString(logsConfigDefaultKeys.Socks5ProxyUser),
+		ProxyPassword:           coreConfig.Datadog.GetString(logsConfigDefaultKeys.Socks5ProxyPassword),
+		ConnectProxyAddress:     connectProxyAddress,
+		CompressionKind:         compressionKindFromKey(logsConfigDefaultKeys.CompressionKind),
+		ConnectionResetInterval: connectionResetIntervalFromKey(coreConfig.Datadog, logsConfigDefaultKeys),
 	}
 	switch {
 	case isSetAndNotEmpty(coreConfig.Datadog, "logs_config.logs_dd_url"):
 		// Proxy settings, expect 'logs_config.logs_dd_url' to respect the format '<HOST>:<PORT>'
 		// and '<PORT>' to be an integer.
 		// By default ssl is enabled ; to disable ssl set 'logs_config.logs_no_ssl' to true.
-		host, port, err := parseAddress(coreConfig.Datadog.GetString("logs_config.logs_dd_url"))
+		address, err := getURL(logsConfigDefaultKeys.ExpandEnv, "logs_dd_url", coreConfig.Datadog.GetString("logs_config.logs_dd_url"))
+		if err != nil {
+			return nil, err
+		}
+		host, port, err := parseAddress(address)
 		if err != nil {
 			return nil, fmt.Errorf("could not parse logs_dd_url: %v", err)
 		}
@@ -162,42 +277,101 @@ func buildTCPEndpoints() (*Endpoints, error) {
 		main.Port = port
 		main.UseSSL = !coreConfig.Datadog.GetBool("logs_config.logs_no_ssl")
 	case coreConfig.Datadog.GetBool("logs_config.use_port_443"):
-		main.Host = coreConfig.Datadog.GetString("logs_config.dd_url_443")
+		host, err := getURL(logsConfigDefaultKeys.ExpandEnv, "dd_url_443", coreConfig.Datadog.GetString("logs_config.dd_url_443"))
+		if err != nil {
+			return nil, err
+		}
+		main.Host = host
 		main.Port = 443
 		main.UseSSL = true
 	default:
 		// If no proxy is set, we default to 'logs_config.dd_url' if set, or to 'site'.
 		// if none of them is set, we default to the US agent endpoint.
-		main.Host = coreConfig.GetMainEndpoint(tcpEndpointPrefix, "logs_config.dd_url")
-		if port, found := logsEndpoints[main.Host]; found {
-			main.Port = port
-		} else {
-			main.Port = coreConfig.Datadog.GetInt("logs_config.dd_port")
+		host, err := getURL(logsConfigDefaultKeys.ExpandEnv, "dd_url", coreConfig.GetMainEndpoint(tcpEndpointPrefix, "logs_config.dd_url"))
+		if err != nil {
+			return nil, err
 		}
+		main.Host = host
+		main.Port = intakePort(main.Host)
 		main.UseSSL = !coreConfig.Datadog.GetBool("logs_config.dev_mode_no_ssl")
 	}
+	if main.UseSSL {
+		main.CACertPath = coreConfig.Datadog.GetString(logsConfigDefaultKeys.CACertFile)
+	}
 
-	additionals := getAdditionalEndpoints()
+	additionals, additionalsErr := getAdditionalEndpointsFromKey("logs_config.additional_endpoints", Endpoint{}, validateTCPEndpoint)
 	for i := 0; i < len(additionals); i++ {
 		additionals[i].UseSSL = main.UseSSL
+		additionals[i].Transport = main.Transport
 		additionals[i].ProxyAddress = proxyAddress
+		additionals[i].ProxyUser = main.ProxyUser
+		additionals[i].ProxyPassword = main.ProxyPassword
+		additionals[i].ConnectProxyAddress = main.ConnectProxyAddress
+		additionals[i].CompressionKind = main.CompressionKind
+		additionals[i].CACertPath = main.CACertPath
 		additionals[i].APIKey = coreConfig.SanitizeAPIKey(additionals[i].APIKey)
 	}
-	return NewEndpoints(main, additionals, useProto, false, 0, 0), nil
+	mirrors, mirrorsErr := getMirrorEndpointsFromKey(logsConfigDefaultKeys.MirrorEndpoints, main.Transport, validateTCPEndpoint)
+
+	endpoints := NewEndpoints(main, additionals, useProto, false, 0, 0)
+	endpoints.Mirrors = mirrors
+	return endpoints, firstAdditionalEndpointsError(additionalsErr, mirrorsErr)
+}
+
+// intakePort returns the port of a logs intake: the configured override, the port of the known intakes,
+// or logs_config.dd_port.
+func intakePort(host string) int {
+	if port, found := intakePortOverride(host); found {
+		return port
+	}
+	if port, found := logsEndpoints[host]; found {
+		return port
+	}
+	return coreConfig.Datadog.GetInt("logs_config.dd_port")
+}
+
+// intakePortOverride returns the port configured for the host in logs_config.intake_port_overrides.
+func intakePortOverride(host string) (int, bool) {
+	overrides := coreConfig.Datadog.GetStringMap("logs_config.intake_port_overrides")
+	for overrideHost, value := range overrides {
+		if !strings.EqualFold(overrideHost, host) {
+			continue
+		}
+		port, err := strconv.Atoi(strings.TrimSpace(fmt.Sprintf("%v", value)))
+		if err != nil || port <= 0 || port > 65535 {
+			log.Warnf("Invalid logs_config.intake_port_overrides port for %s: %v, ignoring it", overrideHost, value)
+			return 0, false
+		}
+		return port, true
+	}
+	return 0, false
 }
 
 // LogsConfigKeys stores logs configuration keys stored in YAML configuration files
 type LogsConfigKeys struct {
-	UseCompression          string
-	CompressionLevel        string
-	ConnectionResetInterval string
-	LogsDDURL               string
-	LogsNoSSL               string
-	DDURL                   string
-	DevModeNoSSL            string
-	AdditionalEndpoints     string
-	BatchWait               string
-	BatchMaxConcurrentSend  string
+	UseCompression             string
+	CompressionLevel           string
+	CompressionKind            string
+	ConnectionResetInterval    string
+	ConnectionResetIntervalMin string
+	ConnectionResetIntervalMax string
+	LogsDDURL                  string
+	LogsNoSSL                  string
+	DDURL                      string
+	DevModeNoSSL               string
+	AdditionalEndpoints        string
+	MirrorEndpoints            string
+	BatchWait                  string
+	BatchWaitMin               string
+	BatchWaitMax               string
+	BatchMaxConcurrentSend     string
+	BatchMaxContentSize        string
+	TLSCertFile                string
+	TLSKeyFile                 string
+	Socks5ProxyUser            string
+	Socks5ProxyPassword        string
+	ExpandEnv                  string
+	CACertFile                 string
 }
 
 // logsConfigDefaultKeys defines the default YAML keys used to retrieve logs configuration
@@ -206,16 +380,29 @@ var logsConfigDefaultKeys = NewLogsConfigKeys("logs_config.")
 // NewLogsConfigKeys returns a new logs configuration keys set
 func NewLogsConfigKeys(configPrefix string) LogsConfigKeys {
 	return LogsConfigKeys{
-		UseCompression:          configPrefix + "use_compression",
-		CompressionLevel:        configPrefix + "compression_level",
-		ConnectionResetInterval: configPrefix + "connection_reset_interval",
-		LogsDDURL:               configPrefix + "logs_dd_url",
-		LogsNoSSL:               configPrefix + "logs_no_ssl",
-		DDURL:                   configPrefix + "dd_url",
-		DevModeNoSSL:            configPrefix + "dev_mode_no_ssl",
-		AdditionalEndpoints:     configPrefix + "additional_endpoints",
-		BatchWait:               configPrefix + "batch_wait",
-		BatchMaxConcurrentSend:  configPrefix + "batch_max_concurrent_send",
+		UseCompression:             configPrefix + "use_compression",
+		CompressionLevel:           configPrefix + "compression_level",
+		CompressionKind:            configPrefix + "compression_kind",
+		ConnectionResetInterval:    configPrefix + "connection_reset_interval",
+		ConnectionResetIntervalMin: configPrefix + "connection_reset_interval_min",
+		ConnectionResetIntervalMax: configPrefix + "connection_reset_interval_max",
+		LogsDDURL:                  configPrefix + "logs_dd_url",
+		LogsNoSSL:                  configPrefix + "logs_no_ssl",
+		DDURL:                      configPrefix + "dd_url",
+		DevModeNoSSL:               configPrefix + "dev_mode_no_ssl",
+		AdditionalEndpoints:        configPrefix + "additional_endpoints",
+		MirrorEndpoints:            configPrefix + "mirror_endpoints",
+		BatchWait:                  configPrefix + "batch_wait",
+		BatchWaitMin:               configPrefix + "batch_wait_min",
+		BatchWaitMax:               configPrefix + "batch_wait_max",
+		BatchMaxConcurrentSend:     configPrefix + "batch_max_concurrent_send",
+		BatchMaxContentSize:        configPrefix + "batch_max_content_size",
+		TLSCertFile:                configPrefix + "tls_cert_file",
+		TLSKeyFile:                 configPrefix + "tls_key_file",
+		Socks5ProxyUser:            configPrefix + "socks5_proxy_user",
+		Socks5ProxyPassword:        configPrefix + "socks5_proxy_password",
+		ExpandEnv:                  configPrefix + "expand_env",
+		CACertFile:                 configPrefix + "ca_cert_file",
 	}
 }
 
@@ -226,6 +413,12 @@ func BuildHTTPEndpoints() (*Endpoints, error) {
 
 // BuildHTTPEndpointsWithConfig uses two arguments that instructs it how to access configuration parameters, then returns the HTTP endpoints to send logs to. This function is able to default to the 'classic' BuildHTTPEndpoints() w ldHTTPEndpointsWithConfigdefault variables logsConfigDefaultKeys and httpEndpointPrefix
 func BuildHTTPEndpointsWithConfig(logsConfig LogsConfigKeys, endpointPrefix string) (*Endpoints, error) {
+	return ignoreAdditionalEndpointsError(BuildHTTPEndpointsWithConfigStrict(logsConfig, endpointPrefix))
+}
+
+// BuildHTTPEndpointsWithConfigStrict behaves like BuildHTTPEndpointsWithConfig but doesn't ignore malformed additional endpoints:
+// it returns the endpoints built from the valid ones along with an *AdditionalEndpointsError.
+func BuildHTTPEndpointsWithConfigStrict(logsConfig LogsConfigKeys, endpointPrefix string) (*Endpoints, error) {
 	// Provide default values for legacy settings when the configuration key does not exist
 	defaultUseSSL := false
 	if len(logsConfig.LogsNoSSL) != 0 {
@@ -238,15 +431,33 @@ func BuildHTTPEndpointsWithConfig(logsConfig LogsConfigKeys, endpointPrefix stri
 	}
 
 	main := Endpoint{
-		APIKey:                  getLogsAPIKey(coreConfig.Datadog),
+		APIKey:                  logsConfig.GetAPIKey(),
+		configKeys:              &logsConfig,
+		Transport:               TransportHTTP,
 		UseCompression:          defaultUseCompression,
 		CompressionLevel:        coreConfig.Datadog.GetInt(logsConfig.CompressionLevel),
-		ConnectionResetInterval: time.Duration(coreConfig.Datadog.GetInt(logsConfig.ConnectionResetInterval)) * time.Second,
+		CompressionKind:         compressionKindFromKey(logsConfig.CompressionKind),
+		ConnectionResetInterval: connectionResetIntervalFromKey(coreConfig.Datadog, logsConfig),
+	}
+
+	if len(logsConfig.TLSCertFile) != 0 && len(logsConfig.TLSKeyFile) != 0 {
+		main.ClientCertPath = coreConfig.Datadog.GetString(logsConfig.TLSCertFile)
+		main.ClientKeyPath = coreConfig.Datadog.GetString(logsConfig.TLSKeyFile)
+		if (main.ClientCertPath == "") != (main.ClientKeyPath == "") {
+			return nil, fmt.Errorf("%s and %s must be set together", logsConfig.TLSCertFile, logsConfig.TLSKeyFile)
+		}
 	}
 
 	switch {
 	case isSetAndNotEmpty(coreConfig.Datadog, logsConfig.LogsDDURL):
-		host, port, err := parseAddress(coreConfig.Datadog.GetString(logsConfig.LogsDDURL))
+		if isUnixAddress(coreConfig.Datadog.GetString(logsConfig.LogsDDURL)) {
+			return nil, fmt.Errorf("could not parse %s: unix sockets are not supported with HTTP", logsConfig.LogsDDURL)
+		}
+		address, err := getURL(logsConfig.ExpandEnv, "logs_dd_url", coreConfig.Datadog.GetString(logsConfig.LogsDDURL))
+		if err != nil {
+			return nil, err
+		}
+		host, port, err := parseAddress(address)
 		if err != nil {
 			return nil, fmt.Errorf("could not parse logs_dd_url: %v", err)
 		}
@@ -254,48 +465,226 @@ func BuildHTTPEndpointsWithConfig(logsConfig LogsConfigKeys, endpointPrefix stri
 		main.Port = port
 		main.UseSSL = !defaultUseSSL
 	default:
-		main.Host = coreConfig.GetMainEndpoint(endpointPrefix, logsConfig.DDURL)
+		host, err := getURL(logsConfig.ExpandEnv, "dd_url", coreConfig.GetMainEndpoint(endpointPrefix, logsConfig.DDURL))
+		if err != nil {
+			return nil, err
+		}
+		main.Host = host
 		main.UseSSL = !coreConfig.Datadog.GetBool(logsConfig.DevModeNoSSL)
 	}
+	if main.UseSSL && len(logsConfig.CACertFile) != 0 {
+		main.CACertPath = coreConfig.Datadog.GetString(logsConfig.CACertFile)
+	}
 
-	additionals := getAdditionalEndpointsFromKey(logsConfig.AdditionalEndpoints)
+	// additional endpoints inherit the compression settings of the main endpoint unless they override them.
+	compressionDefaults := Endpoint{
+		UseCompression:   main.UseCompression,
+		CompressionLevel: main.CompressionLevel,
+		CompressionKind:  main.CompressionKind,
+	}
+	additionals, additionalsErr := getAdditionalEndpointsFromKey(logsConfig.AdditionalEndpoints, compressionDefaults, validateHTTPEndpoint)
 	for i := 0; i < len(additionals); i++ {
 		additionals[i].UseSSL = main.UseSSL
+		additionals[i].Transport = main.Transport
+		additionals[i].CompressionKind = validCompressionKind(additionals[i].CompressionKind, main.CompressionKind)
+		additionals[i].ClientCertPath = main.ClientCertPath
+		additionals[i].ClientKeyPath = main.ClientKeyPath
+		additionals[i].CACertPath = main.CACertPath
 		additionals[i].APIKey = coreConfig.SanitizeAPIKey(additionals[i].APIKey)
 	}
 
-	batchWait := batchWaitFromKey(coreConfig.Datadog, logsConfig.BatchWait)
+	batchWait := batchWaitFromKey(coreConfig.Datadog, logsConfig)
 	batchMaxConcurrentSend := batchMaxConcurrentSendFromKey(logsConfig.BatchMaxConcurrentSend)
 
-	return NewEndpoints(main, additionals, false, true, batchWait, batchMaxConcurrentSend), nil
+	mirrors, mirrorsErr := getMirrorEndpointsFromKey(logsConfig.MirrorEndpoints, main.Transport, validateHTTPEndpoint)
+
+	endpoints := NewEndpoints(main, additionals, false, true, batchWait, batchMaxConcurrentSend)
+	endpoints.BatchMaxContentSize = batchMaxContentSizeFromKey(logsConfig.BatchMaxContentSize)
+	endpoints.Mirrors = mirrors
+	return endpoints, firstAdditionalEndpointsError(additionalsErr, mirrorsErr)
+}
+
+// AdditionalEndpointFailure describes an additional endpoint that could not be parsed.
+type AdditionalEndpointFailure struct {
+	// Index is the position of the endpoint in the additional_endpoints list, -1 if the list itself is malformed.
+	Index int
+	Raw   interface{}
+	Err   error
 }
 
-func getAdditionalEndpoints() []Endpoint {
-	return getAdditionalEndpointsFromKey("logs_config.additional_endpoints")
+// AdditionalEndpointsError is returned when some additional endpoints could not be parsed.
+type AdditionalEndpointsError struct {
+	Key      string
+	Failures []AdditionalEndpointFailure
 }
 
-func getAdditionalEndpointsFromKey(additionalEndpointsParameter string) []Endpoint {
+// Error returns the list of additional endpoints that failed to parse.
+func (e *AdditionalEndpointsError) Error() string {
+	failures := make([]string, 0, len(e.Failures))
+	for _, failure := range e.Failures {
+		if failure.Index < 0 {
+			failures = append(failures, fmt.Sprintf("%v", failure.Err))
+		} else {
+			failures = append(failures, fmt.Sprintf("entry %d (%v): %v", failure.Index, failure.Raw, failure.Err))
+		}
+	}
+	return fmt.Sprintf("could not parse %s: %s", e.Key, strings.Join(failures, "; "))
+}
+
+// ignoreAdditionalEndpointsError logs and discards an *AdditionalEndpointsError, keeping the endpoints that were parsed successfully.
+func ignoreAdditionalEndpointsError(endpoints *Endpoints, err error) (*Endpoints, error) {
+	if additionalsErr, ok := err.(*AdditionalEndpointsError); ok {
+		log.Warnf("Could not parse additional_endpoints for logs: %v", additionalsErr)
+		return endpoints, nil
+	}
+	return endpoints, err
+}
+
+func getAdditionalEndpoints() ([]Endpoint, error) {
+	return getAdditionalEndpointsFromKey("logs_config.additional_endpoints", Endpoint{}, nil)
+}
+
+// getAdditionalEndpointsFromKey parses each additional endpoint individually so that a malformed entry
+// doesn't prevent the others from being used, the fields missing from an entry keep the values of defaults.
+// The entries rejected by validate, when not nil, are dropped as well.
+func getAdditionalEndpointsFromKey(additionalEndpointsParameter string, defaults Endpoint, validate func(Endpoint) error) ([]Endpoint, error) {
 	var endpoints []Endpoint
-	var err error
 	raw := coreConfig.Datadog.Get(additionalEndpointsParameter)
 	if raw == nil {
-		return endpoints
+		return endpoints, nil
 	}
-	if s, ok := raw.(string); ok && s != "" {
-		err = json.Unmarshal([]byte(s), &endpoints)
+
+	additionalsErr := &AdditionalEndpointsError{Key: additionalEndpointsParameter}
+	if s, ok := raw.(string); ok {
+		if s == "" {
+			return endpoints, nil
+		}
+		var entries []json.RawMessage
+		if err := json.Unmarshal([]byte(s), &entries); err != nil {
+			additionalsErr.Failures = append(additionalsErr.Failures, AdditionalEndpointFailure{Index: -1, Raw: s, Err: err})
+			return endpoints, additionalsErr
+		}
+		for i, entry := range entries {
+			endpoint := defaults
+			if err := json.Unmarshal(entry, &endpoint); err != nil {
+				additionalsErr.Failures = append(additionalsErr.Failures, AdditionalEndpointFailure{Index: i, Raw: string(entry), Err: err})
+				continue
+			}
+			if validate != nil {
+				if err := validate(endpoint); err != nil {
+					additionalsErr.Failures = append(additionalsErr.Failures, AdditionalEndpointFailure{Index: i, Raw: string(entry), Err: err})
+					continue
+				}
+			}
+			endpoints = append(endpoints, endpoint)
+		}
 	} else {
-		err = coreConfig.Datadog.UnmarshalKey(additionalEndpointsParameter, &endpoints)
+		entries := reflect.ValueOf(raw)
+		if entries.Kind() != reflect.Slice {
+			additionalsErr.Failures = append(additionalsErr.Failures, AdditionalEndpointFailure{Index: -1, Raw: raw, Err: fmt.Errorf("expected a list, got %T", raw)})
+			return endpoints, additionalsErr
+		}
+		for i := 0; i < entries.Len(); i++ {
+			entry := entries.Index(i).Interface()
+			endpoint := defaults
+			if err := decodeEndpoint(entry, &endpoint); err != nil {
+				additionalsErr.Failures = append(additionalsErr.Failures, AdditionalEndpointFailure{Index: i, Raw: entry, Err: err})
+				continue
+			}
+			if validate != nil {
+				if err := validate(endpoint); err != nil {
+					additionalsErr.Failures = append(additionalsErr.Failures, AdditionalEndpointFailure{Index: i, Raw: entry, Err: err})
+					continue
+				}
+			}
+			endpoints = append(endpoints, endpoint)
+		}
+	}
+
+	if len(additionalsErr.Failures) > 0 {
+		return endpoints, additionalsErr
+	}
+	return endpoints, nil
+}
+
+// getMirrorEndpointsFromKey parses the mirror endpoints, which are fully specified by their own settings:
+// only the transport, which must be the one of the main endpoint, is not configurable.
+func getMirrorEndpointsFromKey(mirrorEndpointsParameter string, transport Transport, validate func(Endpoint) error) ([]Endpoint, error) {
+	if len(mirrorEndpointsParameter) == 0 {
+		return nil, nil
+	}
+	defaults := Endpoint{
+		UseSSL:          true,
+		UseCompression:  transport == TransportHTTP,
+		CompressionKind: GzipCompressionKind,
 	}
+	mirrors, err := getAdditionalEndpointsFromKey(mirrorEndpointsParameter, defaults, validate)
+	for i := 0; i < len(mirrors); i++ {
+		mirrors[i].Transport = transport
+		mirrors[i].CompressionKind = validCompressionKind(mirrors[i].CompressionKind, GzipCompressionKind)
+		mirrors[i].APIKey = coreConfig.SanitizeAPIKey(mirrors[i].APIKey)
+	}
+	return mirrors, err
+}
+
+// firstAdditionalEndpointsError returns the first non nil error, the other one is logged.
+func firstAdditionalEndpointsError(additionalsErr error, mirrorsErr error) error {
+	if additionalsErr == nil {
+		return mirrorsErr
+	}
+	if mirrorsErr != nil {
+		log.Warnf("Could not parse mirror_endpoints for logs: %v", mirrorsErr)
+	}
+	return additionalsErr
+}
+
+// validateTCPEndpoint checks the settings of an additional or mirror TCP endpoint which are not inherited from the main endpoint.
+func validateTCPEndpoint(endpoint Endpoint) error {
+	return validateEndpoint(endpoint, 1)
+}
+
+// validateHTTPEndpoint checks the settings of an additional or mirror HTTP endpoint which are not inherited from the main endpoint,
+// the port can be omitted to use the one of the scheme.
+func validateHTTPEndpoint(endpoint Endpoint) error {
+	return validateEndpoint(endpoint, 0)
+}
+
+func validateEndpoint(endpoint Endpoint, minPort int) error {
+	if strings.TrimSpace(endpoint.Host) == "" {
+		return fmt.Errorf("missing host")
+	}
+	if endpoint.Port < minPort || endpoint.Port > 65535 {
+		return fmt.Errorf("invalid port %d, should be in [%d, 65535]", endpoint.Port, minPort)
+	}
+	return coreConfig.ValidateAPIKey(endpoint.APIKey)
+}
+
+// decodeEndpoint decodes a single endpoint with the same settings viper uses in UnmarshalKey.
+func decodeEndpoint(input interface{}, endpoint *Endpoint) error {
+	decoder, err := mapstructure.NewDecoder(&mapstructure.DecoderConfig{
+		Result:           endpoint,
+		WeaklyTypedInput: true,
+		DecodeHook: mapstructure.ComposeDecodeHookFunc(
+			mapstructure.StringToTimeDurationHookFunc(),
+			mapstructure.StringToSliceHookFunc(","),
+		),
+	})
 	if err != nil {
-		log.Warnf("Could not parse additional_endpoints for logs: %v", err)
+		return err
 	}
-	return endpoints
+	return decoder.Decode(input)
 }
 
 func isSetAndNotEmpty(config coreConfig.Config, key string) bool {
 	return config.IsSet(key) && len(config.GetString(key)) > 0
 }
 
+// GetAPIKey returns the sanitized dd api key used by the main logs agent sender, whatever the prefix of the keys.
+// It is read from the configuration on every call so that it can be re-invoked to pick up a rotated key.
+func (l LogsConfigKeys) GetAPIKey() string {
+	return getLogsAPIKey(coreConfig.Datadog)
+}
+
 // getLogsAPIKey provides the dd api key used by the main logs agent sender.
 func getLogsAPIKey(config coreConfig.Config) string {
 	if isSetAndNotEmpty(config, "logs_config.api_key") {
@@ -304,6 +693,25 @@ func getLogsAPIKey(config coreConfig.Config) string {
 	return coreConfig.SanitizeAPIKey(config.GetString("api_key"))
 }
 
+// getURL returns the url, with its environment variables expanded when expandEnvKey is enabled.
+func getURL(expandEnvKey string, name string, url string) (string, error) {
+	if len(expandEnvKey) == 0 || !coreConfig.Datadog.GetBool(expandEnvKey) {
+		return url, nil
+	}
+	var undefined []string
+	expanded := os.Expand(url, func(variable string) string {
+		value, found := os.LookupEnv(variable)
+		if !found {
+			undefined = append(undefined, variable)
+		}
+		return value
+	})
+	if len(undefined) > 0 {
+		return "", fmt.Errorf("could not parse %s: undefined environment variables %s in %q", name, strings.Join(undefined, ", "), url)
+	}
+	return expanded, nil
+}
+
 // parseAddress returns the host and the port of the address.
 func parseAddress(address string) (string, int, error) {
 	host, portString, err := net.SplitHostPort(address)
@@ -317,13 +725,98 @@ func parseAddress(address string) (string, int, error) {
 	return host, port, nil
 }
 
-func batchWaitFromKey(config coreConfig.Config, batchWaitKey string) time.Duration {
-	batchWait := coreConfig.Datadog.GetInt(batchWaitKey)
-	if batchWait < 1 || 10 < batchWait {
-		log.Warnf("Invalid batch_wait: %v should be in [1, 10], fallback on %v", batchWait, coreConfig.DefaultBatchWait)
-		return coreConfig.DefaultBatchWait * time.Second
+// batchWaitFromKey returns the batch wait, which must be within the configured bounds.
+func batchWaitFromKey(config coreConfig.Config, logsConfig LogsConfigKeys) time.Duration {
+	defaultBatchWait := coreConfig.DefaultBatchWait * time.Second
+	minBatchWait := durationFromKeyOrDefault(config, logsConfig.BatchWaitMin, coreConfig.DefaultBatchWaitMin*time.Second)
+	maxBatchWait := durationFromKeyOrDefault(config, logsConfig.BatchWaitMax, coreConfig.DefaultBatchWaitMax*time.Second)
+	if minBatchWait <= 0 || maxBatchWait < minBatchWait {
+		log.Warnf("Invalid batch_wait bounds: [%v, %v], fallback on [%v, %v]", minBatchWait, maxBatchWait, coreConfig.DefaultBatchWaitMin*time.Second, coreConfig.DefaultBatchWaitMax*time.Second)
+		minBatchWait = coreConfig.DefaultBatchWaitMin * time.Second
+		maxBatchWait = coreConfig.DefaultBatchWaitMax * time.Second
+	}
+	if defaultBatchWait < minBatchWait {
+		defaultBatchWait = minBatchWait
+	} else if maxBatchWait < defaultBatchWait {
+		defaultBatchWait = maxBatchWait
+	}
+
+	batchWait, err := durationFromKey(config, logsConfig.BatchWait)
+	if err != nil || batchWait < minBatchWait || maxBatchWait < batchWait {
+		log.Warnf("Invalid batch_wait: %v should be in [%v, %v], fallback on %v", config.GetString(logsConfig.BatchWait), minBatchWait, maxBatchWait, defaultBatchWait)
+		return defaultBatchWait
+	}
+	return batchWait
+}
+
+// connectionResetIntervalFromKey returns the interval after which the connections are reset, 0 disabling the resets.
+// The interval is set in seconds, it is clamped within the configured bounds.
+func connectionResetIntervalFromKey(config coreConfig.Config, logsConfig LogsConfigKeys) time.Duration {
+	seconds := config.GetInt(logsConfig.ConnectionResetInterval)
+	if seconds == 0 {
+		return 0
+	}
+	if seconds < 0 {
+		log.Warnf("Invalid connection_reset_interval: %d should be positive, the connections are never reset", seconds)
+		return 0
+	}
+
+	minInterval := durationFromKeyOrDefault(config, logsConfig.ConnectionResetIntervalMin, coreConfig.DefaultConnectionResetIntervalMin*time.Second)
+	maxInterval := durationFromKeyOrDefault(config, logsConfig.ConnectionResetIntervalMax, coreConfig.DefaultConnectionResetIntervalMax*time.Second)
+	if minInterval <= 0 || maxInterval < minInterval {
+		log.Warnf("Invalid connection_reset_interval bounds: [%v, %v], fallback on [%v, %v]", minInterval, maxInterval, coreConfig.DefaultConnectionResetIntervalMin*time.Second, coreConfig.DefaultConnectionResetIntervalMax*time.Second)
+		minInterval = coreConfig.DefaultConnectionResetIntervalMin * time.Second
+		maxInterval = coreConfig.DefaultConnectionResetIntervalMax * time.Second
+	}
+
+	// the seconds are compared before being converted so that a huge value can't overflow
+	switch {
+	case int64(seconds) > int64(maxInterval/time.Second):
+		log.Warnf("Invalid connection_reset_interval: %ds should be in [%v, %v], fallback on %v", seconds, minInterval, maxInterval, maxInterval)
+		return maxInterval
+	case time.Duration(seconds)*time.Second < minInterval:
+		log.Warnf("Invalid connection_reset_interval: %ds should be in [%v, %v], fallback on %v", seconds, minInterval, maxInterval, minInterval)
+		return minInterval
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+// durationFromKey parses a duration expressed either as a number of seconds or as a duration string, e.g. "500ms".
+func durationFromKey(config coreConfig.Config, key string) (time.Duration, error) {
+	value := strings.TrimSpace(config.GetString(key))
+	if seconds, err := strconv.ParseFloat(value, 64); err == nil {
+		return time.Duration(seconds * float64(time.Second)), nil
+	}
+	return time.ParseDuration(value)
+}
+
+func durationFromKeyOrDefault(config coreConfig.Config, key string, defaultValue time.Duration) time.Duration {
+	if len(key) == 0 || !config.IsSet(key) {
+		return defaultValue
+	}
+	duration, err := durationFromKey(config, key)
+	if err != nil {
+		log.Warnf("Invalid %s: %v, fallback on %v", key, err, defaultValue)
+		return defaultValue
+	}
+	return duration
+}
+
+func compressionKindFromKey(compressionKindKey string) string {
+	if len(compressionKindKey) == 0 {
+		return GzipCompressionKind
+	}
+	return validCompressionKind(coreConfig.Datadog.GetString(compressionKindKey), GzipCompressionKind)
+}
+
+func validCompressionKind(compressionKind string, fallback string) string {
+	switch compressionKind {
+	case GzipCompressionKind, ZstdCompressionKind:
+		return compressionKind
+	default:
+		log.Warnf("Invalid compression_kind: %v should be one of [%v, %v], fallback on %v", compressionKind, GzipCompressionKind, ZstdCompressionKind, fallback)
+		return fallback
 	}
-	return (time.Duration(batchWait) * time.Second)
 }
 
 func batchMaxConcurrentSendFromKey(batchMaxConcurrentSendKey string) int {
@@ -335,6 +828,18 @@ func batchMaxConcurrentSendFromKey(batchMaxConcurrentSendKey string) int {
 	return batchMaxConcurrentSend
 }
 
+func batchMaxContentSizeFromKey(batchMaxContentSizeKey string) int {
+	if len(batchMaxContentSizeKey) == 0 {
+		return coreConfig.DefaultBatchMaxContentSize
+	}
+	batchMaxContentSize := coreConfig.Datadog.GetInt(batchMaxContentSizeKey)
+	if batchMaxContentSize <= 0 || batchMaxContentSize > coreConfig.MaxBatchMaxContentSize {
+		log.Warnf("Invalid batch_max_content_size: %v should be in [1, %v], fallback on %v", batchMaxContentSize, coreConfig.MaxBatchMaxContentSize, coreConfig.DefaultBatchMaxContentSize)
+		return coreConfig.DefaultBatchMaxContentSize
+	}
+	return batchMaxContentSize
+}
+
 // TaggerWarmupDuration is used to configure the tag providers
 func TaggerWarmupDuration() time.Duration {
 	return coreConfig.Datadog.GetDuration("logs_config.tagger_warmup_duration") * time.Second
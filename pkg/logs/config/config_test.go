@@ -152,33 +152,41 @@ func (suite *ConfigTestSuite) TestMultipleHttpEndpointsEnvVar() {
 	suite.config.Set("logs_config.logs_no_ssl", false)
 
 	os.Setenv("DD_LOGS_CONFIG_ADDITIONAL_ENDPOINTS", `[
-	{"api_key": "456", "host": "additional.endpoint.1", "port": 1234, "use_compression": true, "compression_level": 2},
-	{"api_key": "789", "host": "additional.endpoint.2", "port": 1234, "use_compression": true, "compression_level": 2}]`)
+	{"api_key": "00000000000000000000000000000456", "host": "additional.endpoint.1", "port": 1234, "use_compression": true, "compression_level": 2},
+	{"api_key": "00000000000000000000000000000789", "host": "additional.endpoint.2", "port": 1234, "use_compression": true, "compression_level": 2}]`)
 	defer os.Unsetenv("DD_LOGS_CONFIG_ADDITIONAL_ENDPOINTS")
 
 	expectedMainEndpoint := Endpoint{
+		configKeys:       &logsConfigDefaultKeys,
 		APIKey:           "123",
+		Transport:        TransportHTTP,
 		Host:             "agent-http-intake.logs.datadoghq.com",
 		Port:             443,
 		UseSSL:           true,
 		UseCompression:   true,
-		CompressionLevel: 6}
+		CompressionLevel: 6,
+		CompressionKind:  "gzip"}
 	expectedAdditionalEndpoint1 := Endpoint{
-		APIKey:           "456",
+		APIKey:           "00000000000000000000000000000456",
+		Transport:        TransportHTTP,
 		Host:             "additional.endpoint.1",
 		Port:             1234,
 		UseSSL:           true,
 		UseCompression:   true,
-		CompressionLevel: 2}
+		CompressionLevel: 2,
+		CompressionKind:  "gzip"}
 	expectedAdditionalEndpoint2 := Endpoint{
-		APIKey:           "789",
+		APIKey:           "00000000000000000000000000000789",
+		Transport:        TransportHTTP,
 		Host:             "additional.endpoint.2",
 		Port:             1234,
 		UseSSL:           true,
 		UseCompression:   true,
-		CompressionLevel: 2}
+		CompressionLevel: 2,
+		CompressionKind:  "gzip"}
 
 	expectedEndpoints := NewEndpoints(expectedMainEndpoint, []Endpoint{expectedAdditionalEndpoint1, expectedAdditionalEndpoint2}, false, true, time.Second, 0)
+	expectedEndpoints.BatchMaxContentSize = coreConfig.DefaultBatchMaxContentSize
 	endpoints, err := BuildHTTPEndpoints()
 
 	suite.Nil(err)
@@ -192,24 +200,29 @@ func (suite *ConfigTestSuite) TestMultipleTCPEndpointsEnvVar() {
 	suite.config.Set("logs_config.socks5_proxy_address", "proxy.test:3128")
 	suite.config.Set("logs_config.dev_mode_use_proto", true)
 
-	os.Setenv("DD_LOGS_CONFIG_ADDITIONAL_ENDPOINTS", `[{"api_key": "456      \n", "host": "additional.endpoint", "port": 1234}]`)
+	os.Setenv("DD_LOGS_CONFIG_ADDITIONAL_ENDPOINTS", `[{"api_key": "00000000000000000000000000000456      \n", "host": "additional.endpoint", "port": 1234}]`)
 	defer os.Unsetenv("DD_LOGS_CONFIG_ADDITIONAL_ENDPOINTS")
 
 	expectedMainEndpoint := Endpoint{
+		configKeys:       &logsConfigDefaultKeys,
 		APIKey:           "123",
+		Transport:        TransportTCP,
 		Host:             "agent-http-intake.logs.datadoghq.com",
 		Port:             443,
 		UseSSL:           true,
 		UseCompression:   false,
 		CompressionLevel: 0,
+		CompressionKind:  "gzip",
 		ProxyAddress:     "proxy.test:3128"}
 	expectedAdditionalEndpoint := Endpoint{
-		APIKey:           "456",
+		APIKey:           "00000000000000000000000000000456",
+		Transport:        TransportTCP,
 		Host:             "additional.endpoint",
 		Port:             1234,
 		UseSSL:           true,
 		UseCompression:   false,
 		CompressionLevel: 0,
+		CompressionKind:  "gzip",
 		ProxyAddress:     "proxy.test:3128"}
 
 	expectedEndpoints := NewEndpoints(expectedMainEndpoint, []Endpoint{expectedAdditionalEndpoint}, true, false, 0, 0)
@@ -228,13 +241,13 @@ func (suite *ConfigTestSuite) TestMultipleHttpEndpointsInConfig() {
 	suite.config.Set("logs_config.logs_no_ssl", false)
 	endpointsInConfig := []map[string]interface{}{
 		{
-			"api_key":           "456     \n\n",
+			"api_key":           "00000000000000000000000000000456     \n\n",
 			"host":              "additional.endpoint.1",
 			"port":              1234,
 			"use_compression":   true,
 			"compression_level": 2},
 		{
-			"api_key":           "789",
+			"api_key":           "00000000000000000000000000000789",
 			"host":              "additional.endpoint.2",
 			"port":              1234,
 			"use_compression":   true,
@@ -243,28 +256,36 @@ func (suite *ConfigTestSuite) TestMultipleHttpEndpointsInConfig() {
 	suite.config.Set("logs_config.additional_endpoints", endpointsInConfig)
 
 	expectedMainEndpoint := Endpoint{
+		configKeys:       &logsConfigDefaultKeys,
 		APIKey:           "123",
+		Transport:        TransportHTTP,
 		Host:             "agent-http-intake.logs.datadoghq.com",
 		Port:             443,
 		UseSSL:           true,
 		UseCompression:   true,
-		CompressionLevel: 6}
+		CompressionLevel: 6,
+		CompressionKind:  "gzip"}
 	expectedAdditionalEndpoint1 := Endpoint{
-		APIKey:           "456",
+		APIKey:           "00000000000000000000000000000456",
+		Transport:        TransportHTTP,
 		Host:             "additional.endpoint.1",
 		Port:             1234,
 		UseSSL:           true,
 		UseCompression:   true,
-		CompressionLevel: 2}
+		CompressionLevel: 2,
+		CompressionKind:  "gzip"}
 	expectedAdditionalEndpoint2 := Endpoint{
-		APIKey:           "789",
+		APIKey:           "00000000000000000000000000000789",
+		Transport:        TransportHTTP,
 		Host:             "additional.endpoint.2",
 		Port:             1234,
 		UseSSL:           true,
 		UseCompression:   true,
-		CompressionLevel: 2}
+		CompressionLevel: 2,
+		CompressionKind:  "gzip"}
 
 	expectedEndpoints := NewEndpoints(expectedMainEndpoint, []Endpoint{expectedAdditionalEndpoint1, expectedAdditionalEndpoint2}, false, true, time.Second, 0)
+	expectedEndpoints.BatchMaxContentSize = coreConfig.DefaultBatchMaxContentSize
 	endpoints, err := BuildHTTPEndpoints()
 
 	suite.Nil(err)
@@ -280,27 +301,32 @@ func (suite *ConfigTestSuite) TestMultipleTCPEndpointsInConf() {
 	suite.config.Set("logs_config.dev_mode_use_proto", true)
 	endpointsInConfig := []map[string]interface{}{
 		{
-			"api_key": "456",
+			"api_key": "00000000000000000000000000000456",
 			"host":    "additional.endpoint",
 			"port":    1234},
 	}
 	suite.config.Set("logs_config.additional_endpoints", endpointsInConfig)
 
 	expectedMainEndpoint := Endpoint{
+		configKeys:       &logsConfigDefaultKeys,
 		APIKey:           "123",
+		Transport:        TransportTCP,
 		Host:             "agent-http-intake.logs.datadoghq.com",
 		Port:             443,
 		UseSSL:           true,
 		UseCompression:   false,
 		CompressionLevel: 0,
+		CompressionKind:  "gzip",
 		ProxyAddress:     "proxy.test:3128"}
 	expectedAdditionalEndpoint := Endpoint{
-		APIKey:           "456",
+		APIKey:           "00000000000000000000000000000456",
+		Transport:        TransportTCP,
 		Host:             "additional.endpoint",
 		Port:             1234,
 		UseSSL:           true,
 		UseCompression:   false,
 		CompressionLevel: 0,
+		CompressionKind:  "gzip",
 		ProxyAddress:     "proxy.test:3128"}
 
 	expectedEndpoints := NewEndpoints(expectedMainEndpoint, []Endpoint{expectedAdditionalEndpoint}, true, false, 0, 0)
@@ -320,15 +346,19 @@ func (suite *ConfigTestSuite) TestEndpointsSetLogsDDUrl() {
 	suite.Nil(err)
 
 	expectedEndpoints := &Endpoints{
-		UseHTTP:   true,
-		BatchWait: coreConfig.DefaultBatchWait * time.Second,
+		UseHTTP:             true,
+		BatchWait:           coreConfig.DefaultBatchWait * time.Second,
+		BatchMaxContentSize: coreConfig.DefaultBatchMaxContentSize,
 		Main: Endpoint{
+			configKeys:       &logsConfig,
 			APIKey:           "123",
+			Transport:        TransportHTTP,
 			Host:             "my-proxy",
 			Port:             443,
 			UseSSL:           true,
 			UseCompression:   true,
 			CompressionLevel: 6,
+			CompressionKind:  "gzip",
 		},
 	}
 
@@ -351,15 +381,19 @@ func (suite *ConfigTestSuite) TestEndpointsSetDDSite() {
 	suite.Nil(err)
 
 	expectedEndpoints := &Endpoints{
-		UseHTTP:   true,
-		BatchWait: 10 * time.Second,
+		UseHTTP:             true,
+		BatchWait:           10 * time.Second,
+		BatchMaxContentSize: coreConfig.DefaultBatchMaxContentSize,
 		Main: Endpoint{
+			configKeys:       &logsConfig,
 			APIKey:           "123",
+			Transport:        TransportHTTP,
 			Host:             "default-intake.logs.mydomain.com",
 			Port:             0,
 			UseSSL:           true,
 			UseCompression:   true,
 			CompressionLevel: 6,
+			CompressionKind:  "gzip",
 		},
 	}
 
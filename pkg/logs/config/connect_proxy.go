@@ -0,0 +1,124 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016-present Datadog, Inc.
+
+package config
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"golang.org/x/net/proxy"
+)
+
+// DialContext connects to a TCP endpoint, or to its socket, through its SOCKS5 proxy if any, which
+// takes precedence, or its HTTP CONNECT proxy. The SSL handshake is left to the caller.
+func (e Endpoint) DialContext(ctx context.Context) (net.Conn, error) {
+	address := endpointAddress(e, false)
+	switch {
+	case e.Transport == TransportUnix:
+		var dialer net.Dialer
+		return dialer.DialContext(ctx, "unix", address)
+	case e.ProxyAddress != "":
+		var auth *proxy.Auth
+		if e.ProxyUser != "" {
+			auth = &proxy.Auth{
+				User:     e.ProxyUser,
+				Password: e.ProxyPassword,
+			}
+		}
+		dialer, err := proxy.SOCKS5("tcp", e.ProxyAddress, auth, proxy.Direct)
+		if err != nil {
+			return nil, err
+		}
+		if contextDialer, ok := dialer.(proxy.ContextDialer); ok {
+			return contextDialer.DialContext(ctx, "tcp", address)
+		}
+		return dialer.Dial("tcp", address)
+	case e.ConnectProxyAddress != "":
+		return dialConnectProxy(ctx, e.ConnectProxyAddress, address)
+	default:
+		var dialer net.Dialer
+		return dialer.DialContext(ctx, "tcp", address)
+	}
+}
+
+// dialConnectProxy opens a tunnel to address through an HTTP proxy with the CONNECT method.
+// The proxy is either an address '<HOST>:<PORT>' or an URL, its credentials are used for basic authentication.
+func dialConnectProxy(ctx context.Context, proxyAddress string, address string) (net.Conn, error) {
+	proxyURL, err := parseProxyURL(proxyAddress)
+	if err != nil {
+		return nil, err
+	}
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", proxyURL.Host)
+	if err != nil {
+		return nil, err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+
+	req := &http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Opaque: address},
+		Host:   address,
+		Header: make(http.Header),
+	}
+	if proxyURL.User != nil {
+		password, _ := proxyURL.User.Password()
+		credentials := base64.StdEncoding.EncodeToString([]byte(proxyURL.User.Username() + ":" + password))
+		req.Header.Set("Proxy-Authorization", "Basic "+credentials)
+	}
+	if err = req.Write(conn); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	// the intake doesn't send anything before the agent, nothing is buffered past the response
+	resp, err := http.ReadResponse(bufio.NewReader(conn), req)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		conn.Close()
+		return nil, fmt.Errorf("HTTP CONNECT proxy %s refused the tunnel to %s: %s", proxyURL.Host, address, resp.Status)
+	}
+
+	_ = conn.SetDeadline(time.Time{})
+	return conn, nil
+}
+
+func parseProxyURL(proxyAddress string) (*url.URL, error) {
+	if !strings.Contains(proxyAddress, "://") {
+		proxyAddress = "http://" + proxyAddress
+	}
+	proxyURL, err := url.Parse(proxyAddress)
+	if err != nil {
+		return nil, fmt.Errorf("invalid HTTP CONNECT proxy: %v", err)
+	}
+	if proxyURL.Port() == "" {
+		proxyURL.Host = net.JoinHostPort(proxyURL.Hostname(), "80")
+	}
+	return proxyURL, nil
+}
+
+// RedactProxyURL removes the credentials of the proxy so that it can be logged.
+func RedactProxyURL(proxyAddress string) string {
+	proxyURL, err := parseProxyURL(proxyAddress)
+	if err != nil {
+		return ""
+	}
+	return proxyURL.Host
+}
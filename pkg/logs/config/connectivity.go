@@ -0,0 +1,138 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016-present Datadog, Inc.
+
+package config
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	httputils "github.com/DataDog/datadog-agent/pkg/util/http"
+	"github.com/DataDog/datadog-agent/pkg/util/log"
+)
+
+// CheckEndpointsConnectivity checks that every endpoint can be reached and returns their status keyed by
+// the position of the endpoint followed by its description, e.g. "1 host=... api_key=***", the main endpoint
+// coming first then the additional and the mirror endpoints. Several endpoints may share a description,
+// e.g. with API keys only differing by their masked part.
+// HTTP endpoints are checked with a request going through the agent proxy settings and presenting the client
+// certificate if any, TCP endpoints are dialed, through the SOCKS5 proxy if any, and the SSL handshake is
+// performed like the TCP destinations do when enabled.
+func CheckEndpointsConnectivity(endpoints *Endpoints, timeout time.Duration) map[string]HTTPConnectivity {
+	all := make([]Endpoint, 0, 1+len(endpoints.Additionals)+len(endpoints.Mirrors))
+	all = append(all, endpoints.Main)
+	all = append(all, endpoints.Additionals...)
+	all = append(all, endpoints.Mirrors...)
+	connectivity := make(map[string]HTTPConnectivity, len(all))
+
+	var mutex sync.Mutex
+	var wg sync.WaitGroup
+	for i, endpoint := range all {
+		wg.Add(1)
+		go func(i int, endpoint Endpoint) {
+			defer wg.Done()
+			address := endpointAddress(endpoint, endpoints.UseHTTP)
+			var err error
+			if endpoints.UseHTTP {
+				err = checkHTTPEndpoint(endpoint, address, timeout)
+			} else {
+				err = checkTCPEndpoint(endpoint, timeout)
+			}
+			status := HTTPConnectivitySuccess
+			if err != nil {
+				log.Warnf("Logs endpoint %s is not reachable: %v", endpoint, err)
+				status = HTTPConnectivityFailure
+			}
+			mutex.Lock()
+			connectivity[connectivityKey(i, endpoint)] = status
+			mutex.Unlock()
+		}(i, endpoint)
+	}
+	wg.Wait()
+	return connectivity
+}
+
+// connectivityKey returns the key of the status of an endpoint, the description masks the API key.
+func connectivityKey(i int, endpoint Endpoint) string {
+	return fmt.Sprintf("%d %s", i, endpoint)
+}
+
+// endpointAddress returns the address dialed to reach the endpoint.
+func endpointAddress(endpoint Endpoint, useHTTP bool) string {
+	if endpoint.Transport == TransportUnix {
+		return endpoint.SocketPath
+	}
+	port := endpoint.Port
+	if useHTTP && port == 0 {
+		port = 80
+		if endpoint.UseSSL {
+			port = 443
+		}
+	}
+	return net.JoinHostPort(endpoint.Host, strconv.Itoa(port))
+}
+
+func checkHTTPEndpoint(endpoint Endpoint, address string, timeout time.Duration) error {
+	scheme := "http"
+	if endpoint.UseSSL {
+		scheme = "https"
+	}
+	transport := httputils.CreateHTTPTransport()
+	rootCAs, err := endpoint.RootCAs()
+	if err != nil {
+		return err
+	}
+	if rootCAs != nil {
+		transport.TLSClientConfig.RootCAs = rootCAs
+	}
+	certs, err := endpoint.ClientCertificates()
+	if err != nil {
+		return err
+	}
+	transport.TLSClientConfig.Certificates = certs
+	client := &http.Client{
+		Timeout:   timeout,
+		Transport: transport,
+	}
+	req, err := http.NewRequest("HEAD", fmt.Sprintf("%s://%s/", scheme, address), nil)
+	if err != nil {
+		return err
+	}
+	// any response, even an error status, means the intake could be reached.
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+func checkTCPEndpoint(endpoint Endpoint, timeout time.Duration) error {
+	// dialed like the TCP destinations do
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	conn, err := endpoint.DialContext(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if !endpoint.UseSSL {
+		return nil
+	}
+	if err = conn.SetDeadline(time.Now().Add(timeout)); err != nil {
+		return err
+	}
+	tlsConfig, err := endpoint.TLSConfig()
+	if err != nil {
+		return err
+	}
+	return tls.Client(conn, tlsConfig).Handshake()
+}
@@ -0,0 +1,269 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016-present Datadog, Inc.
+
+package config
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	coreConfig "github.com/DataDog/datadog-agent/pkg/config"
+)
+
+func hostPort(t *testing.T, address string) (string, int) {
+	host, portString, err := net.SplitHostPort(address)
+	require.NoError(t, err)
+	port, err := strconv.Atoi(portString)
+	require.NoError(t, err)
+	return host, port
+}
+
+func TestCheckEndpointsConnectivityTCP(t *testing.T) {
+	coreConfig.Mock()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+
+	closed, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	closedAddress := closed.Addr().String()
+	closed.Close()
+
+	host, port := hostPort(t, listener.Addr().String())
+	closedHost, closedPort := hostPort(t, closedAddress)
+	endpoints := NewEndpoints(
+		Endpoint{Host: host, Port: port},
+		[]Endpoint{{Host: closedHost, Port: closedPort}},
+		false, false, 0, 0)
+
+	connectivity := CheckEndpointsConnectivity(endpoints, time.Second)
+	assert.Equal(t, map[string]HTTPConnectivity{
+		connectivityKey(0, endpoints.Main):           HTTPConnectivitySuccess,
+		connectivityKey(1, endpoints.Additionals[0]): HTTPConnectivityFailure,
+	}, connectivity)
+}
+
+func TestCheckEndpointsConnectivitySameAddress(t *testing.T) {
+	coreConfig.Mock()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+
+	// the endpoints only differ by their API key, e.g. to send the logs to two organizations
+	host, port := hostPort(t, listener.Addr().String())
+	endpoints := NewEndpoints(
+		Endpoint{APIKey: "foo", Host: host, Port: port},
+		[]Endpoint{{APIKey: "bar", Host: host, Port: port}},
+		false, false, 0, 0)
+
+	connectivity := CheckEndpointsConnectivity(endpoints, time.Second)
+	assert.Equal(t, map[string]HTTPConnectivity{
+		connectivityKey(0, endpoints.Main):           HTTPConnectivitySuccess,
+		connectivityKey(1, endpoints.Additionals[0]): HTTPConnectivitySuccess,
+	}, connectivity)
+}
+
+func TestCheckEndpointsConnectivitySSLTimeout(t *testing.T) {
+	coreConfig.Mock()
+
+	// the listener accepts connections but never answers the SSL handshake.
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+
+	host, port := hostPort(t, listener.Addr().String())
+	endpoints := NewEndpoints(Endpoint{Host: host, Port: port, UseSSL: true}, nil, false, false, 0, 0)
+
+	start := time.Now()
+	connectivity := CheckEndpointsConnectivity(endpoints, 100*time.Millisecond)
+	assert.Equal(t, HTTPConnectivityFailure, connectivity[connectivityKey(0, endpoints.Main)])
+	assert.True(t, time.Since(start) < 5*time.Second)
+}
+
+func TestCheckEndpointsConnectivityHTTPS(t *testing.T) {
+	mockConfig := coreConfig.Mock()
+	mockConfig.Set("skip_ssl_validation", true)
+
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	defer server.Close()
+
+	host, port := hostPort(t, server.Listener.Addr().String())
+	endpoints := NewEndpoints(Endpoint{Host: host, Port: port, UseSSL: true}, nil, false, true, 0, 0)
+
+	connectivity := CheckEndpointsConnectivity(endpoints, time.Second)
+	assert.Equal(t, HTTPConnectivitySuccess, connectivity[connectivityKey(0, endpoints.Main)])
+
+	// the certificate of the test server can't be verified.
+	mockConfig.Set("skip_ssl_validation", false)
+	connectivity = CheckEndpointsConnectivity(endpoints, time.Second)
+	assert.Equal(t, HTTPConnectivityFailure, connectivity[connectivityKey(0, endpoints.Main)])
+
+	// the TCP destinations don't skip the certificate validation
+	mockConfig.Set("skip_ssl_validation", true)
+	endpoints.UseHTTP = false
+	connectivity = CheckEndpointsConnectivity(endpoints, time.Second)
+	assert.Equal(t, HTTPConnectivityFailure, connectivity[connectivityKey(0, endpoints.Main)])
+}
+
+func TestCheckEndpointsConnectivityWithCACertFile(t *testing.T) {
+	coreConfig.Mock()
+
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	caCertPath := filepath.Join(t.TempDir(), "ca.pem")
+	err := ioutil.WriteFile(caCertPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}), 0600)
+	require.NoError(t, err)
+
+	host, port := hostPort(t, server.Listener.Addr().String())
+	endpoints := NewEndpoints(Endpoint{Host: host, Port: port, UseSSL: true, CACertPath: caCertPath}, nil, false, true, 0, 0)
+	connectivity := CheckEndpointsConnectivity(endpoints, time.Second)
+	assert.Equal(t, HTTPConnectivitySuccess, connectivity[connectivityKey(0, endpoints.Main)])
+
+	endpoints.UseHTTP = false
+	connectivity = CheckEndpointsConnectivity(endpoints, time.Second)
+	assert.Equal(t, HTTPConnectivitySuccess, connectivity[connectivityKey(0, endpoints.Main)])
+}
+
+// writeClientCert writes a self-signed client certificate and its key to dir, and returns their paths
+func writeClientCert(t *testing.T, dir string) (*x509.Certificate, string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "logs-agent"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	certPath, keyPath := filepath.Join(dir, "client.crt"), filepath.Join(dir, "client.key")
+	require.NoError(t, ioutil.WriteFile(certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600))
+	require.NoError(t, ioutil.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600))
+	return cert, certPath, keyPath
+}
+
+func TestCheckEndpointsConnectivityClientCert(t *testing.T) {
+	mockConfig := coreConfig.Mock()
+	mockConfig.Set("skip_ssl_validation", true)
+
+	dir := t.TempDir()
+	cert, certPath, keyPath := writeClientCert(t, dir)
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(cert)
+
+	// the intake requires a client certificate
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	server.TLS = &tls.Config{ClientAuth: tls.RequireAndVerifyClientCert, ClientCAs: clientCAs}
+	server.StartTLS()
+	defer server.Close()
+
+	host, port := hostPort(t, server.Listener.Addr().String())
+	endpoints := NewEndpoints(Endpoint{Host: host, Port: port, UseSSL: true, ClientCertPath: certPath, ClientKeyPath: keyPath}, nil, false, true, 0, 0)
+	connectivity := CheckEndpointsConnectivity(endpoints, time.Second)
+	assert.Equal(t, HTTPConnectivitySuccess, connectivity[connectivityKey(0, endpoints.Main)])
+
+	endpoints = NewEndpoints(Endpoint{Host: host, Port: port, UseSSL: true}, nil, false, true, 0, 0)
+	connectivity = CheckEndpointsConnectivity(endpoints, time.Second)
+	assert.Equal(t, HTTPConnectivityFailure, connectivity[connectivityKey(0, endpoints.Main)])
+
+	// a missing certificate fails the check rather than being ignored
+	endpoints = NewEndpoints(Endpoint{Host: host, Port: port, UseSSL: true, ClientCertPath: filepath.Join(dir, "missing.crt"), ClientKeyPath: keyPath}, nil, false, true, 0, 0)
+	connectivity = CheckEndpointsConnectivity(endpoints, time.Second)
+	assert.Equal(t, HTTPConnectivityFailure, connectivity[connectivityKey(0, endpoints.Main)])
+}
+
+func TestCheckEndpointsConnectivityConnectProxy(t *testing.T) {
+	coreConfig.Mock()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+
+	// "user:password" in base64
+	proxy := newConnectProxy(t, "Basic dXNlcjpwYXNzd29yZA==")
+	defer proxy.Close()
+
+	host, port := hostPort(t, listener.Addr().String())
+	endpoints := NewEndpoints(
+		Endpoint{Host: host, Port: port, ConnectProxyAddress: "http://user:password@" + proxy.Addr().String()},
+		[]Endpoint{{Host: host, Port: port, ConnectProxyAddress: proxy.Addr().String()}},
+		false, false, 0, 0)
+
+	// the second endpoint doesn't send the proxy credentials
+	connectivity := CheckEndpointsConnectivity(endpoints, time.Second)
+	assert.Equal(t, map[string]HTTPConnectivity{
+		connectivityKey(0, endpoints.Main):           HTTPConnectivitySuccess,
+		connectivityKey(1, endpoints.Additionals[0]): HTTPConnectivityFailure,
+	}, connectivity)
+}
@@ -6,29 +6,155 @@
 package config
 
 import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"strings"
 	"time"
 )
 
+// Compression kinds supported by the HTTP endpoints.
+const (
+	GzipCompressionKind = "gzip"
+	ZstdCompressionKind = "zstd"
+)
+
+// Transport is the network transport used to send logs to an endpoint.
+type Transport string
+
+// Transports supported by the endpoints.
+const (
+	TransportTCP  Transport = "tcp"
+	TransportHTTP Transport = "http"
+	TransportUnix Transport = "unix"
+)
+
 // Endpoint holds all the organization and network parameters to send logs to Datadog.
 type Endpoint struct {
 	APIKey                  string `mapstructure:"api_key" json:"api_key"`
 	Host                    string
 	Port                    int
-	UseSSL                  bool
-	UseCompression          bool `mapstructure:"use_compression" json:"use_compression"`
-	CompressionLevel        int  `mapstructure:"compression_level" json:"compression_level"`
+	SocketPath              string
+	Transport               Transport
+	UseSSL                  bool   `mapstructure:"use_ssl" json:"use_ssl"`
+	UseCompression          bool   `mapstructure:"use_compression" json:"use_compression"`
+	CompressionLevel        int    `mapstructure:"compression_level" json:"compression_level"`
+	CompressionKind         string `mapstructure:"compression_kind" json:"compression_kind"`
 	ProxyAddress            string
+	ProxyUser               string
+	ProxyPassword           string `json:"-"`
+	ConnectProxyAddress     string // HTTP proxy the TCP connections are tunneled through with CONNECT
 	ConnectionResetInterval time.Duration
+	ClientCertPath          string
+	ClientKeyPath           string
+	CACertPath              string
+
+	// configKeys are the keys the API key is read from, they are only set for the main endpoint
+	// so that a rotated key is picked up without rebuilding the endpoints.
+	configKeys *LogsConfigKeys
+}
+
+// GetAPIKey returns the API key to send logs with, it is read from the configuration
+// on every call when the endpoint was built from it.
+func (e Endpoint) GetAPIKey() string {
+	if e.configKeys != nil {
+		return e.configKeys.GetAPIKey()
+	}
+	return e.APIKey
+}
+
+// RootCAs returns the certificate pool used to verify the intake certificate,
+// nil means that the system pool is used.
+func (e Endpoint) RootCAs() (*x509.CertPool, error) {
+	if e.CACertPath == "" {
+		return nil, nil
+	}
+	pem, err := ioutil.ReadFile(e.CACertPath)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no certificate found in %s", e.CACertPath)
+	}
+	return pool, nil
+}
+
+// TLSConfig returns the configuration of the SSL connections of the TCP destinations.
+func (e Endpoint) TLSConfig() (*tls.Config, error) {
+	rootCAs, err := e.RootCAs()
+	if err != nil {
+		return nil, err
+	}
+	return &tls.Config{
+		ServerName: e.Host,
+		RootCAs:    rootCAs,
+	}, nil
+}
+
+// ClientCertificates returns the client certificate presented to the intake, if any.
+// It's loaded on every call so that it can be rotated on disk.
+func (e Endpoint) ClientCertificates() ([]tls.Certificate, error) {
+	if e.ClientCertPath == "" {
+		return nil, nil
+	}
+	cert, err := tls.LoadX509KeyPair(e.ClientCertPath, e.ClientKeyPath)
+	if err != nil {
+		return nil, err
+	}
+	return []tls.Certificate{cert}, nil
+}
+
+// String returns a description of the endpoint safe to log, the API key is masked.
+func (e Endpoint) String() string {
+	var b strings.Builder
+	if e.Transport == TransportUnix {
+		fmt.Fprintf(&b, "socket=%s", e.SocketPath)
+	} else {
+		fmt.Fprintf(&b, "host=%s port=%d ssl=%t", e.Host, e.Port, e.UseSSL)
+	}
+	fmt.Fprintf(&b, " transport=%s compression=%t", e.Transport, e.UseCompression)
+	if e.UseCompression {
+		fmt.Fprintf(&b, " compression_kind=%s compression_level=%d", e.CompressionKind, e.CompressionLevel)
+	}
+	if e.ProxyAddress != "" {
+		fmt.Fprintf(&b, " proxy=%s", e.ProxyAddress)
+	}
+	fmt.Fprintf(&b, " api_key=%s", maskAPIKey(e.APIKey))
+	return b.String()
+}
+
+// equal returns true if both endpoints send logs to the same place with the same settings.
+// The API keys are compared with their current value.
+func (e Endpoint) equal(other Endpoint) bool {
+	e.APIKey, other.APIKey = e.GetAPIKey(), other.GetAPIKey()
+	e.configKeys, other.configKeys = nil, nil
+	return e == other
+}
+
+// maskAPIKey only keeps the last 4 characters of an API key.
+func maskAPIKey(apiKey string) string {
+	const visible = 4
+	if len(apiKey) <= visible {
+		return strings.Repeat("*", len(apiKey))
+	}
+	return strings.Repeat("*", len(apiKey)-visible) + apiKey[len(apiKey)-visible:]
 }
 
 // Endpoints holds the main endpoint and additional ones to dualship logs.
 type Endpoints struct {
-	Main                   Endpoint
-	Additionals            []Endpoint
+	Main        Endpoint
+	Additionals []Endpoint
+	// Mirrors are fully independent endpoints, e.g. of another site, which receive a copy of all the logs.
+	// Unlike the additional endpoints, they don't inherit any setting of the main endpoint.
+	Mirrors                []Endpoint
 	UseProto               bool
 	UseHTTP                bool
 	BatchWait              time.Duration
 	BatchMaxConcurrentSend int
+	// BatchMaxContentSize is the maximum size in bytes of the content of a batch, 0 means the default size.
+	BatchMaxContentSize int
 }
 
 // NewEndpoints returns a new endpoints composite.
@@ -42,3 +168,78 @@ func NewEndpoints(main Endpoint, additionals []Endpoint, useProto bool, useHTTP
 		BatchMaxConcurrentSend: batchMaxConcurrentSend,
 	}
 }
+
+// RefreshAPIKey reads the API key of the main endpoint from the configuration again,
+// it is meant to be called on a config change without rebuilding the endpoints.
+func (e *Endpoints) RefreshAPIKey() {
+	e.Main.APIKey = e.Main.GetAPIKey()
+}
+
+// ForSource returns the endpoints the logs of a source are sent to. When the source config sets an API key,
+// it is used by a copy of the main endpoint instead of the global one, the additional endpoints and the mirrors
+// keep their own keys. The endpoints are returned as is otherwise.
+func (e *Endpoints) ForSource(c *LogsConfig) *Endpoints {
+	if c == nil || c.GetAPIKey() == "" {
+		return e
+	}
+	endpoints := *e
+	endpoints.Main.APIKey = c.GetAPIKey()
+	// the key isn't read from the configuration anymore
+	endpoints.Main.configKeys = nil
+	return &endpoints
+}
+
+// Equal returns true if both endpoints are configured the same way, so that the senders built
+// for one of them can be kept for the other. The additional endpoints and the mirrors are compared
+// regardless of their order.
+func (e *Endpoints) Equal(other *Endpoints) bool {
+	if e == nil || other == nil {
+		return e == other
+	}
+	return e.Main.equal(other.Main) &&
+		sameEndpoints(e.Additionals, other.Additionals) &&
+		sameEndpoints(e.Mirrors, other.Mirrors) &&
+		e.UseProto == other.UseProto &&
+		e.UseHTTP == other.UseHTTP &&
+		e.BatchWait == other.BatchWait &&
+		e.BatchMaxConcurrentSend == other.BatchMaxConcurrentSend &&
+		e.BatchMaxContentSize == other.BatchMaxContentSize
+}
+
+// sameEndpoints returns true if both lists hold the same endpoints, whatever their order
+func sameEndpoints(a, b []Endpoint) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	matched := make([]bool, len(b))
+	for _, endpoint := range a {
+		found := false
+		for i := range b {
+			if !matched[i] && endpoint.equal(b[i]) {
+				matched[i], found = true, true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// String returns a description of the endpoints safe to log, the API keys are masked.
+func (e *Endpoints) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "main={%s}", e.Main)
+	for _, additional := range e.Additionals {
+		fmt.Fprintf(&b, " additional={%s}", additional)
+	}
+	for _, mirror := range e.Mirrors {
+		fmt.Fprintf(&b, " mirror={%s}", mirror)
+	}
+	fmt.Fprintf(&b, " use_http=%t use_proto=%t", e.UseHTTP, e.UseProto)
+	if e.UseHTTP {
+		fmt.Fprintf(&b, " batch_wait=%v batch_max_concurrent_send=%d batch_max_content_size=%d", e.BatchWait, e.BatchMaxConcurrentSend, e.BatchMaxContentSize)
+	}
+	return b.String()
+}
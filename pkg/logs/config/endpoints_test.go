@@ -6,12 +6,21 @@
 package config
 
 import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
 	"testing"
 	"time"
 
+	"github.com/cihub/seelog"
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/suite"
 
 	coreConfig "github.com/DataDog/datadog-agent/pkg/config"
+	"github.com/DataDog/datadog-agent/pkg/util/log"
 )
 
 type EndpointsTestSuite struct {
@@ -166,6 +175,48 @@ func (suite *EndpointsTestSuite) TestBuildEndpointsShouldSucceedWithValidHTTPCon
 	suite.Equal(endpoint.CompressionLevel, 1)
 }
 
+func (suite *EndpointsTestSuite) TestBuildEndpointsShouldSucceedWithValidCompressionKind() {
+	suite.config.Set("logs_config.use_http", true)
+	suite.config.Set("logs_config.additional_endpoints", []map[string]interface{}{
+		{
+			"host":    "foo",
+			"port":    10516,
+			"api_key": "00000000000000000000000000001234",
+		},
+	})
+
+	endpoints, err := BuildEndpoints(HTTPConnectivityFailure)
+	suite.Nil(err)
+	suite.Equal(GzipCompressionKind, endpoints.Main.CompressionKind)
+	suite.Equal(GzipCompressionKind, endpoints.Additionals[0].CompressionKind)
+
+	suite.config.Set("logs_config.compression_kind", "zstd")
+	endpoints, err = BuildEndpoints(HTTPConnectivityFailure)
+	suite.Nil(err)
+	suite.Equal(ZstdCompressionKind, endpoints.Main.CompressionKind)
+	suite.Equal(ZstdCompressionKind, endpoints.Additionals[0].CompressionKind)
+
+	suite.config.Set("logs_config.use_http", false)
+	suite.config.Set("logs_config.use_tcp", true)
+	endpoints, err = BuildEndpoints(HTTPConnectivityFailure)
+	suite.Nil(err)
+	suite.False(endpoints.UseHTTP)
+	suite.Equal(ZstdCompressionKind, endpoints.Main.CompressionKind)
+	suite.Equal(ZstdCompressionKind, endpoints.Additionals[0].CompressionKind)
+}
+
+func (suite *EndpointsTestSuite) TestBuildEndpointsShouldFallbackOnGzipWithInvalidCompressionKind() {
+	suite.config.Set("logs_config.use_http", true)
+
+	invalidCompressionKinds := []string{"", "brotli", "ZSTD"}
+	for _, compressionKind := range invalidCompressionKinds {
+		suite.config.Set("logs_config.compression_kind", compressionKind)
+		endpoints, err := BuildEndpoints(HTTPConnectivityFailure)
+		suite.Nil(err)
+		suite.Equal(GzipCompressionKind, endpoints.Main.CompressionKind)
+	}
+}
+
 func (suite *EndpointsTestSuite) TestBuildEndpointsShouldSucceedWithValidHTTPConfigAndOverride() {
 	var endpoints *Endpoints
 	var endpoint Endpoint
@@ -237,6 +288,158 @@ func (suite *EndpointsTestSuite) TestBuildEndpointsShouldFallbackOnDefaultWithIn
 	}
 }
 
+func (suite *EndpointsTestSuite) TestBuildEndpointsWithBatchMaxContentSize() {
+	suite.config.Set("logs_config.use_http", true)
+
+	endpoints, err := BuildEndpoints(HTTPConnectivityFailure)
+	suite.Nil(err)
+	suite.Equal(coreConfig.DefaultBatchMaxContentSize, endpoints.BatchMaxContentSize)
+
+	suite.config.Set("logs_config.batch_max_content_size", 500000)
+	endpoints, err = BuildEndpoints(HTTPConnectivityFailure)
+	suite.Nil(err)
+	suite.Equal(500000, endpoints.BatchMaxContentSize)
+
+	logsConfig := NewLogsConfigKeys("compliance_config.endpoints.")
+	suite.config.Set("compliance_config.endpoints.batch_max_content_size", 2000000)
+	endpoints, err = BuildHTTPEndpointsWithConfig(logsConfig, "cspm-intake.")
+	suite.Nil(err)
+	suite.Equal(2000000, endpoints.BatchMaxContentSize)
+}
+
+func (suite *EndpointsTestSuite) TestBuildEndpointsShouldFallbackOnDefaultWithInvalidBatchMaxContentSize() {
+	suite.config.Set("logs_config.use_http", true)
+
+	for _, batchMaxContentSize := range []int{-1, 0, coreConfig.MaxBatchMaxContentSize + 1} {
+		var b bytes.Buffer
+		w := bufio.NewWriter(&b)
+		logger, err := seelog.LoggerFromWriterWithMinLevelAndFormat(w, seelog.WarnLvl, "[%LEVEL] %Msg\n")
+		suite.Nil(err)
+		log.SetupLogger(logger, "warn")
+
+		suite.config.Set("logs_config.batch_max_content_size", batchMaxContentSize)
+		endpoints, err := BuildEndpoints(HTTPConnectivityFailure)
+		suite.Nil(err)
+		suite.Equal(coreConfig.DefaultBatchMaxContentSize, endpoints.BatchMaxContentSize)
+
+		w.Flush()
+		suite.Contains(b.String(), fmt.Sprintf("[WARN] Invalid batch_max_content_size: %d should be in [1, %d], fallback on %d",
+			batchMaxContentSize, coreConfig.MaxBatchMaxContentSize, coreConfig.DefaultBatchMaxContentSize))
+	}
+}
+
+func (suite *EndpointsTestSuite) TestBuildEndpointsShouldSucceedWithDurationBatchWait() {
+	suite.config.Set("logs_config.use_http", true)
+
+	suite.config.Set("logs_config.batch_wait", "2s")
+	endpoints, err := BuildEndpoints(HTTPConnectivityFailure)
+	suite.Nil(err)
+	suite.Equal(2*time.Second, endpoints.BatchWait)
+
+	// legacy integer path, also used by environment variables
+	suite.config.Set("logs_config.batch_wait", "7")
+	endpoints, err = BuildEndpoints(HTTPConnectivityFailure)
+	suite.Nil(err)
+	suite.Equal(7*time.Second, endpoints.BatchWait)
+
+	// sub-second values require a lower min bound
+	suite.config.Set("logs_config.batch_wait", "500ms")
+	endpoints, err = BuildEndpoints(HTTPConnectivityFailure)
+	suite.Nil(err)
+	suite.Equal(coreConfig.DefaultBatchWait*time.Second, endpoints.BatchWait)
+
+	suite.config.Set("logs_config.batch_wait_min", "100ms")
+	endpoints, err = BuildEndpoints(HTTPConnectivityFailure)
+	suite.Nil(err)
+	suite.Equal(500*time.Millisecond, endpoints.BatchWait)
+
+	suite.config.Set("logs_config.batch_wait", 0.25)
+	endpoints, err = BuildEndpoints(HTTPConnectivityFailure)
+	suite.Nil(err)
+	suite.Equal(250*time.Millisecond, endpoints.BatchWait)
+}
+
+func (suite *EndpointsTestSuite) TestBuildEndpointsShouldRespectCustomBatchWaitBounds() {
+	suite.config.Set("logs_config.use_http", true)
+	suite.config.Set("logs_config.batch_wait_min", 10)
+	suite.config.Set("logs_config.batch_wait_max", "1m")
+
+	suite.config.Set("logs_config.batch_wait", 30)
+	endpoints, err := BuildEndpoints(HTTPConnectivityFailure)
+	suite.Nil(err)
+	suite.Equal(30*time.Second, endpoints.BatchWait)
+
+	// out of the custom bounds, fallback on the default clamped within the bounds
+	invalidBatchWaits := []interface{}{5, "2m", "foo"}
+	for _, batchWait := range invalidBatchWaits {
+		suite.config.Set("logs_config.batch_wait", batchWait)
+		endpoints, err = BuildEndpoints(HTTPConnectivityFailure)
+		suite.Nil(err)
+		suite.Equal(10*time.Second, endpoints.BatchWait)
+	}
+
+	// invalid bounds, fallback on the default bounds
+	suite.config.Set("logs_config.batch_wait_min", 20)
+	suite.config.Set("logs_config.batch_wait_max", 15)
+	suite.config.Set("logs_config.batch_wait", 9)
+	endpoints, err = BuildEndpoints(HTTPConnectivityFailure)
+	suite.Nil(err)
+	suite.Equal(9*time.Second, endpoints.BatchWait)
+}
+
+func (suite *EndpointsTestSuite) TestBuildEndpointsShouldClampConnectionResetInterval() {
+	suite.config.Set("logs_config.use_http", true)
+
+	for _, test := range []struct {
+		value    interface{}
+		expected time.Duration
+	}{
+		{value: 0, expected: 0},
+		{value: -10, expected: 0},
+		{value: 300, expected: 300 * time.Second},
+		{value: coreConfig.DefaultConnectionResetIntervalMax + 1, expected: coreConfig.DefaultConnectionResetIntervalMax * time.Second},
+		{value: math.MaxInt64, expected: coreConfig.DefaultConnectionResetIntervalMax * time.Second},
+	} {
+		suite.config.Set("logs_config.connection_reset_interval", test.value)
+		endpoints, err := BuildEndpoints(HTTPConnectivityFailure)
+		suite.Nil(err)
+		suite.Equal(test.expected, endpoints.Main.ConnectionResetInterval, "%v", test.value)
+	}
+
+	// the TCP endpoints are clamped the same way
+	suite.config.Set("logs_config.use_http", false)
+	suite.config.Set("logs_config.use_tcp", true)
+	suite.config.Set("logs_config.connection_reset_interval", -1)
+	endpoints, err := BuildEndpoints(HTTPConnectivityFailure)
+	suite.Nil(err)
+	suite.Equal(time.Duration(0), endpoints.Main.ConnectionResetInterval)
+}
+
+func (suite *EndpointsTestSuite) TestBuildEndpointsShouldRespectCustomConnectionResetIntervalBounds() {
+	suite.config.Set("logs_config.use_http", true)
+	suite.config.Set("logs_config.connection_reset_interval_min", 60)
+	suite.config.Set("logs_config.connection_reset_interval_max", "1h")
+
+	for value, expected := range map[int]time.Duration{
+		10:   time.Minute,
+		600:  10 * time.Minute,
+		7200: time.Hour,
+	} {
+		suite.config.Set("logs_config.connection_reset_interval", value)
+		endpoints, err := BuildEndpoints(HTTPConnectivityFailure)
+		suite.Nil(err)
+		suite.Equal(expected, endpoints.Main.ConnectionResetInterval, "%d", value)
+	}
+
+	// invalid bounds, fallback on the default bounds
+	suite.config.Set("logs_config.connection_reset_interval_min", 120)
+	suite.config.Set("logs_config.connection_reset_interval_max", 60)
+	suite.config.Set("logs_config.connection_reset_interval", 90)
+	endpoints, err := BuildEndpoints(HTTPConnectivityFailure)
+	suite.Nil(err)
+	suite.Equal(90*time.Second, endpoints.Main.ConnectionResetInterval)
+}
+
 //When migrating the agent v5 to v6, logs_dd_url is set to empty. Default to the dd_url/site already set instead.
 func (suite *EndpointsTestSuite) TestBuildEndpointsShouldSucceedWhenMigratingToAgentV6() {
 	suite.config.Set("logs_config.logs_dd_url", "")
@@ -295,7 +498,7 @@ func (suite *EndpointsTestSuite) TestBuildEndpointsShouldTakeIntoAccountHTTPConn
 	suite.config.Set("logs_config.additional_endpoints", []map[string]interface{}{
 		{
 			"host":              "foo",
-			"api_key":           "1234",
+			"api_key":           "00000000000000000000000000001234",
 			"use_compression":   true,
 			"compression_level": 1,
 		},
@@ -333,6 +536,47 @@ func (suite *EndpointsTestSuite) TestOverrideApiKey() {
 	suite.Equal("wassuplogskey", endpoints.Main.APIKey)
 }
 
+func (suite *EndpointsTestSuite) TestAPIKeyIsReadOnEveryCall() {
+	suite.config.Set("api_key", "wassupkey")
+	endpoints, err := BuildEndpoints(HTTPConnectivityFailure)
+	suite.Nil(err)
+	suite.Equal("wassupkey", endpoints.Main.GetAPIKey())
+
+	suite.config.Set("api_key", " rotatedkey\n")
+	suite.Equal("rotatedkey", logsConfigDefaultKeys.GetAPIKey())
+	suite.Equal("rotatedkey", endpoints.Main.GetAPIKey())
+	suite.Equal("wassupkey", endpoints.Main.APIKey)
+
+	endpoints.RefreshAPIKey()
+	suite.Equal("rotatedkey", endpoints.Main.APIKey)
+
+	suite.config.Set("logs_config.api_key", "wassuplogskey")
+	suite.Equal("wassuplogskey", endpoints.Main.GetAPIKey())
+}
+
+func (suite *EndpointsTestSuite) TestHTTPAPIKeyIsReadOnEveryCall() {
+	suite.config.Set("api_key", "wassupkey")
+	logsConfig := NewLogsConfigKeys("compliance_config.endpoints.")
+	endpoints, err := BuildHTTPEndpointsWithConfig(logsConfig, "cspm-intake.")
+	suite.Nil(err)
+	suite.Equal("wassupkey", endpoints.Main.GetAPIKey())
+
+	suite.config.Set("logs_config.api_key", "wassuplogskey ")
+	suite.Equal("wassuplogskey", logsConfig.GetAPIKey())
+	suite.Equal("wassuplogskey", endpoints.Main.GetAPIKey())
+
+	// the key isn't read with the prefix of the endpoints
+	suite.config.Set("compliance_config.endpoints.api_key", "compliancekey")
+	suite.Equal("wassuplogskey", endpoints.Main.GetAPIKey())
+}
+
+func (suite *EndpointsTestSuite) TestAdditionalEndpointsAPIKeyIsStatic() {
+	suite.config.Set("api_key", "wassupkey")
+	suite.Equal("wassupkey", Endpoint{APIKey: "wassupkey"}.GetAPIKey())
+	suite.config.Set("api_key", "rotatedkey")
+	suite.Equal("wassupkey", Endpoint{APIKey: "wassupkey"}.GetAPIKey())
+}
+
 func (suite *EndpointsTestSuite) TestAdditionalEndpoints() {
 	var (
 		endpoints *Endpoints
@@ -343,7 +587,8 @@ func (suite *EndpointsTestSuite) TestAdditionalEndpoints() {
 	suite.config.Set("logs_config.additional_endpoints", []map[string]interface{}{
 		{
 			"host":              "foo",
-			"api_key":           "1234",
+			"port":              10516,
+			"api_key":           "00000000000000000000000000001234",
 			"use_compression":   true,
 			"compression_level": 1,
 		},
@@ -355,7 +600,7 @@ func (suite *EndpointsTestSuite) TestAdditionalEndpoints() {
 
 	endpoint = endpoints.Additionals[0]
 	suite.Equal("foo", endpoint.Host)
-	suite.Equal("1234", endpoint.APIKey)
+	suite.Equal("00000000000000000000000000001234", endpoint.APIKey)
 	suite.True(endpoint.UseSSL)
 
 	suite.config.Set("logs_config.use_http", true)
@@ -365,12 +610,755 @@ func (suite *EndpointsTestSuite) TestAdditionalEndpoints() {
 
 	endpoint = endpoints.Additionals[0]
 	suite.Equal("foo", endpoint.Host)
-	suite.Equal("1234", endpoint.APIKey)
+	suite.Equal("00000000000000000000000000001234", endpoint.APIKey)
 	suite.True(endpoint.UseCompression)
 	suite.Equal(1, endpoint.CompressionLevel)
 	suite.True(endpoint.UseSSL)
 }
 
+func (suite *EndpointsTestSuite) TestAdditionalEndpointsWithMalformedEntries() {
+	suite.config.Set("logs_config.use_http", true)
+	suite.config.Set("logs_config.additional_endpoints", []map[string]interface{}{
+		{
+			"host":    "foo",
+			"api_key": "00000000000000000000000000001234",
+		},
+		{
+			"host":              "bar",
+			"api_key":           "00000000000000000000000000005678",
+			"compression_level": "high",
+		},
+		{
+			"host":    "baz",
+			"api_key": "00000000000000000000000000009012",
+		},
+	})
+
+	endpoints, err := BuildEndpoints(HTTPConnectivityFailure)
+	suite.Nil(err)
+	suite.Len(endpoints.Additionals, 2)
+
+	endpoints, err = BuildEndpointsStrict(HTTPConnectivityFailure)
+	suite.NotNil(endpoints)
+	suite.Len(endpoints.Additionals, 2)
+	suite.Equal("foo", endpoints.Additionals[0].Host)
+	suite.Equal("baz", endpoints.Additionals[1].Host)
+
+	additionalsErr, ok := err.(*AdditionalEndpointsError)
+	suite.True(ok)
+	suite.Equal("logs_config.additional_endpoints", additionalsErr.Key)
+	suite.Len(additionalsErr.Failures, 1)
+	suite.Equal(1, additionalsErr.Failures[0].Index)
+	suite.Equal("bar", additionalsErr.Failures[0].Raw.(map[string]interface{})["host"])
+}
+
+func (suite *EndpointsTestSuite) TestAdditionalEndpointsWithMalformedJSONEntries() {
+	suite.config.Set("logs_config.additional_endpoints", `[
+	{"api_key": "00000000000000000000000000001234", "host": "foo", "port": 1234},
+	{"api_key": "00000000000000000000000000005678", "host": "bar", "port": "not-a-port"}]`)
+
+	endpoints, err := BuildEndpointsStrict(HTTPConnectivityFailure)
+	suite.NotNil(endpoints)
+	suite.False(endpoints.UseHTTP)
+	suite.Len(endpoints.Additionals, 1)
+	suite.Equal("foo", endpoints.Additionals[0].Host)
+
+	additionalsErr, ok := err.(*AdditionalEndpointsError)
+	suite.True(ok)
+	suite.Len(additionalsErr.Failures, 1)
+	suite.Equal(1, additionalsErr.Failures[0].Index)
+	suite.Contains(additionalsErr.Failures[0].Raw, "not-a-port")
+
+	suite.config.Set("logs_config.additional_endpoints", `{"api_key": "00000000000000000000000000001234", "host": "foo"`)
+	endpoints, err = BuildEndpointsStrict(HTTPConnectivityFailure)
+	suite.NotNil(endpoints)
+	suite.Len(endpoints.Additionals, 0)
+	additionalsErr, ok = err.(*AdditionalEndpointsError)
+	suite.True(ok)
+	suite.Len(additionalsErr.Failures, 1)
+	suite.Equal(-1, additionalsErr.Failures[0].Index)
+
+	endpoints, err = BuildEndpoints(HTTPConnectivityFailure)
+	suite.Nil(err)
+	suite.Len(endpoints.Additionals, 0)
+}
+
+func (suite *EndpointsTestSuite) TestBuildEndpointsShouldSucceedWithClientCertificate() {
+	suite.config.Set("logs_config.use_http", true)
+	suite.config.Set("logs_config.tls_cert_file", "/etc/datadog-agent/client.crt")
+	suite.config.Set("logs_config.tls_key_file", "/etc/datadog-agent/client.key")
+	suite.config.Set("logs_config.additional_endpoints", []map[string]interface{}{
+		{
+			"host":    "foo",
+			"api_key": "00000000000000000000000000001234",
+		},
+	})
+
+	endpoints, err := BuildEndpoints(HTTPConnectivityFailure)
+	suite.Nil(err)
+	suite.Equal("/etc/datadog-agent/client.crt", endpoints.Main.ClientCertPath)
+	suite.Equal("/etc/datadog-agent/client.key", endpoints.Main.ClientKeyPath)
+	suite.Len(endpoints.Additionals, 1)
+	suite.Equal("/etc/datadog-agent/client.crt", endpoints.Additionals[0].ClientCertPath)
+	suite.Equal("/etc/datadog-agent/client.key", endpoints.Additionals[0].ClientKeyPath)
+}
+
+func (suite *EndpointsTestSuite) TestBuildEndpointsShouldFailWithIncompleteClientCertificate() {
+	suite.config.Set("logs_config.use_http", true)
+
+	suite.config.Set("logs_config.tls_cert_file", "/etc/datadog-agent/client.crt")
+	_, err := BuildEndpoints(HTTPConnectivityFailure)
+	suite.NotNil(err)
+
+	suite.config.Set("logs_config.tls_cert_file", "")
+	suite.config.Set("logs_config.tls_key_file", "/etc/datadog-agent/client.key")
+	_, err = BuildEndpoints(HTTPConnectivityFailure)
+	suite.NotNil(err)
+}
+
+func (suite *EndpointsTestSuite) TestBuildEndpointsShouldSucceedWithSocks5ProxyAuth() {
+	suite.config.Set("logs_config.socks5_proxy_address", "boz:1234")
+	suite.config.Set("logs_config.socks5_proxy_user", "user")
+	suite.config.Set("logs_config.socks5_proxy_password", "secret")
+	suite.config.Set("logs_config.additional_endpoints", []map[string]interface{}{
+		{
+			"host":    "foo",
+			"port":    10516,
+			"api_key": "00000000000000000000000000001234",
+		},
+		{
+			"host":    "bar",
+			"port":    10516,
+			"api_key": "00000000000000000000000000005678",
+		},
+	})
+
+	endpoints, err := BuildEndpoints(HTTPConnectivitySuccess)
+	suite.Nil(err)
+	suite.False(endpoints.UseHTTP)
+	suite.Equal("boz:1234", endpoints.Main.ProxyAddress)
+	suite.Equal("user", endpoints.Main.ProxyUser)
+	suite.Equal("secret", endpoints.Main.ProxyPassword)
+	suite.Len(endpoints.Additionals, 2)
+	for _, endpoint := range endpoints.Additionals {
+		suite.Equal("boz:1234", endpoint.ProxyAddress)
+		suite.Equal("user", endpoint.ProxyUser)
+		suite.Equal("secret", endpoint.ProxyPassword)
+	}
+
+	marshalled, err := json.Marshal(endpoints)
+	suite.Nil(err)
+	suite.NotContains(string(marshalled), "secret")
+}
+
+func (suite *EndpointsTestSuite) TestBuildEndpointsShouldSucceedWithUnixSocket() {
+	suite.config.Set("api_key", "azerty")
+	suite.config.Set("logs_config.logs_dd_url", "unix:///var/run/foo.sock")
+
+	endpoints, err := BuildEndpoints(HTTPConnectivitySuccess)
+	suite.Nil(err)
+	suite.False(endpoints.UseHTTP)
+	suite.Len(endpoints.Additionals, 0)
+
+	endpoint := endpoints.Main
+	suite.Equal(TransportUnix, endpoint.Transport)
+	suite.Equal("/var/run/foo.sock", endpoint.SocketPath)
+	suite.Equal("azerty", endpoint.APIKey)
+	suite.False(endpoint.UseSSL)
+}
+
+func (suite *EndpointsTestSuite) TestBuildEndpointsShouldFailWithInvalidUnixSocket() {
+	suite.config.Set("logs_config.logs_dd_url", "unix://")
+	_, err := BuildEndpoints(HTTPConnectivityFailure)
+	suite.NotNil(err)
+
+	suite.config.Set("logs_config.logs_dd_url", "unix:///var/run/foo.sock")
+	suite.config.Set("logs_config.additional_endpoints", []map[string]interface{}{
+		{
+			"host":    "foo",
+			"api_key": "00000000000000000000000000001234",
+		},
+	})
+	_, err = BuildEndpoints(HTTPConnectivityFailure)
+	suite.NotNil(err)
+}
+
+func (suite *EndpointsTestSuite) TestBuildEndpointsShouldExpandEnvironmentVariables() {
+	os.Setenv("TEST_LOGS_HOST", "my-proxy")
+	defer os.Unsetenv("TEST_LOGS_HOST")
+
+	suite.config.Set("logs_config.logs_dd_url", "${TEST_LOGS_HOST}:10516")
+	endpoints, err := BuildEndpoints(HTTPConnectivityFailure)
+	suite.Nil(err)
+	suite.Equal("${TEST_LOGS_HOST}", endpoints.Main.Host)
+
+	suite.config.Set("logs_config.expand_env", true)
+	endpoints, err = BuildEndpoints(HTTPConnectivityFailure)
+	suite.Nil(err)
+	suite.Equal("my-proxy", endpoints.Main.Host)
+	suite.Equal(10516, endpoints.Main.Port)
+
+	suite.config.Set("logs_config.use_http", true)
+	endpoints, err = BuildEndpoints(HTTPConnectivityFailure)
+	suite.Nil(err)
+	suite.Equal("my-proxy", endpoints.Main.Host)
+	suite.Equal(10516, endpoints.Main.Port)
+
+	suite.config.Set("logs_config.logs_dd_url", "")
+	suite.config.Set("logs_config.dd_url", "$TEST_LOGS_HOST.example.com")
+	endpoints, err = BuildEndpoints(HTTPConnectivityFailure)
+	suite.Nil(err)
+	suite.Equal("my-proxy.example.com", endpoints.Main.Host)
+
+	suite.config.Set("logs_config.use_http", false)
+	suite.config.Set("logs_config.use_port_443", true)
+	suite.config.Set("logs_config.dd_url_443", "${TEST_LOGS_HOST}-443.example.com")
+	endpoints, err = BuildEndpoints(HTTPConnectivityFailure)
+	suite.Nil(err)
+	suite.Equal("my-proxy-443.example.com", endpoints.Main.Host)
+	suite.Equal(443, endpoints.Main.Port)
+}
+
+func (suite *EndpointsTestSuite) TestBuildEndpointsShouldFailWithUndefinedEnvironmentVariables() {
+	os.Unsetenv("TEST_LOGS_UNDEFINED_HOST")
+	suite.config.Set("logs_config.expand_env", true)
+	suite.config.Set("logs_config.logs_dd_url", "${TEST_LOGS_UNDEFINED_HOST}:10516")
+
+	_, err := BuildEndpoints(HTTPConnectivityFailure)
+	suite.NotNil(err)
+	suite.Contains(err.Error(), "TEST_LOGS_UNDEFINED_HOST")
+
+	suite.config.Set("logs_config.use_http", true)
+	_, err = BuildEndpoints(HTTPConnectivityFailure)
+	suite.NotNil(err)
+	suite.Contains(err.Error(), "TEST_LOGS_UNDEFINED_HOST")
+}
+
+func (suite *EndpointsTestSuite) TestBuildEndpointsShouldSucceedWithCACertFile() {
+	suite.config.Set("logs_config.ca_cert_file", "/etc/datadog-agent/ca.pem")
+	suite.config.Set("logs_config.additional_endpoints", []map[string]interface{}{
+		{
+			"host":    "foo",
+			"port":    10516,
+			"api_key": "00000000000000000000000000001234",
+		},
+	})
+
+	endpoints, err := BuildEndpoints(HTTPConnectivityFailure)
+	suite.Nil(err)
+	suite.False(endpoints.UseHTTP)
+	suite.Equal("/etc/datadog-agent/ca.pem", endpoints.Main.CACertPath)
+	suite.Equal("/etc/datadog-agent/ca.pem", endpoints.Additionals[0].CACertPath)
+
+	suite.config.Set("logs_config.use_http", true)
+	endpoints, err = BuildEndpoints(HTTPConnectivityFailure)
+	suite.Nil(err)
+	suite.True(endpoints.UseHTTP)
+	suite.Equal("/etc/datadog-agent/ca.pem", endpoints.Main.CACertPath)
+	suite.Equal("/etc/datadog-agent/ca.pem", endpoints.Additionals[0].CACertPath)
+}
+
+func (suite *EndpointsTestSuite) TestBuildEndpointsShouldIgnoreCACertFileWithoutSSL() {
+	suite.config.Set("logs_config.ca_cert_file", "/etc/datadog-agent/ca.pem")
+	suite.config.Set("logs_config.logs_dd_url", "my-proxy:1234")
+	suite.config.Set("logs_config.logs_no_ssl", true)
+
+	endpoints, err := BuildEndpoints(HTTPConnectivityFailure)
+	suite.Nil(err)
+	suite.False(endpoints.Main.UseSSL)
+	suite.Equal("", endpoints.Main.CACertPath)
+
+	suite.config.Set("logs_config.use_http", true)
+	endpoints, err = BuildEndpoints(HTTPConnectivityFailure)
+	suite.Nil(err)
+	suite.False(endpoints.Main.UseSSL)
+	suite.Equal("", endpoints.Main.CACertPath)
+}
+
+func (suite *EndpointsTestSuite) TestAdditionalEndpointsShouldOverrideOrInheritCompression() {
+	suite.config.Set("logs_config.use_http", true)
+	suite.config.Set("logs_config.use_compression", false)
+	suite.config.Set("logs_config.compression_level", 3)
+	suite.config.Set("logs_config.additional_endpoints", []map[string]interface{}{
+		{
+			"host":    "inherit",
+			"api_key": "00000000000000000000000000001234",
+		},
+		{
+			"host":              "override",
+			"api_key":           "00000000000000000000000000005678",
+			"use_compression":   true,
+			"compression_level": 9,
+			"compression_kind":  "zstd",
+		},
+		{
+			"host":             "invalid",
+			"api_key":          "00000000000000000000000000009012",
+			"use_compression":  true,
+			"compression_kind": "brotli",
+		},
+	})
+
+	endpoints, err := BuildEndpoints(HTTPConnectivityFailure)
+	suite.Nil(err)
+	suite.False(endpoints.Main.UseCompression)
+	suite.Len(endpoints.Additionals, 3)
+
+	endpoint := endpoints.Additionals[0]
+	suite.False(endpoint.UseCompression)
+	suite.Equal(3, endpoint.CompressionLevel)
+	suite.Equal(GzipCompressionKind, endpoint.CompressionKind)
+
+	endpoint = endpoints.Additionals[1]
+	suite.True(endpoint.UseCompression)
+	suite.Equal(9, endpoint.CompressionLevel)
+	suite.Equal(ZstdCompressionKind, endpoint.CompressionKind)
+
+	endpoint = endpoints.Additionals[2]
+	suite.True(endpoint.UseCompression)
+	suite.Equal(3, endpoint.CompressionLevel)
+	suite.Equal(GzipCompressionKind, endpoint.CompressionKind)
+}
+
+func (suite *EndpointsTestSuite) TestAdditionalJSONEndpointsShouldOverrideOrInheritCompression() {
+	suite.config.Set("logs_config.use_http", true)
+	suite.config.Set("logs_config.compression_kind", "zstd")
+	suite.config.Set("logs_config.additional_endpoints", `[
+	{"api_key": "00000000000000000000000000001234", "host": "inherit"},
+	{"api_key": "00000000000000000000000000005678", "host": "override", "use_compression": false, "compression_kind": "gzip"}]`)
+
+	endpoints, err := BuildEndpoints(HTTPConnectivityFailure)
+	suite.Nil(err)
+	suite.Len(endpoints.Additionals, 2)
+
+	endpoint := endpoints.Additionals[0]
+	suite.True(endpoint.UseCompression)
+	suite.Equal(6, endpoint.CompressionLevel)
+	suite.Equal(ZstdCompressionKind, endpoint.CompressionKind)
+
+	endpoint = endpoints.Additionals[1]
+	suite.False(endpoint.UseCompression)
+	suite.Equal(6, endpoint.CompressionLevel)
+	suite.Equal(GzipCompressionKind, endpoint.CompressionKind)
+}
+
+func (suite *EndpointsTestSuite) TestMirrorEndpointsShouldNotInheritMainSettings() {
+	suite.config.Set("logs_config.use_http", true)
+	suite.config.Set("logs_config.logs_dd_url", "main.datadoghq.com:1234")
+	suite.config.Set("logs_config.api_key", "mainkey")
+	suite.config.Set("logs_config.compression_kind", "zstd")
+	suite.config.Set("logs_config.compression_level", 1)
+	suite.config.Set("logs_config.ca_cert_file", "/etc/ssl/main.pem")
+	suite.config.Set("logs_config.tls_cert_file", "/etc/ssl/client.pem")
+	suite.config.Set("logs_config.tls_key_file", "/etc/ssl/client.key")
+	suite.config.Set("logs_config.mirror_endpoints", []map[string]interface{}{
+		{
+			"host":              "agent-http-intake.logs.datadoghq.com",
+			"port":              443,
+			"api_key":           "aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa\n",
+			"use_ssl":           true,
+			"use_compression":   true,
+			"compression_level": 9,
+			"compression_kind":  "gzip",
+		},
+		{
+			"host":            "eu-proxy",
+			"port":            8080,
+			"api_key":         "eeeeeeeeeeeeeeeeeeeeeeeeeeeeeeee",
+			"use_ssl":         false,
+			"use_compression": false,
+		},
+	})
+
+	endpoints, err := BuildEndpoints(HTTPConnectivityFailure)
+	suite.Nil(err)
+	suite.True(endpoints.UseHTTP)
+	suite.Len(endpoints.Additionals, 0)
+	suite.Len(endpoints.Mirrors, 2)
+
+	suite.Equal(Endpoint{
+		APIKey:           "aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa",
+		Host:             "agent-http-intake.logs.datadoghq.com",
+		Port:             443,
+		Transport:        TransportHTTP,
+		UseSSL:           true,
+		UseCompression:   true,
+		CompressionLevel: 9,
+		CompressionKind:  GzipCompressionKind,
+	}, endpoints.Mirrors[0])
+	suite.Equal(Endpoint{
+		APIKey:          "eeeeeeeeeeeeeeeeeeeeeeeeeeeeeeee",
+		Host:            "eu-proxy",
+		Port:            8080,
+		Transport:       TransportHTTP,
+		CompressionKind: GzipCompressionKind,
+	}, endpoints.Mirrors[1])
+}
+
+func (suite *EndpointsTestSuite) TestMirrorEndpointsWithTCP() {
+	suite.config.Set("logs_config.use_tcp", true)
+	suite.config.Set("logs_config.socks5_proxy_address", "proxy:1080")
+	suite.config.Set("logs_config.mirror_endpoints", `[
+	{"api_key": "aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa", "host": "agent-intake.logs.datadoghq.com", "port": 10516},
+	{"api_key": "eeeeeeeeeeeeeeeeeeeeeeeeeeeeeeee", "host": "agent-intake.logs.datadoghq.eu", "port": 443, "use_ssl": false}]`)
+
+	endpoints, err := BuildEndpoints(HTTPConnectivityFailure)
+	suite.Nil(err)
+	suite.False(endpoints.UseHTTP)
+	suite.Equal("proxy:1080", endpoints.Main.ProxyAddress)
+	suite.Len(endpoints.Mirrors, 2)
+
+	for _, mirror := range endpoints.Mirrors {
+		suite.Equal(TransportTCP, mirror.Transport)
+		suite.Empty(mirror.ProxyAddress)
+		suite.False(mirror.UseCompression)
+	}
+	suite.Equal("aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa", endpoints.Mirrors[0].APIKey)
+	suite.True(endpoints.Mirrors[0].UseSSL)
+	suite.Equal("eeeeeeeeeeeeeeeeeeeeeeeeeeeeeeee", endpoints.Mirrors[1].APIKey)
+	suite.Equal(443, endpoints.Mirrors[1].Port)
+	suite.False(endpoints.Mirrors[1].UseSSL)
+}
+
+func (suite *EndpointsTestSuite) TestMirrorEndpointsWithMalformedEntries() {
+	suite.config.Set("logs_config.use_http", true)
+	suite.config.Set("logs_config.mirror_endpoints", []map[string]interface{}{
+		{"host": "foo", "api_key": "00000000000000000000000000001234", "port": "not-a-port"},
+		{"host": "bar", "api_key": "00000000000000000000000000005678"},
+	})
+
+	endpoints, err := BuildEndpointsStrict(HTTPConnectivityFailure)
+	suite.Len(endpoints.Mirrors, 1)
+	suite.Equal("bar", endpoints.Mirrors[0].Host)
+	additionalsErr, ok := err.(*AdditionalEndpointsError)
+	suite.True(ok)
+	suite.Equal("logs_config.mirror_endpoints", additionalsErr.Key)
+}
+
+func (suite *EndpointsTestSuite) TestIntakePortOverrides() {
+	suite.config.Set("logs_config.use_tcp", true)
+	suite.config.Set("logs_config.intake_port_overrides", map[string]interface{}{
+		"agent-intake.logs.datadoghq.com": 20516,
+		"custom.intake.example.com":       "1234",
+	})
+
+	// the override takes precedence over the port of the known intake
+	endpoints, err := BuildEndpoints(HTTPConnectivityFailure)
+	suite.Nil(err)
+	suite.Equal("agent-intake.logs.datadoghq.com", endpoints.Main.Host)
+	suite.Equal(20516, endpoints.Main.Port)
+
+	// the override is used for an intake missing from the known ones
+	suite.config.Set("logs_config.dd_url", "custom.intake.example.com")
+	endpoints, err = BuildEndpoints(HTTPConnectivityFailure)
+	suite.Nil(err)
+	suite.Equal(1234, endpoints.Main.Port)
+
+	// the known intakes and dd_port are used for the hosts without override
+	suite.config.Set("logs_config.dd_url", "agent-intake.logs.datadoghq.eu")
+	endpoints, err = BuildEndpoints(HTTPConnectivityFailure)
+	suite.Nil(err)
+	suite.Equal(443, endpoints.Main.Port)
+
+	suite.config.Set("logs_config.dd_url", "other.intake.example.com")
+	suite.config.Set("logs_config.dd_port", 4321)
+	endpoints, err = BuildEndpoints(HTTPConnectivityFailure)
+	suite.Nil(err)
+	suite.Equal(4321, endpoints.Main.Port)
+}
+
+func (suite *EndpointsTestSuite) TestIntakePortOverridesIgnoresInvalidPorts() {
+	suite.config.Set("logs_config.use_tcp", true)
+	suite.config.Set("logs_config.intake_port_overrides", map[string]interface{}{
+		"agent-intake.logs.datadoghq.com": "not-a-port",
+	})
+
+	endpoints, err := BuildEndpoints(HTTPConnectivityFailure)
+	suite.Nil(err)
+	suite.Equal(10516, endpoints.Main.Port)
+}
+
+func (suite *EndpointsTestSuite) TestBuildEndpointsWithHTTPConnectProxy() {
+	suite.config.Set("logs_config.use_tcp", true)
+	suite.config.Set("logs_config.http_connect_proxy", "http://proxy:3128")
+	suite.config.Set("logs_config.additional_endpoints", []map[string]interface{}{
+		{"host": "foo", "port": 10516, "api_key": "00000000000000000000000000001234"},
+	})
+
+	endpoints, err := BuildEndpoints(HTTPConnectivityFailure)
+	suite.Nil(err)
+	suite.Equal("http://proxy:3128", endpoints.Main.ConnectProxyAddress)
+	suite.Empty(endpoints.Main.ProxyAddress)
+	suite.Equal("http://proxy:3128", endpoints.Additionals[0].ConnectProxyAddress)
+}
+
+func (suite *EndpointsTestSuite) TestBuildEndpointsWithSocks5AndHTTPConnectProxies() {
+	var b bytes.Buffer
+	w := bufio.NewWriter(&b)
+	logger, err := seelog.LoggerFromWriterWithMinLevelAndFormat(w, seelog.WarnLvl, "[%LEVEL] %Msg\n")
+	suite.Nil(err)
+	log.SetupLogger(logger, "warn")
+
+	suite.config.Set("logs_config.socks5_proxy_address", "socks:1080")
+	suite.config.Set("logs_config.http_connect_proxy", "proxy:3128")
+
+	endpoints, err := BuildEndpoints(HTTPConnectivityFailure)
+	suite.Nil(err)
+	suite.Equal("socks:1080", endpoints.Main.ProxyAddress)
+	suite.Empty(endpoints.Main.ConnectProxyAddress)
+
+	w.Flush()
+	suite.Contains(b.String(), "[WARN] Both logs_config.socks5_proxy_address and logs_config.http_connect_proxy are set: logs are sent through the SOCKS5 proxy socks:1080 and logs_config.http_connect_proxy is ignored")
+}
+
+func (suite *EndpointsTestSuite) TestInvalidAdditionalEndpointsAreDropped() {
+	suite.config.Set("logs_config.use_tcp", true)
+	suite.config.Set("logs_config.additional_endpoints", []map[string]interface{}{
+		{"host": "valid-1", "port": 10516, "api_key": "00000000000000000000000000001234"},
+		{"host": "", "port": 10516, "api_key": "00000000000000000000000000001234"},
+		{"host": "no-port", "api_key": "00000000000000000000000000001234"},
+		{"host": "big-port", "port": 65536, "api_key": "00000000000000000000000000001234"},
+		{"host": "blank-key", "port": 10516, "api_key": "\n\t"},
+		{"host": "valid-2", "port": 443, "api_key": "00000000000000000000000000005678"},
+	})
+
+	endpoints, err := BuildEndpointsStrict(HTTPConnectivityFailure)
+	suite.False(endpoints.UseHTTP)
+	suite.Len(endpoints.Additionals, 2)
+	suite.Equal("valid-1", endpoints.Additionals[0].Host)
+	suite.Equal("valid-2", endpoints.Additionals[1].Host)
+
+	additionalsErr, ok := err.(*AdditionalEndpointsError)
+	suite.True(ok)
+	suite.Len(additionalsErr.Failures, 4)
+	for i, expected := range []struct {
+		index int
+		err   string
+	}{
+		{1, "missing host"},
+		{2, "invalid port 0, should be in [1, 65535]"},
+		{3, "invalid port 65536, should be in [1, 65535]"},
+		{4, "missing api_key"},
+	} {
+		suite.Equal(expected.index, additionalsErr.Failures[i].Index)
+		suite.EqualError(additionalsErr.Failures[i].Err, expected.err)
+	}
+
+	// the invalid endpoints are dropped when the error is ignored
+	endpoints, err = BuildEndpoints(HTTPConnectivityFailure)
+	suite.Nil(err)
+	suite.Len(endpoints.Additionals, 2)
+}
+
+func (suite *EndpointsTestSuite) TestInvalidHTTPAdditionalEndpointsAreDropped() {
+	suite.config.Set("logs_config.use_http", true)
+	suite.config.Set("logs_config.additional_endpoints", `[
+	{"host": "default-port", "api_key": "00000000000000000000000000001234"},
+	{"host": "negative-port", "port": -1, "api_key": "00000000000000000000000000001234"},
+	{"port": 443, "api_key": "00000000000000000000000000001234"},
+	{"host": "no-key", "port": 443}]`)
+
+	endpoints, err := BuildEndpointsStrict(HTTPConnectivityFailure)
+	suite.True(endpoints.UseHTTP)
+	suite.Len(endpoints.Additionals, 1)
+	suite.Equal("default-port", endpoints.Additionals[0].Host)
+
+	additionalsErr, ok := err.(*AdditionalEndpointsError)
+	suite.True(ok)
+	suite.Len(additionalsErr.Failures, 3)
+	suite.EqualError(additionalsErr.Failures[0].Err, "invalid port -1, should be in [0, 65535]")
+	suite.Equal(2, additionalsErr.Failures[1].Index)
+	suite.EqualError(additionalsErr.Failures[1].Err, "missing host")
+	suite.EqualError(additionalsErr.Failures[2].Err, "missing api_key")
+}
+
 func TestEndpointsTestSuite(t *testing.T) {
 	suite.Run(t, new(EndpointsTestSuite))
 }
+
+func TestEndpointString(t *testing.T) {
+	endpoint := Endpoint{
+		APIKey:           "0123456789abcdef",
+		Host:             "agent-http-intake.logs.datadoghq.com",
+		Port:             443,
+		Transport:        TransportHTTP,
+		UseSSL:           true,
+		UseCompression:   true,
+		CompressionLevel: 6,
+		CompressionKind:  GzipCompressionKind,
+	}
+	assert.Equal(t, "host=agent-http-intake.logs.datadoghq.com port=443 ssl=true transport=http compression=true compression_kind=gzip compression_level=6 api_key=************cdef", endpoint.String())
+	assert.NotContains(t, fmt.Sprintf("%v", endpoint), "0123456789ab")
+
+	unix := Endpoint{APIKey: "key", SocketPath: "/var/run/logs.sock", Transport: TransportUnix}
+	assert.Equal(t, "socket=/var/run/logs.sock transport=unix compression=false api_key=***", unix.String())
+
+	proxied := Endpoint{APIKey: "abcdefgh", Host: "foo", Port: 10516, Transport: TransportTCP, ProxyAddress: "proxy:1080", ProxyPassword: "hunter2"}
+	assert.Equal(t, "host=foo port=10516 ssl=false transport=tcp compression=false proxy=proxy:1080 api_key=****efgh", proxied.String())
+}
+
+func TestEndpointsString(t *testing.T) {
+	endpoints := NewEndpoints(
+		Endpoint{APIKey: "mainkey1234", Host: "main", Port: 443, Transport: TransportHTTP, UseSSL: true},
+		[]Endpoint{{APIKey: "additionalkey5678", Host: "additional", Port: 443, Transport: TransportHTTP, UseSSL: true}},
+		false, true, 5*time.Second, 2)
+	endpoints.BatchMaxContentSize = 1000
+	endpoints.Mirrors = []Endpoint{{APIKey: "mirrorkey9012", Host: "mirror", Port: 443, Transport: TransportHTTP, UseSSL: true}}
+
+	s := endpoints.String()
+	assert.Equal(t, "main={host=main port=443 ssl=true transport=http compression=false api_key=*******1234} "+
+		"additional={host=additional port=443 ssl=true transport=http compression=false api_key=*************5678} "+
+		"mirror={host=mirror port=443 ssl=true transport=http compression=false api_key=*********9012} "+
+		"use_http=true use_proto=false batch_wait=5s batch_max_concurrent_send=2 batch_max_content_size=1000", s)
+	for _, key := range []string{"mainkey", "add1add1add1add1add1add1add1add1", "mirrorkey"} {
+		assert.NotContains(t, s, key)
+	}
+}
+
+func TestEndpointsEqual(t *testing.T) {
+	newTestEndpoints := func() *Endpoints {
+		endpoints := NewEndpoints(
+			Endpoint{APIKey: "mainkey", Host: "main", Port: 443, Transport: TransportHTTP, UseSSL: true, UseCompression: true, CompressionLevel: 6},
+			[]Endpoint{
+				{APIKey: "key1", Host: "additional1", Port: 443, Transport: TransportHTTP, UseSSL: true},
+				{APIKey: "key2", Host: "additional2", Port: 443, Transport: TransportHTTP, UseSSL: true},
+			},
+			false, true, 5*time.Second, 2)
+		endpoints.Mirrors = []Endpoint{{APIKey: "mirrorkey", Host: "mirror", Port: 443, Transport: TransportHTTP, UseSSL: true}}
+		return endpoints
+	}
+
+	endpoints := newTestEndpoints()
+	assert.True(t, endpoints.Equal(endpoints))
+	assert.True(t, endpoints.Equal(newTestEndpoints()))
+	assert.False(t, endpoints.Equal(nil))
+	assert.True(t, (*Endpoints)(nil).Equal(nil))
+
+	reordered := newTestEndpoints()
+	reordered.Additionals[0], reordered.Additionals[1] = reordered.Additionals[1], reordered.Additionals[0]
+	assert.True(t, endpoints.Equal(reordered))
+	assert.True(t, reordered.Equal(endpoints))
+
+	for name, change := range map[string]func(e *Endpoints){
+		"main api key":          func(e *Endpoints) { e.Main.APIKey = "otherkey" },
+		"main host":             func(e *Endpoints) { e.Main.Host = "other" },
+		"main port":             func(e *Endpoints) { e.Main.Port = 10516 },
+		"main ssl":              func(e *Endpoints) { e.Main.UseSSL = false },
+		"main compression":      func(e *Endpoints) { e.Main.UseCompression = false },
+		"main compression kind": func(e *Endpoints) { e.Main.CompressionKind = ZstdCompressionKind },
+		"additional api key":    func(e *Endpoints) { e.Additionals[1].APIKey = "otherkey" },
+		"additional port":       func(e *Endpoints) { e.Additionals[0].Port = 10516 },
+		"duplicated additional": func(e *Endpoints) { e.Additionals[1] = e.Additionals[0] },
+		"missing additional":    func(e *Endpoints) { e.Additionals = e.Additionals[:1] },
+		"mirror host":           func(e *Endpoints) { e.Mirrors[0].Host = "other" },
+		"use http":              func(e *Endpoints) { e.UseHTTP = false },
+		"batch wait":            func(e *Endpoints) { e.BatchWait = time.Second },
+	} {
+		changed := newTestEndpoints()
+		change(changed)
+		assert.False(t, endpoints.Equal(changed), name)
+		assert.False(t, changed.Equal(endpoints), name)
+	}
+}
+
+func (suite *EndpointsTestSuite) TestEndpointsEqualRotatedAPIKey() {
+	suite.config.Set("api_key", "0123456789abcdef0123456789abcdef")
+	endpoints, err := BuildEndpoints(HTTPConnectivityFailure)
+	suite.Nil(err)
+	rebuilt, err := BuildEndpoints(HTTPConnectivityFailure)
+	suite.Nil(err)
+	suite.True(endpoints.Equal(rebuilt))
+
+	// the main API key is read from the configuration
+	suite.config.Set("api_key", "fedcba9876543210fedcba9876543210")
+	suite.True(endpoints.Equal(rebuilt))
+	suite.False(endpoints.Equal(NewEndpoints(Endpoint{APIKey: "0123456789abcdef0123456789abcdef"}, nil, false, false, 0, 0)))
+}
+
+func (suite *EndpointsTestSuite) TestEndpointsForSource() {
+	suite.config.Set("api_key", "0123456789abcdef0123456789abcdef")
+	suite.config.Set("logs_config.use_http", true)
+	suite.config.Set("logs_config.additional_endpoints", `[{"host": "additional", "api_key": "add1add1add1add1add1add1add1add1"}]`)
+	endpoints, err := BuildEndpoints(HTTPConnectivityFailure)
+	suite.Nil(err)
+
+	// without override the logs are sent with the global key
+	suite.Equal(endpoints, endpoints.ForSource(&LogsConfig{Type: FileType, Path: "/var/log/foo.log"}))
+	suite.Equal("0123456789abcdef0123456789abcdef", endpoints.ForSource(nil).Main.GetAPIKey())
+
+	overridden := endpoints.ForSource(&LogsConfig{Type: FileType, Path: "/var/log/foo.log", APIKey: " fedcba9876543210fedcba9876543210\n"})
+	suite.Equal("fedcba9876543210fedcba9876543210", overridden.Main.GetAPIKey())
+	suite.Equal(endpoints.Main.Host, overridden.Main.Host)
+	suite.Equal("add1add1add1add1add1add1add1add1", overridden.Additionals[0].GetAPIKey())
+	// the endpoints of the other sources are left untouched, and a rotated global key doesn't replace the override
+	suite.config.Set("api_key", "abcdefabcdefabcdefabcdefabcdefab")
+	suite.Equal("abcdefabcdefabcdefabcdefabcdefab", endpoints.Main.GetAPIKey())
+	suite.Equal("fedcba9876543210fedcba9876543210", overridden.Main.GetAPIKey())
+}
+
+func (suite *EndpointsTestSuite) TestAdditionalEndpointsWithMalformedAPIKeysAreDropped() {
+	suite.config.Set("logs_config.use_http", true)
+	suite.config.Set("logs_config.additional_endpoints", `[
+	{"host": "valid", "api_key": "0123456789abcdef0123456789abcdef"},
+	{"host": "quoted", "api_key": "'0123456789abcdef0123456789abcdef'"},
+	{"host": "setting-name", "api_key": "api_key: 0123456789abcdef0123456789abcdef"},
+	{"host": "two-keys", "api_key": "0123456789abcdef 0123456789abcdef"},
+	{"host": "truncated", "api_key": "0123456789abcdef0123456789abcde"},
+	{"host": "not-hex", "api_key": "0123456789abcdef0123456789abcdeg"}]`)
+
+	endpoints, err := BuildEndpointsStrict(HTTPConnectivityFailure)
+	suite.Len(endpoints.Additionals, 1)
+	suite.Equal("valid", endpoints.Additionals[0].Host)
+
+	additionalsErr, ok := err.(*AdditionalEndpointsError)
+	suite.True(ok)
+	suite.Len(additionalsErr.Failures, 5)
+	for i, failure := range additionalsErr.Failures {
+		suite.Equal(i+1, failure.Index)
+	}
+	suite.EqualError(additionalsErr.Failures[0].Err, "invalid api_key: it should be 32 characters long, got 34")
+	suite.EqualError(additionalsErr.Failures[3].Err, "invalid api_key: it should be 32 characters long, got 31")
+	suite.EqualError(additionalsErr.Failures[4].Err, "invalid api_key: it should only contain hexadecimal digits")
+
+	suite.config.Set("logs_config.use_http", false)
+	suite.config.Set("logs_config.use_tcp", true)
+	suite.config.Set("logs_config.additional_endpoints", `[
+	{"host": "valid", "port": 10516, "api_key": "0123456789abcdef0123456789abcdef"},
+	{"host": "quoted", "port": 10516, "api_key": "\"0123456789abcdef0123456789abcdef\""}]`)
+
+	endpoints, err = BuildEndpointsStrict(HTTPConnectivityFailure)
+	suite.Len(endpoints.Additionals, 1)
+	additionalsErr, ok = err.(*AdditionalEndpointsError)
+	suite.True(ok)
+	suite.Len(additionalsErr.Failures, 1)
+	suite.EqualError(additionalsErr.Failures[0].Err, "invalid api_key: it should be 32 characters long, got 34")
+}
+
+func (suite *EndpointsTestSuite) TestBuildEndpointsWithReason() {
+	for _, test := range []struct {
+		name             string
+		settings         map[string]interface{}
+		httpConnectivity HTTPConnectivity
+		reason           TransportReason
+		useHTTP          bool
+	}{
+		{"unix socket", map[string]interface{}{"logs_config.logs_dd_url": "unix:///var/run/logs.sock"}, HTTPConnectivitySuccess, TransportReasonUnixSocket, false},
+		{"force http", map[string]interface{}{"logs_config.use_http": true, "logs_config.use_tcp": true}, HTTPConnectivityFailure, TransportReasonForceHTTP, true},
+		{"connectivity success", nil, HTTPConnectivitySuccess, TransportReasonConnectivitySuccess, true},
+		{"force tcp", map[string]interface{}{"logs_config.use_tcp": true}, HTTPConnectivitySuccess, TransportReasonForceTCP, false},
+		{"socks5 set", map[string]interface{}{"logs_config.socks5_proxy_address": "proxy:1080"}, HTTPConnectivitySuccess, TransportReasonSocks5Set, false},
+		{"additional endpoints present", map[string]interface{}{"logs_config.additional_endpoints": `[{"host": "foo", "port": 10516, "api_key": "00000000000000000000000000001234"}]`}, HTTPConnectivitySuccess, TransportReasonAdditionalEndpointsPresent, false},
+		{"connectivity failure", nil, HTTPConnectivityFailure, TransportReasonConnectivityFailure, false},
+	} {
+		suite.Run(test.name, func() {
+			suite.config = coreConfig.Mock()
+			for key, value := range test.settings {
+				suite.config.Set(key, value)
+			}
+			endpoints, reason, err := BuildEndpointsWithReason(test.httpConnectivity)
+			suite.Nil(err)
+			suite.Equal(test.reason, reason)
+			suite.Equal(test.useHTTP, endpoints.UseHTTP)
+		})
+	}
+}
@@ -8,6 +8,8 @@ package config
 import (
 	"fmt"
 	"strings"
+
+	coreConfig "github.com/DataDog/datadog-agent/pkg/config"
 )
 
 // Logs source types
@@ -62,6 +64,10 @@ type LogsConfig struct {
 	SourceCategory  string
 	Tags            []string
 	ProcessingRules []*ProcessingRule `mapstructure:"log_processing_rules" json:"log_processing_rules"`
+
+	// APIKey, if set, overrides the API key of the main endpoint for the logs of this source,
+	// e.g. to send them to another organization.
+	APIKey string `mapstructure:"api_key" json:"api_key"`
 }
 
 // TailingMode type
@@ -126,6 +132,11 @@ func (c *LogsConfig) Validate() error {
 	case c.Type == UDPType && c.Port == 0:
 		return fmt.Errorf("udp source must have a port")
 	}
+	if c.APIKey != "" {
+		if err := coreConfig.ValidateAPIKey(c.APIKey); err != nil {
+			return err
+		}
+	}
 	err := ValidateProcessingRules(c.ProcessingRules)
 	if err != nil {
 		return err
@@ -133,6 +144,11 @@ func (c *LogsConfig) Validate() error {
 	return CompileProcessingRules(c.ProcessingRules)
 }
 
+// GetAPIKey returns the sanitized API key overriding the one of the main endpoint, empty if not set
+func (c *LogsConfig) GetAPIKey() string {
+	return coreConfig.SanitizeAPIKey(c.APIKey)
+}
+
 func (c *LogsConfig) validateTailingMode() error {
 	mode, found := TailingModeFromString(c.TailingMode)
 	if !found && c.TailingMode != "" {
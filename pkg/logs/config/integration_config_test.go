@@ -21,6 +21,7 @@ func TestValidateShouldSucceedWithValidConfigs(t *testing.T) {
 		{Type: DockerType},
 		{Type: JournaldType, ProcessingRules: []*ProcessingRule{{Name: "foo", Type: ExcludeAtMatch, Pattern: ".*"}}},
 		{Type: SnmpTrapsType},
+		{Type: FileType, Path: "/var/log/foo.log", APIKey: " 0123456789abcdef0123456789abcdef\n"},
 	}
 
 	for _, config := range validConfigs {
@@ -42,6 +43,8 @@ func TestValidateShouldFailWithInvalidConfigs(t *testing.T) {
 		{Type: DockerType, ProcessingRules: []*ProcessingRule{{Type: ExcludeAtMatch, Pattern: ".*"}}},
 		{Type: DockerType, ProcessingRules: []*ProcessingRule{{Type: ExcludeAtMatch}}},
 		{Type: DockerType, ProcessingRules: []*ProcessingRule{{Pattern: ".*"}}},
+		{Type: DockerType, APIKey: "'0123456789abcdef0123456789abcdef'"},
+		{Type: DockerType, APIKey: "api_key: 0123456789abcdef0123456789abcdef"},
 	}
 
 	for _, config := range invalidConfigs {
@@ -39,6 +39,10 @@ func TestParseJSONWithValidFormatShouldSucceed(t *testing.T) {
 	rule := config.ProcessingRules[0]
 	assert.Equal(t, "multi_line", rule.Type)
 	assert.Equal(t, "numbers", rule.Name)
+
+	configs, err = ParseJSON([]byte(`[{"source":"any_source","api_key":"0123456789abcdef0123456789abcdef"}]`))
+	assert.Nil(t, err)
+	assert.Equal(t, "0123456789abcdef0123456789abcdef", configs[0].APIKey)
 }
 
 func TestParseJSONWithInvalidFormatShouldFail(t *testing.T) {
@@ -7,6 +7,7 @@ package pipeline
 
 import (
 	"context"
+	"sync"
 
 	"github.com/DataDog/datadog-agent/pkg/logs/client"
 	"github.com/DataDog/datadog-agent/pkg/logs/client/http"
@@ -20,59 +21,121 @@ import (
 
 // Pipeline processes and sends messages to the backend
 type Pipeline struct {
-	InputChan chan *message.Message
-	processor *processor.Processor
+	InputChan  chan *message.Message
+	processor  *processor.Processor
+	sender     *sender.Sender
+	senderChan chan *message.Message
+
+	outputChan          chan *message.Message
+	endpoints           *config.Endpoints
+	destinationsContext *client.DestinationsContext
+	serverless          bool
+
+	// sourceSenders holds the senders of the sources overriding the API key, by API key
+	sourceSenders map[string]*sourceSender
+	mu            sync.Mutex
+}
+
+// sourceSender sends the logs of the sources configured with their own API key
+type sourceSender struct {
+	inputChan chan *message.Message
 	sender    *sender.Sender
 }
 
 // NewPipeline returns a new Pipeline
 func NewPipeline(outputChan chan *message.Message, processingRules []*config.ProcessingRule, endpoints *config.Endpoints, destinationsContext *client.DestinationsContext, diagnosticMessageReceiver diagnostic.MessageReceiver, serverless bool) *Pipeline {
+	senderChan := make(chan *message.Message, config.ChanSize)
+	sender := newSender(senderChan, outputChan, endpoints, destinationsContext, serverless)
+
+	var encoder processor.Encoder
+	if serverless {
+		encoder = processor.JSONServerlessEncoder
+	} else if endpoints.UseHTTP {
+		encoder = processor.JSONEncoder
+	} else if endpoints.UseProto {
+		encoder = processor.ProtoEncoder
+	} else {
+		encoder = processor.RawEncoder
+	}
+
+	inputChan := make(chan *message.Message, config.ChanSize)
+	processor := processor.New(inputChan, senderChan, processingRules, encoder, diagnosticMessageReceiver)
+
+	pipeline := &Pipeline{
+		InputChan:           inputChan,
+		processor:           processor,
+		sender:              sender,
+		senderChan:          senderChan,
+		outputChan:          outputChan,
+		endpoints:           endpoints,
+		destinationsContext: destinationsContext,
+		serverless:          serverless,
+		sourceSenders:       make(map[string]*sourceSender),
+	}
+	processor.OutputChanFor = pipeline.senderChanFor
+
+	return pipeline
+}
+
+// newSender returns a sender sending the messages of inputChan to the endpoints
+func newSender(inputChan, outputChan chan *message.Message, endpoints *config.Endpoints, destinationsContext *client.DestinationsContext, serverless bool) *sender.Sender {
+	// mirrors are sent a copy of the logs like the additional endpoints. The endpoints may be shared
+	// with other pipelines, so they're copied rather than appended to.
+	additionalEndpoints := make([]config.Endpoint, 0, len(endpoints.Additionals)+len(endpoints.Mirrors))
+	additionalEndpoints = append(additionalEndpoints, endpoints.Additionals...)
+	additionalEndpoints = append(additionalEndpoints, endpoints.Mirrors...)
+
 	var destinations *client.Destinations
 	if endpoints.UseHTTP {
 		main := http.NewDestination(endpoints.Main, http.JSONContentType, destinationsContext, endpoints.BatchMaxConcurrentSend)
 		additionals := []client.Destination{}
-		for _, endpoint := range endpoints.Additionals {
+		for _, endpoint := range additionalEndpoints {
 			additionals = append(additionals, http.NewDestination(endpoint, http.JSONContentType, destinationsContext, endpoints.BatchMaxConcurrentSend))
 		}
 		destinations = client.NewDestinations(main, additionals)
 	} else {
 		main := tcp.NewDestination(endpoints.Main, endpoints.UseProto, destinationsContext)
 		additionals := []client.Destination{}
-		for _, endpoint := range endpoints.Additionals {
+		for _, endpoint := range additionalEndpoints {
 			additionals = append(additionals, tcp.NewDestination(endpoint, endpoints.UseProto, destinationsContext))
 		}
 		destinations = client.NewDestinations(main, additionals)
 	}
 
-	senderChan := make(chan *message.Message, config.ChanSize)
-
 	var strategy sender.Strategy
 	if endpoints.UseHTTP || serverless {
-		strategy = sender.NewBatchStrategy(sender.ArraySerializer, endpoints.BatchWait, endpoints.BatchMaxConcurrentSend)
+		strategy = sender.NewBatchStrategy(sender.ArraySerializer, endpoints.BatchWait, endpoints.BatchMaxConcurrentSend, endpoints.BatchMaxContentSize)
 	} else {
 		strategy = sender.StreamStrategy
 	}
-	sender := sender.NewSender(senderChan, outputChan, destinations, strategy)
+	return sender.NewSender(inputChan, outputChan, destinations, strategy)
+}
 
-	var encoder processor.Encoder
-	if serverless {
-		encoder = processor.JSONServerlessEncoder
-	} else if endpoints.UseHTTP {
-		encoder = processor.JSONEncoder
-	} else if endpoints.UseProto {
-		encoder = processor.ProtoEncoder
-	} else {
-		encoder = processor.RawEncoder
+// senderChanFor returns the input channel of the sender of a message, the logs of a source
+// configured with its own API key are sent by a sender started on its first message.
+func (p *Pipeline) senderChanFor(msg *message.Message) chan *message.Message {
+	if msg.Origin == nil || msg.Origin.LogSource == nil || msg.Origin.LogSource.Config == nil {
+		return p.senderChan
+	}
+	apiKey := msg.Origin.LogSource.Config.GetAPIKey()
+	if apiKey == "" {
+		return p.senderChan
 	}
 
-	inputChan := make(chan *message.Message, config.ChanSize)
-	processor := processor.New(inputChan, senderChan, processingRules, encoder, diagnosticMessageReceiver)
-
-	return &Pipeline{
-		InputChan: inputChan,
-		processor: processor,
-		sender:    sender,
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	s, exists := p.sourceSenders[apiKey]
+	if !exists {
+		inputChan := make(chan *message.Message, config.ChanSize)
+		endpoints := p.endpoints.ForSource(msg.Origin.LogSource.Config)
+		s = &sourceSender{
+			inputChan: inputChan,
+			sender:    newSender(inputChan, p.outputChan, endpoints, p.destinationsContext, p.serverless),
+		}
+		s.sender.Start()
+		p.sourceSenders[apiKey] = s
 	}
+	return s.inputChan
 }
 
 // Start launches the pipeline
@@ -85,10 +148,27 @@ func (p *Pipeline) Start() {
 func (p *Pipeline) Stop() {
 	p.processor.Stop()
 	p.sender.Stop()
+	for _, s := range p.getSourceSenders() {
+		s.Stop()
+	}
 }
 
 // Flush flushes synchronously the processor and sender managed by this pipeline.
 func (p *Pipeline) Flush(ctx context.Context) {
-	p.processor.Flush(ctx) // flush messages in the processor into the sender
-	p.sender.Flush(ctx)    // flush the sender
+	p.processor.Flush(ctx) // flush messages in the processor into the senders
+	p.sender.Flush(ctx)    // flush the senders
+	for _, s := range p.getSourceSenders() {
+		s.Flush(ctx)
+	}
+}
+
+// getSourceSenders returns the senders started for the sources overriding the API key
+func (p *Pipeline) getSourceSenders() []*sender.Sender {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	senders := make([]*sender.Sender, 0, len(p.sourceSenders))
+	for _, s := range p.sourceSenders {
+		senders = append(senders, s.sender)
+	}
+	return senders
 }
@@ -0,0 +1,82 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016-present Datadog, Inc.
+
+package pipeline
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/DataDog/datadog-agent/pkg/logs/client"
+	"github.com/DataDog/datadog-agent/pkg/logs/config"
+	"github.com/DataDog/datadog-agent/pkg/logs/diagnostic"
+	"github.com/DataDog/datadog-agent/pkg/logs/message"
+)
+
+func TestNewPipelineKeepsSharedEndpoints(t *testing.T) {
+	// the additional endpoints have room for the mirrors in their backing array
+	backing := []config.Endpoint{{Host: "additional"}, {Host: "other"}}
+	endpoints := config.NewEndpoints(config.Endpoint{Host: "main"}, backing[:1], false, false, 0, 0)
+	endpoints.Mirrors = []config.Endpoint{{Host: "mirror"}}
+
+	NewPipeline(make(chan *message.Message), nil, endpoints, client.NewDestinationsContext(), nil, false)
+	assert.Equal(t, "other", backing[1].Host)
+}
+
+func TestPipelineSendsSourceLogsWithTheirAPIKey(t *testing.T) {
+	var mu sync.Mutex
+	paths := make(map[string]int)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		paths[r.URL.Path]++
+		mu.Unlock()
+	}))
+	defer server.Close()
+
+	serverURL, err := url.Parse(server.URL)
+	require.NoError(t, err)
+	port, err := strconv.Atoi(serverURL.Port())
+	require.NoError(t, err)
+
+	main := config.Endpoint{APIKey: "0123456789abcdef0123456789abcdef", Host: serverURL.Hostname(), Port: port}
+	endpoints := config.NewEndpoints(main, nil, false, true, 10*time.Millisecond, 1)
+	destinationsContext := client.NewDestinationsContext()
+	destinationsContext.Start()
+	defer destinationsContext.Stop()
+
+	outputChan := make(chan *message.Message, 10)
+	pipeline := NewPipeline(outputChan, nil, endpoints, destinationsContext, diagnostic.NewBufferedMessageReceiver(), false)
+	pipeline.Start()
+	defer pipeline.Stop()
+
+	source := config.NewLogSource("default", &config.LogsConfig{Type: config.FileType, Path: "/var/log/default.log"})
+	overridden := config.NewLogSource("overridden", &config.LogsConfig{Type: config.FileType, Path: "/var/log/overridden.log", APIKey: "fedcba9876543210fedcba9876543210"})
+	pipeline.InputChan <- message.NewMessageWithSource([]byte("default"), message.StatusInfo, source, 0)
+	pipeline.InputChan <- message.NewMessageWithSource([]byte("overridden"), message.StatusInfo, overridden, 0)
+
+	// both payloads are sent and acknowledged
+	for i := 0; i < 2; i++ {
+		select {
+		case <-outputChan:
+		case <-time.After(5 * time.Second):
+			require.FailNow(t, "the logs were not sent")
+		}
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, map[string]int{
+		"/v1/input/0123456789abcdef0123456789abcdef": 1,
+		"/v1/input/fedcba9876543210fedcba9876543210": 1,
+	}, paths)
+}
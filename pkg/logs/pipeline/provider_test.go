@@ -6,6 +6,8 @@
 package pipeline
 
 import (
+	"io/ioutil"
+	"os"
 	"testing"
 	"time"
 
@@ -20,12 +22,16 @@ import (
 
 type ProviderTestSuite struct {
 	suite.Suite
-	p *provider
-	a *auditor.RegistryAuditor
+	p      *provider
+	a      *auditor.RegistryAuditor
+	runDir string
 }
 
 func (suite *ProviderTestSuite) SetupTest() {
-	suite.a = auditor.New("", auditor.DefaultRegistryFilename, time.Hour, health.RegisterLiveness("fake"))
+	var err error
+	suite.runDir, err = ioutil.TempDir("", "dd-test-")
+	suite.Require().NoError(err)
+	suite.a = auditor.New(suite.runDir, auditor.DefaultRegistryFilename, time.Hour, health.RegisterLiveness("fake"))
 	suite.p = &provider{
 		numberOfPipelines: 3,
 		auditor:           suite.a,
@@ -34,6 +40,10 @@ func (suite *ProviderTestSuite) SetupTest() {
 	}
 }
 
+func (suite *ProviderTestSuite) TearDownTest() {
+	os.RemoveAll(suite.runDir)
+}
+
 func (suite *ProviderTestSuite) TestProvider() {
 	suite.a.Start()
 	suite.p.Start()
@@ -27,6 +27,11 @@ type Processor struct {
 	done                      chan struct{}
 	diagnosticMessageReceiver diagnostic.MessageReceiver
 	mu                        sync.Mutex
+
+	// OutputChanFor, when set, returns the channel a processed message is pushed to instead of outputChan,
+	// e.g. to send the logs of a source to its own endpoints. It may be called concurrently by Flush and
+	// must be set before the Processor is started.
+	OutputChanFor func(msg *message.Message) chan *message.Message
 }
 
 // New returns an initialized Processor.
@@ -99,6 +104,10 @@ func (p *Processor) processMessage(msg *message.Message) {
 			return
 		}
 		msg.Content = content
+		if p.OutputChanFor != nil {
+			p.OutputChanFor(msg) <- msg
+			return
+		}
 		p.outputChan <- msg
 	}
 }
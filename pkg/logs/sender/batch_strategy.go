@@ -35,8 +35,12 @@ type batchStrategy struct {
 // NewBatchStrategy returns a new batch concurrent strategy
 // If `maxConcurrent` > 0, then at most that many payloads will be sent concurrently, else there is no concurrency
 // and the pipeline will block while sending each payload.
-func NewBatchStrategy(serializer Serializer, batchWait time.Duration, maxConcurrent int) Strategy {
-	return newBatchStrategyWithSize(serializer, batchWait, maxConcurrent, maxBatchSize, maxContentSize)
+// If `batchMaxContentSize` > 0, then the content of a payload is capped to that many bytes, else the default size is used.
+func NewBatchStrategy(serializer Serializer, batchWait time.Duration, maxConcurrent int, batchMaxContentSize int) Strategy {
+	if batchMaxContentSize <= 0 {
+		batchMaxContentSize = maxContentSize
+	}
+	return newBatchStrategyWithSize(serializer, batchWait, maxConcurrent, maxBatchSize, batchMaxContentSize)
 }
 
 func newBatchStrategyWithSize(serializer Serializer, batchWait time.Duration, maxConcurrent int, maxBatchSize int, maxContentSize int) *batchStrategy {
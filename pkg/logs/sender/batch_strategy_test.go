@@ -254,3 +254,12 @@ func TestBatchStrategySynchronousFlush(t *testing.T) {
 	default:
 	}
 }
+
+func TestBatchStrategyMaxContentSize(t *testing.T) {
+	strategy := NewBatchStrategy(LineSerializer, time.Second, 0, 1000).(*batchStrategy)
+	assert.Equal(t, 1000, strategy.buffer.contentSizeLimit)
+
+	// the default size is used when none is configured
+	strategy = NewBatchStrategy(LineSerializer, time.Second, 0, 0).(*batchStrategy)
+	assert.Equal(t, maxContentSize, strategy.buffer.contentSizeLimit)
+}
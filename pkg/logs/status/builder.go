@@ -67,6 +67,9 @@ func (b *Builder) getEndpoints() []string {
 	for _, additional := range b.endpoints.Additionals {
 		result = append(result, b.formatEndpoint(additional, "Additional: "))
 	}
+	for _, mirror := range b.endpoints.Mirrors {
+		result = append(result, b.formatEndpoint(mirror, "Mirror: "))
+	}
 	return result
 }
 
@@ -76,6 +79,10 @@ func (b *Builder) formatEndpoint(endpoint config.Endpoint, prefix string) string
 		compression = "compressed"
 	}
 
+	if endpoint.Transport == config.TransportUnix {
+		return fmt.Sprintf("%sSending %s logs to unix socket %s", prefix, compression, endpoint.SocketPath)
+	}
+
 	host := endpoint.Host
 	port := endpoint.Port
 
@@ -1,6 +1,10 @@
 package config
 
 import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
 	"strings"
 	"time"
 
@@ -19,6 +23,9 @@ const (
 
 	defaultOffsetThreshold = 400
 	maxOffsetThreshold     = 3000
+
+	defaultHTTPBufferSize    = 25
+	defaultHTTPFlushInterval = 30 * time.Second
 )
 
 // Config stores all flags used by the network eBPF tracer
@@ -59,6 +66,14 @@ type Config struct {
 	// EnableHTTPMonitoring specifies whether the tracer should monitor HTTP traffic
 	EnableHTTPMonitoring bool
 
+	// EnableHTTPSMonitoring specifies whether the tracer should monitor HTTPS traffic by attaching uprobes to OpenSSL
+	// It is relevant *only* when EnableHTTPMonitoring is enabled.
+	EnableHTTPSMonitoring bool
+
+	// LibSSLPath is the path of the OpenSSL library the HTTPS uprobes are attached to. It is looked up in
+	// the usual library directories when empty.
+	LibSSLPath string
+
 	// UDPConnTimeout determines the length of traffic inactivity between two
 	// (IP, port)-pairs before declaring a UDP connection as inactive. This is
 	// set to /proc/sys/net/netfilter/nf_conntrack_udp_timeout on Linux by
@@ -90,6 +105,44 @@ type Config struct {
 	// get flushed on every client request (default 30s check interval)
 	MaxDNSStatsBuffered int
 
+	// HTTPBufferSize is the number of bytes of each HTTP request captured in eBPF, it bounds the length of the
+	// request paths. Longer paths are truncated.
+	// Values above the default load the http-large eBPF program, whose in-flight transactions take 240 bytes instead
+	// of 112 in kernel memory, i.e. about 8MB more with 65536 tracked connections.
+	HTTPBufferSize int
+
+	// HTTPFlushInterval is the interval at which the HTTP transactions captured in eBPF are flushed to
+	// the HTTP stats, on top of the flushes triggered by each client request
+	HTTPFlushInterval time.Duration
+
+	// HTTPBatchCompression is the codec, gzip or zstd, compressing the HTTP transaction batches handed to
+	// the batch handler of the HTTP monitor. The batches are not compressed when it is empty.
+	HTTPBatchCompression string
+
+	// HTTPCapturedHeaders is the list of HTTP request headers, case-insensitive, kept in the request fragment
+	// of the HTTP transactions. The other headers are removed by the HTTP monitor. When it is set, the whole
+	// HTTP buffer is captured so only the headers which fit in it are available.
+	HTTPCapturedHeaders []string
+
+	// HTTPDirection, inbound or outbound, only keeps the HTTP transactions served or sent by the host.
+	// Both directions are kept when it is empty.
+	HTTPDirection string
+
+	// HTTPMaxTrackedConnections is the maximum number of connections whose HTTP transactions are tracked in eBPF,
+	// the oldest incomplete transactions are evicted beyond it. It defaults to MaxTrackedConnections.
+	HTTPMaxTrackedConnections int
+
+	// HTTPAllowedPorts is the list of server ports of the HTTP transactions that are monitored.
+	// All ports are monitored when it is empty.
+	HTTPAllowedPorts []uint16
+
+	// HTTPDeniedPorts is the list of server ports of the HTTP transactions that are ignored.
+	HTTPDeniedPorts []uint16
+
+	// HTTPReplaceRules are applied to the path of the HTTP transactions before they are aggregated,
+	// e.g. to replace the IDs of REST resources by a placeholder
+	HTTPReplaceRules []*ReplaceRule
+
 	// MaxHTTPStatsBuffered represents the maximum number of HTTP stats we'll buffer in memory. These stats
 	// get flushed on every client request (default 30s check interval)
 	MaxHTTPStatsBuffered int
@@ -141,6 +194,18 @@ type Config struct {
 	EnableGatewayLookup bool
 }
 
+// ReplaceRule specifies a replace rule.
+type ReplaceRule struct {
+	// Pattern specifies the regexp pattern to be used when replacing. It must compile.
+	Pattern string `mapstructure:"pattern"`
+
+	// Re holds the compiled Pattern and is only used internally.
+	Re *regexp.Regexp `mapstructure:"-"`
+
+	// Repl specifies the replacement string to be used when Pattern matches.
+	Repl string `mapstructure:"repl"`
+}
+
 func join(pieces ...string) string {
 	return strings.Join(pieces, ".")
 }
@@ -180,8 +245,16 @@ func New() *Config {
 		MaxDNSStatsBuffered: 75000,
 		DNSTimeout:          time.Duration(cfg.GetInt(join(spNS, "dns_timeout_in_s"))) * time.Second,
 
-		EnableHTTPMonitoring: cfg.GetBool(join(netNS, "enable_http_monitoring")),
-		MaxHTTPStatsBuffered: 100000,
+		EnableHTTPMonitoring:      cfg.GetBool(join(netNS, "enable_http_monitoring")),
+		EnableHTTPSMonitoring:     cfg.GetBool(join(netNS, "enable_https_monitoring")),
+		LibSSLPath:                cfg.GetString(join(netNS, "libssl_path")),
+		HTTPBufferSize:            cfg.GetInt(join(netNS, "http_buffer_size")),
+		HTTPFlushInterval:         time.Duration(cfg.GetInt(join(netNS, "http_flush_interval_in_s"))) * time.Second,
+		HTTPBatchCompression:      cfg.GetString(join(netNS, "http_batch_compression")),
+		HTTPCapturedHeaders:       cfg.GetStringSlice(join(netNS, "http_captured_headers")),
+		HTTPMaxTrackedConnections: cfg.GetInt(join(netNS, "http_max_tracked_connections")),
+		HTTPDirection:             cfg.GetString(join(netNS, "http_direction")),
+		MaxHTTPStatsBuffered:      100000,
 
 		EnableConntrack:              cfg.GetBool(join(spNS, "enable_conntrack")),
 		ConntrackMaxStateSize:        cfg.GetInt(join(spNS, "conntrack_max_state_size")),
@@ -200,6 +273,55 @@ func New() *Config {
 		c.OffsetGuessThreshold = defaultOffsetThreshold
 	}
 
+	if c.HTTPBufferSize <= 0 {
+		log.Warnf("http_buffer_size must be positive. Setting it to the default of %d", defaultHTTPBufferSize)
+		c.HTTPBufferSize = defaultHTTPBufferSize
+	}
+
+	if c.HTTPFlushInterval <= 0 {
+		log.Warnf("http_flush_interval_in_s must be positive. Setting it to the default of %s", defaultHTTPFlushInterval)
+		c.HTTPFlushInterval = defaultHTTPFlushInterval
+	}
+
+	if c.HTTPMaxTrackedConnections <= 0 {
+		c.HTTPMaxTrackedConnections = int(c.MaxTrackedConnections)
+	}
+
+	switch c.HTTPBatchCompression {
+	case "", "gzip", "zstd":
+	default:
+		log.Warnf("http_batch_compression must be one of gzip or zstd, got %q. The HTTP batches won't be compressed", c.HTTPBatchCompression)
+		c.HTTPBatchCompression = ""
+	}
+
+	switch c.HTTPDirection {
+	case "", "inbound", "outbound":
+	default:
+		log.Warnf("http_direction must be one of inbound or outbound, got %q. Both directions will be kept", c.HTTPDirection)
+		c.HTTPDirection = ""
+	}
+
+	for k, ports := range map[string]*[]uint16{
+		join(netNS, "http_allowed_ports"): &c.HTTPAllowedPorts,
+		join(netNS, "http_denied_ports"):  &c.HTTPDeniedPorts,
+	} {
+		parsed, err := parsePorts(cfg.GetStringSlice(k))
+		if err != nil {
+			log.Errorf("Bad format for %q, it should be a list of ports: %v", k, err)
+			continue
+		}
+		*ports = parsed
+	}
+
+	if k := join(netNS, "http_replace_rules"); cfg.IsSet(k) {
+		rules, err := parseReplaceRules(cfg, k)
+		if err != nil {
+			log.Errorf("Bad format for %q it should be of the form '[{\"pattern\":\"pattern\",\"repl\":\"replace_str\"}]', error: %v", k, err)
+		} else {
+			c.HTTPReplaceRules = rules
+		}
+	}
+
 	if !kernel.IsIPv6Enabled() {
 		c.CollectIPv6Conns = false
 		log.Info("network tracer IPv6 tracing disabled by system")
@@ -219,3 +341,36 @@ func New() *Config {
 
 	return c
 }
+
+// parseReplaceRules unmarshals the replace rules and compiles their regular expressions.
+// If it fails it returns the first error.
+func parseReplaceRules(cfg ddconfig.Config, key string) ([]*ReplaceRule, error) {
+	rules := make([]*ReplaceRule, 0)
+	if err := cfg.UnmarshalKey(key, &rules); err != nil {
+		return nil, err
+	}
+
+	for _, r := range rules {
+		if r.Pattern == "" {
+			return nil, errors.New(`all rules must have a "pattern"`)
+		}
+		re, err := regexp.Compile(r.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("pattern %q: %s", r.Pattern, err)
+		}
+		r.Re = re
+	}
+	return rules, nil
+}
+
+func parsePorts(values []string) ([]uint16, error) {
+	var ports []uint16
+	for _, v := range values {
+		port, err := strconv.ParseUint(v, 10, 16)
+		if err != nil || port == 0 {
+			return nil, fmt.Errorf("invalid port %q", v)
+		}
+		ports = append(ports, uint16(port))
+	}
+	return ports, nil
+}
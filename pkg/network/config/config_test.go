@@ -2,8 +2,10 @@ package config
 
 import (
 	"os"
+	"regexp"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
 
@@ -230,3 +232,269 @@ func TestSettingMaxDNSStats(t *testing.T) {
 		assert.Equal(t, 10000, cfg.MaxDNSStats)
 	})
 }
+
+func TestHTTPBufferSize(t *testing.T) {
+	t.Run("via YAML", func(t *testing.T) {
+		newConfig()
+		defer restoreGlobalConfig()
+		_, err := sysconfig.New("./testdata/TestDDAgentConfigYamlAndSystemProbeConfig-HTTPBufferSize.yaml")
+		require.NoError(t, err)
+		cfg := New()
+
+		assert.Equal(t, 120, cfg.HTTPBufferSize)
+	})
+
+	t.Run("via ENV variable", func(t *testing.T) {
+		newConfig()
+		defer restoreGlobalConfig()
+		_, err := sysconfig.New("")
+		require.NoError(t, err)
+		cfg := New()
+
+		assert.Equal(t, 25, cfg.HTTPBufferSize) // default value
+
+		newConfig()
+		os.Setenv("DD_SYSTEM_PROBE_NETWORK_HTTP_BUFFER_SIZE", "64")
+		defer os.Unsetenv("DD_SYSTEM_PROBE_NETWORK_HTTP_BUFFER_SIZE")
+		_, err = sysconfig.New("")
+		require.NoError(t, err)
+		cfg = New()
+
+		assert.Equal(t, 64, cfg.HTTPBufferSize)
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		newConfig()
+		defer restoreGlobalConfig()
+		os.Setenv("DD_SYSTEM_PROBE_NETWORK_HTTP_BUFFER_SIZE", "-1")
+		defer os.Unsetenv("DD_SYSTEM_PROBE_NETWORK_HTTP_BUFFER_SIZE")
+		_, err := sysconfig.New("")
+		require.NoError(t, err)
+		cfg := New()
+
+		assert.Equal(t, 25, cfg.HTTPBufferSize)
+	})
+}
+
+func TestHTTPFlushInterval(t *testing.T) {
+	newConfig()
+	defer restoreGlobalConfig()
+	_, err := sysconfig.New("")
+	require.NoError(t, err)
+	cfg := New()
+
+	assert.Equal(t, 30*time.Second, cfg.HTTPFlushInterval) // default value
+
+	newConfig()
+	os.Setenv("DD_SYSTEM_PROBE_NETWORK_HTTP_FLUSH_INTERVAL_IN_S", "5")
+	defer os.Unsetenv("DD_SYSTEM_PROBE_NETWORK_HTTP_FLUSH_INTERVAL_IN_S")
+	_, err = sysconfig.New("")
+	require.NoError(t, err)
+	cfg = New()
+
+	assert.Equal(t, 5*time.Second, cfg.HTTPFlushInterval)
+
+	newConfig()
+	os.Setenv("DD_SYSTEM_PROBE_NETWORK_HTTP_FLUSH_INTERVAL_IN_S", "0")
+	_, err = sysconfig.New("")
+	require.NoError(t, err)
+	cfg = New()
+
+	assert.Equal(t, 30*time.Second, cfg.HTTPFlushInterval)
+}
+
+func TestHTTPCapturedHeaders(t *testing.T) {
+	newConfig()
+	defer restoreGlobalConfig()
+	_, err := sysconfig.New("")
+	require.NoError(t, err)
+	cfg := New()
+
+	assert.Empty(t, cfg.HTTPCapturedHeaders) // default value
+
+	newConfig()
+	os.Setenv("DD_SYSTEM_PROBE_NETWORK_HTTP_CAPTURED_HEADERS", "X-Correlation-Id User-Agent")
+	defer os.Unsetenv("DD_SYSTEM_PROBE_NETWORK_HTTP_CAPTURED_HEADERS")
+	_, err = sysconfig.New("")
+	require.NoError(t, err)
+	cfg = New()
+
+	assert.Equal(t, []string{"X-Correlation-Id", "User-Agent"}, cfg.HTTPCapturedHeaders)
+}
+
+func TestHTTPMaxTrackedConnections(t *testing.T) {
+	newConfig()
+	defer restoreGlobalConfig()
+	_, err := sysconfig.New("")
+	require.NoError(t, err)
+	cfg := New()
+
+	assert.Equal(t, 65536, cfg.HTTPMaxTrackedConnections) // defaults to max_tracked_connections
+
+	newConfig()
+	os.Setenv("DD_SYSTEM_PROBE_NETWORK_HTTP_MAX_TRACKED_CONNECTIONS", "1024")
+	defer os.Unsetenv("DD_SYSTEM_PROBE_NETWORK_HTTP_MAX_TRACKED_CONNECTIONS")
+	_, err = sysconfig.New("")
+	require.NoError(t, err)
+	cfg = New()
+
+	assert.Equal(t, 1024, cfg.HTTPMaxTrackedConnections)
+}
+
+func TestHTTPDirection(t *testing.T) {
+	newConfig()
+	defer restoreGlobalConfig()
+	_, err := sysconfig.New("")
+	require.NoError(t, err)
+	cfg := New()
+
+	assert.Equal(t, "", cfg.HTTPDirection) // default value
+
+	newConfig()
+	os.Setenv("DD_SYSTEM_PROBE_NETWORK_HTTP_DIRECTION", "inbound")
+	defer os.Unsetenv("DD_SYSTEM_PROBE_NETWORK_HTTP_DIRECTION")
+	_, err = sysconfig.New("")
+	require.NoError(t, err)
+	cfg = New()
+
+	assert.Equal(t, "inbound", cfg.HTTPDirection)
+
+	newConfig()
+	os.Setenv("DD_SYSTEM_PROBE_NETWORK_HTTP_DIRECTION", "sideways")
+	_, err = sysconfig.New("")
+	require.NoError(t, err)
+	cfg = New()
+
+	assert.Equal(t, "", cfg.HTTPDirection)
+}
+
+func TestHTTPPorts(t *testing.T) {
+	t.Run("via YAML", func(t *testing.T) {
+		newConfig()
+		defer restoreGlobalConfig()
+		_, err := sysconfig.New("./testdata/TestDDAgentConfigYamlAndSystemProbeConfig-HTTPPorts.yaml")
+		require.NoError(t, err)
+		cfg := New()
+
+		assert.Equal(t, []uint16{80, 8080}, cfg.HTTPAllowedPorts)
+		assert.Equal(t, []uint16{8081}, cfg.HTTPDeniedPorts)
+	})
+
+	t.Run("via ENV variable", func(t *testing.T) {
+		newConfig()
+		defer restoreGlobalConfig()
+		_, err := sysconfig.New("")
+		require.NoError(t, err)
+		cfg := New()
+
+		assert.Empty(t, cfg.HTTPAllowedPorts)
+		assert.Empty(t, cfg.HTTPDeniedPorts)
+
+		newConfig()
+		os.Setenv("DD_SYSTEM_PROBE_NETWORK_HTTP_ALLOWED_PORTS", "80 443")
+		defer os.Unsetenv("DD_SYSTEM_PROBE_NETWORK_HTTP_ALLOWED_PORTS")
+		os.Setenv("DD_SYSTEM_PROBE_NETWORK_HTTP_DENIED_PORTS", "8081")
+		defer os.Unsetenv("DD_SYSTEM_PROBE_NETWORK_HTTP_DENIED_PORTS")
+		_, err = sysconfig.New("")
+		require.NoError(t, err)
+		cfg = New()
+
+		assert.Equal(t, []uint16{80, 443}, cfg.HTTPAllowedPorts)
+		assert.Equal(t, []uint16{8081}, cfg.HTTPDeniedPorts)
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		newConfig()
+		defer restoreGlobalConfig()
+		os.Setenv("DD_SYSTEM_PROBE_NETWORK_HTTP_ALLOWED_PORTS", "80 http")
+		defer os.Unsetenv("DD_SYSTEM_PROBE_NETWORK_HTTP_ALLOWED_PORTS")
+		_, err := sysconfig.New("")
+		require.NoError(t, err)
+		cfg := New()
+
+		assert.Empty(t, cfg.HTTPAllowedPorts)
+	})
+}
+
+func TestHTTPReplaceRules(t *testing.T) {
+	expected := []*ReplaceRule{
+		{
+			Pattern: "/users/(.*)",
+			Re:      regexp.MustCompile("/users/(.*)"),
+			Repl:    "/users/?",
+		},
+		{
+			Pattern: "foo",
+			Re:      regexp.MustCompile("foo"),
+			Repl:    "bar",
+		},
+		{
+			Pattern: "payment_id",
+			Re:      regexp.MustCompile("payment_id"),
+		},
+	}
+
+	t.Run("via YAML", func(t *testing.T) {
+		newConfig()
+		defer restoreGlobalConfig()
+
+		_, err := sysconfig.New("./testdata/TestDDAgentConfigYamlAndSystemProbeConfig-HTTPReplaceRules.yaml")
+		require.NoError(t, err)
+		cfg := New()
+
+		assert.Equal(t, expected, cfg.HTTPReplaceRules)
+	})
+
+	t.Run("via ENV variable", func(t *testing.T) {
+		newConfig()
+		defer restoreGlobalConfig()
+
+		os.Setenv("DD_SYSTEM_PROBE_NETWORK_HTTP_REPLACE_RULES", `
+		[
+			{"pattern": "/users/(.*)", "repl": "/users/?"},
+			{"pattern": "foo", "repl": "bar"},
+			{"pattern": "payment_id"}
+		]
+		`)
+		defer os.Unsetenv("DD_SYSTEM_PROBE_NETWORK_HTTP_REPLACE_RULES")
+		_, err := sysconfig.New("")
+		require.NoError(t, err)
+		cfg := New()
+
+		assert.Equal(t, expected, cfg.HTTPReplaceRules)
+	})
+
+	t.Run("invalid pattern", func(t *testing.T) {
+		newConfig()
+		defer restoreGlobalConfig()
+
+		os.Setenv("DD_SYSTEM_PROBE_NETWORK_HTTP_REPLACE_RULES", `[{"pattern": "(", "repl": "bar"}]`)
+		defer os.Unsetenv("DD_SYSTEM_PROBE_NETWORK_HTTP_REPLACE_RULES")
+		_, err := sysconfig.New("")
+		require.NoError(t, err)
+		cfg := New()
+
+		assert.Empty(t, cfg.HTTPReplaceRules)
+	})
+}
+
+func TestHTTPBatchCompression(t *testing.T) {
+	newConfig()
+	defer restoreGlobalConfig()
+	_, err := sysconfig.New("")
+	require.NoError(t, err)
+	cfg := New()
+
+	assert.Equal(t, "", cfg.HTTPBatchCompression) // default value
+
+	for value, expected := range map[string]string{"gzip": "gzip", "zstd": "zstd", "lz4": ""} {
+		newConfig()
+		os.Setenv("DD_SYSTEM_PROBE_NETWORK_HTTP_BATCH_COMPRESSION", value)
+		_, err = sysconfig.New("")
+		require.NoError(t, err)
+		cfg = New()
+
+		assert.Equal(t, expected, cfg.HTTPBatchCompression)
+	}
+	os.Unsetenv("DD_SYSTEM_PROBE_NETWORK_HTTP_BATCH_COMPRESSION")
+}
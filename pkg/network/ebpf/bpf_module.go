@@ -23,12 +23,16 @@ func ReadBPFModule(bpfDir string, debug bool) (bytecode.AssetReader, error) {
 	return ebpfReader, nil
 }
 
-// ReadHTTPModule from the asset file
-func ReadHTTPModule(bpfDir string, debug bool) (bytecode.AssetReader, error) {
-	file := "http.o"
+// ReadHTTPModule from the asset file, large selects the http-large program capturing larger request fragments
+func ReadHTTPModule(bpfDir string, debug bool, large bool) (bytecode.AssetReader, error) {
+	file := "http"
+	if large {
+		file = "http-large"
+	}
 	if debug {
-		file = "http-debug.o"
+		file += "-debug"
 	}
+	file += ".o"
 
 	ebpfReader, err := bytecode.GetReader(bpfDir, file)
 	if err != nil {
@@ -45,4 +45,34 @@ struct bpf_map_def SEC("maps/http_batch_state") http_batch_state = {
     .namespace = "",
 };
 
+/* This map associates OpenSSL contexts (SSL*) to the socket file descriptor set with SSL_set_fd */
+struct bpf_map_def SEC("maps/ssl_sock_by_ctx") ssl_sock_by_ctx = {
+    .type = BPF_MAP_TYPE_HASH,
+    .key_size = sizeof(ssl_ctx_key_t),
+    .value_size = sizeof(__u32),
+    .max_entries = 0, // This will get overridden at runtime using max_tracked_connections
+    .pinning = 0,
+    .namespace = "",
+};
+
+/* This map is used for notifying userspace of the socket file descriptors set on and released by the OpenSSL contexts */
+struct bpf_map_def SEC("maps/ssl_sock_events") ssl_sock_events = {
+    .type = BPF_MAP_TYPE_PERF_EVENT_ARRAY,
+    .key_size = sizeof(__u32),
+    .value_size = sizeof(__u32),
+    .max_entries = 0, // This will get overridden at runtime
+    .pinning = 0,
+    .namespace = "",
+};
+
+/* This map stores the SSL_read arguments of each thread until the call returns */
+struct bpf_map_def SEC("maps/ssl_read_args") ssl_read_args = {
+    .type = BPF_MAP_TYPE_HASH,
+    .key_size = sizeof(__u64),
+    .value_size = sizeof(ssl_read_args_t),
+    .max_entries = 1024,
+    .pinning = 0,
+    .namespace = "",
+};
+
 #endif
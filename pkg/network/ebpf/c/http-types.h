@@ -3,8 +3,19 @@
 
 #include "tracer.h"
 
-// This determines the size of the payload fragment that is captured for each HTTP request
-#define HTTP_BUFFER_SIZE 25
+// This determines the size of the payload fragment stored for each HTTP request.
+// The fragment is part of every transaction of the in-flight and batch maps, so the default program
+// keeps it small, and the http-large program, built with HTTP_LARGE_BUFFER, captures longer request paths.
+// The number of bytes actually captured is configured from userspace with the http_buffer_size constant
+#define HTTP_DEFAULT_BUFFER_SIZE 25
+#define HTTP_LARGE_BUFFER_SIZE (8 * 20)
+#ifdef HTTP_LARGE_BUFFER
+#define HTTP_BUFFER_SIZE HTTP_LARGE_BUFFER_SIZE
+#else
+#define HTTP_BUFFER_SIZE HTTP_DEFAULT_BUFFER_SIZE
+#endif
+// Packets with a smaller payload can't hold the beginning of a HTTP request or response
+#define HTTP_MIN_FRAGMENT_SIZE 16
 // This controls the number of HTTP transactions read from userspace at a time
 #define HTTP_BATCH_SIZE 15
 // The greater this number is the less likely are colisions/data-races between the flushes
@@ -29,6 +40,24 @@ typedef enum
     HTTP_PATCH
 } http_method_t;
 
+// HTTPS transactions are captured by the OpenSSL uprobes, where the socket tuple isn't available.
+// Their tuple only holds the pid and the socket file descriptor, it gets resolved from userspace.
+// The role tells which side of the connection the process is on.
+typedef enum
+{
+    HTTP_TLS_NONE,
+    HTTP_TLS_CLIENT,
+    HTTP_TLS_SERVER
+} http_tls_role_t;
+
+// The direction of a transaction isn't known by the socket filter, it is resolved from userspace.
+typedef enum
+{
+    HTTP_DIRECTION_UNKNOWN,
+    HTTP_DIRECTION_INBOUND,
+    HTTP_DIRECTION_OUTBOUND
+} http_direction_t;
+
 typedef struct {
     // idx is a monotonic counter used for uniquely determinng a batch within a CPU core
     // this is useful for detecting race conditions that result in a batch being overrriden
@@ -54,6 +83,8 @@ typedef struct {
 typedef struct {
     conn_tuple_t tup;
     __u8 request_method;
+    __u8 tls_role;
+    __u8 direction;
     __u64 request_started;
     __u16 response_status_code;
     __u64 response_last_seen;
@@ -66,6 +97,34 @@ typedef struct {
     http_transaction_t txs[HTTP_BATCH_SIZE];
 } http_batch_t;
 
+// The SSL_read arguments are stored until the uretprobe can read the decrypted data
+typedef struct {
+    void *ctx;
+    void *buf;
+} ssl_read_args_t;
+
+// ssl_ctx_key_t identifies an OpenSSL context (SSL*), the pointer is only unique within a process
+// since forked workers share the address space layout of their parent
+typedef struct {
+    void *ctx;
+    __u32 tgid;
+    __u32 _pad;
+} ssl_ctx_key_t;
+
+typedef enum
+{
+    SSL_SOCK_SET = 1,
+    SSL_SOCK_SHUTDOWN
+} ssl_sock_event_type_t;
+
+// ssl_sock_event_t notifies userspace that a socket file descriptor was set on an OpenSSL context,
+// or that the context was shut down, so that the socket tuple is resolved while the descriptor is open
+typedef struct {
+    __u32 pid;
+    __u32 fd;
+    __u32 type;
+} ssl_sock_event_t;
+
 // http_batch_notification_t is flushed to userspace every time we complete a
 // batch (that is, when we fill a page with HTTP_BATCH_SIZE entries). uppon
 // receiving this notification the userpace program is then supposed to fetch
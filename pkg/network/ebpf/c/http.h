@@ -7,6 +7,22 @@
 
 #include <uapi/linux/ptrace.h>
 
+/* The LOAD_CONSTANT macro is used to define a named constant that will be replaced
+ * at runtime by the Go code, see prebuilt/tracer.c.
+ */
+#ifndef LOAD_CONSTANT
+#define LOAD_CONSTANT(param, var) asm("%0 = " param " ll" \
+                                      : "=r"(var))
+#endif
+
+// http_buffer_size returns the number of bytes captured for each HTTP request fragment,
+// it is never greater than HTTP_BUFFER_SIZE
+static __always_inline __u64 http_buffer_size() {
+    __u64 val = 0;
+    LOAD_CONSTANT("http_buffer_size", val);
+    return val;
+}
+
 static __always_inline void http_prepare_key(u32 cpu, http_batch_key_t *key, http_batch_state_t *batch_state) {
     __builtin_memset(key, 0, sizeof(http_batch_key_t));
     key->cpu = cpu;
@@ -148,16 +164,7 @@ static __always_inline int http_begin_response(http_transaction_t *http, const c
     return 1;
 }
 
-static __always_inline void http_read_data(struct __sk_buff *skb, skb_info_t *skb_info, char *p, http_packet_t *packet_type, http_method_t *method) {
-    if (skb->len - skb_info->data_off < HTTP_BUFFER_SIZE) {
-        return;
-    }
-
-#pragma unroll
-    for (int i = 0; i < HTTP_BUFFER_SIZE; i++) {
-        p[i] = load_byte(skb, skb_info->data_off + i);
-    }
-
+static __always_inline void http_parse_data(char *p, http_packet_t *packet_type, http_method_t *method) {
     if ((p[0] == 'H') && (p[1] == 'T') && (p[2] == 'T') && (p[3] == 'P')) {
         *packet_type = HTTP_RESPONSE;
     } else if ((p[0] == 'G') && (p[1] == 'E') && (p[2] == 'T')) {
@@ -184,25 +191,37 @@ static __always_inline void http_read_data(struct __sk_buff *skb, skb_info_t *sk
     }
 }
 
-static __always_inline int http_handle_packet(struct __sk_buff *skb, skb_info_t *skb_info) {
-    char buffer[HTTP_BUFFER_SIZE];
-    __builtin_memset(&buffer, '\0', sizeof(buffer));
+static __always_inline void http_read_data(struct __sk_buff *skb, skb_info_t *skb_info, char *p, http_packet_t *packet_type, http_method_t *method) {
+    __u32 len = skb->len - skb_info->data_off;
+    if (len < HTTP_MIN_FRAGMENT_SIZE) {
+        return;
+    }
 
-    http_packet_t packet_type = HTTP_PACKET_UNKNOWN;
-    http_method_t method = HTTP_METHOD_UNKNOWN;
-    http_read_data(skb, skb_info, buffer, &packet_type, &method);
+    __u64 size = http_buffer_size();
+#pragma unroll
+    for (int i = 0; i < HTTP_BUFFER_SIZE; i++) {
+        if (i >= size || i >= len) {
+            break;
+        }
+        p[i] = load_byte(skb, skb_info->data_off + i);
+    }
 
+    http_parse_data(p, packet_type, method);
+}
+
+// http_process updates the in-flight transaction of the given tuple with a request or a response fragment
+static __always_inline http_transaction_t *http_process(conn_tuple_t *tup, char *buffer, http_packet_t packet_type, http_method_t method) {
     if (packet_type == HTTP_REQUEST) {
         // Ensure the creation of a http_transaction_t entry for tracking this request
         http_transaction_t new_entry = {};
-        __builtin_memcpy(&new_entry.tup, &skb_info->tup, sizeof(conn_tuple_t));
-        bpf_map_update_elem(&http_in_flight, &skb_info->tup, &new_entry, BPF_NOEXIST);
+        __builtin_memcpy(&new_entry.tup, tup, sizeof(conn_tuple_t));
+        bpf_map_update_elem(&http_in_flight, tup, &new_entry, BPF_NOEXIST);
     }
 
-    http_transaction_t *http = bpf_map_lookup_elem(&http_in_flight, &skb_info->tup);
+    http_transaction_t *http = bpf_map_lookup_elem(&http_in_flight, tup);
     if (http == NULL) {
         // This happens when we lose the beginning of a HTTP request
-        return 0;
+        return NULL;
     }
 
     if (packet_type == HTTP_REQUEST) {
@@ -213,6 +232,22 @@ static __always_inline int http_handle_packet(struct __sk_buff *skb, skb_info_t
         http_begin_response(http, buffer);
     }
 
+    return http;
+}
+
+static __always_inline int http_handle_packet(struct __sk_buff *skb, skb_info_t *skb_info) {
+    char buffer[HTTP_BUFFER_SIZE];
+    __builtin_memset(&buffer, '\0', sizeof(buffer));
+
+    http_packet_t packet_type = HTTP_PACKET_UNKNOWN;
+    http_method_t method = HTTP_METHOD_UNKNOWN;
+    http_read_data(skb, skb_info, buffer, &packet_type, &method);
+
+    http_transaction_t *http = http_process(&skb_info->tup, buffer, packet_type, method);
+    if (http == NULL) {
+        return 0;
+    }
+
     if (http_responding(http)) {
         if (skb->len - 1 > skb_info->data_off) {
             // Only if we have a (L7/application-layer) payload we want to update the response_last_seen
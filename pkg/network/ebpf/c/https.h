@@ -0,0 +1,117 @@
+#ifndef __HTTPS_H
+#define __HTTPS_H
+
+#include "tracer.h"
+#include "http-types.h"
+#include "http-maps.h"
+#include "http.h"
+
+// https_prepare_tuple builds the tuple identifying a TLS connection: the socket tuple isn't
+// available from the OpenSSL uprobes so the connection is identified by the pid and the socket
+// file descriptor, which are resolved into the socket tuple from userspace
+static __always_inline void https_prepare_tuple(conn_tuple_t *tup, u32 pid, u32 fd) {
+    __builtin_memset(tup, 0, sizeof(conn_tuple_t));
+    tup->pid = pid;
+    tup->saddr_l = fd;
+    tup->metadata = CONN_TYPE_TCP;
+}
+
+static __always_inline void https_ctx_key(ssl_ctx_key_t *key, void *ssl_ctx) {
+    __builtin_memset(key, 0, sizeof(ssl_ctx_key_t));
+    key->ctx = ssl_ctx;
+    key->tgid = bpf_get_current_pid_tgid() >> 32;
+}
+
+// https_notify_sock sends the socket file descriptor of an OpenSSL context to userspace
+static __always_inline void https_notify_sock(struct pt_regs *ctx, u32 fd, ssl_sock_event_type_t type) {
+    ssl_sock_event_t event = { 0 };
+    event.pid = bpf_get_current_pid_tgid() >> 32;
+    event.fd = fd;
+    event.type = type;
+    u32 cpu = bpf_get_smp_processor_id();
+    bpf_perf_event_output(ctx, &ssl_sock_events, cpu, &event, sizeof(ssl_sock_event_t));
+}
+
+// https_set_sock associates a socket file descriptor to an OpenSSL context
+static __always_inline void https_set_sock(struct pt_regs *ctx, void *ssl_ctx, u32 fd) {
+    ssl_ctx_key_t key;
+    https_ctx_key(&key, ssl_ctx);
+    bpf_map_update_elem(&ssl_sock_by_ctx, &key, &fd, BPF_ANY);
+    https_notify_sock(ctx, fd, SSL_SOCK_SET);
+}
+
+static __always_inline int https_read_tuple(void *ssl_ctx, conn_tuple_t *tup) {
+    ssl_ctx_key_t key;
+    https_ctx_key(&key, ssl_ctx);
+    u32 *fd = bpf_map_lookup_elem(&ssl_sock_by_ctx, &key);
+    if (fd == NULL) {
+        // The SSL_set_fd call happened before the uprobes were attached
+        return 0;
+    }
+
+    https_prepare_tuple(tup, key.tgid, *fd);
+    return 1;
+}
+
+// https_process handles the len bytes of decrypted data read or written by the process, request_role
+// tells which side of the connection the process is on when the data is a HTTP request
+static __always_inline void https_process(void *ssl_ctx, void *data, __u64 len, http_tls_role_t request_role) {
+    conn_tuple_t tup;
+    if (!https_read_tuple(ssl_ctx, &tup)) {
+        return;
+    }
+
+    char buffer[HTTP_BUFFER_SIZE];
+    __builtin_memset(&buffer, '\0', sizeof(buffer));
+    __u64 size = http_buffer_size();
+    if (size > sizeof(buffer)) {
+        size = sizeof(buffer);
+    }
+    // the data past len wasn't written by OpenSSL, len is bounded first for the verifier
+    if (len > sizeof(buffer)) {
+        len = sizeof(buffer);
+    }
+    if (size > len) {
+        size = len;
+    }
+    bpf_probe_read(&buffer, size, data);
+
+    http_packet_t packet_type = HTTP_PACKET_UNKNOWN;
+    http_method_t method = HTTP_METHOD_UNKNOWN;
+    http_parse_data(buffer, &packet_type, &method);
+
+    http_transaction_t *http = http_process(&tup, buffer, packet_type, method);
+    if (http == NULL) {
+        return;
+    }
+
+    if (packet_type == HTTP_REQUEST) {
+        http->tls_role = request_role;
+    }
+
+    if (http_responding(http)) {
+        http->response_last_seen = bpf_ktime_get_ns();
+    }
+}
+
+// https_finish flushes the in-flight transaction of a TLS connection being shut down,
+// there is no FIN flag telling when the last response ended
+static __always_inline void https_finish(struct pt_regs *ctx, void *ssl_ctx) {
+    conn_tuple_t tup;
+    if (!https_read_tuple(ssl_ctx, &tup)) {
+        return;
+    }
+
+    http_transaction_t *http = bpf_map_lookup_elem(&http_in_flight, &tup);
+    if (http != NULL) {
+        http_end_response(http);
+        bpf_map_delete_elem(&http_in_flight, &tup);
+    }
+
+    ssl_ctx_key_t key;
+    https_ctx_key(&key, ssl_ctx);
+    bpf_map_delete_elem(&ssl_sock_by_ctx, &key);
+    https_notify_sock(ctx, tup.saddr_l, SSL_SOCK_SHUTDOWN);
+}
+
+#endif
@@ -4,6 +4,7 @@
 #include "ip.h"
 #include "ipv6.h"
 #include "http.h"
+#include "https.h"
 
 SEC("socket/http_filter")
 int socket__http_filter(struct __sk_buff* skb) {
@@ -35,6 +36,64 @@ int kretprobe__tcp_sendmsg(struct pt_regs* ctx) {
     return 0;
 }
 
+// The OpenSSL uprobes below are only attached when HTTPS monitoring is enabled
+
+SEC("uprobe/SSL_set_fd")
+int uprobe__SSL_set_fd(struct pt_regs* ctx) {
+    void *ssl_ctx = (void *)PT_REGS_PARM1(ctx);
+    u32 fd = (u32)PT_REGS_PARM2(ctx);
+    https_set_sock(ctx, ssl_ctx, fd);
+    return 0;
+}
+
+SEC("uprobe/SSL_read")
+int uprobe__SSL_read(struct pt_regs* ctx) {
+    u64 pid_tgid = bpf_get_current_pid_tgid();
+    ssl_read_args_t args = { 0 };
+    args.ctx = (void *)PT_REGS_PARM1(ctx);
+    args.buf = (void *)PT_REGS_PARM2(ctx);
+    bpf_map_update_elem(&ssl_read_args, &pid_tgid, &args, BPF_ANY);
+    return 0;
+}
+
+SEC("uretprobe/SSL_read")
+int uretprobe__SSL_read(struct pt_regs* ctx) {
+    u64 pid_tgid = bpf_get_current_pid_tgid();
+    ssl_read_args_t *args = bpf_map_lookup_elem(&ssl_read_args, &pid_tgid);
+    if (args == NULL) {
+        return 0;
+    }
+
+    int len = (int)PT_REGS_RC(ctx);
+    if (len > 0) {
+        // A process reading a request is the server side of the connection
+        https_process(args->ctx, args->buf, len, HTTP_TLS_SERVER);
+    }
+
+    bpf_map_delete_elem(&ssl_read_args, &pid_tgid);
+    return 0;
+}
+
+SEC("uprobe/SSL_write")
+int uprobe__SSL_write(struct pt_regs* ctx) {
+    void *ssl_ctx = (void *)PT_REGS_PARM1(ctx);
+    void *buf = (void *)PT_REGS_PARM2(ctx);
+    int len = (int)PT_REGS_PARM3(ctx);
+    if (len <= 0) {
+        return 0;
+    }
+    // A process writing a request is the client side of the connection
+    https_process(ssl_ctx, buf, len, HTTP_TLS_CLIENT);
+    return 0;
+}
+
+SEC("uprobe/SSL_shutdown")
+int uprobe__SSL_shutdown(struct pt_regs* ctx) {
+    void *ssl_ctx = (void *)PT_REGS_PARM1(ctx);
+    https_finish(ctx, ssl_ctx);
+    return 0;
+}
+
 // This number will be interpreted by elf-loader to set the current running kernel version
 __u32 _version SEC("version") = 0xFFFFFFFE; // NOLINT(bugprone-reserved-identifier)
 
@@ -82,6 +82,17 @@ const (
 	// SocketHTTPFilter is the socket probe for HTTP
 	SocketHTTPFilter ProbeName = "socket/http_filter"
 
+	// SSLSetFD is the uprobe of the OpenSSL SSL_set_fd call
+	SSLSetFD ProbeName = "uprobe/SSL_set_fd"
+	// SSLRead is the uprobe of the OpenSSL SSL_read call
+	SSLRead ProbeName = "uprobe/SSL_read"
+	// SSLReadReturn is the uretprobe of the OpenSSL SSL_read call
+	SSLReadReturn ProbeName = "uretprobe/SSL_read"
+	// SSLWrite is the uprobe of the OpenSSL SSL_write call
+	SSLWrite ProbeName = "uprobe/SSL_write"
+	// SSLShutdown is the uprobe of the OpenSSL SSL_shutdown call
+	SSLShutdown ProbeName = "uprobe/SSL_shutdown"
+
 	// IPRouteOutputFlow is the kprobe of a ip_route_output_flow call
 	IPRouteOutputFlow ProbeName = "kprobe/ip_route_output_flow"
 	// IPRouteOutputFlow is the kretprobe of a ip_route_output_flow call
@@ -107,6 +118,9 @@ const (
 	HttpBatchesMap        BPFMapName = "http_batches"
 	HttpBatchStateMap     BPFMapName = "http_batch_state"
 	HttpNotificationsMap  BPFMapName = "http_notifications"
+	SSLSockByCtxMap       BPFMapName = "ssl_sock_by_ctx"
+	SSLReadArgsMap        BPFMapName = "ssl_read_args"
+	SSLSockEventsMap      BPFMapName = "ssl_sock_events"
 	GatewayMap            BPFMapName = "ip_route_dest_gateways"
 	ConntrackMap          BPFMapName = "conntrack"
 	ConntrackTelemetryMap BPFMapName = "conntrack_telemetry"
@@ -0,0 +1,147 @@
+// +build linux_bpf
+
+package http
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io/ioutil"
+	"unsafe"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// BatchCodec is the compression applied to the HTTP transaction batches handed to the batch handler
+type BatchCodec string
+
+// Codecs of the HTTP transaction batches
+const (
+	BatchCodecNone BatchCodec = ""
+	BatchCodecGzip BatchCodec = "gzip"
+	BatchCodecZstd BatchCodec = "zstd"
+)
+
+// BatchTransactionSize is the size of a transaction in the payload of an EncodedBatch
+const BatchTransactionSize = int(unsafe.Sizeof(httpTX{}))
+
+// txSize is the size of a transaction as laid out by the http-large eBPF program
+const txSize = BatchTransactionSize
+
+// EncodedBatch is a batch of HTTP transactions serialized with their eBPF layout then compressed with Codec,
+// it is meant to be handed to a consumer running out of process.
+//
+// Once decompressed, the payload is the concatenation of the transactions, each of them BatchTransactionSize
+// bytes long and laid out as the http_transaction_t struct of pkg/network/ebpf/c/http-types.h built with
+// HTTP_LARGE_BUFFER, whatever the program the transactions were captured with, in the byte order
+// and with the alignment of the host: the conn_tuple_t of the connection, then the request method, the TLS role,
+// the direction, the request start in nanoseconds since boot, the response status code, the last time the response
+// was seen in nanoseconds since boot and the first HTTPBufferSize bytes of the request, zero-padded when fewer
+// bytes were captured.
+type EncodedBatch struct {
+	Codec   BatchCodec
+	Payload []byte
+}
+
+// batchEncoder encodes the HTTP transaction batches with a codec, it reuses its compression writer
+// across the batches and isn't safe for concurrent use.
+type batchEncoder struct {
+	codec BatchCodec
+	gzip  *gzip.Writer
+	zstd  *zstd.Encoder
+}
+
+func newBatchEncoder(codec BatchCodec) (*batchEncoder, error) {
+	e := &batchEncoder{codec: codec}
+	switch codec {
+	case BatchCodecNone:
+	case BatchCodecGzip:
+		e.gzip = gzip.NewWriter(nil)
+	case BatchCodecZstd:
+		w, err := zstd.NewWriter(nil)
+		if err != nil {
+			return nil, err
+		}
+		e.zstd = w
+	default:
+		return nil, fmt.Errorf("unsupported http batch codec %q", codec)
+	}
+	return e, nil
+}
+
+func (e *batchEncoder) encode(transactions []httpTX) (EncodedBatch, error) {
+	var raw []byte
+	if len(transactions) > 0 {
+		n := len(transactions) * txSize
+		raw = (*[1 << 30]byte)(unsafe.Pointer(&transactions[0]))[:n:n]
+	}
+
+	var payload []byte
+	switch e.codec {
+	case BatchCodecNone:
+		// the transactions are copied since the handler may keep the payload
+		payload = append([]byte(nil), raw...)
+	case BatchCodecGzip:
+		var buf bytes.Buffer
+		e.gzip.Reset(&buf)
+		if _, err := e.gzip.Write(raw); err != nil {
+			return EncodedBatch{}, err
+		}
+		if err := e.gzip.Close(); err != nil {
+			return EncodedBatch{}, err
+		}
+		payload = buf.Bytes()
+	case BatchCodecZstd:
+		payload = e.zstd.EncodeAll(raw, nil)
+	}
+
+	return EncodedBatch{Codec: e.codec, Payload: payload}, nil
+}
+
+// Decompress returns the serialized transactions of the batch, see EncodedBatch for their layout
+func (b EncodedBatch) Decompress() ([]byte, error) {
+	var raw []byte
+	switch b.Codec {
+	case BatchCodecNone:
+		raw = b.Payload
+	case BatchCodecGzip:
+		r, err := gzip.NewReader(bytes.NewReader(b.Payload))
+		if err != nil {
+			return nil, err
+		}
+		defer r.Close()
+		if raw, err = ioutil.ReadAll(r); err != nil {
+			return nil, err
+		}
+	case BatchCodecZstd:
+		r, err := zstd.NewReader(nil)
+		if err != nil {
+			return nil, err
+		}
+		defer r.Close()
+		if raw, err = r.DecodeAll(b.Payload, nil); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unsupported http batch codec %q", b.Codec)
+	}
+
+	if len(raw)%BatchTransactionSize != 0 {
+		return nil, fmt.Errorf("invalid http batch size %d, should be a multiple of %d", len(raw), BatchTransactionSize)
+	}
+	return raw, nil
+}
+
+// decode returns the transactions of the batch
+func (b EncodedBatch) decode() ([]httpTX, error) {
+	raw, err := b.Decompress()
+	if err != nil {
+		return nil, err
+	}
+
+	transactions := make([]httpTX, len(raw)/txSize)
+	if len(transactions) > 0 {
+		copy((*[1 << 30]byte)(unsafe.Pointer(&transactions[0]))[:len(raw):len(raw)], raw)
+	}
+	return transactions, nil
+}
@@ -0,0 +1,89 @@
+// +build linux_bpf
+
+package http
+
+import (
+	"testing"
+
+	"github.com/DataDog/datadog-agent/pkg/network/config"
+	"github.com/DataDog/datadog-agent/pkg/process/util"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEncodedBatchRoundTrip(t *testing.T) {
+	sourceIP := util.AddressFromString("1.1.1.1")
+	destIP := util.AddressFromString("2.2.2.2")
+	transactions := []httpTX{
+		generateIPv4HTTPTransaction(sourceIP, destIP, 1234, 8080, "/foo", 200, 10),
+		generateIPv4HTTPTransaction(sourceIP, destIP, 1235, 8080, "/bar", 404, 20),
+		generateIPv6HTTPTransaction(util.AddressFromString("::1"), util.AddressFromString("::2"), 1236, 443, "/baz", 500, 30),
+	}
+
+	for name, codec := range map[string]BatchCodec{"none": BatchCodecNone, "gzip": BatchCodecGzip, "zstd": BatchCodecZstd} {
+		t.Run(name, func(t *testing.T) {
+			encoder, err := newBatchEncoder(codec)
+			require.NoError(t, err)
+
+			// the compression writer is reused across the batches
+			for i := 0; i < 2; i++ {
+				batch, err := encoder.encode(transactions[i:])
+				require.NoError(t, err)
+				assert.Equal(t, codec, batch.Codec)
+
+				raw, err := batch.Decompress()
+				require.NoError(t, err)
+				assert.Len(t, raw, (len(transactions)-i)*BatchTransactionSize)
+
+				decoded, err := batch.decode()
+				require.NoError(t, err)
+				assert.Equal(t, transactions[i:], decoded)
+			}
+		})
+	}
+}
+
+func TestEncodedBatchInvalid(t *testing.T) {
+	_, err := newBatchEncoder("lz4")
+	assert.Error(t, err)
+
+	_, err = EncodedBatch{Codec: BatchCodecNone, Payload: make([]byte, txSize+1)}.decode()
+	assert.Error(t, err)
+
+	_, err = EncodedBatch{Codec: BatchCodecGzip, Payload: []byte("not gzip")}.decode()
+	assert.Error(t, err)
+
+	_, err = EncodedBatch{Codec: BatchCodecZstd, Payload: []byte("not zstd")}.Decompress()
+	assert.Error(t, err)
+}
+
+func TestMonitorBatchHandler(t *testing.T) {
+	sourceIP := util.AddressFromString("1.1.1.1")
+	destIP := util.AddressFromString("2.2.2.2")
+	transactions := []httpTX{
+		generateIPv4HTTPTransaction(sourceIP, destIP, 1234, 8080, "/foo", 200, 10),
+		generateIPv4HTTPTransaction(sourceIP, destIP, 1235, 8080, "/bar", 404, 20),
+	}
+
+	encoder, err := newBatchEncoder(BatchCodecZstd)
+	require.NoError(t, err)
+
+	var batches []EncodedBatch
+	m := &Monitor{
+		batchEncoder: encoder,
+		telemetry:    newTelemetry(),
+		portFilter:   newPortFilter(&config.Config{}, newTLSResolver("/proc")),
+	}
+	m.SetBatchHandler(func(batch EncodedBatch) {
+		batches = append(batches, batch)
+	})
+	m.process(transactions, nil)
+	// empty batches are not handed to the handler
+	m.process(nil, nil)
+
+	require.Len(t, batches, 1)
+	assert.Equal(t, BatchCodecZstd, batches[0].Codec)
+	decoded, err := batches[0].decode()
+	require.NoError(t, err)
+	assert.Equal(t, transactions, decoded)
+}
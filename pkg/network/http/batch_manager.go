@@ -12,6 +12,7 @@ import (
 )
 
 /*
+#define HTTP_LARGE_BUFFER
 #include "../ebpf/c/http-types.h"
 */
 import "C"
@@ -28,10 +29,15 @@ type batchManager struct {
 	batchMap   *ebpf.Map
 	stateByCPU []usrBatchState
 	numCPUs    int
+
+	// fragmentSize is the size of the request fragments of the eBPF program, the batches are
+	// read into raw and converted to the layout of httpBatch when it's smaller than HTTPBufferSize
+	fragmentSize int
+	raw          []byte
 }
 
-func newBatchManager(batchMap, batchStateMap *ebpf.Map, numCPUs int) *batchManager {
-	batch := new(httpBatch)
+func newBatchManager(batchMap, batchStateMap *ebpf.Map, numCPUs int, fragmentSize int) *batchManager {
+	batch := make([]byte, batchSizeFor(fragmentSize))
 	state := new(C.http_batch_state_t)
 	stateByCPU := make([]usrBatchState, numCPUs)
 
@@ -40,15 +46,30 @@ func newBatchManager(batchMap, batchStateMap *ebpf.Map, numCPUs int) *batchManag
 		batchStateMap.Put(unsafe.Pointer(&i), unsafe.Pointer(state))
 		for j := 0; j < HTTPBatchPages; j++ {
 			key := &httpBatchKey{cpu: C.uint(i), page_num: C.uint(j)}
-			batchMap.Put(unsafe.Pointer(key), unsafe.Pointer(batch))
+			batchMap.Put(unsafe.Pointer(key), unsafe.Pointer(&batch[0]))
 		}
 	}
 
 	return &batchManager{
-		batchMap:   batchMap,
-		stateByCPU: stateByCPU,
-		numCPUs:    numCPUs,
+		batchMap:     batchMap,
+		stateByCPU:   stateByCPU,
+		numCPUs:      numCPUs,
+		fragmentSize: fragmentSize,
+		raw:          batch,
+	}
+}
+
+// lookup reads a batch page into batch
+func (m *batchManager) lookup(key *httpBatchKey, batch *httpBatch) error {
+	if m.fragmentSize == HTTPBufferSize {
+		return m.batchMap.Lookup(unsafe.Pointer(key), unsafe.Pointer(batch))
+	}
+
+	if err := m.batchMap.Lookup(unsafe.Pointer(key), unsafe.Pointer(&m.raw[0])); err != nil {
+		return err
 	}
+	toHTTPBatch(m.raw, m.fragmentSize, batch)
+	return nil
 }
 
 func (m *batchManager) GetTransactionsFrom(notification httpNotification) ([]httpTX, error) {
@@ -59,7 +80,7 @@ func (m *batchManager) GetTransactionsFrom(notification httpNotification) ([]htt
 	)
 
 	batchKey.Prepare(notification)
-	err := m.batchMap.Lookup(unsafe.Pointer(batchKey), unsafe.Pointer(batch))
+	err := m.lookup(batchKey, batch)
 	if err != nil {
 		return nil, fmt.Errorf("error retrieving http batch for cpu=%d", notification.cpu)
 	}
@@ -92,7 +113,7 @@ func (m *batchManager) GetPendingTransactions() []httpTX {
 				batch    = new(httpBatch)
 			)
 
-			err := m.batchMap.Lookup(unsafe.Pointer(batchKey), unsafe.Pointer(batch))
+			err := m.lookup(batchKey, batch)
 			if err != nil {
 				break
 			}
@@ -0,0 +1,256 @@
+// +build linux_bpf
+
+package http
+
+import (
+	"bufio"
+	"bytes"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/DataDog/datadog-agent/pkg/network/config"
+	"github.com/DataDog/datadog-agent/pkg/process/util"
+	"github.com/DataDog/datadog-agent/pkg/util/log"
+)
+
+/*
+#define HTTP_LARGE_BUFFER
+#include "../ebpf/c/http-types.h"
+*/
+import "C"
+
+// Direction tells whether a HTTP transaction was served or sent by the host
+type Direction uint8
+
+// Directions of the HTTP transactions
+const (
+	DirectionUnknown  Direction = C.HTTP_DIRECTION_UNKNOWN
+	DirectionInbound  Direction = C.HTTP_DIRECTION_INBOUND
+	DirectionOutbound Direction = C.HTTP_DIRECTION_OUTBOUND
+)
+
+func (d Direction) String() string {
+	switch d {
+	case DirectionInbound:
+		return "inbound"
+	case DirectionOutbound:
+		return "outbound"
+	default:
+		return "unknown"
+	}
+}
+
+// tcpListen is the state of the listening sockets in /proc/net/tcp{,6}
+const tcpListen = "0A"
+
+// Direction returns DirectionInbound when the host is the server of the transaction and DirectionOutbound when it is the client.
+// It is resolved by the monitor before the transactions are handed to its handler.
+func (tx *httpTX) Direction() Direction {
+	return Direction(tx.direction)
+}
+
+// serverAddress returns the address of the server of the transaction, the tuples captured by the socket filter
+// go from the client to the server
+func (tx *httpTX) serverAddress() util.Address {
+	if tx.IsIPv6() {
+		return util.V6Address(uint64(tx.tup.daddr_l), uint64(tx.tup.daddr_h))
+	}
+	return util.V4Address(uint32(tx.tup.daddr_l))
+}
+
+// listenKey is an address and a port listened on by the host
+type listenKey struct {
+	addr string
+	port uint16
+}
+
+func newListenKey(addr util.Address, port uint16) listenKey {
+	// IPv4-mapped IPv6 addresses are keyed as IPv4 addresses, like in /proc/net/tcp6
+	return listenKey{addr: util.NetIPFromAddress(addr).String(), port: port}
+}
+
+// directionResolver labels the HTTP transactions with their direction, and only keeps the ones with the direction
+// configured by network_config.http_direction when it is set.
+// A transaction is inbound when its server address and port are listened on by the host, in any network namespace
+// since the socket filter also captures the traffic of the containers. The direction of the HTTPS transactions is
+// given by the side of the connection the OpenSSL uprobes were called from.
+type directionResolver struct {
+	procRoot string
+	kept     Direction
+
+	// local addresses and ports listened on, this is rotated with the stats map
+	listening map[listenKey]struct{}
+}
+
+func newDirectionResolver(c *config.Config) *directionResolver {
+	r := &directionResolver{procRoot: c.ProcRoot}
+	switch c.HTTPDirection {
+	case "inbound":
+		r.kept = DirectionInbound
+	case "outbound":
+		r.kept = DirectionOutbound
+	}
+	return r
+}
+
+// filter sets the direction of the transactions and removes the ones that aren't kept, the slice is modified in place
+func (r *directionResolver) filter(transactions []httpTX) []httpTX {
+	if r == nil {
+		return transactions
+	}
+
+	kept := transactions[:0]
+	for _, tx := range transactions {
+		tx.direction = C.__u8(r.direction(&tx))
+		if r.kept == DirectionUnknown || tx.Direction() == r.kept {
+			kept = append(kept, tx)
+		}
+	}
+	return kept
+}
+
+func (r *directionResolver) direction(tx *httpTX) Direction {
+	switch tx.tls_role {
+	case tlsRoleServer:
+		return DirectionInbound
+	case tlsRoleClient:
+		return DirectionOutbound
+	}
+
+	if r.listening == nil {
+		listening, err := readListeningSockets(r.procRoot)
+		if err != nil {
+			log.Debugf("could not read the listening sockets: %s", err)
+			return DirectionUnknown
+		}
+		r.listening = listening
+	}
+	if _, ok := r.listening[newListenKey(tx.serverAddress(), uint16(tx.tup.dport))]; ok {
+		return DirectionInbound
+	}
+	return DirectionOutbound
+}
+
+func (r *directionResolver) reset() {
+	if r != nil {
+		r.listening = nil
+	}
+}
+
+// nsSockets holds the TCP sockets of a network namespace
+type nsSockets struct {
+	listening map[listenKey]struct{}
+	// ports listened on all the addresses of the namespace
+	wildcardPorts map[uint16]struct{}
+	// addresses of the namespace, as seen on its sockets
+	local map[string]struct{}
+}
+
+func newNSSockets() *nsSockets {
+	return &nsSockets{
+		listening:     make(map[listenKey]struct{}),
+		wildcardPorts: make(map[uint16]struct{}),
+		local: map[string]struct{}{
+			net.IPv4(127, 0, 0, 1).String(): {},
+			net.IPv6loopback.String():       {},
+		},
+	}
+}
+
+// readListeningSockets returns the addresses and ports of the TCP sockets listening in the network namespaces
+// of the processes under procRoot. The sockets listening on all the addresses of a namespace are returned
+// for each address used by the sockets of that namespace, and for the interface addresses of the current namespace.
+func readListeningSockets(procRoot string) (map[listenKey]struct{}, error) {
+	namespaces := make(map[uint32]*nsSockets)
+	err := util.WithAllProcs(procRoot, func(pid int) error {
+		nsIno, err := util.GetNetNsInoFromPid(procRoot, pid)
+		if err != nil {
+			// the process may have exited, or its namespace can't be accessed
+			return nil
+		}
+		if _, ok := namespaces[nsIno]; ok {
+			return nil
+		}
+
+		sockets := newNSSockets()
+		for _, file := range []string{"tcp", "tcp6"} {
+			if err := sockets.read(filepath.Join(procRoot, strconv.Itoa(pid), "net", file)); err != nil {
+				log.Debugf("could not read the tcp sockets of net ns ino=%d pid=%d: %s", nsIno, pid, err)
+			}
+		}
+		namespaces[nsIno] = sockets
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if ino, err := util.GetCurrentIno(); err == nil {
+		if sockets, ok := namespaces[ino]; ok {
+			addrs, err := net.InterfaceAddrs()
+			if err != nil {
+				log.Debugf("could not read the interface addresses: %s", err)
+			}
+			for _, addr := range addrs {
+				if ipNet, ok := addr.(*net.IPNet); ok {
+					sockets.local[ipNet.IP.String()] = struct{}{}
+				}
+			}
+		}
+	}
+
+	listening := make(map[listenKey]struct{})
+	for _, sockets := range namespaces {
+		for key := range sockets.listening {
+			listening[key] = struct{}{}
+		}
+		for port := range sockets.wildcardPorts {
+			for addr := range sockets.local {
+				listening[listenKey{addr: addr, port: port}] = struct{}{}
+			}
+		}
+	}
+	return listening, nil
+}
+
+// read adds the sockets of a /proc/<pid>/net/tcp{,6} file
+func (s *nsSockets) read(path string) error {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	// Skip header line
+	scanner.Scan()
+	for scanner.Scan() {
+		// sl local_address rem_address st ...
+		fields := bytes.Fields(scanner.Bytes())
+		if len(fields) < 4 {
+			continue
+		}
+		addr, port, err := parseProcNetAddress(string(fields[1]))
+		if err != nil {
+			return err
+		}
+
+		ip := util.NetIPFromAddress(addr)
+		if !strings.EqualFold(string(fields[3]), tcpListen) {
+			s.local[ip.String()] = struct{}{}
+			continue
+		}
+		if ip.IsUnspecified() {
+			s.wildcardPorts[port] = struct{}{}
+		} else {
+			s.listening[newListenKey(addr, port)] = struct{}{}
+		}
+	}
+	return scanner.Err()
+}
@@ -0,0 +1,176 @@
+// +build linux_bpf
+
+package http
+
+import (
+	"io/ioutil"
+	"net"
+	nethttp "net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/DataDog/datadog-agent/pkg/network/config"
+	"github.com/DataDog/datadog-agent/pkg/process/util"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDirection(t *testing.T) {
+	srv := httptest.NewServer(nethttp.HandlerFunc(func(w nethttp.ResponseWriter, r *nethttp.Request) {}))
+	defer srv.Close()
+	srvPort := srv.Listener.Addr().(*net.TCPAddr).Port
+
+	// the port of a remote server isn't listened on by the host
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	remotePort := l.Addr().(*net.TCPAddr).Port
+	l.Close()
+
+	// the port of a server listening on all the addresses
+	wildcard, err := net.Listen("tcp", ":0")
+	require.NoError(t, err)
+	defer wildcard.Close()
+	wildcardPort := wildcard.Addr().(*net.TCPAddr).Port
+
+	localIP := util.AddressFromString("127.0.0.1")
+	remoteIP := util.AddressFromString("2.2.2.2")
+	inbound := generateIPv4HTTPTransaction(remoteIP, localIP, 1234, srvPort, "/inbound", 200, 10)
+	outbound := generateIPv4HTTPTransaction(localIP, remoteIP, 1235, remotePort, "/outbound", 200, 10)
+	tlsServer := generateIPv4HTTPTransaction(remoteIP, localIP, 1236, remotePort, "/tls-server", 200, 10)
+	tlsServer.tls_role = tlsRoleServer
+	tlsClient := generateIPv4HTTPTransaction(localIP, remoteIP, 1237, srvPort, "/tls-client", 200, 10)
+	tlsClient.tls_role = tlsRoleClient
+	// a remote server may use a port listened on by the host
+	otherServer := generateIPv4HTTPTransaction(localIP, remoteIP, 1238, srvPort, "/other-server", 200, 10)
+	wildcardInbound := generateIPv4HTTPTransaction(remoteIP, localIP, 1239, wildcardPort, "/wildcard-inbound", 200, 10)
+	wildcardOutbound := generateIPv4HTTPTransaction(localIP, remoteIP, 1240, wildcardPort, "/wildcard-outbound", 200, 10)
+	all := []httpTX{inbound, outbound, tlsServer, tlsClient, otherServer, wildcardInbound, wildcardOutbound}
+
+	buffer := make([]byte, HTTPBufferSize)
+	directions := func(transactions []httpTX) map[string]Direction {
+		res := make(map[string]Direction)
+		for _, tx := range transactions {
+			path, _ := tx.Path(buffer)
+			res[string(path)] = tx.Direction()
+		}
+		return res
+	}
+
+	r := newDirectionResolver(directionConfig(""))
+	transactions := r.filter(append([]httpTX(nil), all...))
+	assert.Equal(t, map[string]Direction{
+		"/inbound":           DirectionInbound,
+		"/outbound":          DirectionOutbound,
+		"/tls-server":        DirectionInbound,
+		"/tls-client":        DirectionOutbound,
+		"/other-server":      DirectionOutbound,
+		"/wildcard-inbound":  DirectionInbound,
+		"/wildcard-outbound": DirectionOutbound,
+	}, directions(transactions))
+
+	r = newDirectionResolver(directionConfig("inbound"))
+	transactions = r.filter(append([]httpTX(nil), all...))
+	assert.Equal(t, map[string]Direction{
+		"/inbound":          DirectionInbound,
+		"/tls-server":       DirectionInbound,
+		"/wildcard-inbound": DirectionInbound,
+	}, directions(transactions))
+
+	r = newDirectionResolver(directionConfig("outbound"))
+	transactions = r.filter(append([]httpTX(nil), all...))
+	assert.Equal(t, map[string]Direction{
+		"/outbound":          DirectionOutbound,
+		"/tls-client":        DirectionOutbound,
+		"/other-server":      DirectionOutbound,
+		"/wildcard-outbound": DirectionOutbound,
+	}, directions(transactions))
+}
+
+func TestDirectionNetworkNamespaces(t *testing.T) {
+	procRoot, err := ioutil.TempDir("", "http-direction")
+	require.NoError(t, err)
+	defer os.RemoveAll(procRoot)
+
+	const header = "  sl  local_address rem_address   st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode\n"
+	writeProc := func(pid string, file string, lines ...string) {
+		dir := filepath.Join(procRoot, pid, "net")
+		require.NoError(t, os.MkdirAll(dir, 0755))
+		content := header
+		for _, line := range lines {
+			content += line + "\n"
+		}
+		require.NoError(t, ioutil.WriteFile(filepath.Join(dir, file), []byte(content), 0644))
+	}
+	writeNS := func(pid string) {
+		dir := filepath.Join(procRoot, pid, "ns")
+		require.NoError(t, os.MkdirAll(dir, 0755))
+		require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "net"), nil, 0644))
+	}
+
+	// the host listens on 127.0.0.1:8080 and on port 80 of all its addresses, 10.0.0.5 being one of them
+	writeNS("1")
+	writeProc("1", "tcp",
+		"   0: 0100007F:1F90 00000000:0000 0A 00000000:00000000 00:00000000 00000000     0        0 1 1 0000000000000000 100 0 0 10 0",
+		"   1: 00000000:0050 00000000:0000 0A 00000000:00000000 00:00000000 00000000     0        0 2 1 0000000000000000 100 0 0 10 0",
+		"   2: 0500000A:0050 0200000A:C000 01 00000000:00000000 00:00000000 00000000     0        0 3 1 0000000000000000 100 0 0 10 0",
+	)
+	// a container listens on port 443 of all its addresses, 10.0.0.6 being one of them
+	writeNS("2")
+	writeProc("2", "tcp6",
+		"   0: 00000000000000000000000000000000:01BB 00000000000000000000000000000000:0000 0A 00000000:00000000 00:00000000 00000000     0        0 4 1 0000000000000000 100 0 0 10 0",
+		"   1: 0000000000000000FFFF00000600000A:01BB 0000000000000000FFFF00000200000A:C001 01 00000000:00000000 00:00000000 00000000     0        0 5 1 0000000000000000 100 0 0 10 0",
+	)
+	// another process of the host network namespace, its sockets were already read
+	require.NoError(t, os.MkdirAll(filepath.Join(procRoot, "3", "ns"), 0755))
+	require.NoError(t, os.Link(filepath.Join(procRoot, "1", "ns", "net"), filepath.Join(procRoot, "3", "ns", "net")))
+	writeProc("3", "tcp",
+		"   0: 00000000:270F 00000000:0000 0A 00000000:00000000 00:00000000 00000000     0        0 6 1 0000000000000000 100 0 0 10 0",
+	)
+
+	listening, err := readListeningSockets(procRoot)
+	require.NoError(t, err)
+	assert.Equal(t, map[listenKey]struct{}{
+		{addr: "127.0.0.1", port: 8080}: {},
+		{addr: "127.0.0.1", port: 80}:   {},
+		{addr: "::1", port: 80}:         {},
+		{addr: "10.0.0.5", port: 80}:    {},
+		{addr: "127.0.0.1", port: 443}:  {},
+		{addr: "::1", port: 443}:        {},
+		{addr: "10.0.0.6", port: 443}:   {},
+	}, listening)
+
+	c := directionConfig("")
+	c.ProcRoot = procRoot
+	r := newDirectionResolver(c)
+	client := util.AddressFromString("10.0.0.2")
+	for _, test := range []struct {
+		server    string
+		port      int
+		direction Direction
+	}{
+		{"127.0.0.1", 8080, DirectionInbound},
+		{"10.0.0.5", 8080, DirectionOutbound},
+		{"10.0.0.5", 80, DirectionInbound},
+		{"10.0.0.6", 80, DirectionOutbound},
+		{"10.0.0.6", 443, DirectionInbound},
+		{"10.0.0.5", 443, DirectionOutbound},
+		{"10.0.0.5", 9999, DirectionOutbound},
+	} {
+		tx := generateIPv4HTTPTransaction(client, util.AddressFromString(test.server), 1234, test.port, "/", 200, 10)
+		assert.Equal(t, test.direction, r.direction(&tx), "%s:%d", test.server, test.port)
+	}
+
+	// the IPv6 transactions are compared to the IPv6 listening sockets
+	tx := generateIPv6HTTPTransaction(util.AddressFromString("::2"), util.AddressFromString("::1"), 1234, 443, "/", 200, 10)
+	assert.Equal(t, DirectionInbound, r.direction(&tx))
+	tx = generateIPv6HTTPTransaction(util.AddressFromString("::2"), util.AddressFromString("fd00::1"), 1234, 443, "/", 200, 10)
+	assert.Equal(t, DirectionOutbound, r.direction(&tx))
+}
+
+func directionConfig(direction string) *config.Config {
+	c := &config.Config{HTTPDirection: direction}
+	c.ProcRoot = "/proc"
+	return c
+}
@@ -3,6 +3,7 @@
 package http
 
 import (
+	"fmt"
 	"math"
 	"os"
 
@@ -11,6 +12,8 @@ import (
 	"github.com/DataDog/datadog-agent/pkg/network/config"
 	netebpf "github.com/DataDog/datadog-agent/pkg/network/ebpf"
 	"github.com/DataDog/datadog-agent/pkg/network/ebpf/probes"
+	"github.com/DataDog/datadog-agent/pkg/util/kernel"
+	"github.com/DataDog/datadog-agent/pkg/util/log"
 	"github.com/DataDog/ebpf"
 	"github.com/DataDog/ebpf/manager"
 	"golang.org/x/sys/unix"
@@ -23,15 +26,57 @@ const (
 	defaultClosedChannelSize = 500
 )
 
+// sslProbes are the OpenSSL uprobes capturing HTTPS transactions
+var sslProbes = []probes.ProbeName{
+	probes.SSLSetFD,
+	probes.SSLRead,
+	probes.SSLReadReturn,
+	probes.SSLWrite,
+	probes.SSLShutdown,
+}
+
 type ebpfProgram struct {
 	*manager.Manager
 	cfg         *config.Config
 	perfHandler *ddebpf.PerfHandler
 	bytecode    bytecode.AssetReader
+
+	// sslPerfHandler receives the socket file descriptors set on and released by the OpenSSL contexts
+	sslPerfHandler *ddebpf.PerfHandler
+
+	// libSSLPath is the OpenSSL library the uprobes are attached to, HTTPS monitoring is disabled when empty
+	libSSLPath string
+
+	// bufferSize is the number of bytes of each request captured in eBPF
+	bufferSize int
+	// fragmentSize is the size of the request fragment of the transactions of the program, the default
+	// program is loaded unless bufferSize needs the http-large one
+	fragmentSize int
+}
+
+// httpBufferSize returns the number of bytes of each request to capture in eBPF
+func httpBufferSize(c *config.Config) int {
+	bufferSize := c.HTTPBufferSize
+	if bufferSize > HTTPBufferSize {
+		log.Warnf("http_buffer_size exceeds the maximum of %d. Setting it to %d", HTTPBufferSize, HTTPBufferSize)
+		bufferSize = HTTPBufferSize
+	}
+	if len(c.HTTPCapturedHeaders) > 0 && bufferSize < HTTPBufferSize {
+		// the headers are read from the captured request fragment
+		log.Infof("http_captured_headers is set. Setting http_buffer_size to %d", HTTPBufferSize)
+		bufferSize = HTTPBufferSize
+	}
+	return bufferSize
 }
 
-func newEBPFProgram(c *config.Config) (*ebpfProgram, error) {
-	bytecode, err := netebpf.ReadHTTPModule(c.BPFDir, c.BPFDebug)
+// newEBPFProgram returns the program capturing bufferSize bytes of each request, bufferSize
+// must not exceed HTTPBufferSize
+func newEBPFProgram(c *config.Config, bufferSize int) (*ebpfProgram, error) {
+	fragmentSize := httpDefaultBufferSize
+	if bufferSize > httpDefaultBufferSize {
+		fragmentSize = HTTPBufferSize
+	}
+	bytecode, err := netebpf.ReadHTTPModule(c.BPFDir, c.BPFDebug, fragmentSize == HTTPBufferSize)
 	if err != nil {
 		return nil, err
 	}
@@ -41,6 +86,7 @@ func newEBPFProgram(c *config.Config) (*ebpfProgram, error) {
 		closedChannelSize = c.ClosedChannelSize
 	}
 	perfHandler := ddebpf.NewPerfHandler(closedChannelSize)
+	sslPerfHandler := ddebpf.NewPerfHandler(closedChannelSize)
 
 	mgr := &manager.Manager{
 		Maps: []*manager.Map{
@@ -65,29 +111,84 @@ func newEBPFProgram(c *config.Config) (*ebpfProgram, error) {
 		},
 	}
 
+	libSSLPath := ""
+	if c.EnableHTTPSMonitoring {
+		libSSLPath, err = setupHTTPSProbes(c, mgr, sslPerfHandler)
+		if err != nil {
+			log.Warnf("https monitoring disabled: %s", err)
+		}
+	}
+
 	return &ebpfProgram{
-		Manager:     mgr,
-		perfHandler: perfHandler,
-		bytecode:    bytecode,
-		cfg:         c,
+		Manager:        mgr,
+		perfHandler:    perfHandler,
+		sslPerfHandler: sslPerfHandler,
+		bytecode:       bytecode,
+		cfg:            c,
+		libSSLPath:     libSSLPath,
+		bufferSize:     bufferSize,
+		fragmentSize:   fragmentSize,
 	}, nil
 }
 
+// setupHTTPSProbes registers the OpenSSL uprobes and their maps and returns the library they are attached to
+func setupHTTPSProbes(c *config.Config, mgr *manager.Manager, sslPerfHandler *ddebpf.PerfHandler) (string, error) {
+	kv, err := kernel.HostVersion()
+	if err != nil {
+		return "", err
+	}
+	if kv < minHTTPSKernelVersion {
+		return "", fmt.Errorf("eBPF uprobes are not supported by kernel %s", kv)
+	}
+
+	libSSLPath, err := findLibSSL(c.LibSSLPath)
+	if err != nil {
+		return "", err
+	}
+
+	mgr.Maps = append(mgr.Maps,
+		&manager.Map{Name: string(probes.SSLSockByCtxMap)},
+		&manager.Map{Name: string(probes.SSLReadArgsMap)},
+	)
+	mgr.PerfMaps = append(mgr.PerfMaps, &manager.PerfMap{
+		Map: manager.Map{Name: string(probes.SSLSockEventsMap)},
+		PerfMapOptions: manager.PerfMapOptions{
+			PerfRingBufferSize: 8 * os.Getpagesize(),
+			Watermark:          1,
+			DataHandler:        sslPerfHandler.DataHandler,
+			LostHandler:        sslPerfHandler.LostHandler,
+		},
+	})
+	for _, probe := range sslProbes {
+		mgr.Probes = append(mgr.Probes, &manager.Probe{Section: string(probe), BinaryPath: libSSLPath})
+	}
+	return libSSLPath, nil
+}
+
 func (e *ebpfProgram) Init() error {
 	defer e.bytecode.Close()
 
-	return e.InitWithOptions(e.bytecode, manager.Options{
+	options := manager.Options{
 		RLimit: &unix.Rlimit{
 			Cur: math.MaxUint64,
 			Max: math.MaxUint64,
 		},
 		MapSpecEditors: map[string]manager.MapSpecEditor{
 			string(probes.HttpInFlightMap): {
+				Type:       ebpf.Hash,
+				MaxEntries: uint32(e.cfg.HTTPMaxTrackedConnections),
+				EditorFlag: manager.EditMaxEntries,
+			},
+			// the map is part of the bytecode even when HTTPS monitoring is disabled
+			string(probes.SSLSockByCtxMap): {
 				Type:       ebpf.Hash,
 				MaxEntries: uint32(e.cfg.MaxTrackedConnections),
 				EditorFlag: manager.EditMaxEntries,
 			},
 		},
+		ConstantEditors: []manager.ConstantEditor{
+			{Name: "http_buffer_size", Value: uint64(e.bufferSize)},
+		},
 		ActivatedProbes: []manager.ProbesSelector{
 			&manager.ProbeSelector{
 				ProbeIdentificationPair: manager.ProbeIdentificationPair{
@@ -100,5 +201,17 @@ func (e *ebpfProgram) Init() error {
 				},
 			},
 		},
-	})
+	}
+
+	if e.libSSLPath != "" {
+		for _, probe := range sslProbes {
+			options.ActivatedProbes = append(options.ActivatedProbes, &manager.ProbeSelector{
+				ProbeIdentificationPair: manager.ProbeIdentificationPair{
+					Section: string(probe),
+				},
+			})
+		}
+	}
+
+	return e.InitWithOptions(e.bytecode, options)
 }
@@ -0,0 +1,67 @@
+// +build linux_bpf
+
+package http
+
+import (
+	"bytes"
+	"unsafe"
+)
+
+var grpcContentType = []byte("content-type: application/grpc")
+
+// IsGRPC returns true if the request fragment carries the gRPC content type.
+// Only gRPC requests framed as HTTP/1.1, e.g. gRPC-Web, are seen by the socket filter: HTTP/2 frames aren't parsed.
+// The content type is only found when the buffer is large enough to capture the request headers.
+func (tx *httpTX) IsGRPC() bool {
+	if tx.Method() != "POST" {
+		return false
+	}
+
+	b := *(*[HTTPBufferSize]byte)(unsafe.Pointer(&tx.request_fragment))
+	return containsFold(b[:], grpcContentType)
+}
+
+// GRPCMethod returns the service and the method called by a gRPC request
+// Example:
+// For a request fragment "POST /helloworld.Greeter/SayHello HTTP/1.1", this method will return "helloworld.Greeter" and "SayHello"
+func (tx *httpTX) GRPCMethod(buffer []byte) (service, method []byte, ok bool) {
+	path, fullPath := tx.Path(buffer)
+	if !fullPath {
+		return nil, nil, false
+	}
+	return parseGRPCPath(path)
+}
+
+// parseGRPCPath splits a gRPC path of the form /<service>/<method>
+func parseGRPCPath(path []byte) (service, method []byte, ok bool) {
+	if len(path) == 0 || path[0] != '/' {
+		return nil, nil, false
+	}
+
+	path = path[1:]
+	i := bytes.IndexByte(path, '/')
+	if i <= 0 || i == len(path)-1 || bytes.IndexByte(path[i+1:], '/') != -1 {
+		return nil, nil, false
+	}
+	return path[:i], path[i+1:], true
+}
+
+// containsFold reports whether the lower case subslice is within b, ignoring the case of b
+func containsFold(b, lower []byte) bool {
+	for i := 0; i+len(lower) <= len(b); i++ {
+		j := 0
+		for ; j < len(lower); j++ {
+			c := b[i+j]
+			if 'A' <= c && c <= 'Z' {
+				c += 'a' - 'A'
+			}
+			if c != lower[j] {
+				break
+			}
+		}
+		if j == len(lower) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,83 @@
+// +build linux_bpf
+
+package http
+
+import (
+	"testing"
+
+	"github.com/DataDog/datadog-agent/pkg/network/config"
+	"github.com/DataDog/datadog-agent/pkg/process/util"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsGRPC(t *testing.T) {
+	tx := httpTX{
+		request_method: 2, // HTTP_POST
+		request_fragment: requestFragment(
+			[]byte("POST /helloworld.Greeter/SayHello HTTP/1.1\r\nContent-Type: application/grpc-web+proto\r\n"),
+		),
+	}
+	assert.True(t, tx.IsGRPC())
+
+	b := make([]byte, HTTPBufferSize)
+	service, method, ok := tx.GRPCMethod(b)
+	assert.True(t, ok)
+	assert.Equal(t, "helloworld.Greeter", string(service))
+	assert.Equal(t, "SayHello", string(method))
+
+	// a REST request
+	tx = httpTX{
+		request_method: 2, // HTTP_POST
+		request_fragment: requestFragment(
+			[]byte("POST /users HTTP/1.1\r\nContent-Type: application/json\r\n"),
+		),
+	}
+	assert.False(t, tx.IsGRPC())
+
+	// gRPC requests are always POST requests
+	tx = httpTX{
+		request_method: 1, // HTTP_GET
+		request_fragment: requestFragment(
+			[]byte("GET /helloworld.Greeter/SayHello HTTP/1.1\r\ncontent-type: application/grpc\r\n"),
+		),
+	}
+	assert.False(t, tx.IsGRPC())
+}
+
+func TestParseGRPCPath(t *testing.T) {
+	for _, tc := range []struct {
+		path            string
+		service, method string
+		ok              bool
+	}{
+		{path: "/helloworld.Greeter/SayHello", service: "helloworld.Greeter", method: "SayHello", ok: true},
+		{path: "/Greeter/SayHello", service: "Greeter", method: "SayHello", ok: true},
+		{path: "/helloworld.Greeter/", ok: false},
+		{path: "//SayHello", ok: false},
+		{path: "/helloworld.Greeter", ok: false},
+		{path: "/a/b/c", ok: false},
+		{path: "", ok: false},
+	} {
+		service, method, ok := parseGRPCPath([]byte(tc.path))
+		assert.Equal(t, tc.ok, ok, tc.path)
+		assert.Equal(t, tc.service, string(service), tc.path)
+		assert.Equal(t, tc.method, string(method), tc.path)
+	}
+}
+
+func TestProcessGRPCTransactions(t *testing.T) {
+	sk := newHTTPStatkeeper(&config.Config{MaxHTTPStatsBuffered: 1000}, newTelemetry())
+	sourceIP := util.AddressFromString("1.1.1.1")
+	destIP := util.AddressFromString("2.2.2.2")
+
+	grpcTX := generateIPv4HTTPTransaction(sourceIP, destIP, 1234, 8080, "/helloworld.Greeter/SayHello", 200, 10)
+	grpcTX.request_method = 2 // HTTP_POST
+	grpcTX.request_fragment = requestFragment([]byte("POST /helloworld.Greeter/SayHello HTTP/1.1\r\nContent-Type: application/grpc\r\n"))
+	restTX := generateIPv4HTTPTransaction(sourceIP, destIP, 1234, 8080, "/users", 200, 10)
+	restTX.request_method = 2 // HTTP_POST
+	sk.Process([]httpTX{grpcTX, restTX})
+
+	stats := sk.GetAndResetEndpointStats()
+	assert.Contains(t, stats, EndpointKey{Path: "/helloworld.Greeter/SayHello", Method: "POST", GRPC: true})
+	assert.Contains(t, stats, EndpointKey{Path: "/users", Method: "POST"})
+}
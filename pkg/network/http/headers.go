@@ -0,0 +1,103 @@
+// +build linux_bpf
+
+package http
+
+import (
+	"bytes"
+	"strings"
+	"unsafe"
+
+	"github.com/DataDog/datadog-agent/pkg/network/config"
+)
+
+// headerFilter only keeps the allowed headers in the request fragments of the HTTP transactions,
+// so that the other headers, which may hold credentials, never leave the monitor.
+// The headers are read from the request fragment captured in eBPF: the headers which don't fit in it are lost.
+// The content type is always kept since it is needed to detect the gRPC requests.
+type headerFilter struct {
+	// lowercase header names
+	allowed map[string]struct{}
+}
+
+func newHeaderFilter(c *config.Config) *headerFilter {
+	if len(c.HTTPCapturedHeaders) == 0 {
+		return nil
+	}
+
+	allowed := map[string]struct{}{"content-type": {}}
+	for _, name := range c.HTTPCapturedHeaders {
+		allowed[strings.ToLower(name)] = struct{}{}
+	}
+	return &headerFilter{allowed: allowed}
+}
+
+// filter rewrites the request fragments of the transactions in place
+func (f *headerFilter) filter(transactions []httpTX) {
+	if f == nil {
+		return
+	}
+
+	for i := range transactions {
+		f.scrub(&transactions[i])
+	}
+}
+
+// scrub rewrites the request fragment with the request line followed by the allowed headers
+func (f *headerFilter) scrub(tx *httpTX) {
+	b := (*[HTTPBufferSize]byte)(unsafe.Pointer(&tx.request_fragment))[:]
+	end := bytes.IndexByte(b, 0)
+	if end == -1 {
+		end = len(b)
+	}
+	requestLineEnd := bytes.IndexByte(b[:end], '\n')
+	if requestLineEnd == -1 {
+		// no header was captured
+		return
+	}
+
+	pos := requestLineEnd + 1
+	for _, line := range bytes.SplitAfter(b[pos:end], []byte("\n")) {
+		// the last line may be a truncated header, which is only kept when its name is complete and allowed
+		if name, _, ok := parseHeader(line); ok {
+			if _, ok := f.allowed[strings.ToLower(name)]; ok {
+				pos += copy(b[pos:], line)
+			}
+		}
+	}
+	for i := pos; i < len(b); i++ {
+		b[i] = 0
+	}
+}
+
+// Header returns the value of a header of the request fragment captured in eBPF, the header name
+// is case-insensitive. Only the headers listed in network_config.http_captured_headers are kept by the monitor.
+func (tx *httpTX) Header(name string) (string, bool) {
+	b := (*[HTTPBufferSize]byte)(unsafe.Pointer(&tx.request_fragment))[:]
+	if end := bytes.IndexByte(b, 0); end != -1 {
+		b = b[:end]
+	}
+	requestLineEnd := bytes.IndexByte(b, '\n')
+	if requestLineEnd == -1 {
+		return "", false
+	}
+
+	for _, line := range bytes.SplitAfter(b[requestLineEnd+1:], []byte("\n")) {
+		if !bytes.HasSuffix(line, []byte("\n")) {
+			// the header is truncated
+			break
+		}
+		if headerName, value, ok := parseHeader(line); ok && strings.EqualFold(headerName, name) {
+			return value, true
+		}
+	}
+	return "", false
+}
+
+// parseHeader parses a "Name: value" header line, terminated by \n or \r\n
+func parseHeader(line []byte) (string, string, bool) {
+	idx := bytes.IndexByte(line, ':')
+	if idx <= 0 {
+		return "", "", false
+	}
+	return string(line[:idx]), string(bytes.TrimSpace(line[idx+1:])), true
+}
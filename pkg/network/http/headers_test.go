@@ -0,0 +1,69 @@
+// +build linux_bpf
+
+package http
+
+import (
+	"testing"
+
+	"github.com/DataDog/datadog-agent/pkg/network/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHeader(t *testing.T) {
+	tx := httpTX{
+		request_fragment: requestFragment(
+			[]byte("GET /foo HTTP/1.1\r\nHost: example.com\r\nX-Correlation-Id: abc123\r\nUser-Agent: cur"),
+		),
+	}
+
+	value, ok := tx.Header("host")
+	assert.True(t, ok)
+	assert.Equal(t, "example.com", value)
+
+	value, ok = tx.Header("X-CORRELATION-ID")
+	assert.True(t, ok)
+	assert.Equal(t, "abc123", value)
+
+	// the header is truncated
+	_, ok = tx.Header("User-Agent")
+	assert.False(t, ok)
+
+	_, ok = tx.Header("Authorization")
+	assert.False(t, ok)
+}
+
+func TestHeaderFilter(t *testing.T) {
+	assert.Nil(t, newHeaderFilter(&config.Config{}))
+
+	f := newHeaderFilter(&config.Config{HTTPCapturedHeaders: []string{"X-Correlation-Id", "user-agent"}})
+	transactions := []httpTX{
+		{
+			request_fragment: requestFragment(
+				[]byte("GET /foo HTTP/1.1\r\nHost: example.com\r\nAuthorization: Bearer secret\r\nx-correlation-id: abc123\r\nUser-Agent: cur"),
+			),
+		},
+		{
+			request_fragment: requestFragment(
+				[]byte("POST /helloworld.Greeter/SayHello HTTP/1.1\r\nCookie: session=secret\r\nContent-Type: application/grpc\r\n"),
+			),
+		},
+		{
+			request_fragment: requestFragment([]byte("GET /bar HTTP/1.1")),
+		},
+	}
+	f.filter(transactions)
+
+	assert.Equal(t, requestFragment([]byte("GET /foo HTTP/1.1\r\nx-correlation-id: abc123\r\nUser-Agent: cur")), transactions[0].request_fragment)
+	value, ok := transactions[0].Header("X-Correlation-Id")
+	assert.True(t, ok)
+	assert.Equal(t, "abc123", value)
+	_, ok = transactions[0].Header("Host")
+	assert.False(t, ok)
+	_, ok = transactions[0].Header("Authorization")
+	assert.False(t, ok)
+
+	// the content type is kept to detect gRPC requests
+	assert.Equal(t, requestFragment([]byte("POST /helloworld.Greeter/SayHello HTTP/1.1\r\nContent-Type: application/grpc\r\n")), transactions[1].request_fragment)
+
+	assert.Equal(t, requestFragment([]byte("GET /bar HTTP/1.1")), transactions[2].request_fragment)
+}
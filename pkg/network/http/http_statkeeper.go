@@ -5,12 +5,19 @@ package http
 import (
 	"C"
 )
-import "sync/atomic"
+import (
+	"sync/atomic"
+
+	"github.com/DataDog/datadog-agent/pkg/network/config"
+	"github.com/DataDog/datadog-agent/pkg/util/log"
+)
 
 type httpStatKeeper struct {
-	stats      map[Key]RequestStats
-	maxEntries int
-	telemetry  *telemetry
+	stats        map[Key]RequestStats
+	endpoints    map[EndpointKey]RequestStats
+	maxEntries   int
+	replaceRules []*config.ReplaceRule
+	telemetry    *telemetry
 
 	// http path buffer
 	buffer []byte
@@ -18,22 +25,35 @@ type httpStatKeeper struct {
 	// map containing interned path strings
 	// this is rotated  with the stats map
 	interned map[string]string
+
+	// resolves the socket tuple of HTTPS transactions
+	tlsResolver *tlsResolver
 }
 
-func newHTTPStatkeeper(maxEntries int, telemetry *telemetry) *httpStatKeeper {
+func newHTTPStatkeeper(c *config.Config, telemetry *telemetry) *httpStatKeeper {
 	return &httpStatKeeper{
-		stats:      make(map[Key]RequestStats),
-		maxEntries: maxEntries,
-		buffer:     make([]byte, HTTPBufferSize),
-		interned:   make(map[string]string),
-		telemetry:  telemetry,
+		stats:        make(map[Key]RequestStats),
+		endpoints:    make(map[EndpointKey]RequestStats),
+		maxEntries:   c.MaxHTTPStatsBuffered,
+		replaceRules: c.HTTPReplaceRules,
+		buffer:       make([]byte, HTTPBufferSize),
+		interned:     make(map[string]string),
+		telemetry:    telemetry,
+		tlsResolver:  newTLSResolver(c.ProcRoot),
 	}
 }
 
 func (h *httpStatKeeper) Process(transactions []httpTX) {
-	var dropped int
+	var dropped, truncated int
 	for _, tx := range transactions {
-		key := h.newKey(tx)
+		key, fullPath, ok := h.newKey(tx)
+		if !fullPath {
+			truncated++
+		}
+		if !ok {
+			dropped++
+			continue
+		}
 		stats, ok := h.stats[key]
 		if !ok && len(h.stats) >= h.maxEntries {
 			dropped++
@@ -42,9 +62,12 @@ func (h *httpStatKeeper) Process(transactions []httpTX) {
 
 		stats.AddRequest(tx.StatusClass(), tx.RequestLatency())
 		h.stats[key] = stats
+
+		h.addEndpointRequest(key.Path, tx)
 	}
 
-	atomic.AddInt64(&h.telemetry.dropped, int64(dropped))
+	h.telemetry.addDropped(dropped)
+	atomic.AddInt64(&h.telemetry.truncated, int64(truncated))
 	atomic.StoreInt64(&h.telemetry.aggregations, int64(len(h.stats)))
 }
 
@@ -52,13 +75,43 @@ func (h *httpStatKeeper) GetAndResetAllStats() map[Key]RequestStats {
 	ret := h.stats // No deep copy needed since `h.stats` gets reset
 	h.stats = make(map[Key]RequestStats)
 	h.interned = make(map[string]string)
+	h.tlsResolver.reset()
+	return ret
+}
+
+// GetAndResetEndpointStats returns the latencies of the requests aggregated by path and method
+func (h *httpStatKeeper) GetAndResetEndpointStats() map[EndpointKey]RequestStats {
+	ret := h.endpoints
+	h.endpoints = make(map[EndpointKey]RequestStats)
 	return ret
 }
 
-func (h *httpStatKeeper) newKey(tx httpTX) Key {
-	path := tx.Path(h.buffer)
+func (h *httpStatKeeper) addEndpointRequest(path string, tx httpTX) {
+	key := EndpointKey{Path: path, Method: tx.Method(), GRPC: tx.IsGRPC()}
+	stats, ok := h.endpoints[key]
+	if !ok && len(h.endpoints) >= h.maxEntries {
+		return
+	}
+
+	stats.AddRequest(tx.StatusClass(), tx.RequestLatency())
+	h.endpoints[key] = stats
+}
+
+// newKey returns the aggregation key of the transaction, whether its path was fully captured,
+// and false if the connection of the transaction couldn't be resolved
+func (h *httpStatKeeper) newKey(tx httpTX) (Key, bool, bool) {
+	path, fullPath := tx.Path(h.buffer)
 	pathString := h.intern(path)
 
+	if tx.IsTLS() {
+		key, err := h.tlsResolver.newKey(tx, pathString)
+		if err != nil {
+			log.Debugf("could not resolve the connection of https transaction: %s", err)
+			return key, fullPath, false
+		}
+		return key, fullPath, true
+	}
+
 	return Key{
 		SrcIPHigh: uint64(tx.tup.saddr_h),
 		SrcIPLow:  uint64(tx.tup.saddr_l),
@@ -66,15 +119,25 @@ func (h *httpStatKeeper) newKey(tx httpTX) Key {
 		DstIPHigh: uint64(tx.tup.daddr_h),
 		DstIPLow:  uint64(tx.tup.daddr_l),
 		DstPort:   uint16(tx.tup.dport),
+		IPv6:      tx.IsIPv6(),
 		Path:      pathString,
-	}
+	}, fullPath, true
 }
 
+// intern returns the interned path used to aggregate the transactions, with the replace rules applied
 func (h *httpStatKeeper) intern(b []byte) string {
 	v, ok := h.interned[string(b)]
 	if !ok {
-		v = string(b)
-		h.interned[v] = v
+		raw := string(b)
+		v = h.normalize(raw)
+		h.interned[raw] = v
 	}
 	return v
 }
+
+func (h *httpStatKeeper) normalize(path string) string {
+	for _, r := range h.replaceRules {
+		path = r.Re.ReplaceAllString(path, r.Repl)
+	}
+	return path
+}
@@ -5,15 +5,19 @@ package http
 import (
 	"encoding/binary"
 	"fmt"
+	"regexp"
 	"strconv"
+	"strings"
 	"testing"
 
+	"github.com/DataDog/datadog-agent/pkg/network/config"
 	"github.com/DataDog/datadog-agent/pkg/process/util"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestProcessHTTPTransactions(t *testing.T) {
-	sk := newHTTPStatkeeper(1000, newTelemetry())
+	sk := newHTTPStatkeeper(&config.Config{MaxHTTPStatsBuffered: 1000}, newTelemetry())
 	txs := make([]httpTX, 100)
 
 	sourceIP := util.AddressFromString("1.1.1.1")
@@ -54,6 +58,149 @@ func TestProcessHTTPTransactions(t *testing.T) {
 	}
 }
 
+func TestProcessHTTPTransactionsWithReplaceRules(t *testing.T) {
+	cfg := &config.Config{
+		MaxHTTPStatsBuffered: 1000,
+		HTTPReplaceRules: []*config.ReplaceRule{
+			{Re: regexp.MustCompile(`/[0-9]+`), Repl: "/{id}"},
+		},
+	}
+	sk := newHTTPStatkeeper(cfg, newTelemetry())
+
+	sourceIP := util.AddressFromString("1.1.1.1")
+	destIP := util.AddressFromString("2.2.2.2")
+	var txs []httpTX
+	for i := 0; i < 10; i++ {
+		path := fmt.Sprintf("/users/%d/orders/%d", 1000+i, i*7)
+		txs = append(txs, generateIPv4HTTPTransaction(sourceIP, destIP, 1234, 8080, path, 200, 10))
+	}
+	txs = append(txs, generateIPv4HTTPTransaction(sourceIP, destIP, 1234, 8080, "/users", 200, 10))
+	sk.Process(txs)
+
+	stats := sk.GetAndResetAllStats()
+	require.Len(t, stats, 2)
+	key := NewKey(sourceIP, destIP, 1234, 8080, "/users/{id}/orders/{id}")
+	require.Contains(t, stats, key)
+	assert.Equal(t, 10, stats[key][1].Count)
+	assert.Contains(t, stats, NewKey(sourceIP, destIP, 1234, 8080, "/users"))
+
+	// the raw path is still available
+	buffer := make([]byte, HTTPBufferSize)
+	path, _ := txs[0].Path(buffer)
+	assert.Equal(t, "/users/1000/orders/0", string(path))
+}
+
+func TestProcessHTTPTransactionsWithQueryString(t *testing.T) {
+	sk := newHTTPStatkeeper(&config.Config{MaxHTTPStatsBuffered: 1000}, newTelemetry())
+	sourceIP := util.AddressFromString("1.1.1.1")
+	destIP := util.AddressFromString("2.2.2.2")
+
+	txs := []httpTX{
+		generateIPv4HTTPTransaction(sourceIP, destIP, 1234, 8080, "/search?q=secret", 200, 10),
+		generateIPv4HTTPTransaction(sourceIP, destIP, 1234, 8080, "/search?q=other&page=2", 200, 10),
+		generateIPv4HTTPTransaction(sourceIP, destIP, 1234, 8080, "/search", 200, 10),
+	}
+	sk.Process(txs)
+
+	stats := sk.GetAndResetAllStats()
+	require.Len(t, stats, 1)
+	key := NewKey(sourceIP, destIP, 1234, 8080, "/search")
+	require.Contains(t, stats, key)
+	assert.Equal(t, 3, stats[key][1].Count)
+
+	// the query string is still available for debugging
+	buffer := make([]byte, HTTPBufferSize)
+	path, _ := txs[0].RawPath(buffer)
+	assert.Equal(t, "/search?q=secret", string(path))
+}
+
+func TestProcessHTTPTransactionsTruncatedPath(t *testing.T) {
+	telemetry := newTelemetry()
+	sk := newHTTPStatkeeper(&config.Config{MaxHTTPStatsBuffered: 1000}, telemetry)
+	sourceIP := util.AddressFromString("1.1.1.1")
+	destIP := util.AddressFromString("2.2.2.2")
+
+	path := "/" + strings.Repeat("a", HTTPBufferSize)
+	sk.Process([]httpTX{
+		generateIPv4HTTPTransaction(sourceIP, destIP, 1234, 8080, path, 200, 10),
+		generateIPv4HTTPTransaction(sourceIP, destIP, 1234, 8080, "/testpath", 200, 10),
+	})
+
+	stats := sk.GetAndResetAllStats()
+	assert.Len(t, stats, 2)
+	assert.Equal(t, int64(1), telemetry.reset().truncated)
+}
+
+func TestProcessHTTPTransactionsEndpointLatencies(t *testing.T) {
+	sk := newHTTPStatkeeper(&config.Config{MaxHTTPStatsBuffered: 1000}, newTelemetry())
+
+	// the transactions are sent on different connections
+	destIP := util.AddressFromString("2.2.2.2")
+	var txs []httpTX
+	for i := 1; i <= 100; i++ {
+		sourceIP := util.AddressFromString(fmt.Sprintf("1.1.1.%d", i))
+		get := generateIPv4HTTPTransaction(sourceIP, destIP, 1234, 8080, "/testpath", 200, float64(i))
+		get.request_method = 1 // HTTP_GET
+		post := generateIPv4HTTPTransaction(sourceIP, destIP, 1234, 8080, "/testpath", 500, 200)
+		post.request_method = 2 // HTTP_POST
+		txs = append(txs, get, post)
+	}
+	sk.Process(txs)
+
+	stats := sk.GetAndResetEndpointStats()
+	assert.Len(t, stats, 2)
+	assert.Empty(t, sk.endpoints)
+
+	get := stats[EndpointKey{Path: "/testpath", Method: "GET"}]
+	assert.Equal(t, 100, get[1].Count)
+	for q, expected := range map[float64]float64{0.5: 50, 0.95: 95, 0.99: 99} {
+		latency, ok := get.Percentile(200, q)
+		assert.True(t, ok)
+		assert.InDelta(t, expected, latency, expected*RelativeAccuracy+1, "p%v", q*100)
+	}
+	_, ok := get.Percentile(500, 0.5)
+	assert.False(t, ok)
+
+	post := stats[EndpointKey{Path: "/testpath", Method: "POST"}]
+	assert.Equal(t, 100, post[4].Count)
+	latency, ok := post.Percentile(500, 0.99)
+	assert.True(t, ok)
+	assert.InDelta(t, 200, latency, 200*RelativeAccuracy)
+}
+
+func TestProcessHTTPTransactionsIPv6(t *testing.T) {
+	sk := newHTTPStatkeeper(&config.Config{MaxHTTPStatsBuffered: 1000}, newTelemetry())
+	sourceIP := util.AddressFromString("2001:db8::1")
+	destIP := util.AddressFromString("2001:db8::2")
+
+	sk.Process([]httpTX{
+		generateIPv6HTTPTransaction(sourceIP, destIP, 1234, 8080, "/testpath", 200, 10),
+		// the IPv6 and IPv4 addresses of these connections have the same 64-bit halves
+		generateIPv6HTTPTransaction(util.AddressFromString("::101:101:0:0"), util.AddressFromString("::202:202:0:0"), 1234, 8080, "/testpath", 200, 10),
+		generateIPv4HTTPTransaction(util.AddressFromString("1.1.1.1"), util.AddressFromString("2.2.2.2"), 1234, 8080, "/testpath", 200, 10),
+	})
+
+	stats := sk.GetAndResetAllStats()
+	assert.Len(t, stats, 3)
+	key := NewKey(sourceIP, destIP, 1234, 8080, "/testpath")
+	assert.True(t, key.IPv6)
+	require.Contains(t, stats, key)
+	assert.Equal(t, 1, stats[key][1].Count)
+	assert.Contains(t, stats, NewKey(util.AddressFromString("1.1.1.1"), util.AddressFromString("2.2.2.2"), 1234, 8080, "/testpath"))
+}
+
+func generateIPv6HTTPTransaction(source util.Address, dest util.Address, sourcePort int, destPort int, path string, code int, latency float64) httpTX {
+	tx := generateIPv4HTTPTransaction(source, dest, sourcePort, destPort, path, code, latency)
+	saddrl, saddrh := util.ToLowHigh(source)
+	daddrl, daddrh := util.ToLowHigh(dest)
+	tx.tup.saddr_l = _Ctype_ulonglong(saddrl)
+	tx.tup.saddr_h = _Ctype_ulonglong(saddrh)
+	tx.tup.daddr_l = _Ctype_ulonglong(daddrl)
+	tx.tup.daddr_h = _Ctype_ulonglong(daddrh)
+	tx.tup.metadata |= 2 // CONN_V6
+	return tx
+}
+
 func generateIPv4HTTPTransaction(source util.Address, dest util.Address, sourcePort int, destPort int, path string, code int, latency float64) httpTX {
 	var tx httpTX
 
@@ -72,7 +219,7 @@ func generateIPv4HTTPTransaction(source util.Address, dest util.Address, sourceP
 }
 
 func BenchmarkProcessSameConn(b *testing.B) {
-	sk := newHTTPStatkeeper(1000, newTelemetry())
+	sk := newHTTPStatkeeper(&config.Config{MaxHTTPStatsBuffered: 1000}, newTelemetry())
 	tx := generateIPv4HTTPTransaction(
 		util.AddressFromString("1.1.1.1"),
 		util.AddressFromString("2.2.2.2"),
@@ -1,6 +1,8 @@
 package http
 
 import (
+	"net"
+
 	"github.com/DataDog/datadog-agent/pkg/process/util"
 	"github.com/DataDog/datadog-agent/pkg/util/log"
 	"github.com/DataDog/sketches-go/ddsketch"
@@ -16,6 +18,9 @@ type Key struct {
 	DstIPLow  uint64
 	DstPort   uint16
 
+	// IPv6 is true when the addresses are IPv6 addresses
+	IPv6 bool
+
 	Path string
 }
 
@@ -30,10 +35,21 @@ func NewKey(saddr, daddr util.Address, sport, dport uint16, path string) Key {
 		DstIPHigh: daddrh,
 		DstIPLow:  daddrl,
 		DstPort:   dport,
+		IPv6:      saddr != nil && len(saddr.Bytes()) == net.IPv6len,
 		Path:      path,
 	}
 }
 
+// EndpointKey is an identifier for the HTTP transactions sent to a path with a given method,
+// whatever the connection they were sent on
+type EndpointKey struct {
+	Path   string
+	Method string
+
+	// GRPC is true for the gRPC requests, whose path is of the form /<service>/<method>
+	GRPC bool
+}
+
 // IsHTTP determines whether the port number corresponds to a HTTP port
 func IsHTTP(port int) bool {
 	return port == 80 || port == 8080
@@ -138,6 +154,26 @@ func (r *RequestStats) AddRequest(statusClass int, latency float64) {
 	}
 }
 
+// Percentile returns the latency (in milliseconds) at the given quantile, between 0 and 1, of the requests
+// of a status class. It returns false if there is no request for this status class.
+func (r *RequestStats) Percentile(statusClass int, q float64) (float64, bool) {
+	i := statusClass/100 - 1
+	if i < 0 || i >= len(r) || r[i].Count == 0 {
+		return 0, false
+	}
+
+	if r[i].Latencies == nil {
+		return r[i].FirstLatencySample, true
+	}
+
+	latency, err := r[i].Latencies.GetValueAtQuantile(q)
+	if err != nil {
+		log.Debugf("could not compute request latency percentile: %v", err)
+		return 0, false
+	}
+	return latency, true
+}
+
 func (r *RequestStats) initSketch(i int) (err error) {
 	r[i].Latencies, err = ddsketch.NewDefaultDDSketch(RelativeAccuracy)
 	if err != nil {
@@ -59,6 +59,30 @@ func TestCombineWith(t *testing.T) {
 	}
 }
 
+func TestPercentile(t *testing.T) {
+	var stats RequestStats
+	_, ok := stats.Percentile(200, 0.5)
+	assert.False(t, ok)
+
+	// a single sample doesn't have a sketch
+	stats.AddRequest(200, 10.0)
+	latency, ok := stats.Percentile(200, 0.99)
+	assert.True(t, ok)
+	assert.Equal(t, 10.0, latency)
+
+	for i := 1; i <= 1000; i++ {
+		stats.AddRequest(404, float64(i))
+	}
+	for q, expected := range map[float64]float64{0.5: 500, 0.95: 950, 0.99: 990} {
+		latency, ok := stats.Percentile(400, q)
+		assert.True(t, ok)
+		assert.InDelta(t, expected, latency, expected*RelativeAccuracy)
+	}
+
+	_, ok = stats.Percentile(600, 0.5)
+	assert.False(t, ok)
+}
+
 func verifyQuantile(t *testing.T, sketch *ddsketch.DDSketch, q float64, expectedValue float64) {
 	val, err := sketch.GetValueAtQuantile(q)
 	assert.Nil(t, err)
@@ -0,0 +1,262 @@
+// +build linux_bpf
+
+package http
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/DataDog/datadog-agent/pkg/process/util"
+	"github.com/DataDog/datadog-agent/pkg/util/kernel"
+	"github.com/DataDog/datadog-agent/pkg/util/log"
+)
+
+// minHTTPSKernelVersion is the first kernel version supporting eBPF programs attached to uprobes
+var minHTTPSKernelVersion = kernel.VersionCode(4, 3, 0)
+
+// libSSLCandidates are the usual locations of the OpenSSL library
+var libSSLCandidates = []string{
+	"/usr/lib/x86_64-linux-gnu/libssl.so.3",
+	"/usr/lib/aarch64-linux-gnu/libssl.so.3",
+	"/usr/lib64/libssl.so.3",
+	"/usr/lib/x86_64-linux-gnu/libssl.so.1.1",
+	"/usr/lib/aarch64-linux-gnu/libssl.so.1.1",
+	"/usr/lib64/libssl.so.1.1",
+	"/usr/lib/libssl.so.1.1",
+	"/lib/x86_64-linux-gnu/libssl.so.1.1",
+	"/lib64/libssl.so.1.1",
+	"/usr/lib/x86_64-linux-gnu/libssl.so.1.0.0",
+	"/usr/lib64/libssl.so.10",
+	"/usr/lib/x86_64-linux-gnu/libssl.so",
+	"/usr/lib64/libssl.so",
+}
+
+// findLibSSL returns the OpenSSL library the HTTPS uprobes are attached to
+func findLibSSL(configured string) (string, error) {
+	if configured != "" {
+		if _, err := os.Stat(configured); err != nil {
+			return "", fmt.Errorf("invalid libssl path: %s", err)
+		}
+		return configured, nil
+	}
+
+	for _, candidate := range libSSLCandidates {
+		if _, err := os.Stat(candidate); err == nil {
+			return candidate, nil
+		}
+	}
+	return "", fmt.Errorf("could not find libssl, please set network_config.libssl_path")
+}
+
+// IsTLS returns true if the transaction was captured by the OpenSSL uprobes
+func (tx *httpTX) IsTLS() bool {
+	return tx.tls_role != tlsRoleNone
+}
+
+// tlsSocket returns the pid and the socket file descriptor identifying the connection of a TLS transaction
+func (tx *httpTX) tlsSocket() (pid uint32, fd uint32) {
+	return uint32(tx.tup.pid), uint32(tx.tup.saddr_l)
+}
+
+type tlsSocketKey struct {
+	pid, fd uint32
+}
+
+// tcpSocket holds the addresses of a TCP socket as seen by the process owning it
+type tcpSocket struct {
+	laddr, raddr util.Address
+	lport, rport uint16
+
+	// inode tells whether the file descriptor still refers to the same socket
+	inode string
+}
+
+// tlsResolver resolves the socket tuple of the TLS transactions from procfs.
+// The uprobes only know about the pid and the socket file descriptor.
+// The sockets are resolved when they're set on an OpenSSL context, which may be
+// long before their transactions are flushed, and they're only resolved from the
+// transactions when the notification was lost.
+type tlsResolver struct {
+	procRoot string
+
+	// resolved sockets, they're kept until their OpenSSL context is shut down
+	cache map[tlsSocketKey]*tcpSocket
+	// sockets of the OpenSSL contexts shut down since the last reset, some of
+	// their transactions may still be pending
+	closed map[tlsSocketKey]struct{}
+}
+
+func newTLSResolver(procRoot string) *tlsResolver {
+	return &tlsResolver{
+		procRoot: procRoot,
+		cache:    make(map[tlsSocketKey]*tcpSocket),
+		closed:   make(map[tlsSocketKey]struct{}),
+	}
+}
+
+// add resolves the socket set on an OpenSSL context by SSL_set_fd
+func (r *tlsResolver) add(pid, fd uint32) {
+	key := tlsSocketKey{pid: pid, fd: fd}
+	// the file descriptor may have been reused since the previous socket was shut down
+	delete(r.cache, key)
+	delete(r.closed, key)
+	if _, err := r.resolve(pid, fd); err != nil {
+		log.Debugf("could not resolve tls socket: %s", err)
+	}
+}
+
+// remove drops the socket of an OpenSSL context shut down by SSL_shutdown at the next reset,
+// once the transactions captured before the shutdown are processed
+func (r *tlsResolver) remove(pid, fd uint32) {
+	key := tlsSocketKey{pid: pid, fd: fd}
+	if _, ok := r.cache[key]; ok {
+		r.closed[key] = struct{}{}
+	}
+}
+
+// newKey returns the Key of a TLS transaction, with the server side of the connection as destination
+func (r *tlsResolver) newKey(tx httpTX, path string) (Key, error) {
+	pid, fd := tx.tlsSocket()
+	sock, err := r.resolve(pid, fd)
+	if err != nil {
+		return Key{}, err
+	}
+
+	if tx.tls_role == tlsRoleServer {
+		return NewKey(sock.raddr, sock.laddr, sock.rport, sock.lport, path), nil
+	}
+	return NewKey(sock.laddr, sock.raddr, sock.lport, sock.rport, path), nil
+}
+
+// serverPort returns the port of the server side of the connection of a TLS transaction
+func (r *tlsResolver) serverPort(tx httpTX) (uint16, error) {
+	pid, fd := tx.tlsSocket()
+	sock, err := r.resolve(pid, fd)
+	if err != nil {
+		return 0, err
+	}
+
+	if tx.tls_role == tlsRoleServer {
+		return sock.lport, nil
+	}
+	return sock.rport, nil
+}
+
+func (r *tlsResolver) resolve(pid, fd uint32) (*tcpSocket, error) {
+	key := tlsSocketKey{pid: pid, fd: fd}
+	if sock, ok := r.cache[key]; ok {
+		return sock, nil
+	}
+
+	inode, err := r.socketInode(pid, fd)
+	if err != nil {
+		return nil, err
+	}
+
+	pidRoot := filepath.Join(r.procRoot, strconv.Itoa(int(pid)))
+	for _, file := range []string{"tcp", "tcp6"} {
+		sock, err := findTCPSocket(filepath.Join(pidRoot, "net", file), inode)
+		if err != nil {
+			return nil, err
+		}
+		if sock != nil {
+			r.cache[key] = sock
+			return sock, nil
+		}
+	}
+	return nil, fmt.Errorf("could not find tcp socket %s of process %d", inode, pid)
+}
+
+// socketInode returns the inode of the socket a file descriptor of a process refers to
+func (r *tlsResolver) socketInode(pid, fd uint32) (string, error) {
+	link, err := os.Readlink(filepath.Join(r.procRoot, strconv.Itoa(int(pid)), "fd", strconv.Itoa(int(fd))))
+	if err != nil {
+		return "", err
+	}
+	// socket file descriptors link to socket:[<inode>]
+	if !strings.HasPrefix(link, "socket:[") || !strings.HasSuffix(link, "]") {
+		return "", fmt.Errorf("file descriptor %d of process %d is not a socket: %s", fd, pid, link)
+	}
+	return link[len("socket:[") : len(link)-1], nil
+}
+
+// reset drops the sockets of the OpenSSL contexts shut down since the last reset, as well as the
+// sockets closed without SSL_shutdown, e.g. when the process exited
+func (r *tlsResolver) reset() {
+	for key := range r.closed {
+		delete(r.cache, key)
+	}
+	r.closed = make(map[tlsSocketKey]struct{})
+
+	for key, sock := range r.cache {
+		if inode, err := r.socketInode(key.pid, key.fd); err != nil || inode != sock.inode {
+			delete(r.cache, key)
+		}
+	}
+}
+
+// findTCPSocket looks for the socket with the given inode in a /proc/net/tcp{,6} file
+func findTCPSocket(path, inode string) (*tcpSocket, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	// Skip header line
+	scanner.Scan()
+	for scanner.Scan() {
+		// sl local_address rem_address st tx_queue:rx_queue tr:tm->when retrnsmt uid timeout inode
+		fields := bytes.Fields(scanner.Bytes())
+		if len(fields) < 10 || string(fields[9]) != inode {
+			continue
+		}
+
+		laddr, lport, err := parseProcNetAddress(string(fields[1]))
+		if err != nil {
+			return nil, err
+		}
+		raddr, rport, err := parseProcNetAddress(string(fields[2]))
+		if err != nil {
+			return nil, err
+		}
+		return &tcpSocket{laddr: laddr, raddr: raddr, lport: lport, rport: rport, inode: inode}, nil
+	}
+	return nil, scanner.Err()
+}
+
+// parseProcNetAddress parses an address of a /proc/net/tcp{,6} file, e.g. 0100007F:1F90.
+// The address is printed as 32-bit words in host byte order, little-endian on the supported architectures.
+func parseProcNetAddress(s string) (util.Address, uint16, error) {
+	idx := strings.IndexByte(s, ':')
+	if idx == -1 {
+		return nil, 0, fmt.Errorf("invalid address %s", s)
+	}
+
+	port, err := strconv.ParseUint(s[idx+1:], 16, 16)
+	if err != nil {
+		return nil, 0, fmt.Errorf("invalid port in address %s: %s", s, err)
+	}
+
+	ip, err := hex.DecodeString(s[:idx])
+	if err != nil || (len(ip) != 4 && len(ip) != 16) {
+		return nil, 0, fmt.Errorf("invalid ip in address %s", s)
+	}
+	for i := 0; i < len(ip); i += 4 {
+		word := ip[i : i+4]
+		word[0], word[1], word[2], word[3] = word[3], word[2], word[1], word[0]
+	}
+
+	// IPv4-mapped IPv6 addresses are reported as IPv4 addresses
+	return util.AddressFromNetIP(ip), uint16(port), nil
+}
@@ -0,0 +1,142 @@
+// +build linux_bpf
+
+package http
+
+import (
+	"net"
+	"os"
+	"testing"
+
+	"github.com/DataDog/datadog-agent/pkg/network/config"
+	"github.com/DataDog/datadog-agent/pkg/process/util"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseProcNetAddress(t *testing.T) {
+	addr, port, err := parseProcNetAddress("0100007F:1F90")
+	require.NoError(t, err)
+	assert.Equal(t, util.AddressFromString("127.0.0.1"), addr)
+	assert.Equal(t, uint16(8080), port)
+
+	addr, port, err = parseProcNetAddress("00000000000000000000000001000000:01BB")
+	require.NoError(t, err)
+	assert.Equal(t, util.AddressFromString("::1"), addr)
+	assert.Equal(t, uint16(443), port)
+
+	// IPv4-mapped IPv6 address
+	addr, _, err = parseProcNetAddress("0000000000000000FFFF00000100007F:01BB")
+	require.NoError(t, err)
+	assert.Equal(t, util.AddressFromString("127.0.0.1"), addr)
+
+	_, _, err = parseProcNetAddress("0100007F")
+	assert.Error(t, err)
+	_, _, err = parseProcNetAddress("0100:1F90")
+	assert.Error(t, err)
+}
+
+func TestTLSResolver(t *testing.T) {
+	server, client, fd := tcpConnection(t)
+	defer server.Close()
+	defer client.Close()
+
+	resolver := newTLSResolver("/proc")
+	sock, err := resolver.resolve(uint32(os.Getpid()), fd)
+	require.NoError(t, err)
+
+	laddr := client.LocalAddr().(*net.TCPAddr)
+	raddr := client.RemoteAddr().(*net.TCPAddr)
+	assert.Equal(t, util.AddressFromNetIP(laddr.IP), sock.laddr)
+	assert.Equal(t, uint16(laddr.Port), sock.lport)
+	assert.Equal(t, util.AddressFromNetIP(raddr.IP), sock.raddr)
+	assert.Equal(t, uint16(raddr.Port), sock.rport)
+
+	// the file descriptor of a regular file isn't resolved
+	f, err := os.Open(os.Args[0])
+	require.NoError(t, err)
+	defer f.Close()
+	_, err = resolver.resolve(uint32(os.Getpid()), uint32(f.Fd()))
+	assert.Error(t, err)
+}
+
+func TestTLSResolverSocketLifetime(t *testing.T) {
+	pid := uint32(os.Getpid())
+	key := func(fd uint32) tlsSocketKey { return tlsSocketKey{pid: pid, fd: fd} }
+	resolver := newTLSResolver("/proc")
+
+	// the socket is resolved when it's set on the OpenSSL context and outlives the resets
+	server, client, fd := tcpConnection(t)
+	defer server.Close()
+	resolver.add(pid, fd)
+	require.Contains(t, resolver.cache, key(fd))
+	resolver.reset()
+	require.Contains(t, resolver.cache, key(fd))
+
+	// the pending transactions of a connection shut down are still resolved until the next reset
+	resolver.remove(pid, fd)
+	_, err := resolver.resolve(pid, fd)
+	require.NoError(t, err)
+	resolver.reset()
+	assert.NotContains(t, resolver.cache, key(fd))
+	client.Close()
+
+	// the socket of a connection closed without SSL_shutdown is dropped
+	server, client, fd = tcpConnection(t)
+	defer server.Close()
+	resolver.add(pid, fd)
+	require.Contains(t, resolver.cache, key(fd))
+	client.Close()
+	resolver.reset()
+	assert.NotContains(t, resolver.cache, key(fd))
+}
+
+func TestProcessHTTPSTransactions(t *testing.T) {
+	server, client, fd := tcpConnection(t)
+	defer server.Close()
+	defer client.Close()
+
+	clientAddr := client.LocalAddr().(*net.TCPAddr)
+	serverAddr := client.RemoteAddr().(*net.TCPAddr)
+
+	sk := newHTTPStatkeeper(config.New(), newTelemetry())
+	clientTX := generateHTTPSTransaction(fd, tlsRoleClient, "/client")
+	// with the server role the local end of the socket is the destination
+	serverTX := generateHTTPSTransaction(fd, tlsRoleServer, "/server")
+	unresolvedTX := generateHTTPSTransaction(1<<30, tlsRoleClient, "/unresolved")
+	sk.Process([]httpTX{clientTX, serverTX, unresolvedTX})
+
+	stats := sk.GetAndResetAllStats()
+	assert.Len(t, stats, 2)
+	clientIP := util.AddressFromNetIP(clientAddr.IP)
+	serverIP := util.AddressFromNetIP(serverAddr.IP)
+	assert.Contains(t, stats, NewKey(clientIP, serverIP, uint16(clientAddr.Port), uint16(serverAddr.Port), "/client"))
+	assert.Contains(t, stats, NewKey(serverIP, clientIP, uint16(serverAddr.Port), uint16(clientAddr.Port), "/server"))
+}
+
+func generateHTTPSTransaction(fd uint32, role int, path string) httpTX {
+	tx := generateIPv4HTTPTransaction(util.AddressFromString("0.0.0.0"), util.AddressFromString("0.0.0.0"), 0, 0, path, 200, 10)
+	tx.tup.pid = _Ctype_uint(os.Getpid())
+	tx.tup.saddr_l = _Ctype_ulonglong(fd)
+	tx.tls_role = _Ctype_uchar(role)
+	return tx
+}
+
+// tcpConnection returns both ends of a local TCP connection and the file descriptor of the client end
+func tcpConnection(t *testing.T) (net.Conn, net.Conn, uint32) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+
+	client, err := net.Dial("tcp", listener.Addr().String())
+	require.NoError(t, err)
+	server, err := listener.Accept()
+	require.NoError(t, err)
+
+	raw, err := client.(*net.TCPConn).SyscallConn()
+	require.NoError(t, err)
+	var fd uint32
+	err = raw.Control(func(sysfd uintptr) { fd = uint32(sysfd) })
+	require.NoError(t, err)
+
+	return server, client, fd
+}
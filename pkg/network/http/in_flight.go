@@ -0,0 +1,121 @@
+// +build linux_bpf
+
+package http
+
+import (
+	"sort"
+	"unsafe"
+
+	"github.com/DataDog/datadog-agent/pkg/util/log"
+	"github.com/DataDog/ebpf"
+)
+
+/*
+#define HTTP_LARGE_BUFFER
+#include "../ebpf/c/http-types.h"
+*/
+import "C"
+
+// inFlightHeadroom is the percentage of the in-flight map kept free by the evictions, so that new connections can be tracked
+const inFlightHeadroom = 10
+
+// inFlightMap gives access to the transactions tracked in eBPF for the connections which haven't been closed yet
+type inFlightMap interface {
+	transactions() ([]httpTX, error)
+	delete(tx *httpTX) error
+}
+
+type ebpfInFlightMap struct {
+	m *ebpf.Map
+	// fragmentSize is the size of the request fragments of the eBPF program
+	fragmentSize int
+}
+
+func (m *ebpfInFlightMap) transactions() ([]httpTX, error) {
+	var (
+		key C.conn_tuple_t
+		tx  httpTX
+		txs []httpTX
+		raw = make([]byte, txSizeFor(m.fragmentSize))
+	)
+
+	it := m.m.Iterate()
+	for it.Next(unsafe.Pointer(&key), unsafe.Pointer(&raw[0])) {
+		toHTTPTX(raw, m.fragmentSize, &tx)
+		txs = append(txs, tx)
+	}
+	return txs, it.Err()
+}
+
+func (m *ebpfInFlightMap) delete(tx *httpTX) error {
+	return m.m.Delete(unsafe.Pointer(&tx.tup))
+}
+
+// inFlightEvictor keeps the number of tracked connections under network_config.http_max_tracked_connections,
+// minus the headroom, by evicting the oldest incomplete transactions. Otherwise the in-flight map fills up
+// under high connection churn and the new connections are silently ignored by the eBPF program.
+type inFlightEvictor struct {
+	inFlight   inFlightMap
+	capacity   int
+	maxEntries int
+	telemetry  *telemetry
+}
+
+func newInFlightEvictor(inFlight inFlightMap, maxTrackedConnections int, telemetry *telemetry) *inFlightEvictor {
+	return &inFlightEvictor{
+		inFlight:   inFlight,
+		capacity:   maxTrackedConnections,
+		maxEntries: maxTrackedConnections - maxTrackedConnections*inFlightHeadroom/100,
+		telemetry:  telemetry,
+	}
+}
+
+// getCapacity returns the maximum number of connections tracked in eBPF
+func (e *inFlightEvictor) getCapacity() int {
+	if e == nil {
+		return 0
+	}
+	return e.capacity
+}
+
+// evict removes the oldest transactions still waiting for their response. The transactions whose response
+// was seen are kept since they are complete and only wait for the end of the connection to be reported.
+func (e *inFlightEvictor) evict() {
+	if e == nil {
+		return
+	}
+
+	txs, err := e.inFlight.transactions()
+	if err != nil {
+		log.Debugf("could not read the http in-flight transactions: %s", err)
+		return
+	}
+	e.telemetry.setInFlight(len(txs))
+
+	excess := len(txs) - e.maxEntries
+	if excess <= 0 {
+		return
+	}
+
+	incomplete := txs[:0]
+	for _, tx := range txs {
+		if tx.response_status_code == 0 {
+			incomplete = append(incomplete, tx)
+		}
+	}
+	sort.Slice(incomplete, func(i, j int) bool {
+		return incomplete[i].request_started < incomplete[j].request_started
+	})
+	if excess > len(incomplete) {
+		excess = len(incomplete)
+	}
+
+	evicted := 0
+	for i := range incomplete[:excess] {
+		// the connection may have been closed in the meantime
+		if err := e.inFlight.delete(&incomplete[i]); err == nil {
+			evicted++
+		}
+	}
+	e.telemetry.addEvicted(evicted)
+}
@@ -0,0 +1,80 @@
+// +build linux_bpf
+
+package http
+
+import (
+	"testing"
+
+	"github.com/DataDog/datadog-agent/pkg/network/config"
+	"github.com/DataDog/datadog-agent/pkg/process/util"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeInFlightMap map[int]httpTX
+
+func (m fakeInFlightMap) transactions() ([]httpTX, error) {
+	var txs []httpTX
+	for _, tx := range m {
+		txs = append(txs, tx)
+	}
+	return txs, nil
+}
+
+func (m fakeInFlightMap) delete(tx *httpTX) error {
+	delete(m, int(tx.tup.sport))
+	return nil
+}
+
+func TestInFlightEviction(t *testing.T) {
+	sourceIP := util.AddressFromString("1.1.1.1")
+	destIP := util.AddressFromString("2.2.2.2")
+	inFlight := make(fakeInFlightMap)
+
+	// 15 connections are opened with a cap of 10, i.e. at most 9 tracked connections after the evictions
+	for port := 1000; port < 1015; port++ {
+		tx := generateIPv4HTTPTransaction(sourceIP, destIP, port, 8080, "/incomplete", 0, 0)
+		tx.request_started = _Ctype_ulonglong(port)
+		inFlight[port] = tx
+	}
+	// the connections waiting for their close are complete
+	for port := 2000; port < 2005; port++ {
+		inFlight[port] = generateIPv4HTTPTransaction(sourceIP, destIP, port, 8080, "/complete", 200, 10)
+	}
+
+	telemetry := newTelemetry()
+	statkeeper := newHTTPStatkeeper(&config.Config{MaxHTTPStatsBuffered: 1000}, telemetry)
+	m := &Monitor{
+		handler:    statkeeper.Process,
+		telemetry:  telemetry,
+		statkeeper: statkeeper,
+		evictor:    newInFlightEvictor(inFlight, 10, telemetry),
+	}
+	m.evictor.evict()
+
+	stats := m.GetStats()
+	assert.Equal(t, int64(11), stats.Evicted)
+	assert.Equal(t, int64(20), stats.InFlight)
+	assert.Equal(t, int64(10), stats.InFlightCapacity)
+	assert.Len(t, inFlight, 9)
+	for port := 1000; port < 1011; port++ {
+		assert.NotContains(t, inFlight, port)
+	}
+	for port := 1011; port < 1015; port++ {
+		assert.Contains(t, inFlight, port)
+	}
+
+	// the complete transactions are reported when their connection is closed
+	var completed []httpTX
+	for port := 2000; port < 2005; port++ {
+		assert.Contains(t, inFlight, port)
+		completed = append(completed, inFlight[port])
+	}
+	m.process(completed, nil)
+	assert.Len(t, statkeeper.GetAndResetAllStats(), 5)
+
+	// nothing is evicted under the cap
+	m.evictor.evict()
+	stats = m.GetStats()
+	assert.Equal(t, int64(11), stats.Evicted)
+	assert.Equal(t, int64(9), stats.InFlight)
+}
@@ -7,6 +7,8 @@ import (
 )
 
 /*
+// the transactions are handled with the layout of the http-large program, see toHTTPTX
+#define HTTP_LARGE_BUFFER
 #include "../ebpf/c/http-types.h"
 */
 import "C"
@@ -14,18 +16,38 @@ import "C"
 const (
 	HTTPBatchSize  = int(C.HTTP_BATCH_SIZE)
 	HTTPBatchPages = int(C.HTTP_BATCH_PAGES)
-	HTTPBufferSize = int(C.HTTP_BUFFER_SIZE)
+	// HTTPBufferSize is the maximum size of the request fragment captured in eBPF, by the http-large program
+	HTTPBufferSize = int(C.HTTP_LARGE_BUFFER_SIZE)
+	// httpDefaultBufferSize is the size of the request fragment of the default program, larger buffer
+	// sizes load the http-large program
+	httpDefaultBufferSize = int(C.HTTP_DEFAULT_BUFFER_SIZE)
+)
+
+const (
+	tlsRoleNone   = C.HTTP_TLS_NONE
+	tlsRoleClient = C.HTTP_TLS_CLIENT
+	tlsRoleServer = C.HTTP_TLS_SERVER
+)
+
+const (
+	sslSockSet      = C.SSL_SOCK_SET
+	sslSockShutdown = C.SSL_SOCK_SHUTDOWN
 )
 
 type httpTX C.http_transaction_t
 type httpNotification C.http_batch_notification_t
 type httpBatch C.http_batch_t
 type httpBatchKey C.http_batch_key_t
+type sslSockEvent C.ssl_sock_event_t
 
 func toHTTPNotification(data []byte) httpNotification {
 	return *(*httpNotification)(unsafe.Pointer(&data[0]))
 }
 
+func toSSLSockEvent(data []byte) sslSockEvent {
+	return *(*sslSockEvent)(unsafe.Pointer(&data[0]))
+}
+
 // Prepare the httpBatchKey for a map lookup
 func (k *httpBatchKey) Prepare(n httpNotification) {
 	k.cpu = n.cpu
@@ -36,7 +58,21 @@ func (k *httpBatchKey) Prepare(n httpNotification) {
 // GET variables excluded.
 // Example:
 // For a request fragment "GET /foo?var=bar HTTP/1.1", this method will return "/foo"
-func (tx *httpTX) Path(buffer []byte) []byte {
+// The second return value is false when the path was truncated, i.e. it didn't fit in the
+// request fragment.
+func (tx *httpTX) Path(buffer []byte) ([]byte, bool) {
+	return tx.requestTarget(buffer, true)
+}
+
+// RawPath returns the URL from the request fragment captured in eBPF, including the query string.
+// It is meant for debugging, the query string isn't part of the aggregation keys.
+// Example:
+// For a request fragment "GET /foo?var=bar HTTP/1.1", this method will return "/foo?var=bar"
+func (tx *httpTX) RawPath(buffer []byte) ([]byte, bool) {
+	return tx.requestTarget(buffer, false)
+}
+
+func (tx *httpTX) requestTarget(buffer []byte, stripQuery bool) ([]byte, bool) {
 	b := *(*[HTTPBufferSize]byte)(unsafe.Pointer(&tx.request_fragment))
 
 	var i, j int
@@ -45,15 +81,22 @@ func (tx *httpTX) Path(buffer []byte) []byte {
 
 	i++
 
-	for j = i; j < len(b) && b[j] != ' ' && b[j] != '?'; j++ {
+	// the fragment is zero-padded when the configured buffer size is smaller than HTTPBufferSize
+	for j = i; j < len(b) && b[j] != ' ' && b[j] != 0 && !(stripQuery && b[j] == '?'); j++ {
 	}
 
 	if i < j && j <= len(b) {
 		n := copy(buffer, b[i:j])
-		return buffer[:n]
+		fullPath := j < len(b) && b[j] != 0 && n == j-i
+		return buffer[:n], fullPath
 	}
 
-	return nil
+	return nil, false
+}
+
+// IsIPv6 returns true if the transaction was captured on an IPv6 connection
+func (tx *httpTX) IsIPv6() bool {
+	return tx.tup.metadata&C.CONN_V6 != 0
 }
 
 // StatusClass returns an integer representing the status code class
@@ -101,3 +144,39 @@ func (batch *httpBatch) IsDirty(notification httpNotification) bool {
 func (batch *httpBatch) Transactions() []httpTX {
 	return (*(*[HTTPBatchSize]httpTX)(unsafe.Pointer(&batch.txs)))[:]
 }
+
+// txSizeFor returns the size of the http_transaction_t of a program capturing fragmentSize bytes of each request.
+// The request fragment is the last member of the struct.
+func txSizeFor(fragmentSize int) int {
+	align := int(unsafe.Alignof(httpTX{}))
+	size := int(unsafe.Offsetof(httpTX{}.request_fragment)) + fragmentSize
+	return (size + align - 1) / align * align
+}
+
+// batchSizeFor returns the size of the http_batch_t of a program capturing fragmentSize bytes of each request
+func batchSizeFor(fragmentSize int) int {
+	return int(unsafe.Offsetof(httpBatch{}.txs)) + HTTPBatchSize*txSizeFor(fragmentSize)
+}
+
+// toHTTPTX reads a http_transaction_t of a program capturing fragmentSize bytes of each request into tx.
+// The transactions are handled with the layout of the http-large program, whose request fragment is
+// HTTPBufferSize bytes long: the fragment of the transactions of the default program is zero-padded.
+func toHTTPTX(raw []byte, fragmentSize int, tx *httpTX) {
+	*tx = httpTX{}
+	b := (*[unsafe.Sizeof(httpTX{})]byte)(unsafe.Pointer(tx))
+	copy(b[:int(unsafe.Offsetof(tx.request_fragment))+fragmentSize], raw)
+}
+
+// toHTTPBatch reads a http_batch_t of a program capturing fragmentSize bytes of each request into batch
+func toHTTPBatch(raw []byte, fragmentSize int, batch *httpBatch) {
+	*batch = httpBatch{}
+	offset := int(unsafe.Offsetof(batch.txs))
+	b := (*[unsafe.Sizeof(httpBatch{})]byte)(unsafe.Pointer(batch))
+	copy(b[:offset], raw)
+
+	size := txSizeFor(fragmentSize)
+	txs := batch.Transactions()
+	for i := range txs {
+		toHTTPTX(raw[offset+i*size:], fragmentSize, &txs[i])
+	}
+}
@@ -3,8 +3,10 @@
 package http
 
 import (
+	"bytes"
 	"runtime"
 	"testing"
+	"unsafe"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -17,7 +19,55 @@ func TestPath(t *testing.T) {
 	}
 
 	b := make([]byte, HTTPBufferSize)
-	assert.Equal(t, "/foo/bar", string(tx.Path(b)))
+	path, fullPath := tx.Path(b)
+	assert.Equal(t, "/foo/bar", string(path))
+	assert.True(t, fullPath)
+}
+
+func TestRawPath(t *testing.T) {
+	tx := httpTX{
+		request_fragment: requestFragment(
+			[]byte("GET /foo/bar?var1=value HTTP/1.1\nHost: example.com\nUser-Agent: example-browser/1.0"),
+		),
+	}
+
+	b := make([]byte, HTTPBufferSize)
+	path, fullPath := tx.RawPath(b)
+	assert.Equal(t, "/foo/bar?var1=value", string(path))
+	assert.True(t, fullPath)
+
+	// the query string is truncated
+	tx = httpTX{request_fragment: requestFragment([]byte("GET /foo/bar?var1=value"))}
+	path, fullPath = tx.RawPath(b)
+	assert.Equal(t, "/foo/bar?var1=value", string(path))
+	assert.False(t, fullPath)
+	path, fullPath = tx.Path(b)
+	assert.Equal(t, "/foo/bar", string(path))
+	assert.True(t, fullPath)
+}
+
+func TestPathTruncated(t *testing.T) {
+	request := []byte("GET /api/v1/users/1000/orders/2000/items HTTP/1.1\nHost: example.com")
+	b := make([]byte, HTTPBufferSize)
+
+	// only the configured number of bytes is captured in eBPF, the rest of the fragment is zeroed
+	tx := httpTX{request_fragment: requestFragment(request[:25])}
+	path, fullPath := tx.Path(b)
+	assert.Equal(t, "/api/v1/users/1000/or", string(path))
+	assert.False(t, fullPath)
+
+	// a larger buffer captures the full path
+	tx = httpTX{request_fragment: requestFragment(request[:64])}
+	path, fullPath = tx.Path(b)
+	assert.Equal(t, "/api/v1/users/1000/orders/2000/items", string(path))
+	assert.True(t, fullPath)
+
+	// the path fills the whole fragment
+	long := append([]byte("GET /"), bytes.Repeat([]byte("a"), HTTPBufferSize)...)
+	tx = httpTX{request_fragment: requestFragment(long)}
+	path, fullPath = tx.Path(b)
+	assert.Len(t, path, HTTPBufferSize-len("GET "))
+	assert.False(t, fullPath)
 }
 
 func BenchmarkPath(b *testing.B) {
@@ -31,11 +81,47 @@ func BenchmarkPath(b *testing.B) {
 	b.ResetTimer()
 	buf := make([]byte, HTTPBufferSize)
 	for i := 0; i < b.N; i++ {
-		_ = tx.Path(buf)
+		_, _ = tx.Path(buf)
 	}
 	runtime.KeepAlive(buf)
 }
 
+func TestTXSizeFor(t *testing.T) {
+	assert.Equal(t, int(unsafe.Sizeof(httpTX{})), txSizeFor(HTTPBufferSize))
+	assert.Equal(t, int(unsafe.Sizeof(httpBatch{})), batchSizeFor(HTTPBufferSize))
+	assert.Less(t, txSizeFor(httpDefaultBufferSize), txSizeFor(HTTPBufferSize))
+	assert.Zero(t, txSizeFor(httpDefaultBufferSize)%int(unsafe.Alignof(httpTX{})))
+}
+
+func TestToHTTPBatch(t *testing.T) {
+	request := "GET /foo/bar/and/a/much/longer/path HTTP/1.1\nHost: example.com"
+	var txs [HTTPBatchSize]httpTX
+	for i := range txs {
+		txs[i] = httpTX{
+			request_started:      _Ctype_ulonglong(i + 1),
+			response_status_code: _Ctype_ushort(200 + i),
+			request_fragment:     requestFragment([]byte(request)),
+		}
+	}
+
+	// lay the transactions out the way the default program does
+	size := txSizeFor(httpDefaultBufferSize)
+	offset := int(unsafe.Offsetof(httpBatch{}.txs))
+	raw := make([]byte, batchSizeFor(httpDefaultBufferSize))
+	for i := range txs {
+		b := (*[unsafe.Sizeof(httpTX{})]byte)(unsafe.Pointer(&txs[i]))
+		copy(raw[offset+i*size:], b[:int(unsafe.Offsetof(httpTX{}.request_fragment))+httpDefaultBufferSize])
+	}
+
+	var batch httpBatch
+	toHTTPBatch(raw, httpDefaultBufferSize, &batch)
+	for i, tx := range batch.Transactions() {
+		assert.Equal(t, txs[i].request_started, tx.request_started)
+		assert.Equal(t, txs[i].response_status_code, tx.response_status_code)
+		assert.Equal(t, requestFragment([]byte(request[:httpDefaultBufferSize])), tx.request_fragment)
+	}
+}
+
 func requestFragment(fragment []byte) [HTTPBufferSize]_Ctype_char {
 	var b [HTTPBufferSize]_Ctype_char
 	for i := 0; i < len(b) && i < len(fragment); i++ {
@@ -3,18 +3,33 @@
 package http
 
 import (
+	"errors"
 	"fmt"
 
 	"sync"
+	"sync/atomic"
 	"time"
 
 	ddebpf "github.com/DataDog/datadog-agent/pkg/ebpf"
 	"github.com/DataDog/datadog-agent/pkg/network/config"
 	"github.com/DataDog/datadog-agent/pkg/network/ebpf/probes"
 	filterpkg "github.com/DataDog/datadog-agent/pkg/network/filter"
+	"github.com/DataDog/datadog-agent/pkg/util/kernel"
+	"github.com/DataDog/datadog-agent/pkg/util/log"
 	"github.com/DataDog/ebpf/manager"
 )
 
+const defaultFlushInterval = 30 * time.Second
+
+// ErrNotSupported is returned by NewMonitor, along with a null monitor, when the kernel can't run the HTTP monitoring
+var ErrNotSupported = errors.New("http monitoring is not supported by this kernel version")
+
+// minKernelVersion is the first kernel version supporting the HTTP socket filter
+var minKernelVersion = kernel.VersionCode(4, 1, 0)
+
+// hostVersion returns the version of the running kernel, it is replaced in tests
+var hostVersion = kernel.HostVersion
+
 // Monitor is responsible for:
 // * Creating a raw socket and attaching an eBPF filter to it;
 // * Polling a perf buffer that contains notifications about HTTP transaction batches ready to be read;
@@ -23,12 +38,24 @@ import (
 type Monitor struct {
 	handler func([]httpTX)
 
-	ebpfProgram  *ebpfProgram
-	batchManager *batchManager
-	perfHandler  *ddebpf.PerfHandler
-	telemetry    *telemetry
-	pollRequests chan chan map[Key]RequestStats
-	statkeeper   *httpStatKeeper
+	// batchHandler, if set, receives a copy of the transactions handed to handler encoded by batchEncoder
+	batchHandler func(EncodedBatch)
+	batchEncoder *batchEncoder
+
+	ebpfProgram      *ebpfProgram
+	batchManager     *batchManager
+	perfHandler      *ddebpf.PerfHandler
+	sslPerfHandler   *ddebpf.PerfHandler
+	telemetry        *telemetry
+	pollRequests     chan chan map[Key]RequestStats
+	endpointRequests chan chan map[EndpointKey]RequestStats
+	statkeeper       *httpStatKeeper
+	supported        bool
+	portFilter       *portFilter
+	headerFilter     *headerFilter
+	directions       *directionResolver
+	evictor          *inFlightEvictor
+	flushInterval    time.Duration
 
 	// termination
 	mux           sync.Mutex
@@ -37,15 +64,37 @@ type Monitor struct {
 	stopped       bool
 }
 
-// NewMonitor returns a new Monitor instance
+// NewMonitor returns a new Monitor instance.
+// On kernels older than 4.1.0 it returns a null monitor and ErrNotSupported, so that callers can run without HTTP monitoring.
 func NewMonitor(c *config.Config) (*Monitor, error) {
-	mgr, err := newEBPFProgram(c)
+	currKernelVersion, err := hostVersion()
+	if err != nil {
+		// if the kernel version couldn't be determined, the eBPF program is loaded anyway
+		log.Warnf("could not detect the kernel version, http monitoring may not be supported: %s", err)
+	} else if currKernelVersion < minKernelVersion {
+		return NewNullMonitor(), ErrNotSupported
+	}
+
+	bufferSize := httpBufferSize(c)
+	mgr, err := newEBPFProgram(c, bufferSize)
 	if err != nil {
 		return nil, fmt.Errorf("error setting up http ebpf program: %s", err)
 	}
 
 	if err := mgr.Init(); err != nil {
-		return nil, fmt.Errorf("error initializing http ebpf program: %s", err)
+		if mgr.fragmentSize == httpDefaultBufferSize {
+			return nil, fmt.Errorf("error initializing http ebpf program: %s", err)
+		}
+
+		// the http-large program may exceed the instruction limit of the verifier of older kernels
+		log.Warnf("could not load the http ebpf program capturing %d bytes of each request, capturing %d bytes instead: %s", bufferSize, httpDefaultBufferSize, err)
+		mgr, err = newEBPFProgram(c, httpDefaultBufferSize)
+		if err != nil {
+			return nil, fmt.Errorf("error setting up http ebpf program: %s", err)
+		}
+		if err := mgr.Init(); err != nil {
+			return nil, fmt.Errorf("error initializing http ebpf program: %s", err)
+		}
 	}
 
 	filter, _ := mgr.GetProbe(manager.ProbeIdentificationPair{Section: string(probes.SocketHTTPFilter)})
@@ -68,11 +117,26 @@ func NewMonitor(c *config.Config) (*Monitor, error) {
 		return nil, err
 	}
 
+	inFlightMap, _, err := mgr.GetMap(string(probes.HttpInFlightMap))
+	if err != nil {
+		return nil, err
+	}
+
 	notificationMap, _, _ := mgr.GetMap(string(probes.HttpNotificationsMap))
 	numCPUs := int(notificationMap.ABI().MaxEntries)
 
 	telemetry := newTelemetry()
-	statkeeper := newHTTPStatkeeper(c.MaxHTTPStatsBuffered, telemetry)
+	statkeeper := newHTTPStatkeeper(c, telemetry)
+
+	batchEncoder, err := newBatchEncoder(BatchCodec(c.HTTPBatchCompression))
+	if err != nil {
+		return nil, err
+	}
+
+	flushInterval := c.HTTPFlushInterval
+	if flushInterval <= 0 {
+		flushInterval = defaultFlushInterval
+	}
 
 	handler := func(transactions []httpTX) {
 		if statkeeper != nil {
@@ -81,20 +145,49 @@ func NewMonitor(c *config.Config) (*Monitor, error) {
 	}
 
 	return &Monitor{
-		handler:       handler,
-		ebpfProgram:   mgr,
-		batchManager:  newBatchManager(batchMap, batchStateMap, numCPUs),
-		perfHandler:   mgr.perfHandler,
-		telemetry:     telemetry,
-		pollRequests:  make(chan chan map[Key]RequestStats),
-		closeFilterFn: closeFilterFn,
-		statkeeper:    statkeeper,
+		handler:          handler,
+		supported:        true,
+		batchEncoder:     batchEncoder,
+		ebpfProgram:      mgr,
+		batchManager:     newBatchManager(batchMap, batchStateMap, numCPUs, mgr.fragmentSize),
+		perfHandler:      mgr.perfHandler,
+		sslPerfHandler:   mgr.sslPerfHandler,
+		telemetry:        telemetry,
+		pollRequests:     make(chan chan map[Key]RequestStats),
+		endpointRequests: make(chan chan map[EndpointKey]RequestStats),
+		closeFilterFn:    closeFilterFn,
+		statkeeper:       statkeeper,
+		portFilter:       newPortFilter(c, statkeeper.tlsResolver),
+		headerFilter:     newHeaderFilter(c),
+		directions:       newDirectionResolver(c),
+		evictor:          newInFlightEvictor(&ebpfInFlightMap{m: inFlightMap, fragmentSize: mgr.fragmentSize}, c.HTTPMaxTrackedConnections, telemetry),
+		flushInterval:    flushInterval,
 	}, nil
 }
 
+// NewNullMonitor returns a monitor which captures nothing, its stats are always empty
+func NewNullMonitor() *Monitor {
+	return &Monitor{}
+}
+
+// Supported returns false for the null monitor returned when the kernel can't run the HTTP monitoring
+func (m *Monitor) Supported() bool {
+	return m != nil && m.supported
+}
+
+// SetBatchHandler registers a handler receiving the HTTP transaction batches encoded with the codec
+// configured by network_config.http_batch_compression, e.g. to hand them to a consumer running out of process.
+// It must be called before Start.
+func (m *Monitor) SetBatchHandler(handler func(EncodedBatch)) {
+	if m == nil {
+		return
+	}
+	m.batchHandler = handler
+}
+
 // Start consuming HTTP events
 func (m *Monitor) Start() error {
-	if m == nil {
+	if !m.Supported() {
 		return nil
 	}
 
@@ -105,8 +198,9 @@ func (m *Monitor) Start() error {
 	m.eventLoopWG.Add(1)
 	go func() {
 		defer m.eventLoopWG.Done()
-		report := time.NewTicker(30 * time.Second)
-		defer report.Stop()
+		// the transactions are flushed to the handler periodically, even if no stats are requested
+		flush := time.NewTicker(m.flushInterval)
+		defer flush.Stop()
 		for {
 			select {
 			case dataEvent, ok := <-m.perfHandler.DataChannel:
@@ -124,6 +218,24 @@ func (m *Monitor) Start() error {
 				}
 
 				m.process(nil, errLostBatch)
+			case dataEvent, ok := <-m.sslPerfHandler.DataChannel:
+				if !ok {
+					return
+				}
+
+				// the socket is resolved while its file descriptor is still open
+				event := toSSLSockEvent(dataEvent.Data)
+				switch event._type {
+				case sslSockSet:
+					m.statkeeper.tlsResolver.add(uint32(event.pid), uint32(event.fd))
+				case sslSockShutdown:
+					m.statkeeper.tlsResolver.remove(uint32(event.pid), uint32(event.fd))
+				}
+			case _, ok := <-m.sslPerfHandler.LostChannel:
+				if !ok {
+					return
+				}
+				// the sockets of the lost events are resolved when their transactions are processed
 			case reply, ok := <-m.pollRequests:
 				if !ok {
 					return
@@ -135,8 +247,21 @@ func (m *Monitor) Start() error {
 				delta := m.telemetry.reset()
 				delta.report()
 
-				reply <- m.statkeeper.GetAndResetAllStats()
-			case <-report.C:
+				stats := m.statkeeper.GetAndResetAllStats()
+				atomic.StoreInt64(&m.telemetry.flushed, int64(len(stats)))
+				reply <- stats
+			case reply, ok := <-m.endpointRequests:
+				if !ok {
+					return
+				}
+
+				transactions := m.batchManager.GetPendingTransactions()
+				m.process(transactions, nil)
+
+				reply <- m.statkeeper.GetAndResetEndpointStats()
+			case <-flush.C:
+				m.evictor.evict()
+				m.directions.reset()
 				transactions := m.batchManager.GetPendingTransactions()
 				m.process(transactions, nil)
 			}
@@ -149,7 +274,7 @@ func (m *Monitor) Start() error {
 // GetHTTPStats returns a map of HTTP stats stored in the following format:
 // [source, dest tuple, request path] -> RequestStats object
 func (m *Monitor) GetHTTPStats() map[Key]RequestStats {
-	if m == nil {
+	if !m.Supported() {
 		return nil
 	}
 
@@ -165,9 +290,50 @@ func (m *Monitor) GetHTTPStats() map[Key]RequestStats {
 	return <-reply
 }
 
+// GetHTTPLatencyStats returns a map of HTTP stats aggregated by request path and method, whatever the connection:
+// [request path, method] -> RequestStats object
+// The stats are reset independently of the ones returned by GetHTTPStats.
+func (m *Monitor) GetHTTPLatencyStats() map[EndpointKey]RequestStats {
+	if !m.Supported() {
+		return nil
+	}
+
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	if m.stopped {
+		return nil
+	}
+
+	reply := make(chan map[EndpointKey]RequestStats, 1)
+	defer close(reply)
+	m.endpointRequests <- reply
+	return <-reply
+}
+
+// GetStats returns the counters and gauges describing the monitor internals,
+// e.g. to alert on the HTTP transactions lost by the monitor
+func (m *Monitor) GetStats() MonitorStats {
+	// the null monitor has no stats
+	if m == nil || m.statkeeper == nil {
+		return MonitorStats{}
+	}
+
+	return MonitorStats{
+		Captured:         atomic.LoadInt64(&m.telemetry.captured),
+		Missed:           atomic.LoadInt64(&m.telemetry.totalMisses),
+		Dropped:          atomic.LoadInt64(&m.telemetry.totalDropped),
+		Flushed:          atomic.LoadInt64(&m.telemetry.flushed),
+		Buffered:         atomic.LoadInt64(&m.telemetry.aggregations),
+		BufferCapacity:   int64(m.statkeeper.maxEntries),
+		Evicted:          atomic.LoadInt64(&m.telemetry.totalEvicted),
+		InFlight:         atomic.LoadInt64(&m.telemetry.inFlight),
+		InFlightCapacity: int64(m.evictor.getCapacity()),
+	}
+}
+
 // Stop HTTP monitoring
 func (m *Monitor) Stop() {
-	if m == nil {
+	if !m.Supported() {
 		return
 	}
 
@@ -177,18 +343,38 @@ func (m *Monitor) Stop() {
 		return
 	}
 
-	m.ebpfProgram.Stop(manager.CleanAll)
+	// no more transactions are captured by the socket filter while draining
 	m.closeFilterFn()
-	m.perfHandler.Stop()
 	close(m.pollRequests)
+	close(m.endpointRequests)
 	m.eventLoopWG.Wait()
+
+	// the transactions captured since the last flush are sent to the handler
+	// before the eBPF maps are closed
+	m.process(m.batchManager.GetPendingTransactions(), nil)
+
+	m.ebpfProgram.Stop(manager.CleanAll)
+	m.perfHandler.Stop()
+	m.sslPerfHandler.Stop()
 	m.stopped = true
 }
 
 func (m *Monitor) process(transactions []httpTX, err error) {
+	transactions = m.portFilter.filter(transactions)
+	transactions = m.directions.filter(transactions)
+	m.headerFilter.filter(transactions)
 	m.telemetry.aggregate(transactions, err)
 
 	if m.handler != nil && len(transactions) > 0 {
 		m.handler(transactions)
 	}
+
+	if m.batchHandler != nil && len(transactions) > 0 {
+		batch, err := m.batchEncoder.encode(transactions)
+		if err != nil {
+			log.Warnf("could not encode http batch: %s", err)
+			return
+		}
+		m.batchHandler(batch)
+	}
 }
@@ -4,13 +4,18 @@ package http
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"math/rand"
 	nethttp "net/http"
+	"net/http/httptest"
+	"os/exec"
 	"regexp"
 	"strconv"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -26,7 +31,24 @@ func TestHTTPMonitorIntegration(t *testing.T) {
 		t.Skip("HTTP feature not available on pre 4.1.0 kernels")
 	}
 
-	srvDoneFn := serverSetup(t)
+	testHTTPMonitor(t, "localhost:8080")
+}
+
+func TestHTTPMonitorIntegrationIPv6(t *testing.T) {
+	currKernelVersion, err := kernel.HostVersion()
+	require.NoError(t, err)
+	if currKernelVersion < kernel.VersionCode(4, 1, 0) {
+		t.Skip("HTTP feature not available on pre 4.1.0 kernels")
+	}
+	if !kernel.IsIPv6Enabled() {
+		t.Skip("IPv6 is disabled")
+	}
+
+	testHTTPMonitor(t, "[::1]:8080")
+}
+
+func testHTTPMonitor(t *testing.T, addr string) {
+	srvDoneFn := serverSetup(t, addr)
 	defer srvDoneFn()
 
 	// Create a monitor that simply buffers all HTTP requests
@@ -43,7 +65,7 @@ func TestHTTPMonitorIntegration(t *testing.T) {
 	defer monitor.Stop()
 
 	// Perform a number of random requests
-	requestFn := requestGenerator(t)
+	requestFn := requestGenerator(t, addr)
 	var requests []*nethttp.Request
 	for i := 0; i < 100; i++ {
 		requests = append(requests, requestFn())
@@ -57,13 +79,124 @@ func TestHTTPMonitorIntegration(t *testing.T) {
 	for _, req := range requests {
 		hasMatchingTX(t, req, buffer)
 	}
+
+	// and attributed to connections of the server address family
+	ipv6 := strings.HasPrefix(addr, "[")
+	for _, tx := range buffer {
+		require.Equal(t, ipv6, tx.IsIPv6())
+	}
+}
+
+func TestHTTPMonitorFlushInterval(t *testing.T) {
+	currKernelVersion, err := kernel.HostVersion()
+	require.NoError(t, err)
+	if currKernelVersion < kernel.VersionCode(4, 1, 0) {
+		t.Skip("HTTP feature not available on pre 4.1.0 kernels")
+	}
+
+	srvDoneFn := serverSetup(t, "localhost:8080")
+	defer srvDoneFn()
+
+	// the handler is called from the event loop of the monitor
+	var (
+		mux    sync.Mutex
+		buffer []httpTX
+	)
+	handlerFn := func(transactions []httpTX) {
+		mux.Lock()
+		defer mux.Unlock()
+		buffer = append(buffer, transactions...)
+	}
+
+	cfg := config.New()
+	cfg.HTTPFlushInterval = 100 * time.Millisecond
+	monitor, err := NewMonitor(cfg)
+	require.NoError(t, err)
+	monitor.handler = handlerFn
+	err = monitor.Start()
+	require.NoError(t, err)
+	defer monitor.Stop()
+
+	requestFn := requestGenerator(t, "localhost:8080")
+	var requests []*nethttp.Request
+	for i := 0; i < 10; i++ {
+		requests = append(requests, requestFn())
+	}
+
+	// the transactions reach the handler without any GetHTTPStats call
+	require.Eventually(t, func() bool {
+		mux.Lock()
+		defer mux.Unlock()
+		return len(buffer) >= len(requests)
+	}, 5*time.Second, 100*time.Millisecond)
+
+	mux.Lock()
+	defer mux.Unlock()
+	for _, req := range requests {
+		hasMatchingTX(t, req, buffer)
+	}
+}
+
+func TestHTTPSMonitorIntegration(t *testing.T) {
+	currKernelVersion, err := kernel.HostVersion()
+	require.NoError(t, err)
+	if currKernelVersion < minHTTPSKernelVersion {
+		t.Skip("HTTPS feature not available on pre 4.3.0 kernels")
+	}
+	if _, err := findLibSSL(""); err != nil {
+		t.Skip("HTTPS feature requires libssl")
+	}
+	// curl is used as the OpenSSL client, the Go TLS stack doesn't rely on libssl
+	curl, err := exec.LookPath("curl")
+	if err != nil {
+		t.Skip("HTTPS integration test requires curl")
+	}
+
+	srv := httptest.NewTLSServer(nethttp.HandlerFunc(func(w nethttp.ResponseWriter, req *nethttp.Request) {
+		io.Copy(ioutil.Discard, req.Body)
+		w.WriteHeader(statusFromPath(req.URL.Path))
+	}))
+	defer srv.Close()
+
+	var buffer []httpTX
+	handlerFn := func(transactions []httpTX) {
+		buffer = append(buffer, transactions...)
+	}
+
+	cfg := config.New()
+	cfg.EnableHTTPSMonitoring = true
+	monitor, err := NewMonitor(cfg)
+	require.NoError(t, err)
+	monitor.handler = handlerFn
+	err = monitor.Start()
+	require.NoError(t, err)
+	defer monitor.Stop()
+
+	var requests []*nethttp.Request
+	for i, method := range []string{"GET", "POST", "PUT", "DELETE"} {
+		status := []int{200, 300, 400, 500}[i]
+		url := fmt.Sprintf("%s/%d/request-%d", srv.URL, status, i)
+		req, err := nethttp.NewRequest(method, url, nil)
+		require.NoError(t, err)
+		out, err := exec.Command(curl, "--insecure", "--silent", "--http1.1", "--request", method, url).CombinedOutput()
+		require.NoError(t, err, string(out))
+		requests = append(requests, req)
+	}
+
+	// Ensure all captured transactions get sent to user-space
+	time.Sleep(10 * time.Millisecond)
+	monitor.GetHTTPStats()
+
+	for _, req := range requests {
+		hasMatchingTX(t, req, buffer)
+	}
 }
 
 func hasMatchingTX(t *testing.T, req *nethttp.Request, transactions []httpTX) {
 	expectedStatus := statusFromPath(req.URL.Path)
 	buffer := make([]byte, HTTPBufferSize)
 	for _, tx := range transactions {
-		if string(tx.Path(buffer)) == req.URL.Path && int(tx.response_status_code) == expectedStatus && tx.Method() == req.Method {
+		if path, _ := tx.Path(buffer); string(path) == req.URL.Path && int(tx.response_status_code) == expectedStatus && tx.Method() == req.Method {
 			return
 		}
 	}
@@ -76,11 +209,11 @@ func hasMatchingTX(t *testing.T, req *nethttp.Request, transactions []httpTX) {
 	)
 }
 
-// serverSetup spins up a HTTP test server that returns the status code included in the URL
+// serverSetup spins up a HTTP test server listening on addr that returns the status code included in the URL
 // Example:
 // * GET /200/foo returns a 200 status code;
 // * PUT /404/bar returns a 404 status code;
-func serverSetup(t *testing.T) func() {
+func serverSetup(t *testing.T, addr string) func() {
 	handler := func(w nethttp.ResponseWriter, req *nethttp.Request) {
 		statusCode := statusFromPath(req.URL.Path)
 		io.Copy(ioutil.Discard, req.Body)
@@ -88,7 +221,7 @@ func serverSetup(t *testing.T) func() {
 	}
 
 	srv := &nethttp.Server{
-		Addr:         "localhost:8080",
+		Addr:         addr,
 		Handler:      nethttp.HandlerFunc(handler),
 		ReadTimeout:  time.Second,
 		WriteTimeout: time.Second,
@@ -103,7 +236,7 @@ func serverSetup(t *testing.T) func() {
 	return func() { srv.Shutdown(context.Background()) }
 }
 
-func requestGenerator(t *testing.T) func() *nethttp.Request {
+func requestGenerator(t *testing.T, addr string) func() *nethttp.Request {
 	var (
 		methods     = []string{"GET", "HEAD", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"}
 		statusCodes = []int{200, 300, 400, 500}
@@ -116,7 +249,7 @@ func requestGenerator(t *testing.T) func() *nethttp.Request {
 		idx++
 		method := methods[random.Intn(len(methods))]
 		status := statusCodes[random.Intn(len(statusCodes))]
-		url := fmt.Sprintf("http://localhost:8080/%d/request-%d", status, idx)
+		url := fmt.Sprintf("http://%s/%d/request-%d", addr, status, idx)
 		req, err := nethttp.NewRequest(method, url, nil)
 		require.NoError(t, err)
 
@@ -137,3 +270,20 @@ func statusFromPath(path string) (status int) {
 
 	return
 }
+
+func TestHTTPMonitorNotSupported(t *testing.T) {
+	defer func(f func() (kernel.Version, error)) { hostVersion = f }(hostVersion)
+	hostVersion = func() (kernel.Version, error) {
+		return kernel.VersionCode(4, 0, 0), nil
+	}
+
+	monitor, err := NewMonitor(config.New())
+	require.True(t, errors.Is(err, ErrNotSupported))
+	require.False(t, monitor.Supported())
+
+	require.NoError(t, monitor.Start())
+	require.Empty(t, monitor.GetHTTPStats())
+	require.Empty(t, monitor.GetHTTPLatencyStats())
+	require.Equal(t, MonitorStats{}, monitor.GetStats())
+	monitor.Stop()
+}
@@ -0,0 +1,73 @@
+// +build linux_bpf
+
+package http
+
+import (
+	"github.com/DataDog/datadog-agent/pkg/network/config"
+	"github.com/DataDog/datadog-agent/pkg/util/log"
+)
+
+// portFilter selects the HTTP transactions handled by the monitor according to the port of their server
+type portFilter struct {
+	allowed map[uint16]struct{}
+	denied  map[uint16]struct{}
+
+	// resolves the server port of HTTPS transactions
+	tlsResolver *tlsResolver
+}
+
+// newPortFilter returns nil when no port is allowed or denied, in which case every transaction is kept
+func newPortFilter(c *config.Config, tlsResolver *tlsResolver) *portFilter {
+	if len(c.HTTPAllowedPorts) == 0 && len(c.HTTPDeniedPorts) == 0 {
+		return nil
+	}
+
+	return &portFilter{
+		allowed:     portSet(c.HTTPAllowedPorts),
+		denied:      portSet(c.HTTPDeniedPorts),
+		tlsResolver: tlsResolver,
+	}
+}
+
+// filter removes the transactions that aren't monitored, the slice is modified in place
+func (f *portFilter) filter(transactions []httpTX) []httpTX {
+	if f == nil {
+		return transactions
+	}
+
+	kept := transactions[:0]
+	for _, tx := range transactions {
+		if f.keep(tx) {
+			kept = append(kept, tx)
+		}
+	}
+	return kept
+}
+
+func (f *portFilter) keep(tx httpTX) bool {
+	port := uint16(tx.tup.dport)
+	if tx.IsTLS() {
+		var err error
+		if port, err = f.tlsResolver.serverPort(tx); err != nil {
+			log.Debugf("could not resolve the connection of https transaction: %s", err)
+			return false
+		}
+	}
+
+	if _, ok := f.denied[port]; ok {
+		return false
+	}
+	if len(f.allowed) == 0 {
+		return true
+	}
+	_, ok := f.allowed[port]
+	return ok
+}
+
+func portSet(ports []uint16) map[uint16]struct{} {
+	set := make(map[uint16]struct{}, len(ports))
+	for _, p := range ports {
+		set[p] = struct{}{}
+	}
+	return set
+}
@@ -0,0 +1,82 @@
+// +build linux_bpf
+
+package http
+
+import (
+	"net"
+	"testing"
+
+	"github.com/DataDog/datadog-agent/pkg/network/config"
+	"github.com/DataDog/datadog-agent/pkg/process/util"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPortFilter(t *testing.T) {
+	sourceIP := util.AddressFromString("1.1.1.1")
+	destIP := util.AddressFromString("2.2.2.2")
+	transactions := func() []httpTX {
+		return []httpTX{
+			generateIPv4HTTPTransaction(sourceIP, destIP, 1234, 8080, "/allowed", 200, 10),
+			generateIPv4HTTPTransaction(sourceIP, destIP, 1235, 8081, "/denied", 200, 10),
+			generateIPv4HTTPTransaction(sourceIP, destIP, 1236, 8080, "/allowed", 404, 10),
+		}
+	}
+
+	t.Run("no filter", func(t *testing.T) {
+		handled := monitorWithPortFilter(&config.Config{}, transactions())
+		assert.Len(t, handled, 3)
+	})
+
+	t.Run("allowed ports", func(t *testing.T) {
+		handled := monitorWithPortFilter(&config.Config{HTTPAllowedPorts: []uint16{8080}}, transactions())
+		assert.Len(t, handled, 2)
+		for _, tx := range handled {
+			assert.Equal(t, uint16(8080), uint16(tx.tup.dport))
+		}
+	})
+
+	t.Run("denied ports", func(t *testing.T) {
+		handled := monitorWithPortFilter(&config.Config{HTTPDeniedPorts: []uint16{8080}}, transactions())
+		assert.Len(t, handled, 1)
+		assert.Equal(t, uint16(8081), uint16(handled[0].tup.dport))
+	})
+
+	t.Run("denied ports take precedence", func(t *testing.T) {
+		handled := monitorWithPortFilter(&config.Config{HTTPAllowedPorts: []uint16{8080, 8081}, HTTPDeniedPorts: []uint16{8080}}, transactions())
+		assert.Len(t, handled, 1)
+		assert.Equal(t, uint16(8081), uint16(handled[0].tup.dport))
+	})
+}
+
+func TestPortFilterHTTPS(t *testing.T) {
+	server, client, fd := tcpConnection(t)
+	defer server.Close()
+	defer client.Close()
+
+	serverPort := uint16(client.RemoteAddr().(*net.TCPAddr).Port)
+	transactions := []httpTX{
+		generateHTTPSTransaction(fd, tlsRoleClient, "/client"),
+		generateHTTPSTransaction(fd, tlsRoleServer, "/server"),
+		generateHTTPSTransaction(1<<30, tlsRoleClient, "/unresolved"),
+	}
+
+	// with the server role the local end of the socket is the server
+	handled := monitorWithPortFilter(&config.Config{HTTPAllowedPorts: []uint16{serverPort}}, transactions)
+	assert.Len(t, handled, 1)
+	path, _ := handled[0].Path(make([]byte, HTTPBufferSize))
+	assert.Equal(t, "/client", string(path))
+}
+
+// monitorWithPortFilter returns the transactions reaching the handler of a monitor filtering ports
+func monitorWithPortFilter(c *config.Config, transactions []httpTX) []httpTX {
+	var handled []httpTX
+	m := &Monitor{
+		handler: func(txs []httpTX) {
+			handled = append(handled, txs...)
+		},
+		telemetry:  newTelemetry(),
+		portFilter: newPortFilter(c, newTLSResolver("/proc")),
+	}
+	m.process(transactions, nil)
+	return handled
+}
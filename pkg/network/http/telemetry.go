@@ -16,7 +16,54 @@ type telemetry struct {
 	hits         [5]int64
 	misses       int64 // this happens when we can't cope with the rate of events
 	dropped      int64 // this happens when httpStatKeeper reaches capacity
+	truncated    int64 // this happens when the request path doesn't fit in the captured fragment
+	evicted      int64 // this happens when too many connections are tracked in eBPF
 	aggregations int64
+
+	// cumulative counters exposed by Monitor.GetStats, they aren't reset along with the fields above
+	captured     int64
+	totalMisses  int64
+	totalDropped int64
+	totalEvicted int64
+	flushed      int64 // number of stats returned by the last flush
+	inFlight     int64 // number of connections tracked in eBPF at the last flush, before the evictions
+}
+
+// MonitorStats holds the counters and gauges describing the internals of the HTTP monitor
+type MonitorStats struct {
+	// Captured is the number of HTTP transactions read from the eBPF batches
+	Captured int64
+	// Missed is the number of HTTP transactions lost because the eBPF batches were overridden before being read
+	Missed int64
+	// Dropped is the number of HTTP transactions dropped because the stats buffer was full
+	Dropped int64
+	// Flushed is the number of HTTP stats returned by the last GetHTTPStats call
+	Flushed int64
+	// Buffered is the number of HTTP stats waiting for the next GetHTTPStats call
+	Buffered int64
+	// BufferCapacity is the maximum number of HTTP stats buffered
+	BufferCapacity int64
+	// Evicted is the number of incomplete HTTP transactions evicted because too many connections were tracked
+	Evicted int64
+	// InFlight is the number of connections tracked in the eBPF in-flight map at the last flush, before the evictions
+	InFlight int64
+	// InFlightCapacity is the maximum number of connections tracked in the eBPF in-flight map
+	InFlightCapacity int64
+}
+
+// Map returns the stats keyed by their snake case name, as exposed in the tracer expvars
+func (s MonitorStats) Map() map[string]int64 {
+	return map[string]int64{
+		"captured":           s.Captured,
+		"missed":             s.Missed,
+		"dropped":            s.Dropped,
+		"flushed":            s.Flushed,
+		"buffered":           s.Buffered,
+		"buffer_capacity":    s.BufferCapacity,
+		"evicted":            s.Evicted,
+		"in_flight":          s.InFlight,
+		"in_flight_capacity": s.InFlightCapacity,
+	}
 }
 
 func newTelemetry() *telemetry {
@@ -26,6 +73,7 @@ func newTelemetry() *telemetry {
 }
 
 func (t *telemetry) aggregate(txs []httpTX, err error) {
+	atomic.AddInt64(&t.captured, int64(len(txs)))
 	for _, tx := range txs {
 		if i := tx.StatusClass()/100 - 1; i >= 0 && i < len(t.hits) {
 			atomic.AddInt64(&t.hits[i], 1)
@@ -34,9 +82,24 @@ func (t *telemetry) aggregate(txs []httpTX, err error) {
 
 	if err == errLostBatch {
 		atomic.AddInt64(&t.misses, int64(HTTPBatchSize))
+		atomic.AddInt64(&t.totalMisses, int64(HTTPBatchSize))
 	}
 }
 
+func (t *telemetry) addDropped(n int) {
+	atomic.AddInt64(&t.dropped, int64(n))
+	atomic.AddInt64(&t.totalDropped, int64(n))
+}
+
+func (t *telemetry) addEvicted(n int) {
+	atomic.AddInt64(&t.evicted, int64(n))
+	atomic.AddInt64(&t.totalEvicted, int64(n))
+}
+
+func (t *telemetry) setInFlight(n int) {
+	atomic.StoreInt64(&t.inFlight, int64(n))
+}
+
 func (t *telemetry) reset() telemetry {
 	now := time.Now()
 	then := atomic.SwapInt64(&t.then, now.Unix())
@@ -44,6 +107,8 @@ func (t *telemetry) reset() telemetry {
 	delta := telemetry{
 		misses:       atomic.SwapInt64(&t.misses, 0),
 		dropped:      atomic.SwapInt64(&t.dropped, 0),
+		truncated:    atomic.SwapInt64(&t.truncated, 0),
+		evicted:      atomic.SwapInt64(&t.evicted, 0),
 		aggregations: atomic.SwapInt64(&t.aggregations, 0),
 		elapsed:      now.Unix() - then,
 	}
@@ -62,13 +127,15 @@ func (t *telemetry) report() {
 	}
 
 	log.Debugf(
-		"http stats summary: requests_processed=%d(%.2f/s) requests_missed=%d(%.2f/s) requests_dropped=%d(%.2f/s) aggregations=%d",
+		"http stats summary: requests_processed=%d(%.2f/s) requests_missed=%d(%.2f/s) requests_dropped=%d(%.2f/s) paths_truncated=%d connections_evicted=%d aggregations=%d",
 		totalRequests,
 		float64(totalRequests)/float64(t.elapsed),
 		t.misses,
 		float64(t.misses)/float64(t.elapsed),
 		t.dropped,
 		float64(t.dropped)/float64(t.elapsed),
+		t.truncated,
+		t.evicted,
 		t.aggregations,
 	)
 }
@@ -0,0 +1,56 @@
+// +build linux_bpf
+
+package http
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/DataDog/datadog-agent/pkg/network/config"
+	"github.com/DataDog/datadog-agent/pkg/process/util"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMonitorStats(t *testing.T) {
+	telemetry := newTelemetry()
+	statkeeper := newHTTPStatkeeper(&config.Config{MaxHTTPStatsBuffered: 2}, telemetry)
+	m := &Monitor{
+		handler:    statkeeper.Process,
+		telemetry:  telemetry,
+		statkeeper: statkeeper,
+	}
+
+	sourceIP := util.AddressFromString("1.1.1.1")
+	destIP := util.AddressFromString("2.2.2.2")
+	var txs []httpTX
+	for i := 0; i < 5; i++ {
+		txs = append(txs, generateIPv4HTTPTransaction(sourceIP, destIP, 1234, 8080, "/path"+strconv.Itoa(i), 200, 10))
+	}
+
+	// the stats buffer can only hold 2 paths
+	m.process(txs, nil)
+	stats := m.GetStats()
+	assert.Equal(t, int64(5), stats.Captured)
+	assert.Equal(t, int64(3), stats.Dropped)
+	assert.Equal(t, int64(2), stats.Buffered)
+	assert.Equal(t, int64(2), stats.BufferCapacity)
+	assert.Equal(t, int64(0), stats.Missed)
+
+	m.process(nil, errLostBatch)
+	stats = m.GetStats()
+	assert.Equal(t, int64(HTTPBatchSize), stats.Missed)
+
+	// the counters aren't reset by the periodic telemetry report
+	telemetry.reset()
+	m.process(txs[:1], nil)
+	stats = m.GetStats()
+	assert.Equal(t, int64(6), stats.Captured)
+	assert.Equal(t, int64(3), stats.Dropped)
+	assert.Equal(t, int64(HTTPBatchSize), stats.Missed)
+}
+
+func TestMonitorStatsNil(t *testing.T) {
+	var m *Monitor
+	assert.Equal(t, MonitorStats{}, m.GetStats())
+	assert.Len(t, m.GetStats().Map(), 9)
+}
@@ -269,7 +269,7 @@ func NewTracer(config *config.Config) (*Tracer, error) {
 		config:                     config,
 		state:                      state,
 		reverseDNS:                 reverseDNS,
-		httpMonitor:                newHTTPMonitor(!pre410Kernel, config),
+		httpMonitor:                newHTTPMonitor(config),
 		buffer:                     make([]network.ConnectionStats, 0, 512),
 		conntracker:                conntracker,
 		sourceExcludes:             network.ParseConnectionFilters(config.ExcludedSourceConnections),
@@ -893,11 +893,6 @@ func (t *Tracer) getTelemetry() (map[string]interface{}, error) {
 			stats["state"] = telemetry
 		}
 	}
-	if states, ok := stats["http"]; ok {
-		if telemetry, ok := states.(map[string]interface{})["telemetry"]; ok {
-			stats["http"] = telemetry
-		}
-	}
 	return stats, nil
 }
 
@@ -936,6 +931,7 @@ func (t *Tracer) GetStats() (map[string]interface{}, error) {
 		"ebpf":      t.getEbpfTelemetry(),
 		"kprobes":   ddebpf.GetProbeStats(),
 		"dns":       t.reverseDNS.GetStats(),
+		"http":      t.httpMonitor.GetStats().Map(),
 	}
 
 	return ret, nil
@@ -1011,17 +1007,16 @@ func (t *Tracer) connVia(cs *network.ConnectionStats) {
 	cs.Via = t.gwLookup.Lookup(cs)
 }
 
-func newHTTPMonitor(supported bool, c *config.Config) *http.Monitor {
+func newHTTPMonitor(c *config.Config) *http.Monitor {
 	if !c.EnableHTTPMonitoring {
 		return nil
 	}
 
-	if !supported {
+	monitor, err := http.NewMonitor(c)
+	if errors.Is(err, http.ErrNotSupported) {
 		log.Warnf("http monitoring is not supported by this kernel version. please refer to system-probe's documentation")
-		return nil
+		return monitor
 	}
-
-	monitor, err := http.NewMonitor(c)
 	if err != nil {
 		log.Errorf("could not instantiate http monitor: %s", err)
 		return nil
@@ -124,6 +124,17 @@ func TestTracerExpvar(t *testing.T) {
 			"TimestampMicroSecs",
 			"TruncatedPackets",
 		},
+		"http": {
+			"BufferCapacity",
+			"Buffered",
+			"Captured",
+			"Dropped",
+			"Evicted",
+			"Flushed",
+			"InFlight",
+			"InFlightCapacity",
+			"Missed",
+		},
 		"kprobes": {
 			"PTcpCleanupRbufHits",
 			"PTcpCleanupRbufMisses",
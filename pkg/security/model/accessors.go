@@ -8848,6 +8848,10 @@ func (e *Event) SetFieldValue(field eval.Field, value interface{}) error {
 	case "container.tags":
 
 		var ok bool
+		if strs, isArray := value.([]string); isArray {
+			e.ContainerContext.Tags = strs
+			return nil
+		}
 		str, ok := value.(string)
 		if !ok {
 			return &eval.ErrValueTypeMismatch{Field: "ContainerContext.Tags"}
@@ -8870,6 +8874,10 @@ func (e *Event) SetFieldValue(field eval.Field, value interface{}) error {
 	case "exec.args_flags":
 
 		var ok bool
+		if strs, isArray := value.([]string); isArray {
+			e.Exec.Argv = strs
+			return nil
+		}
 		str, ok := value.(string)
 		if !ok {
 			return &eval.ErrValueTypeMismatch{Field: "Exec.Argv"}
@@ -8881,6 +8889,10 @@ func (e *Event) SetFieldValue(field eval.Field, value interface{}) error {
 	case "exec.args_options":
 
 		var ok bool
+		if strs, isArray := value.([]string); isArray {
+			e.Exec.Argv = strs
+			return nil
+		}
 		str, ok := value.(string)
 		if !ok {
 			return &eval.ErrValueTypeMismatch{Field: "Exec.Argv"}
@@ -8900,6 +8912,10 @@ func (e *Event) SetFieldValue(field eval.Field, value interface{}) error {
 	case "exec.argv":
 
 		var ok bool
+		if strs, isArray := value.([]string); isArray {
+			e.Exec.Argv = strs
+			return nil
+		}
 		str, ok := value.(string)
 		if !ok {
 			return &eval.ErrValueTypeMismatch{Field: "Exec.Argv"}
@@ -8984,6 +9000,10 @@ func (e *Event) SetFieldValue(field eval.Field, value interface{}) error {
 	case "exec.envs":
 
 		var ok bool
+		if strs, isArray := value.([]string); isArray {
+			e.Exec.Envs = strs
+			return nil
+		}
 		str, ok := value.(string)
 		if !ok {
 			return &eval.ErrValueTypeMismatch{Field: "Exec.Envs"}
@@ -13,6 +13,7 @@ package model
 import (
 	"bytes"
 	"fmt"
+	"net"
 	"path"
 	"regexp"
 	"strings"
@@ -71,6 +72,18 @@ func (m *Model) ValidateField(field eval.Field, fieldValue eval.FieldValue) erro
 		}
 	}
 
+	// check that network addresses are valid
+	if fieldValue.Type == eval.CIDRValueType {
+		value, ok := fieldValue.Value.(string)
+		if !ok {
+			return fmt.Errorf("invalid CIDR value type on `%s`", field)
+		}
+
+		if _, _, err := net.ParseCIDR(value); err != nil {
+			return fmt.Errorf("invalid CIDR `%s`: %s", value, err)
+		}
+	}
+
 	switch field {
 
 	case "event.retval":
@@ -82,6 +95,12 @@ func (m *Model) ValidateField(field eval.Field, fieldValue eval.FieldValue) erro
 	return nil
 }
 
+// IsCIDRField returns whether the strings compared to the field are network addresses in CIDR notation.
+// None of the fields of the model holds a network address yet.
+func (m *Model) IsCIDRField(field eval.Field) bool {
+	return false
+}
+
 // ChmodEvent represents a chmod event
 type ChmodEvent struct {
 	SyscallEvent
@@ -9047,6 +9047,10 @@ func (e *Event) SetFieldValue(field eval.Field, value interface{}) error {
 	case "container.tags":
 
 		var ok bool
+		if strs, isArray := value.([]string); isArray {
+			e.ContainerContext.Tags = strs
+			return nil
+		}
 		str, ok := value.(string)
 		if !ok {
 			return &eval.ErrValueTypeMismatch{Field: "ContainerContext.Tags"}
@@ -9069,6 +9073,10 @@ func (e *Event) SetFieldValue(field eval.Field, value interface{}) error {
 	case "exec.args_flags":
 
 		var ok bool
+		if strs, isArray := value.([]string); isArray {
+			e.Exec.Argv = strs
+			return nil
+		}
 		str, ok := value.(string)
 		if !ok {
 			return &eval.ErrValueTypeMismatch{Field: "Exec.Argv"}
@@ -9080,6 +9088,10 @@ func (e *Event) SetFieldValue(field eval.Field, value interface{}) error {
 	case "exec.args_options":
 
 		var ok bool
+		if strs, isArray := value.([]string); isArray {
+			e.Exec.Argv = strs
+			return nil
+		}
 		str, ok := value.(string)
 		if !ok {
 			return &eval.ErrValueTypeMismatch{Field: "Exec.Argv"}
@@ -9099,6 +9111,10 @@ func (e *Event) SetFieldValue(field eval.Field, value interface{}) error {
 	case "exec.argv":
 
 		var ok bool
+		if strs, isArray := value.([]string); isArray {
+			e.Exec.Argv = strs
+			return nil
+		}
 		str, ok := value.(string)
 		if !ok {
 			return &eval.ErrValueTypeMismatch{Field: "Exec.Argv"}
@@ -9183,6 +9199,10 @@ func (e *Event) SetFieldValue(field eval.Field, value interface{}) error {
 	case "exec.envs":
 
 		var ok bool
+		if strs, isArray := value.([]string); isArray {
+			e.Exec.Envs = strs
+			return nil
+		}
 		str, ok := value.(string)
 		if !ok {
 			return &eval.ErrValueTypeMismatch{Field: "Exec.Envs"}
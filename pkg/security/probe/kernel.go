@@ -8,15 +8,21 @@
 package probe
 
 import (
+	"io/ioutil"
 	"path/filepath"
+	"regexp"
+	"strconv"
 	"strings"
+	"sync"
 
 	"github.com/cobaugh/osrelease"
 	"github.com/pkg/errors"
+	"golang.org/x/sys/unix"
 
 	"github.com/DataDog/datadog-agent/pkg/config"
 	"github.com/DataDog/datadog-agent/pkg/process/util"
 	"github.com/DataDog/datadog-agent/pkg/util/kernel"
+	"github.com/DataDog/datadog-agent/pkg/util/log"
 )
 
 var (
@@ -27,9 +33,55 @@ var (
 	kernel5_3  = kernel.VersionCode(5, 3, 0)  //nolint:deadcode,unused
 )
 
+const (
+	procVersion = "/proc/version"
+	// btfVmlinux is where the kernel exposes its BTF type information, relative to the host root
+	btfVmlinux = "sys/kernel/btf/vmlinux"
+)
+
+var (
+	// muslLoaderGlobs match the dynamic loader of musl, e.g. lib/ld-musl-x86_64.so.1, relative to the host root
+	muslLoaderGlobs = []string{"lib/ld-musl-*.so.1", "usr/lib/ld-musl-*.so.1"}
+	// glibcLoaderGlobs match the dynamic loader of the glibc, e.g. lib64/ld-linux-x86-64.so.2, relative to the host root
+	glibcLoaderGlobs = []string{"lib/ld-linux*.so.*", "lib64/ld-linux*.so.*", "usr/lib/ld-linux*.so.*", "usr/lib64/ld-linux*.so.*"}
+)
+
+// procVersionDistros guesses the os-release fields of the distribution from the kernel release
+// and the compiler found in /proc/version, the first matching entry is used
+var procVersionDistros = []struct {
+	re        *regexp.Regexp
+	osrelease map[string]string
+}{
+	{regexp.MustCompile(`\.amzn2023\.`), map[string]string{"ID": "amzn", "VERSION_ID": "2023", "PLATFORM_ID": "platform:al2023"}},
+	{regexp.MustCompile(`\.amzn2\.`), map[string]string{"ID": "amzn", "VERSION_ID": "2"}},
+	{regexp.MustCompile(`\.el7[._]`), map[string]string{"ID": "centos", "VERSION_ID": "7"}},
+	{regexp.MustCompile(`\.el8[._]`), map[string]string{"ID": "centos", "VERSION_ID": "8", "PLATFORM_ID": "platform:el8"}},
+	{regexp.MustCompile(`\.el9[._]`), map[string]string{"ID": "centos", "VERSION_ID": "9", "PLATFORM_ID": "platform:el9"}},
+	{regexp.MustCompile(`Ubuntu`), map[string]string{"ID": "ubuntu"}},
+	{regexp.MustCompile(`Debian`), map[string]string{"ID": "debian"}},
+}
+
+var (
+	// hostVersion returns the version of the running kernel, mocked in tests
+	hostVersion = kernel.HostVersion
+	// hostRelease returns the release of the running kernel, mocked in tests
+	hostRelease = unameRelease
+	// readOSRelease reads an os-release file, mocked in tests
+	readOSRelease = osrelease.ReadFile
+
+	// cached kernel version helper, see GetKernelVersion
+	kernelVersion     *KernelVersion
+	kernelVersionLock sync.Mutex
+)
+
 // KernelVersion defines a kernel version helper
 type KernelVersion struct {
-	osrelease map[string]string
+	osrelease   map[string]string
+	code        kernel.Version
+	release     string
+	procVersion string
+	// hostRoot is where the host filesystem is mounted, / when empty
+	hostRoot string
 }
 
 // NewKernelVersion returns a new kernel version helper
@@ -46,18 +98,140 @@ func NewKernelVersion() (*KernelVersion, error) {
 		}, osReleasePaths...)
 	}
 
+	procVersionPaths := []string{procVersion}
+	if config.IsContainerized() && util.PathExists("/host") {
+		procVersionPaths = append([]string{filepath.Join("/host", procVersion)}, procVersionPaths...)
+	}
+
+	kv, err := newKernelVersion(osReleasePaths, procVersionPaths)
+	if err != nil {
+		return nil, err
+	}
+	if config.IsContainerized() && util.PathExists("/host") {
+		kv.hostRoot = "/host"
+	}
+	return kv, nil
+}
+
+// GetKernelVersion returns the kernel version helper of the host, it's only created once
+// as neither the os-release files nor the running kernel change during the run
+func GetKernelVersion() (*KernelVersion, error) {
+	kernelVersionLock.Lock()
+	defer kernelVersionLock.Unlock()
+
+	if kernelVersion != nil {
+		return kernelVersion, nil
+	}
+
+	kv, err := NewKernelVersion()
+	if err != nil {
+		return nil, err
+	}
+	kernelVersion = kv
+	return kernelVersion, nil
+}
+
+// resetKernelVersion drops the cached kernel version helper, used by tests
+func resetKernelVersion() {
+	kernelVersionLock.Lock()
+	kernelVersion = nil
+	kernelVersionLock.Unlock()
+}
+
+func newKernelVersion(osReleasePaths, procVersionPaths []string) (*KernelVersion, error) {
+	// the version is left unknown if it can't be detected, the os-release helpers remain usable
+	code, err := hostVersion()
+	if err != nil {
+		code = 0
+	}
+
+	release, err := hostRelease()
+	if err != nil {
+		release = ""
+	}
+
+	var procVersion, procVersionPath string
+	for _, path := range procVersionPaths {
+		content, err := ioutil.ReadFile(path)
+		if err == nil {
+			procVersion, procVersionPath = string(content), path
+			break
+		}
+	}
+
 	for _, osReleasePath := range osReleasePaths {
-		osrelease, err := osrelease.ReadFile(osReleasePath)
+		osrelease, err := readOSRelease(osReleasePath)
 		if err == nil {
 			return &KernelVersion{
-				osrelease: osrelease,
+				osrelease:   osrelease,
+				code:        code,
+				release:     release,
+				procVersion: procVersion,
 			}, nil
 		}
 	}
 
+	// best effort guess, allowing the probe to proceed with the defaults of an unknown distribution
+	if procVersionPath != "" {
+		log.Debugf("no os-release file found, guessing the operating system from %s", procVersionPath)
+		return &KernelVersion{
+			osrelease:   parseProcVersion(procVersion),
+			code:        code,
+			release:     release,
+			procVersion: procVersion,
+		}, nil
+	}
+
 	return nil, errors.New("failed to detect operating system version")
 }
 
+func unameRelease() (string, error) {
+	var uname unix.Utsname
+	if err := unix.Uname(&uname); err != nil {
+		return "", err
+	}
+	return unix.ByteSliceToString(uname.Release[:]), nil
+}
+
+// parseProcVersion returns the os-release fields guessed from the content of /proc/version,
+// an empty map for an unknown distribution
+func parseProcVersion(content string) map[string]string {
+	for _, distro := range procVersionDistros {
+		if distro.re.MatchString(content) {
+			osrelease := make(map[string]string, len(distro.osrelease))
+			for k, v := range distro.osrelease {
+				osrelease[k] = v
+			}
+			return osrelease
+		}
+	}
+	return map[string]string{}
+}
+
+// Code returns the version of the running kernel, 0 if it couldn't be detected
+func (k *KernelVersion) Code() kernel.Version {
+	return k.code
+}
+
+// OSRelease returns a copy of the os-release fields the helpers rely on
+func (k *KernelVersion) OSRelease() map[string]string {
+	osrelease := make(map[string]string, len(k.osrelease))
+	for key, value := range k.osrelease {
+		osrelease[key] = value
+	}
+	return osrelease
+}
+
+// IsAtLeast returns whether the running kernel version is at least a.b.c, false if it couldn't be detected
+func (k *KernelVersion) IsAtLeast(a, b, c int) bool {
+	return k.code != 0 && k.code >= kernel.VersionCode(byte(a), byte(b), byte(c))
+}
+
+// HasBTF returns whether the running kernel exposes its BTF type information, required by CO-RE eBPF programs
+func (k *KernelVersion) HasBTF() bool {
+	return k.hasFile([]string{btfVmlinux})
+}
+
 // IsRH7Kernel returns whether the kernel is a rh7 kernel
 func (k *KernelVersion) IsRH7Kernel() bool {
 	return (k.osrelease["ID"] == "centos" || k.osrelease["ID"] == "rhel") && k.osrelease["VERSION_ID"] == "7"
@@ -68,6 +242,30 @@ func (k *KernelVersion) IsRH8Kernel() bool {
 	return k.osrelease["PLATFORM_ID"] == "platform:el8"
 }
 
+// IsRH9Kernel returns whether the kernel is a rh9 kernel
+func (k *KernelVersion) IsRH9Kernel() bool {
+	return k.osrelease["PLATFORM_ID"] == "platform:el9"
+}
+
+// RHELMajorVersion returns the major version of a rhel compatible kernel, e.g. 8 for platform:el8
+func (k *KernelVersion) RHELMajorVersion() (int, bool) {
+	if platform := k.osrelease["PLATFORM_ID"]; strings.HasPrefix(platform, "platform:el") {
+		if major, err := strconv.Atoi(strings.TrimPrefix(platform, "platform:el")); err == nil {
+			return major, true
+		}
+	}
+
+	// rh7 doesn't set a platform id
+	if k.osrelease["ID"] == "centos" || k.osrelease["ID"] == "rhel" {
+		major := strings.SplitN(k.osrelease["VERSION_ID"], ".", 2)[0]
+		if major, err := strconv.Atoi(major); err == nil {
+			return major, true
+		}
+	}
+
+	return 0, false
+}
+
 // IsSuseKernel returns whether the kernel is a suse kernel
 func (k *KernelVersion) IsSuseKernel() bool {
 	return k.osrelease["ID"] == "sles" || k.osrelease["ID"] == "opensuse-leap"
@@ -82,3 +280,116 @@ func (k *KernelVersion) IsSLES12Kernel() bool {
 func (k *KernelVersion) IsSLES15Kernel() bool {
 	return k.IsSuseKernel() && strings.HasPrefix(k.osrelease["VERSION_ID"], "15")
 }
+
+// IsAmazonLinuxKernel returns whether the kernel is an amazon linux kernel
+func (k *KernelVersion) IsAmazonLinuxKernel() bool {
+	return k.osrelease["ID"] == "amzn"
+}
+
+// IsAmazonLinux1Kernel returns whether the kernel is an amazon linux 1 kernel
+func (k *KernelVersion) IsAmazonLinux1Kernel() bool {
+	// amazon linux 1 versions are named after their release date, e.g. 2018.03
+	return k.IsAmazonLinuxKernel() && strings.Contains(k.osrelease["VERSION_ID"], ".")
+}
+
+// IsAmazonLinux2Kernel returns whether the kernel is an amazon linux 2 kernel
+func (k *KernelVersion) IsAmazonLinux2Kernel() bool {
+	return k.IsAmazonLinuxKernel() && k.osrelease["VERSION_ID"] == "2"
+}
+
+// IsAmazonLinux2023Kernel returns whether the kernel is an amazon linux 2023 kernel
+func (k *KernelVersion) IsAmazonLinux2023Kernel() bool {
+	return k.IsAmazonLinuxKernel() && (k.osrelease["PLATFORM_ID"] == "platform:al2023" || k.osrelease["VERSION_ID"] == "2023")
+}
+
+// IsDebianKernel returns whether the kernel is a debian kernel
+func (k *KernelVersion) IsDebianKernel() bool {
+	return k.osrelease["ID"] == "debian"
+}
+
+// IsUbuntuKernel returns whether the kernel is an ubuntu kernel
+func (k *KernelVersion) IsUbuntuKernel() bool {
+	return k.osrelease["ID"] == "ubuntu"
+}
+
+// UbuntuVersion returns the ubuntu version, e.g. 20.04, and whether the kernel is an ubuntu kernel
+func (k *KernelVersion) UbuntuVersion() (string, bool) {
+	if !k.IsUbuntuKernel() {
+		return "", false
+	}
+	return k.osrelease["VERSION_ID"], true
+}
+
+// IsFedoraKernel returns whether the kernel is a fedora kernel, including fedora coreos
+func (k *KernelVersion) IsFedoraKernel() bool {
+	return k.osrelease["ID"] == "fedora"
+}
+
+// IsFedoraCoreOSKernel returns whether the kernel is a fedora coreos kernel
+func (k *KernelVersion) IsFedoraCoreOSKernel() bool {
+	return k.IsFedoraKernel() && k.osrelease["VARIANT_ID"] == "coreos"
+}
+
+// IsFlatcarKernel returns whether the kernel is a flatcar container linux kernel
+func (k *KernelVersion) IsFlatcarKernel() bool {
+	return k.osrelease["ID"] == "flatcar"
+}
+
+// IsArchKernel returns whether the kernel is an arch linux kernel
+func (k *KernelVersion) IsArchKernel() bool {
+	return k.osrelease["ID"] == "arch"
+}
+
+// IsGentooKernel returns whether the kernel is a gentoo kernel
+func (k *KernelVersion) IsGentooKernel() bool {
+	return k.osrelease["ID"] == "gentoo"
+}
+
+// IsRollingRelease returns whether the distribution is a rolling release, which doesn't have a stable version
+func (k *KernelVersion) IsRollingRelease() bool {
+	return k.IsArchKernel() || k.IsGentooKernel() || k.osrelease["BUILD_ID"] == "rolling"
+}
+
+// OSVersion returns the version of the distribution, "rolling" for the rolling releases, and false when it's unknown.
+// The VERSION_ID of gentoo is the one of its baselayout package, so it's ignored.
+func (k *KernelVersion) OSVersion() (string, bool) {
+	if k.IsRollingRelease() {
+		return "rolling", true
+	}
+	version, ok := k.osrelease["VERSION_ID"]
+	return version, ok && version != ""
+}
+
+// IsAlpineKernel returns whether the kernel is an alpine kernel
+func (k *KernelVersion) IsAlpineKernel() bool {
+	return k.osrelease["ID"] == "alpine"
+}
+
+// IsMusl returns whether the host uses the musl libc rather than the glibc. It is a best effort guess:
+// alpine is assumed to use musl, other distributions when the musl dynamic loader is installed but not the glibc one.
+func (k *KernelVersion) IsMusl() bool {
+	if k.IsAlpineKernel() {
+		return true
+	}
+	return k.hasFile(muslLoaderGlobs) && !k.hasFile(glibcLoaderGlobs)
+}
+
+// hasFile returns whether a file of the host filesystem matches one of the glob patterns
+func (k *KernelVersion) hasFile(patterns []string) bool {
+	root := k.hostRoot
+	if root == "" {
+		root = "/"
+	}
+	for _, pattern := range patterns {
+		if matches, _ := filepath.Glob(filepath.Join(root, pattern)); len(matches) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// IsWSLKernel returns whether the kernel is a windows subsystem for linux kernel
+func (k *KernelVersion) IsWSLKernel() bool {
+	// e.g. 5.10.16.3-microsoft-standard-WSL2, or 4.4.0-19041-Microsoft for WSL1
+	return strings.Contains(strings.ToLower(k.release), "-microsoft") || strings.Contains(k.procVersion, "WSL")
+}
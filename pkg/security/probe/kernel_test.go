@@ -0,0 +1,649 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016-present Datadog, Inc.
+
+// +build linux
+
+package probe
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/DataDog/datadog-agent/pkg/util/kernel"
+)
+
+func TestAmazonLinuxKernel(t *testing.T) {
+	tests := []struct {
+		name      string
+		osrelease map[string]string
+		al1       bool
+		al2       bool
+		al2023    bool
+	}{
+		{
+			name: "amazon linux 1",
+			osrelease: map[string]string{
+				"NAME":       "Amazon Linux AMI",
+				"ID":         "amzn",
+				"ID_LIKE":    "rhel fedora",
+				"VERSION_ID": "2018.03",
+			},
+			al1: true,
+		},
+		{
+			name: "amazon linux 2",
+			osrelease: map[string]string{
+				"NAME":       "Amazon Linux",
+				"ID":         "amzn",
+				"ID_LIKE":    "centos rhel fedora",
+				"VERSION_ID": "2",
+				"CPE_NAME":   "cpe:2.3:o:amazon:amazon_linux:2",
+			},
+			al2: true,
+		},
+		{
+			name: "amazon linux 2023",
+			osrelease: map[string]string{
+				"NAME":        "Amazon Linux",
+				"ID":          "amzn",
+				"ID_LIKE":     "fedora",
+				"VERSION_ID":  "2023",
+				"PLATFORM_ID": "platform:al2023",
+			},
+			al2023: true,
+		},
+		{
+			name: "centos 7",
+			osrelease: map[string]string{
+				"NAME":       "CentOS Linux",
+				"ID":         "centos",
+				"ID_LIKE":    "rhel fedora",
+				"VERSION_ID": "7",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			k := &KernelVersion{osrelease: test.osrelease}
+			assert.Equal(t, test.al1 || test.al2 || test.al2023, k.IsAmazonLinuxKernel())
+			assert.Equal(t, test.al1, k.IsAmazonLinux1Kernel())
+			assert.Equal(t, test.al2, k.IsAmazonLinux2Kernel())
+			assert.Equal(t, test.al2023, k.IsAmazonLinux2023Kernel())
+			assert.False(t, k.IsRH8Kernel())
+		})
+	}
+}
+
+func TestDebianUbuntuKernel(t *testing.T) {
+	tests := []struct {
+		name          string
+		osrelease     map[string]string
+		debian        bool
+		ubuntu        bool
+		ubuntuVersion string
+	}{
+		{
+			name: "debian 11",
+			osrelease: map[string]string{
+				"NAME":             "Debian GNU/Linux",
+				"ID":               "debian",
+				"VERSION_ID":       "11",
+				"VERSION_CODENAME": "bullseye",
+			},
+			debian: true,
+		},
+		{
+			name: "ubuntu 20.04",
+			osrelease: map[string]string{
+				"NAME":             "Ubuntu",
+				"ID":               "ubuntu",
+				"ID_LIKE":          "debian",
+				"VERSION_ID":       "20.04",
+				"VERSION_CODENAME": "focal",
+			},
+			ubuntu:        true,
+			ubuntuVersion: "20.04",
+		},
+		{
+			name: "ubuntu 22.04",
+			osrelease: map[string]string{
+				"NAME":             "Ubuntu",
+				"ID":               "ubuntu",
+				"ID_LIKE":          "debian",
+				"VERSION_ID":       "22.04",
+				"VERSION_CODENAME": "jammy",
+			},
+			ubuntu:        true,
+			ubuntuVersion: "22.04",
+		},
+		{
+			name: "sles 15",
+			osrelease: map[string]string{
+				"NAME":       "SLES",
+				"ID":         "sles",
+				"VERSION_ID": "15.2",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			k := &KernelVersion{osrelease: test.osrelease}
+			assert.Equal(t, test.debian, k.IsDebianKernel())
+			assert.Equal(t, test.ubuntu, k.IsUbuntuKernel())
+			version, ok := k.UbuntuVersion()
+			assert.Equal(t, test.ubuntu, ok)
+			assert.Equal(t, test.ubuntuVersion, version)
+		})
+	}
+}
+
+func TestKernelVersionIsAtLeast(t *testing.T) {
+	defer func(f func() (kernel.Version, error)) { hostVersion = f }(hostVersion)
+
+	hostVersion = func() (kernel.Version, error) {
+		return kernel.VersionCode(4, 15, 3), nil
+	}
+	k, err := NewKernelVersion()
+	require.NoError(t, err)
+	assert.Equal(t, kernel.VersionCode(4, 15, 3), k.Code())
+
+	assert.True(t, k.IsAtLeast(3, 10, 0))
+	assert.True(t, k.IsAtLeast(4, 14, 255))
+	assert.True(t, k.IsAtLeast(4, 15, 0))
+	assert.True(t, k.IsAtLeast(4, 15, 3))
+	assert.False(t, k.IsAtLeast(4, 15, 4))
+	assert.False(t, k.IsAtLeast(4, 16, 0))
+	assert.False(t, k.IsAtLeast(5, 0, 0))
+
+	// unknown kernel version
+	hostVersion = func() (kernel.Version, error) {
+		return 0, errors.New("uname failed")
+	}
+	k, err = NewKernelVersion()
+	require.NoError(t, err)
+	assert.Equal(t, kernel.Version(0), k.Code())
+	assert.False(t, k.IsAtLeast(0, 0, 1))
+}
+
+func TestKernelVersionProcVersionFallback(t *testing.T) {
+	tests := []struct {
+		name        string
+		procVersion string
+		check       func(t *testing.T, k *KernelVersion)
+	}{
+		{
+			name:        "ubuntu",
+			procVersion: "Linux version 5.4.0-1029-aws (buildd@lcy01-amd64-021) (gcc version 9.3.0 (Ubuntu 9.3.0-10ubuntu2)) #30-Ubuntu SMP Tue Oct 20 10:06:38 UTC 2020",
+			check: func(t *testing.T, k *KernelVersion) {
+				assert.True(t, k.IsUbuntuKernel())
+				version, ok := k.UbuntuVersion()
+				assert.True(t, ok)
+				assert.Empty(t, version)
+			},
+		},
+		{
+			name:        "centos 7",
+			procVersion: "Linux version 3.10.0-1160.el7.x86_64 (mockbuild@kbuilder.bsys.centos.org) (gcc version 4.8.5 20150623 (Red Hat 4.8.5-44) (GCC) ) #1 SMP Mon Oct 19 16:18:59 UTC 2020",
+			check: func(t *testing.T, k *KernelVersion) {
+				assert.True(t, k.IsRH7Kernel())
+				assert.False(t, k.IsRH8Kernel())
+			},
+		},
+		{
+			name:        "rhel 8",
+			procVersion: "Linux version 4.18.0-305.el8.x86_64 (mockbuild@x86-vm-07.build.eng.bos.redhat.com) (gcc version 8.4.1 20200928 (Red Hat 8.4.1-1) (GCC)) #1 SMP Thu Apr 29 08:54:30 EDT 2021",
+			check: func(t *testing.T, k *KernelVersion) {
+				assert.True(t, k.IsRH8Kernel())
+				assert.False(t, k.IsRH7Kernel())
+			},
+		},
+		{
+			name:        "amazon linux 2",
+			procVersion: "Linux version 4.14.219-161.340.amzn2.x86_64 (mockbuild@ip-10-0-1-32) (gcc version 7.3.1 20180712 (Red Hat 7.3.1-12) (GCC)) #1 SMP Thu Feb 4 15:47:20 UTC 2021",
+			check: func(t *testing.T, k *KernelVersion) {
+				assert.True(t, k.IsAmazonLinux2Kernel())
+				assert.False(t, k.IsRH7Kernel())
+			},
+		},
+		{
+			name:        "unknown",
+			procVersion: "Linux version 5.10.0 (builder@localhost) (gcc version 10.2.0 (GCC)) #1 SMP PREEMPT",
+			check: func(t *testing.T, k *KernelVersion) {
+				assert.Empty(t, k.osrelease)
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := t.TempDir()
+			procVersionPath := filepath.Join(dir, "version")
+			require.NoError(t, ioutil.WriteFile(procVersionPath, []byte(test.procVersion), 0644))
+
+			k, err := newKernelVersion([]string{filepath.Join(dir, "os-release")}, []string{procVersionPath})
+			require.NoError(t, err)
+			test.check(t, k)
+		})
+	}
+}
+
+func TestKernelVersionOSReleasePreferred(t *testing.T) {
+	dir := t.TempDir()
+	osReleasePath := filepath.Join(dir, "os-release")
+	require.NoError(t, ioutil.WriteFile(osReleasePath, []byte("ID=debian\nVERSION_ID=\"11\"\n"), 0644))
+	procVersionPath := filepath.Join(dir, "version")
+	require.NoError(t, ioutil.WriteFile(procVersionPath, []byte("Linux version 5.4.0-1029-aws (gcc version 9.3.0 (Ubuntu 9.3.0-10ubuntu2)) #30-Ubuntu SMP"), 0644))
+
+	k, err := newKernelVersion([]string{osReleasePath}, []string{procVersionPath})
+	require.NoError(t, err)
+	assert.True(t, k.IsDebianKernel())
+	assert.False(t, k.IsUbuntuKernel())
+
+	_, err = newKernelVersion([]string{filepath.Join(dir, "missing")}, []string{filepath.Join(dir, "missing")})
+	assert.Error(t, err)
+}
+
+func TestGetKernelVersion(t *testing.T) {
+	defer func(f func(string) (map[string]string, error)) { readOSRelease = f }(readOSRelease)
+	defer resetKernelVersion()
+	resetKernelVersion()
+
+	reads := 0
+	readOSRelease = func(path string) (map[string]string, error) {
+		reads++
+		return map[string]string{"ID": "ubuntu", "VERSION_ID": "20.04"}, nil
+	}
+
+	kv, err := GetKernelVersion()
+	require.NoError(t, err)
+	assert.True(t, kv.IsUbuntuKernel())
+	assert.Equal(t, 1, reads)
+
+	cached, err := GetKernelVersion()
+	require.NoError(t, err)
+	assert.Same(t, kv, cached)
+	assert.Equal(t, 1, reads)
+
+	// the helper is created again once reset
+	resetKernelVersion()
+	kv, err = GetKernelVersion()
+	require.NoError(t, err)
+	assert.NotSame(t, cached, kv)
+	assert.Equal(t, 2, reads)
+}
+
+func TestWSLKernel(t *testing.T) {
+	defer func(f func() (string, error)) { hostRelease = f }(hostRelease)
+
+	tests := []struct {
+		name        string
+		release     string
+		procVersion string
+		wsl         bool
+	}{
+		{
+			name:        "wsl2",
+			release:     "5.10.16.3-microsoft-standard-WSL2",
+			procVersion: "Linux version 5.10.16.3-microsoft-standard-WSL2 (oe-user@oe-host) (x86_64-msft-linux-gcc (GCC) 9.3.0) #1 SMP Fri Apr 2 22:23:49 UTC 2021",
+			wsl:         true,
+		},
+		{
+			name:        "wsl1",
+			release:     "4.4.0-19041-Microsoft",
+			procVersion: "Linux version 4.4.0-19041-Microsoft (Microsoft@Microsoft.com) (gcc version 5.4.0 (GCC) ) #488-Microsoft Mon Sep 01 13:43:00 PST 2020",
+			wsl:         true,
+		},
+		{
+			name:        "wsl marker only",
+			procVersion: "Linux version 5.15.90.1-custom-WSL2 (builder@localhost) (gcc version 11.2.0 (GCC)) #1 SMP",
+			wsl:         true,
+		},
+		{
+			name:        "ubuntu",
+			release:     "5.4.0-1029-aws",
+			procVersion: "Linux version 5.4.0-1029-aws (buildd@lcy01-amd64-021) (gcc version 9.3.0 (Ubuntu 9.3.0-10ubuntu2)) #30-Ubuntu SMP Tue Oct 20 10:06:38 UTC 2020",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			hostRelease = func() (string, error) {
+				return test.release, nil
+			}
+
+			dir := t.TempDir()
+			osReleasePath := filepath.Join(dir, "os-release")
+			require.NoError(t, ioutil.WriteFile(osReleasePath, []byte("ID=ubuntu\nVERSION_ID=\"20.04\"\n"), 0644))
+			procVersionPath := filepath.Join(dir, "version")
+			require.NoError(t, ioutil.WriteFile(procVersionPath, []byte(test.procVersion), 0644))
+
+			k, err := newKernelVersion([]string{osReleasePath}, []string{procVersionPath})
+			require.NoError(t, err)
+			assert.Equal(t, test.wsl, k.IsWSLKernel())
+		})
+	}
+}
+
+func TestRHKernel(t *testing.T) {
+	tests := []struct {
+		name      string
+		osrelease map[string]string
+		major     int
+	}{
+		{
+			name: "centos 7",
+			osrelease: map[string]string{
+				"ID":         "centos",
+				"VERSION_ID": "7",
+			},
+			major: 7,
+		},
+		{
+			name: "rhel 8",
+			osrelease: map[string]string{
+				"ID":          "rhel",
+				"VERSION_ID":  "8.4",
+				"PLATFORM_ID": "platform:el8",
+			},
+			major: 8,
+		},
+		{
+			name: "rhel 9",
+			osrelease: map[string]string{
+				"ID":          "rhel",
+				"VERSION_ID":  "9.0",
+				"PLATFORM_ID": "platform:el9",
+			},
+			major: 9,
+		},
+		{
+			name: "rocky 9",
+			osrelease: map[string]string{
+				"ID":          "rocky",
+				"VERSION_ID":  "9.1",
+				"PLATFORM_ID": "platform:el9",
+			},
+			major: 9,
+		},
+		{
+			name: "fedora",
+			osrelease: map[string]string{
+				"ID":          "fedora",
+				"VERSION_ID":  "34",
+				"PLATFORM_ID": "platform:f34",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			k := &KernelVersion{osrelease: test.osrelease}
+			assert.Equal(t, test.major == 7, k.IsRH7Kernel())
+			assert.Equal(t, test.major == 8, k.IsRH8Kernel())
+			assert.Equal(t, test.major == 9, k.IsRH9Kernel())
+
+			major, ok := k.RHELMajorVersion()
+			assert.Equal(t, test.major != 0, ok)
+			assert.Equal(t, test.major, major)
+		})
+	}
+}
+
+func TestKernelVersionOSRelease(t *testing.T) {
+	input := map[string]string{
+		"ID":          "rhel",
+		"VERSION_ID":  "8.4",
+		"PLATFORM_ID": "platform:el8",
+	}
+	k := &KernelVersion{osrelease: input}
+
+	osrelease := k.OSRelease()
+	assert.Equal(t, input, osrelease)
+
+	// the internal map can't be altered through the copy
+	osrelease["PLATFORM_ID"] = "platform:el9"
+	assert.True(t, k.IsRH8Kernel())
+	assert.Equal(t, "platform:el8", k.OSRelease()["PLATFORM_ID"])
+}
+
+func TestFlatcarFedoraKernel(t *testing.T) {
+	tests := []struct {
+		name      string
+		osrelease map[string]string
+		flatcar   bool
+		fedora    bool
+		coreos    bool
+	}{
+		{
+			name: "flatcar",
+			osrelease: map[string]string{
+				"NAME":       "Flatcar Container Linux by Kinvolk",
+				"ID":         "flatcar",
+				"ID_LIKE":    "coreos",
+				"VERSION_ID": "2905.2.3",
+				"BUILD_ID":   "2021-09-01-0022",
+			},
+			flatcar: true,
+		},
+		{
+			name: "fedora coreos",
+			osrelease: map[string]string{
+				"NAME":        "Fedora Linux",
+				"ID":          "fedora",
+				"VERSION_ID":  "35",
+				"VARIANT":     "CoreOS",
+				"VARIANT_ID":  "coreos",
+				"PLATFORM_ID": "platform:f35",
+			},
+			fedora: true,
+			coreos: true,
+		},
+		{
+			name: "fedora workstation",
+			osrelease: map[string]string{
+				"NAME":        "Fedora Linux",
+				"ID":          "fedora",
+				"VERSION_ID":  "35",
+				"VARIANT":     "Workstation Edition",
+				"VARIANT_ID":  "workstation",
+				"PLATFORM_ID": "platform:f35",
+			},
+			fedora: true,
+		},
+		{
+			name: "centos 8",
+			osrelease: map[string]string{
+				"NAME":        "CentOS Linux",
+				"ID":          "centos",
+				"ID_LIKE":     "rhel fedora",
+				"VERSION_ID":  "8",
+				"PLATFORM_ID": "platform:el8",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			k := &KernelVersion{osrelease: test.osrelease}
+			assert.Equal(t, test.flatcar, k.IsFlatcarKernel())
+			assert.Equal(t, test.fedora, k.IsFedoraKernel())
+			assert.Equal(t, test.coreos, k.IsFedoraCoreOSKernel())
+		})
+	}
+}
+
+func TestAlpineMuslKernel(t *testing.T) {
+	tests := []struct {
+		name      string
+		osrelease map[string]string
+		files     []string
+		alpine    bool
+		musl      bool
+	}{
+		{
+			name: "alpine",
+			osrelease: map[string]string{
+				"NAME":       "Alpine Linux",
+				"ID":         "alpine",
+				"VERSION_ID": "3.14.2",
+				"HOME_URL":   "https://alpinelinux.org/",
+			},
+			files:  []string{"lib/ld-musl-x86_64.so.1"},
+			alpine: true,
+			musl:   true,
+		},
+		{
+			name: "alpine without loader",
+			osrelease: map[string]string{
+				"ID":         "alpine",
+				"VERSION_ID": "3.14.2",
+			},
+			alpine: true,
+			musl:   true,
+		},
+		{
+			name: "void musl",
+			osrelease: map[string]string{
+				"NAME": "Void Linux",
+				"ID":   "void",
+			},
+			files: []string{"usr/lib/ld-musl-aarch64.so.1"},
+			musl:  true,
+		},
+		{
+			name: "debian with the musl package",
+			osrelease: map[string]string{
+				"ID":         "debian",
+				"VERSION_ID": "11",
+			},
+			files: []string{"lib/ld-musl-x86_64.so.1", "lib64/ld-linux-x86-64.so.2"},
+		},
+		{
+			name: "ubuntu",
+			osrelease: map[string]string{
+				"ID":         "ubuntu",
+				"VERSION_ID": "20.04",
+			},
+			files: []string{"lib64/ld-linux-x86-64.so.2"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			root := t.TempDir()
+			for _, file := range test.files {
+				path := filepath.Join(root, file)
+				require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+				require.NoError(t, ioutil.WriteFile(path, nil, 0644))
+			}
+
+			k := &KernelVersion{osrelease: test.osrelease, hostRoot: root}
+			assert.Equal(t, test.alpine, k.IsAlpineKernel())
+			assert.Equal(t, test.musl, k.IsMusl())
+		})
+	}
+}
+
+func TestHasBTF(t *testing.T) {
+	root := t.TempDir()
+	k := &KernelVersion{hostRoot: root}
+	assert.False(t, k.HasBTF())
+
+	path := filepath.Join(root, "sys", "kernel", "btf", "vmlinux")
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+	require.NoError(t, ioutil.WriteFile(path, nil, 0444))
+	assert.True(t, k.HasBTF())
+}
+
+func TestRollingReleaseKernel(t *testing.T) {
+	tests := []struct {
+		name      string
+		osrelease map[string]string
+		arch      bool
+		gentoo    bool
+		version   string
+		known     bool
+	}{
+		{
+			name: "arch",
+			osrelease: map[string]string{
+				"NAME":     "Arch Linux",
+				"ID":       "arch",
+				"BUILD_ID": "rolling",
+			},
+			arch:    true,
+			version: "rolling",
+			known:   true,
+		},
+		{
+			name: "gentoo",
+			osrelease: map[string]string{
+				"NAME":       "Gentoo",
+				"ID":         "gentoo",
+				"VERSION_ID": "2.7",
+			},
+			gentoo:  true,
+			version: "rolling",
+			known:   true,
+		},
+		{
+			name: "gentoo without version",
+			osrelease: map[string]string{
+				"NAME": "Gentoo",
+				"ID":   "gentoo",
+			},
+			gentoo:  true,
+			version: "rolling",
+			known:   true,
+		},
+		{
+			name: "manjaro",
+			osrelease: map[string]string{
+				"NAME":     "Manjaro Linux",
+				"ID":       "manjaro",
+				"ID_LIKE":  "arch",
+				"BUILD_ID": "rolling",
+			},
+			version: "rolling",
+			known:   true,
+		},
+		{
+			name: "debian 11",
+			osrelease: map[string]string{
+				"ID":         "debian",
+				"VERSION_ID": "11",
+			},
+			version: "11",
+			known:   true,
+		},
+		{
+			name: "debian sid",
+			osrelease: map[string]string{
+				"ID": "debian",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			k := &KernelVersion{osrelease: test.osrelease}
+			assert.Equal(t, test.arch, k.IsArchKernel())
+			assert.Equal(t, test.gentoo, k.IsGentooKernel())
+			assert.Equal(t, test.version == "rolling", k.IsRollingRelease())
+
+			version, ok := k.OSVersion()
+			assert.Equal(t, test.known, ok)
+			assert.Equal(t, test.version, version)
+		})
+	}
+}
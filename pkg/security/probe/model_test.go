@@ -49,6 +49,31 @@ func TestPathValidation(t *testing.T) {
 	}
 }
 
+func TestCIDRValidation(t *testing.T) {
+	model := &Model{}
+
+	for _, cidr := range []string{"10.0.0.0/8", "192.168.1.0/24", "127.0.0.1/32", "::1/128", "fd00::/8", "2001:db8::/32"} {
+		if err := model.ValidateField("container.id", eval.FieldValue{Value: cidr, Type: eval.CIDRValueType}); err != nil {
+			t.Errorf("shouldn't return an error for %s: %s", cidr, err)
+		}
+	}
+
+	for _, cidr := range []string{"10.0.0.0/33", "::1/129", "10.0.0.0", "10.0.0/8", "300.0.0.0/8", "10.0.0.0/-1", "fd00:::/8", ""} {
+		if err := model.ValidateField("container.id", eval.FieldValue{Value: cidr, Type: eval.CIDRValueType}); err == nil {
+			t.Errorf("should return an error for %s", cidr)
+		}
+	}
+
+	if err := model.ValidateField("container.id", eval.FieldValue{Value: 123, Type: eval.CIDRValueType}); err == nil {
+		t.Error("should return an error")
+	}
+
+	// scalar values aren't parsed as CIDRs
+	if err := model.ValidateField("container.id", eval.FieldValue{Value: "10.0.0.0/33", Type: eval.ScalarValueType}); err != nil {
+		t.Errorf("shouldn't return an error: %s", err)
+	}
+}
+
 func TestSetFieldValue(t *testing.T) {
 	event := &Event{}
 
@@ -77,6 +102,51 @@ func TestSetFieldValue(t *testing.T) {
 	}
 }
 
+func TestSetFieldValueArray(t *testing.T) {
+	event := &Event{}
+
+	// a string is appended
+	if err := event.SetFieldValue("exec.envs", "PATH=/usr/bin"); err != nil {
+		t.Fatal(err)
+	}
+	if err := event.SetFieldValue("exec.envs", "HOME=/root"); err != nil {
+		t.Fatal(err)
+	}
+
+	value, err := event.GetFieldValue("exec.envs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(value, []string{"PATH=/usr/bin", "HOME=/root"}) {
+		t.Errorf("unexpected envs: %v", value)
+	}
+
+	// a []string replaces the values
+	if err = event.SetFieldValue("exec.envs", []string{"USER=root"}); err != nil {
+		t.Fatal(err)
+	}
+
+	value, err = event.GetFieldValue("exec.envs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(value, []string{"USER=root"}) {
+		t.Errorf("unexpected envs: %v", value)
+	}
+
+	if err = event.SetFieldValue("exec.args_flags", []string{"-v", "--debug"}); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(event.Exec.Argv, []string{"-v", "--debug"}) {
+		t.Errorf("unexpected argv: %v", event.Exec.Argv)
+	}
+
+	// scalar fields don't accept arrays
+	if err = event.SetFieldValue("exec.args", []string{"-v"}); err == nil {
+		t.Error("should return an error")
+	}
+}
+
 func TestExecArgsFlags(t *testing.T) {
 	e := Event{
 		Event: model.Event{
@@ -349,7 +349,7 @@ func (mr *MountResolver) GetMountPath(mountID uint32) (string, string, string, e
 func getMountIDOffset(probe *Probe) uint64 {
 	offset := uint64(284)
 
-	kv, err := NewKernelVersion()
+	kv, err := GetKernelVersion()
 	if err == nil {
 		switch {
 		case kv.IsSuseKernel():
@@ -365,7 +365,7 @@ func getMountIDOffset(probe *Probe) uint64 {
 func getSizeOfStructInode(probe *Probe) uint64 {
 	sizeOf := uint64(600)
 
-	kv, err := NewKernelVersion()
+	kv, err := GetKernelVersion()
 	if err == nil {
 		switch {
 		case kv.IsRH7Kernel():
@@ -387,7 +387,7 @@ func getSizeOfStructInode(probe *Probe) uint64 {
 func getSuperBlockMagicOffset(probe *Probe) uint64 {
 	sizeOf := uint64(96)
 
-	kv, err := NewKernelVersion()
+	kv, err := GetKernelVersion()
 	if err == nil && kv.IsRH7Kernel() {
 		sizeOf = 88
 	}
@@ -64,7 +64,7 @@ func getDoForkInput(probe *Probe) uint64 {
 // space
 func getCGroupWriteConstants() manager.ConstantEditor {
 	cgroupWriteConst := uint64(1)
-	kv, err := NewKernelVersion()
+	kv, err := GetKernelVersion()
 	if err == nil {
 		if kv.IsRH7Kernel() {
 			cgroupWriteConst = 2
@@ -81,7 +81,7 @@ func getCGroupWriteConstants() manager.ConstantEditor {
 func TTYConstants(probe *Probe) []manager.ConstantEditor {
 	ttyOffset, nameOffset := uint64(400), uint64(368)
 
-	kv, err := NewKernelVersion()
+	kv, err := GetKernelVersion()
 	if err == nil {
 		switch {
 		case kv.IsRH7Kernel():
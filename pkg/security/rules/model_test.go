@@ -80,6 +80,10 @@ func (m *testModel) ValidateField(key string, value eval.FieldValue) error {
 	return nil
 }
 
+func (m *testModel) IsCIDRField(field eval.Field) bool {
+	return false
+}
+
 func (m *testModel) GetIterator(field eval.Field) (eval.Iterator, error) {
 	return nil, &eval.ErrIteratorNotSupported{Field: field}
 }
@@ -31,6 +31,7 @@ const (
 	PatternValueType FieldValueType = 1 << 1
 	RegexpValueType  FieldValueType = 1 << 2
 	BitmaskValueType FieldValueType = 1 << 3
+	CIDRValueType    FieldValueType = 1 << 4
 )
 
 // defines factor applied by specific operator
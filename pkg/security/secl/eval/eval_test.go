@@ -671,6 +671,29 @@ func TestFieldValidator(t *testing.T) {
 	}
 }
 
+func TestCIDRFieldValidator(t *testing.T) {
+	tests := []struct {
+		Expr     string
+		Expected bool
+	}{
+		{Expr: `connect.addr == "10.0.0.0/8"`, Expected: true},
+		{Expr: `connect.addr != "fd00::/8"`, Expected: true},
+		{Expr: `connect.addr in ["10.0.0.0/8", "192.168.1.0/24"]`, Expected: true},
+		{Expr: `connect.addr == "10.0.0.0/33"`, Expected: false},
+		{Expr: `connect.addr == "10.0.0.0"`, Expected: false},
+		{Expr: `connect.addr in ["10.0.0.0/8", "::1/129"]`, Expected: false},
+		{Expr: `"10.0.0.0/33" == connect.addr`, Expected: false},
+		{Expr: `open.filename == "10.0.0.0/33"`, Expected: true},
+	}
+
+	for _, test := range tests {
+		_, err := parseRule(test.Expr, &testModel{}, &Opts{})
+		if err == nil != test.Expected {
+			t.Errorf("expected result `%t` not found, got `%t`: %v\n%s", test.Expected, err == nil, err, test.Expr)
+		}
+	}
+}
+
 func TestLegacyField(t *testing.T) {
 	model := &testModel{}
 	opts := NewOptsWithParams(testConstants, legacyAttributes)
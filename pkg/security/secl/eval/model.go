@@ -11,6 +11,8 @@ type Model interface {
 	GetEvaluator(field Field, regID RegisterID) (Evaluator, error)
 	// ValidateField returns whether the value use against the field is valid, ex: for constant
 	ValidateField(field Field, value FieldValue) error
+	// IsCIDRField returns whether the strings compared to the field are network addresses in CIDR notation
+	IsCIDRField(field Field) bool
 	// GetIterator return an iterator
 	GetIterator(field Field) (Iterator, error)
 	// NewEvent returns a new event instance
@@ -6,6 +6,7 @@
 package eval
 
 import (
+	"net"
 	"reflect"
 	"syscall"
 	"unsafe"
@@ -93,6 +94,10 @@ type testMkdir struct {
 	mode     int
 }
 
+type testConnect struct {
+	addr string
+}
+
 type testEvent struct {
 	id   string
 	kind string
@@ -100,6 +105,7 @@ type testEvent struct {
 	process testProcess
 	open    testOpen
 	mkdir   testMkdir
+	connect testConnect
 
 	listEvaluated bool
 	uidEvaluated  bool
@@ -139,11 +145,25 @@ func (m *testModel) ValidateField(key string, value FieldValue) error {
 			return errors.New("process.uid cannot be negative")
 		}
 
+	case "connect.addr":
+
+		if value.Type != CIDRValueType {
+			return errors.New("connect.addr should be compared to CIDRs")
+		}
+
+		if _, _, err := net.ParseCIDR(value.Value.(string)); err != nil {
+			return err
+		}
+
 	}
 
 	return nil
 }
 
+func (m *testModel) IsCIDRField(field Field) bool {
+	return field == "connect.addr"
+}
+
 func (m *testModel) GetIterator(field Field) (Iterator, error) {
 	switch field {
 	case "process.list":
@@ -341,6 +361,13 @@ func (m *testModel) GetEvaluator(field Field, regID RegisterID) (Evaluator, erro
 			EvalFnc: func(ctx *Context) int { return (*testEvent)(ctx.Object).mkdir.mode },
 			Field:   field,
 		}, nil
+
+	case "connect.addr":
+
+		return &StringEvaluator{
+			EvalFnc: func(ctx *Context) string { return (*testEvent)(ctx.Object).connect.addr },
+			Field:   field,
+		}, nil
 	}
 
 	return nil, &ErrFieldNotFound{Field: field}
@@ -385,6 +412,10 @@ func (e *testEvent) GetFieldValue(field Field) (interface{}, error) {
 
 		return e.mkdir.mode, nil
 
+	case "connect.addr":
+
+		return e.connect.addr, nil
+
 	}
 
 	return nil, &ErrFieldNotFound{Field: field}
@@ -453,6 +484,10 @@ func (e *testEvent) GetFieldEventType(field Field) (string, error) {
 
 		return "mkdir", nil
 
+	case "connect.addr":
+
+		return "connect", nil
+
 	}
 
 	return "", &ErrFieldNotFound{Field: field}
@@ -506,6 +541,11 @@ func (e *testEvent) SetFieldValue(field Field, value interface{}) error {
 		e.mkdir.mode = value.(int)
 		return nil
 
+	case "connect.addr":
+
+		e.connect.addr = value.(string)
+		return nil
+
 	}
 
 	return &ErrFieldNotFound{Field: field}
@@ -568,6 +608,10 @@ func (e *testEvent) GetFieldType(field Field) (reflect.Kind, error) {
 
 		return reflect.Int, nil
 
+	case "connect.addr":
+
+		return reflect.String, nil
+
 	}
 
 	return reflect.Invalid, &ErrFieldNotFound{Field: field}
@@ -31,6 +31,11 @@ func (s *state) UpdateFields(field Field) {
 }
 
 func (s *state) UpdateFieldValues(field Field, value FieldValue) error {
+	// strings compared to a network field are CIDRs
+	if _, isString := value.Value.(string); isString && value.Type == ScalarValueType && s.model.IsCIDRField(field) {
+		value.Type = CIDRValueType
+	}
+
 	values, ok := s.fieldValues[field]
 	if !ok {
 		values = []FieldValue{}
@@ -712,6 +712,12 @@ func (e *Event) SetFieldValue(field eval.Field, value interface{}) error {
 		{{end}}
 			var ok bool
 		{{- if eq $Field.OrigType "string"}}
+			{{- if $Field.IsArray}}
+			if strs, isArray := value.([]string); isArray {
+				{{$FieldName}} = strs
+				return nil
+			}
+			{{- end}}
 			str, ok := value.(string)
 			if !ok {
 				return &eval.ErrValueTypeMismatch{Field: "{{$Field.Name}}"}
@@ -219,6 +219,18 @@ func (c *AgentConfig) applyDatadogConfig() error {
 	if config.Datadog.IsSet("apm_config.max_traces_per_second") {
 		c.TargetTPS = config.Datadog.GetFloat64("apm_config.max_traces_per_second")
 	}
+	if k := "apm_config.service_ttl"; config.Datadog.IsSet(k) {
+		c.ServiceTTL = time.Duration(config.Datadog.GetInt(k)) * time.Second
+	}
+	if k := "apm_config.default_service_rate_key"; config.Datadog.IsSet(k) {
+		c.DefaultServiceRateKey = config.Datadog.GetString(k)
+	}
+	if k := "apm_config.max_catalog_services"; config.Datadog.IsSet(k) {
+		c.MaxCatalogServices = config.Datadog.GetInt(k)
+	}
+	if k := "apm_config.case_insensitive_services"; config.Datadog.IsSet(k) {
+		c.CaseInsensitiveServices = config.Datadog.GetBool(k)
+	}
 	if k := "apm_config.ignore_resources"; config.Datadog.IsSet(k) {
 		c.Ignore["resource"] = config.Datadog.GetStringSlice(k)
 	}
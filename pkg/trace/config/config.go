@@ -68,6 +68,18 @@ type AgentConfig struct {
 	ExtraSampleRate float64
 	TargetTPS       float64
 	MaxEPS          float64
+	// ServiceTTL is the time after which the priority sampler forgets a service that stopped
+	// emitting traces, 0 disables the expiration.
+	ServiceTTL time.Duration
+	// DefaultServiceRateKey is the key the rate of the services unknown to the priority sampler is
+	// reported with, formatted as service:<service>,env:<env>. It defaults to service:,env:.
+	DefaultServiceRateKey string
+	// MaxCatalogServices is the maximum number of services tracked by the priority sampler,
+	// the least recently seen one is forgotten past it. 0 means unlimited.
+	MaxCatalogServices int
+	// CaseInsensitiveServices makes the priority sampler match the services and envs case-insensitively,
+	// their rates are reported with lowercase keys.
+	CaseInsensitiveServices bool
 
 	// Receiver
 	ReceiverHost    string
@@ -239,6 +239,10 @@ func TestUndocumentedYamlConfig(t *testing.T) {
 	assert.Equal(0.33, c.ExtraSampleRate)
 	assert.Equal(100.0, c.TargetTPS)
 	assert.Equal(1000.0, c.MaxEPS)
+	assert.Equal(10*time.Minute, c.ServiceTTL)
+	assert.Equal("service:tenant-a,env:", c.DefaultServiceRateKey)
+	assert.Equal(1000, c.MaxCatalogServices)
+	assert.True(c.CaseInsensitiveServices)
 	assert.Equal(25, c.ReceiverPort)
 	assert.Equal(120*time.Second, c.ConnectionResetInterval)
 	// watchdog
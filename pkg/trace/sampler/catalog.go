@@ -5,45 +5,274 @@
 
 package sampler
 
-import "sync"
+import (
+	"container/list"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unsafe"
+)
 
 const defaultServiceRateKey = "service:,env:"
 
+// maxSeenServices is the number of service signatures remembered to call onNewService once per
+// signature, the oldest one is forgotten past it.
+const maxSeenServices = 10000
+
+// parseServiceSignature parses a service signature formatted as its String, e.g. service:web,env:prod.
+func parseServiceSignature(s string) (ServiceSignature, bool) {
+	if !strings.HasPrefix(s, "service:") {
+		return ServiceSignature{}, false
+	}
+	parts := strings.SplitN(strings.TrimPrefix(s, "service:"), ",env:", 2)
+	if len(parts) != 2 {
+		return ServiceSignature{}, false
+	}
+	return ServiceSignature{Name: parts[0], Env: parts[1]}, true
+}
+
 // serviceKeyCatalog reverse-maps service signatures to their generated hashes for
 // easy look up.
 type serviceKeyCatalog struct {
-	mu     sync.Mutex
+	mu     sync.RWMutex
 	lookup map[ServiceSignature]Signature
+	// lastSeen holds the last time each service signature was registered
+	lastSeen map[ServiceSignature]time.Time
+	// ttl is the time after which a service signature that isn't registered anymore
+	// is evicted, 0 disables the eviction.
+	ttl time.Duration
+	// defaultSig is the signature the total score is reported with, defaultServiceRateKey by default.
+	defaultSig ServiceSignature
+	now        func() time.Time
+
+	// maxEntries is the maximum number of tracked service signatures, the least recently
+	// registered one is evicted past it. 0 means unlimited.
+	maxEntries int
+	// recency holds the service signatures, most recently registered first
+	recency *list.List
+	elems   map[ServiceSignature]*list.Element
+
+	// caseInsensitive lowercases the service and env of the signatures before they are
+	// tracked, so that e.g. Web and web share the same rate.
+	caseInsensitive bool
+
+	// onNewService, if set, is called the first time a service signature is registered,
+	// without holding the lock.
+	onNewService func(ServiceSignature)
+	// seen holds the service signatures onNewService was called with, regardless of their
+	// eviction from the catalog. At most maxSeen signatures are kept, the oldest first in seenOrder.
+	seen      map[ServiceSignature]struct{}
+	seenOrder []ServiceSignature
+	seenNext  int
+	maxSeen   int
 }
 
-// newServiceLookup returns a new serviceKeyCatalog.
-func newServiceLookup() *serviceKeyCatalog {
+// newServiceLookup returns a new serviceKeyCatalog evicting the services unseen for ttl,
+// and reporting the total score with defaultSig. At most maxEntries services are tracked
+// when maxEntries is positive.
+func newServiceLookup(ttl time.Duration, defaultSig ServiceSignature, maxEntries int) *serviceKeyCatalog {
 	return &serviceKeyCatalog{
-		lookup: make(map[ServiceSignature]Signature),
+		lookup:     make(map[ServiceSignature]Signature),
+		lastSeen:   make(map[ServiceSignature]time.Time),
+		ttl:        ttl,
+		defaultSig: defaultSig,
+		now:        time.Now,
+		maxEntries: maxEntries,
+		recency:    list.New(),
+		elems:      make(map[ServiceSignature]*list.Element),
+		seen:       make(map[ServiceSignature]struct{}),
+		maxSeen:    maxSeenServices,
 	}
 }
 
+// normalize returns the signature the service is tracked with, lowercased if the catalog is case-insensitive.
+func (cat *serviceKeyCatalog) normalize(svcSig ServiceSignature) ServiceSignature {
+	if !cat.caseInsensitive {
+		return svcSig
+	}
+	return ServiceSignature{Name: strings.ToLower(svcSig.Name), Env: strings.ToLower(svcSig.Env)}
+}
+
 func (cat *serviceKeyCatalog) register(svcSig ServiceSignature) Signature {
+	svcSig = cat.normalize(svcSig)
 	hash := svcSig.Hash()
 	cat.mu.Lock()
+	isNew := cat.onNewService != nil && cat.markSeenLocked(svcSig)
 	cat.lookup[svcSig] = hash
+	cat.lastSeen[svcSig] = cat.now()
+	if elem, ok := cat.elems[svcSig]; ok {
+		cat.recency.MoveToFront(elem)
+	} else {
+		cat.elems[svcSig] = cat.recency.PushFront(svcSig)
+	}
+	for cat.maxEntries > 0 && len(cat.lookup) > cat.maxEntries {
+		cat.deleteLocked(cat.recency.Back().Value.(ServiceSignature))
+	}
 	cat.mu.Unlock()
+
+	// the callback may use the catalog, it is called once the lock is released
+	if isNew {
+		cat.onNewService(svcSig)
+	}
 	return hash
 }
 
+// markSeenLocked remembers the service signature and returns true if it wasn't seen before.
+// The caller must hold the write lock.
+func (cat *serviceKeyCatalog) markSeenLocked(svcSig ServiceSignature) bool {
+	if _, ok := cat.seen[svcSig]; ok {
+		return false
+	}
+	if len(cat.seenOrder) < cat.maxSeen {
+		cat.seenOrder = append(cat.seenOrder, svcSig)
+	} else {
+		delete(cat.seen, cat.seenOrder[cat.seenNext])
+		cat.seenOrder[cat.seenNext] = svcSig
+		cat.seenNext = (cat.seenNext + 1) % cat.maxSeen
+	}
+	cat.seen[svcSig] = struct{}{}
+	return true
+}
+
+// deleteLocked stops tracking the service signature. The caller must hold the write lock.
+func (cat *serviceKeyCatalog) deleteLocked(svcSig ServiceSignature) {
+	delete(cat.lookup, svcSig)
+	delete(cat.lastSeen, svcSig)
+	if elem, ok := cat.elems[svcSig]; ok {
+		cat.recency.Remove(elem)
+		delete(cat.elems, svcSig)
+	}
+}
+
+// merge copies the service signatures tracked by other, keeping the most recent last seen time
+// of the signatures tracked by both catalogs. The least recently registered signatures are evicted
+// past maxEntries.
+func (cat *serviceKeyCatalog) merge(other *serviceKeyCatalog) {
+	if cat == other {
+		return
+	}
+
+	// both locks are always taken in the same order so that concurrent merges can't deadlock
+	if uintptr(unsafe.Pointer(cat)) < uintptr(unsafe.Pointer(other)) {
+		cat.mu.Lock()
+		other.mu.RLock()
+	} else {
+		other.mu.RLock()
+		cat.mu.Lock()
+	}
+	defer cat.mu.Unlock()
+	defer other.mu.RUnlock()
+
+	for svcSig, hash := range other.lookup {
+		seen := other.lastSeen[svcSig]
+		if _, ok := cat.lookup[svcSig]; ok && !seen.After(cat.lastSeen[svcSig]) {
+			continue
+		}
+		cat.lookup[svcSig] = hash
+		cat.lastSeen[svcSig] = seen
+	}
+
+	// the recency follows the last seen times of the merged signatures
+	services := make([]ServiceSignature, 0, len(cat.lookup))
+	for svcSig := range cat.lookup {
+		services = append(services, svcSig)
+	}
+	sort.SliceStable(services, func(i, j int) bool {
+		return cat.lastSeen[services[i]].After(cat.lastSeen[services[j]])
+	})
+	cat.recency.Init()
+	for _, svcSig := range services {
+		cat.elems[svcSig] = cat.recency.PushBack(svcSig)
+	}
+	for cat.maxEntries > 0 && len(cat.lookup) > cat.maxEntries {
+		cat.deleteLocked(cat.recency.Back().Value.(ServiceSignature))
+	}
+}
+
+// remove stops tracking the service signature, it's a no-op if the signature isn't registered.
+func (cat *serviceKeyCatalog) remove(svcSig ServiceSignature) {
+	svcSig = cat.normalize(svcSig)
+	cat.mu.Lock()
+	cat.deleteLocked(svcSig)
+	cat.mu.Unlock()
+}
+
+// removeByHash stops tracking the service signatures with the given hash.
+func (cat *serviceKeyCatalog) removeByHash(hash Signature) {
+	cat.mu.Lock()
+	defer cat.mu.Unlock()
+	for key, sig := range cat.lookup {
+		if sig == hash {
+			cat.deleteLocked(key)
+		}
+	}
+}
+
+// Len returns the number of service signatures tracked by the catalog.
+func (cat *serviceKeyCatalog) Len() int {
+	cat.mu.RLock()
+	defer cat.mu.RUnlock()
+	return len(cat.lookup)
+}
+
+// Services returns a snapshot of the service signatures tracked by the catalog, sorted by service and env.
+func (cat *serviceKeyCatalog) Services() []ServiceSignature {
+	cat.mu.RLock()
+	services := make([]ServiceSignature, 0, len(cat.lookup))
+	for svcSig := range cat.lookup {
+		services = append(services, svcSig)
+	}
+	cat.mu.RUnlock()
+
+	sort.Slice(services, func(i, j int) bool {
+		if services[i].Name != services[j].Name {
+			return services[i].Name < services[j].Name
+		}
+		return services[i].Env < services[j].Env
+	})
+	return services
+}
+
 // ratesByService returns a map of service signatures mapping to the rates identified using
-// the signatures.
+// the signatures. The signatures without a rate, or expired, stop being tracked.
 func (cat *serviceKeyCatalog) ratesByService(rates map[Signature]float64, totalScore float64) map[ServiceSignature]float64 {
 	rbs := make(map[ServiceSignature]float64, len(rates)+1)
-	cat.mu.Lock()
-	defer cat.mu.Unlock()
+	now := cat.now()
+
+	// the rates are looked up under the read lock, the stale signatures are
+	// collected and only deleted afterwards under the write lock.
+	var stale []ServiceSignature
+	cat.mu.RLock()
 	for key, sig := range cat.lookup {
-		if rate, ok := rates[sig]; ok {
-			rbs[key] = rate
-		} else {
-			delete(cat.lookup, key)
+		if cat.isStale(key, sig, rates, now) {
+			stale = append(stale, key)
+			continue
 		}
+		rbs[key] = rates[sig]
 	}
-	rbs[ServiceSignature{}] = totalScore
+	cat.mu.RUnlock()
+
+	if len(stale) > 0 {
+		cat.mu.Lock()
+		for _, key := range stale {
+			// the signature may have been registered again in the meantime
+			if sig, ok := cat.lookup[key]; ok && cat.isStale(key, sig, rates, now) {
+				cat.deleteLocked(key)
+			}
+		}
+		cat.mu.Unlock()
+	}
+
+	rbs[cat.normalize(cat.defaultSig)] = totalScore
 	return rbs
 }
+
+// isStale returns true if the service signature has no rate, or wasn't registered for longer
+// than the ttl. The caller must hold the lock.
+func (cat *serviceKeyCatalog) isStale(key ServiceSignature, sig Signature, rates map[Signature]float64, now time.Time) bool {
+	if _, ok := rates[sig]; !ok {
+		return true
+	}
+	return cat.ttl > 0 && now.Sub(cat.lastSeen[key]) > cat.ttl
+}
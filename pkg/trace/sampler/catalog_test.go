@@ -6,8 +6,10 @@
 package sampler
 
 import (
+	"strconv"
 	"sync"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -16,7 +18,7 @@ import (
 // occurring when registering entries in the catalog in parallel to obtaining
 // the rates by service map.
 func TestCatalogRegression(t *testing.T) {
-	cat := newServiceLookup()
+	cat := newServiceLookup(0, ServiceSignature{}, 0)
 	n := 100
 
 	var wg sync.WaitGroup
@@ -51,14 +53,14 @@ func TestServiceSignatureString(t *testing.T) {
 }
 
 func TestNewServiceLookup(t *testing.T) {
-	cat := newServiceLookup()
+	cat := newServiceLookup(0, ServiceSignature{}, 0)
 	assert.NotNil(t, cat.lookup)
 }
 
 func TestServiceKeyCatalogRegister(t *testing.T) {
 	assert := assert.New(t)
 
-	cat := newServiceLookup()
+	cat := newServiceLookup(0, ServiceSignature{}, 0)
 	s := getTestPrioritySampler()
 
 	_, root1 := getTestTraceWithService(t, "service1", s)
@@ -84,7 +86,7 @@ func TestServiceKeyCatalogRegister(t *testing.T) {
 func TestServiceKeyCatalogRatesByService(t *testing.T) {
 	assert := assert.New(t)
 
-	cat := newServiceLookup()
+	cat := newServiceLookup(0, ServiceSignature{}, 0)
 	s := getTestPrioritySampler()
 
 	_, root1 := getTestTraceWithService(t, "service1", s)
@@ -120,3 +122,457 @@ func TestServiceKeyCatalogRatesByService(t *testing.T) {
 		{}: 0.2,
 	}, rateByService)
 }
+
+func TestServiceKeyCatalogTTL(t *testing.T) {
+	assert := assert.New(t)
+
+	now := time.Now()
+	cat := newServiceLookup(time.Minute, ServiceSignature{}, 0)
+	cat.now = func() time.Time { return now }
+
+	sig1 := cat.register(ServiceSignature{"service1", "none"})
+	sig2 := cat.register(ServiceSignature{"service2", "none"})
+	rates := map[Signature]float64{
+		sig1: 0.3,
+		sig2: 0.7,
+	}
+	const totalRate = 0.2
+
+	// service1 keeps emitting traces, service2 stops
+	now = now.Add(45 * time.Second)
+	cat.register(ServiceSignature{"service1", "none"})
+	assert.Equal(map[ServiceSignature]float64{
+		{"service1", "none"}: 0.3,
+		{"service2", "none"}: 0.7,
+		{}:                   0.2,
+	}, cat.ratesByService(rates, totalRate))
+
+	now = now.Add(30 * time.Second)
+	assert.Equal(map[ServiceSignature]float64{
+		{"service1", "none"}: 0.3,
+		{}:                   0.2,
+	}, cat.ratesByService(rates, totalRate))
+	assert.Equal(map[ServiceSignature]Signature{{"service1", "none"}: sig1}, cat.lookup)
+	assert.Len(cat.lastSeen, 1)
+
+	now = now.Add(time.Hour)
+	assert.Equal(map[ServiceSignature]float64{
+		{}: 0.2,
+	}, cat.ratesByService(rates, totalRate))
+	assert.Empty(cat.lookup)
+	assert.Empty(cat.lastSeen)
+}
+
+func TestServiceKeyCatalogNoTTL(t *testing.T) {
+	now := time.Now()
+	cat := newServiceLookup(0, ServiceSignature{}, 0)
+	cat.now = func() time.Time { return now }
+
+	sig := cat.register(ServiceSignature{"service1", "none"})
+	now = now.Add(24 * time.Hour)
+	assert.Equal(t, map[ServiceSignature]float64{
+		{"service1", "none"}: 0.3,
+		{}:                   0.2,
+	}, cat.ratesByService(map[Signature]float64{sig: 0.3}, 0.2))
+}
+
+func TestServiceKeyCatalogServices(t *testing.T) {
+	assert := assert.New(t)
+
+	cat := newServiceLookup(0, ServiceSignature{}, 0)
+	assert.Equal(0, cat.Len())
+	assert.Empty(cat.Services())
+
+	sig := cat.register(ServiceSignature{"web", "prod"})
+	cat.register(ServiceSignature{"db", "prod"})
+	cat.register(ServiceSignature{"web", "staging"})
+	// registering a service again doesn't duplicate it
+	cat.register(ServiceSignature{"db", "prod"})
+
+	assert.Equal(3, cat.Len())
+	assert.Equal([]ServiceSignature{
+		{"db", "prod"},
+		{"web", "prod"},
+		{"web", "staging"},
+	}, cat.Services())
+
+	// the snapshot isn't affected by later changes
+	services := cat.Services()
+	cat.ratesByService(map[Signature]float64{sig: 0.5}, 1)
+	assert.Equal(1, cat.Len())
+	assert.Equal([]ServiceSignature{{"web", "prod"}}, cat.Services())
+	assert.Len(services, 3)
+}
+
+func TestServiceKeyCatalogRemove(t *testing.T) {
+	assert := assert.New(t)
+
+	cat := newServiceLookup(0, ServiceSignature{}, 0)
+	sig1 := cat.register(ServiceSignature{"service1", "none"})
+	sig2 := cat.register(ServiceSignature{"service2", "none"})
+	sig3 := cat.register(ServiceSignature{"service3", "none"})
+	rates := map[Signature]float64{
+		sig1: 0.3,
+		sig2: 0.7,
+		sig3: 0.5,
+	}
+
+	cat.remove(ServiceSignature{"service1", "none"})
+	// removing an unknown service is a no-op
+	cat.remove(ServiceSignature{"unknown", "none"})
+	assert.Equal(map[ServiceSignature]float64{
+		{"service2", "none"}: 0.7,
+		{"service3", "none"}: 0.5,
+		{}:                   0.2,
+	}, cat.ratesByService(rates, 0.2))
+
+	cat.removeByHash(sig3)
+	cat.removeByHash(ServiceSignature{"unknown", "none"}.Hash())
+	assert.Equal(map[ServiceSignature]float64{
+		{"service2", "none"}: 0.7,
+		{}:                   0.2,
+	}, cat.ratesByService(rates, 0.2))
+	assert.Equal([]ServiceSignature{{"service2", "none"}}, cat.Services())
+	assert.Len(cat.lastSeen, 1)
+}
+
+func TestServiceKeyCatalogConcurrency(t *testing.T) {
+	cat := newServiceLookup(time.Minute, ServiceSignature{}, 0)
+	const services = 50
+
+	rates := make(map[Signature]float64, services)
+	for i := 0; i < services; i++ {
+		// only the even services have a rate
+		if i%2 == 0 {
+			rates[ServiceSignature{strconv.Itoa(i), "none"}.Hash()] = 0.5
+		}
+	}
+
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 1000; i++ {
+				cat.register(ServiceSignature{strconv.Itoa(i % services), "none"})
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 1000; i++ {
+				rbs := cat.ratesByService(rates, 0.2)
+				for svcSig, rate := range rbs {
+					if svcSig != (ServiceSignature{}) {
+						assert.Equal(t, 0.5, rate)
+					}
+				}
+				cat.Len()
+			}
+		}()
+	}
+	wg.Wait()
+
+	// the services without a rate are dropped by the next lookup
+	rbs := cat.ratesByService(rates, 0.2)
+	assert.Len(t, rbs, services/2+1)
+	assert.Equal(t, services/2, cat.Len())
+}
+
+func TestServiceKeyCatalogDefaultSignature(t *testing.T) {
+	assert := assert.New(t)
+
+	defaultSig := ServiceSignature{"tenant-a", "prod"}
+	cat := newServiceLookup(0, defaultSig, 0)
+	sig := cat.register(ServiceSignature{"web", "prod"})
+
+	assert.Equal(map[ServiceSignature]float64{
+		{"web", "prod"}: 0.3,
+		defaultSig:      0.2,
+	}, cat.ratesByService(map[Signature]float64{sig: 0.3}, 0.2))
+
+	var rbs RateByService
+	rbs.SetAll(cat.ratesByService(map[Signature]float64{sig: 0.3}, 0.2))
+	assert.Equal(map[string]float64{
+		"service:web,env:prod":      0.3,
+		"service:tenant-a,env:prod": 0.2,
+	}, rbs.GetAll())
+}
+
+func TestParseServiceSignature(t *testing.T) {
+	for in, want := range map[string]ServiceSignature{
+		defaultServiceRateKey:               {},
+		"service:web,env:prod":              {"web", "prod"},
+		"service:tenant-a,env:":             {"tenant-a", ""},
+		"service:,env:staging":              {"", "staging"},
+		"service:a,b,env:c":                 {"a,b", "c"},
+		ServiceSignature{"x", "y"}.String(): {"x", "y"},
+	} {
+		sig, ok := parseServiceSignature(in)
+		assert.True(t, ok, in)
+		assert.Equal(t, want, sig)
+	}
+
+	for _, in := range []string{"", "web", "service:web", "env:prod,service:web"} {
+		_, ok := parseServiceSignature(in)
+		assert.False(t, ok, in)
+	}
+}
+
+func TestServiceKeyCatalogMaxEntries(t *testing.T) {
+	assert := assert.New(t)
+
+	cat := newServiceLookup(0, ServiceSignature{}, 3)
+	rates := make(map[Signature]float64)
+	for _, name := range []string{"a", "b", "c"} {
+		rates[cat.register(ServiceSignature{name, "none"})] = 0.5
+	}
+	assert.Equal(3, cat.Len())
+
+	// registering a again makes b the least recently registered
+	cat.register(ServiceSignature{"a", "none"})
+	rates[cat.register(ServiceSignature{"d", "none"})] = 0.5
+	assert.Equal([]ServiceSignature{{"a", "none"}, {"c", "none"}, {"d", "none"}}, cat.Services())
+
+	rates[cat.register(ServiceSignature{"e", "none"})] = 0.5
+	assert.Equal([]ServiceSignature{{"a", "none"}, {"d", "none"}, {"e", "none"}}, cat.Services())
+	assert.Equal(map[ServiceSignature]float64{
+		{"a", "none"}: 0.5,
+		{"d", "none"}: 0.5,
+		{"e", "none"}: 0.5,
+		{}:            0.2,
+	}, cat.ratesByService(rates, 0.2))
+
+	for i := 0; i < 100; i++ {
+		cat.register(ServiceSignature{strconv.Itoa(i), "none"})
+		assert.LessOrEqual(cat.Len(), 3)
+	}
+	assert.Equal([]ServiceSignature{{"97", "none"}, {"98", "none"}, {"99", "none"}}, cat.Services())
+	assert.Equal(3, cat.recency.Len())
+	assert.Len(cat.elems, 3)
+	assert.Len(cat.lastSeen, 3)
+
+	// removed signatures leave the recency list
+	cat.remove(ServiceSignature{"98", "none"})
+	assert.Equal(2, cat.recency.Len())
+	assert.Len(cat.elems, 2)
+}
+
+func TestServiceKeyCatalogCaseInsensitive(t *testing.T) {
+	assert := assert.New(t)
+
+	t.Run("enabled", func(t *testing.T) {
+		cat := newServiceLookup(0, ServiceSignature{"Tenant-A", ""}, 0)
+		cat.caseInsensitive = true
+		sig := cat.register(ServiceSignature{"Web", "Prod"})
+		assert.Equal(sig, cat.register(ServiceSignature{"web", "prod"}))
+		assert.Equal(sig, cat.register(ServiceSignature{"WEB", "prod"}))
+		assert.Equal(ServiceSignature{"web", "prod"}.Hash(), sig)
+		assert.Equal([]ServiceSignature{{"web", "prod"}}, cat.Services())
+
+		assert.Equal(map[ServiceSignature]float64{
+			{"web", "prod"}:  0.3,
+			{"tenant-a", ""}: 0.2,
+		}, cat.ratesByService(map[Signature]float64{sig: 0.3}, 0.2))
+
+		cat.remove(ServiceSignature{"wEb", "PROD"})
+		assert.Equal(0, cat.Len())
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		cat := newServiceLookup(0, ServiceSignature{}, 0)
+		rates := map[Signature]float64{
+			cat.register(ServiceSignature{"Web", "Prod"}): 0.3,
+			cat.register(ServiceSignature{"web", "prod"}): 0.4,
+		}
+		assert.Len(rates, 2)
+		assert.Equal(map[ServiceSignature]float64{
+			{"Web", "Prod"}: 0.3,
+			{"web", "prod"}: 0.4,
+			{}:              0.2,
+		}, cat.ratesByService(rates, 0.2))
+	})
+}
+
+func TestServiceKeyCatalogOnNewService(t *testing.T) {
+	assert := assert.New(t)
+
+	cat := newServiceLookup(0, ServiceSignature{}, 0)
+	seen := make(map[ServiceSignature]int)
+	cat.onNewService = func(svcSig ServiceSignature) {
+		seen[svcSig]++
+		// the lock isn't held by the callback
+		assert.Equal(len(seen), cat.Len())
+	}
+	for i := 0; i < 10; i++ {
+		cat.register(ServiceSignature{"web", "prod"})
+		cat.register(ServiceSignature{"web", "staging"})
+		cat.register(ServiceSignature{"db", "prod"})
+	}
+	assert.Equal(map[ServiceSignature]int{
+		{"web", "prod"}:    1,
+		{"web", "staging"}: 1,
+		{"db", "prod"}:     1,
+	}, seen)
+
+	// an evicted signature isn't new when it's registered again
+	cat.remove(ServiceSignature{"db", "prod"})
+	cat.register(ServiceSignature{"db", "prod"})
+	assert.Equal(1, seen[ServiceSignature{"db", "prod"}])
+}
+
+func TestServiceKeyCatalogOnNewServiceEviction(t *testing.T) {
+	assert := assert.New(t)
+
+	now := time.Now()
+	cat := newServiceLookup(time.Minute, ServiceSignature{}, 2)
+	cat.now = func() time.Time { return now }
+	seen := make(map[ServiceSignature]int)
+	cat.onNewService = func(svcSig ServiceSignature) { seen[svcSig]++ }
+
+	// web is evicted by the ttl, then db by the maximum number of services
+	web := cat.register(ServiceSignature{"web", "prod"})
+	now = now.Add(2 * time.Minute)
+	db := cat.register(ServiceSignature{"db", "prod"})
+	cat.ratesByService(map[Signature]float64{web: 1, db: 1}, 1)
+	cat.register(ServiceSignature{"api", "prod"})
+	cat.register(ServiceSignature{"worker", "prod"})
+	assert.Equal(2, cat.Len())
+
+	cat.register(ServiceSignature{"web", "prod"})
+	cat.register(ServiceSignature{"db", "prod"})
+	assert.Equal(map[ServiceSignature]int{
+		{"web", "prod"}:    1,
+		{"db", "prod"}:     1,
+		{"api", "prod"}:    1,
+		{"worker", "prod"}: 1,
+	}, seen)
+}
+
+func TestServiceKeyCatalogOnNewServiceBound(t *testing.T) {
+	cat := newServiceLookup(0, ServiceSignature{}, 0)
+	cat.maxSeen = 2
+	seen := make(map[ServiceSignature]int)
+	cat.onNewService = func(svcSig ServiceSignature) { seen[svcSig]++ }
+
+	for _, service := range []string{"web", "db", "web", "api", "web", "api"} {
+		cat.register(ServiceSignature{service, "prod"})
+	}
+	assert.Len(t, cat.seen, 2)
+	// web is the oldest seen signature when api is registered, even though it was registered again
+	assert.Equal(t, map[ServiceSignature]int{
+		{"web", "prod"}: 2,
+		{"db", "prod"}:  1,
+		{"api", "prod"}: 1,
+	}, seen)
+}
+
+func TestServiceKeyCatalogOnNewServiceConcurrency(t *testing.T) {
+	cat := newServiceLookup(0, ServiceSignature{}, 0)
+	var mu sync.Mutex
+	seen := make(map[ServiceSignature]int)
+	cat.onNewService = func(svcSig ServiceSignature) {
+		mu.Lock()
+		seen[svcSig]++
+		mu.Unlock()
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				cat.register(ServiceSignature{strconv.Itoa(j % 20), "none"})
+			}
+		}()
+	}
+	wg.Wait()
+
+	assert.Len(t, seen, 20)
+	for svcSig, n := range seen {
+		assert.Equal(t, 1, n, svcSig.String())
+	}
+}
+
+func TestServiceKeyCatalogMerge(t *testing.T) {
+	now := time.Now()
+	primary := newServiceLookup(0, ServiceSignature{}, 0)
+	primary.now = func() time.Time { return now }
+	secondary := newServiceLookup(0, ServiceSignature{}, 0)
+	secondary.now = func() time.Time { return now }
+
+	primary.register(ServiceSignature{"web", "prod"})
+	secondary.register(ServiceSignature{"db", "prod"})
+	now = now.Add(time.Minute)
+	primary.register(ServiceSignature{"api", "prod"})
+	secondary.register(ServiceSignature{"web", "prod"})
+	now = now.Add(time.Minute)
+	primary.register(ServiceSignature{"db", "prod"})
+	secondary.register(ServiceSignature{"worker", "prod"})
+
+	primary.merge(secondary)
+
+	assert.Equal(t, []ServiceSignature{
+		{"api", "prod"},
+		{"db", "prod"},
+		{"web", "prod"},
+		{"worker", "prod"},
+	}, primary.Services())
+	for _, svcSig := range primary.Services() {
+		assert.Equal(t, svcSig.Hash(), primary.lookup[svcSig])
+	}
+
+	// the most recent last seen time is kept
+	start := now.Add(-2 * time.Minute)
+	assert.Equal(t, map[ServiceSignature]time.Time{
+		{"api", "prod"}:    start.Add(time.Minute),
+		{"db", "prod"}:     start.Add(2 * time.Minute),
+		{"web", "prod"}:    start.Add(time.Minute),
+		{"worker", "prod"}: start.Add(2 * time.Minute),
+	}, primary.lastSeen)
+
+	// the other catalog is left untouched
+	assert.Equal(t, []ServiceSignature{
+		{"db", "prod"},
+		{"web", "prod"},
+		{"worker", "prod"},
+	}, secondary.Services())
+
+	// merging disjoint catalogs, the least recently seen signatures are evicted past maxEntries
+	bounded := newServiceLookup(0, ServiceSignature{}, 3)
+	bounded.now = func() time.Time { return start.Add(-time.Minute) }
+	bounded.register(ServiceSignature{"cache", "prod"})
+	bounded.merge(primary)
+	assert.Equal(t, 3, bounded.recency.Len())
+	assert.Len(t, bounded.Services(), 3)
+	assert.NotContains(t, bounded.lookup, ServiceSignature{"cache", "prod"})
+	assert.Contains(t, bounded.lookup, ServiceSignature{"db", "prod"})
+	assert.Contains(t, bounded.lookup, ServiceSignature{"worker", "prod"})
+
+	// merging a catalog into itself is a no-op
+	primary.merge(primary)
+	assert.Len(t, primary.Services(), 4)
+}
+
+func TestServiceKeyCatalogMergeConcurrency(t *testing.T) {
+	a := newServiceLookup(0, ServiceSignature{}, 0)
+	b := newServiceLookup(0, ServiceSignature{}, 0)
+	a.register(ServiceSignature{"a", "prod"})
+	b.register(ServiceSignature{"b", "prod"})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			a.merge(b)
+		}()
+		go func() {
+			defer wg.Done()
+			b.merge(a)
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, a.Services(), b.Services())
+}
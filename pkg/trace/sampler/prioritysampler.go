@@ -23,6 +23,7 @@ import (
 
 	"github.com/DataDog/datadog-agent/pkg/trace/config"
 	"github.com/DataDog/datadog-agent/pkg/trace/pb"
+	"github.com/DataDog/datadog-agent/pkg/util/log"
 )
 
 const (
@@ -47,17 +48,44 @@ type PrioritySampler struct {
 
 // NewPrioritySampler returns an initialized Sampler
 func NewPrioritySampler(conf *config.AgentConfig, dynConf *DynamicConfig) *PrioritySampler {
+	var defaultSig ServiceSignature
+	if conf.DefaultServiceRateKey != "" {
+		sig, ok := parseServiceSignature(conf.DefaultServiceRateKey)
+		if ok {
+			defaultSig = sig
+		} else {
+			log.Warnf("Invalid default service rate key %q, expected service:<service>,env:<env>, using %q", conf.DefaultServiceRateKey, defaultServiceRateKey)
+		}
+	}
 	s := &PrioritySampler{
 		Sampler:       newSampler(conf.ExtraSampleRate, conf.TargetTPS, []string{"sampler:priority"}),
 		rateByService: &dynConf.RateByService,
-		catalog:       newServiceLookup(),
+		catalog:       newServiceLookup(conf.ServiceTTL, defaultSig, conf.MaxCatalogServices),
 		exit:          make(chan struct{}),
 	}
+	s.catalog.caseInsensitive = conf.CaseInsensitiveServices
 	s.Sampler.setRateThresholdTo1(prioritySamplingRateThresholdTo1)
 
 	return s
 }
 
+// OnNewService registers a callback called the first time Sample sees a service and env, even if they
+// are evicted and seen again later. It is called synchronously, from the goroutine calling Sample.
+// It must be called before Start.
+func (s *PrioritySampler) OnNewService(fn func(ServiceSignature)) {
+	s.catalog.onNewService = fn
+}
+
+// ServiceCount returns the number of service signatures tracked by the sampler.
+func (s *PrioritySampler) ServiceCount() int {
+	return s.catalog.Len()
+}
+
+// Services returns a snapshot of the service signatures tracked by the sampler, sorted by service and env.
+func (s *PrioritySampler) Services() []ServiceSignature {
+	return s.catalog.Services()
+}
+
 // Start runs and block on the Sampler main loop
 func (s *PrioritySampler) Start() {
 	s.Sampler.Start()
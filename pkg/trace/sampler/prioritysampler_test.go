@@ -120,6 +120,23 @@ func TestPrioritySample(t *testing.T) {
 	assert.False(sampled, "this should not happen but a trace without priority sampling set should be dropped")
 }
 
+func TestPrioritySamplerServices(t *testing.T) {
+	assert := assert.New(t)
+	s := getTestPrioritySampler()
+	assert.Equal(0, s.ServiceCount())
+	assert.Empty(s.Services())
+
+	for _, service := range []string{testServiceB, testServiceA, testServiceB} {
+		trace, root := getTestTraceWithService(t, service, s)
+		s.Sample(trace, root, defaultEnv, false)
+	}
+	assert.Equal(2, s.ServiceCount())
+	assert.Equal([]ServiceSignature{
+		{testServiceA, defaultEnv},
+		{testServiceB, defaultEnv},
+	}, s.Services())
+}
+
 func TestPrioritySampleThresholdTo1(t *testing.T) {
 	assert := assert.New(t)
 	env := defaultEnv
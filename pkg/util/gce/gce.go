@@ -6,12 +6,18 @@
 package gce
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"net/http"
 	"strings"
+	"sync"
 	"time"
 
+	"golang.org/x/sync/errgroup"
+
 	"github.com/DataDog/datadog-agent/pkg/config"
 	"github.com/DataDog/datadog-agent/pkg/util/common"
 	httputils "github.com/DataDog/datadog-agent/pkg/util/http"
@@ -26,6 +32,11 @@ var (
 	CloudProviderName = "GCP"
 )
 
+var (
+	httpClientMutex sync.Mutex
+	httpClient      *http.Client
+)
+
 // IsRunningOn returns true if the agent is running on GCE
 func IsRunningOn() bool {
 	if _, err := GetHostname(); err == nil {
@@ -34,12 +45,32 @@ func IsRunningOn() bool {
 	return false
 }
 
+// IsRunningOnGKE returns true if the agent is running on a GKE node, detected through
+// the cluster-name or kube-env instance attributes that bare GCE instances don't have
+func IsRunningOnGKE() bool {
+	if _, err := GetClusterName(); err == nil {
+		return true
+	}
+	if !config.IsCloudProviderEnabled(CloudProviderName) {
+		return false
+	}
+	if _, err := getResponse(context.Background(), metadataURL+"/instance/attributes/kube-env"); err == nil {
+		return true
+	}
+	return false
+}
+
 // GetHostname returns the hostname querying GCE Metadata api
 func GetHostname() (string, error) {
+	return GetHostnameWithContext(context.Background())
+}
+
+// GetHostnameWithContext returns the hostname querying GCE Metadata api, the request is canceled with ctx
+func GetHostnameWithContext(ctx context.Context) (string, error) {
 	if !config.IsCloudProviderEnabled(CloudProviderName) {
 		return "", fmt.Errorf("cloud provider is disabled by configuration")
 	}
-	hostname, err := getResponseWithMaxLength(metadataURL+"/instance/hostname",
+	hostname, err := getResponseWithMaxLength(ctx, metadataURL+"/instance/hostname",
 		config.Datadog.GetInt("metadata_endpoints_max_hostname_size"))
 	if err != nil {
 		return "", fmt.Errorf("unable to retrieve hostname from GCE: %s", err)
@@ -49,20 +80,45 @@ func GetHostname() (string, error) {
 
 // GetHostAliases returns the host aliases from GCE
 func GetHostAliases() ([]string, error) {
+	return GetHostAliasesWithContext(context.Background())
+}
+
+// GetHostAliasesWithContext returns the host aliases from GCE, the requests are canceled with ctx
+func GetHostAliasesWithContext(ctx context.Context) ([]string, error) {
 	if !config.IsCloudProviderEnabled(CloudProviderName) {
 		return nil, fmt.Errorf("cloud provider is disabled by configuration")
 	}
 
+	maxLength := config.Datadog.GetInt("metadata_endpoints_max_hostname_size")
+
+	// The lookups are independent, issue them concurrently so that the total
+	// latency is the one of the slowest call rather than the sum of all calls.
+	var hostname, instanceName, projectID string
+	var hostnameErr, instanceNameErr, projectIDErr error
+	var g errgroup.Group
+	g.Go(func() error {
+		hostname, hostnameErr = GetHostnameWithContext(ctx)
+		return nil
+	})
+	g.Go(func() error {
+		instanceName, instanceNameErr = getResponseWithMaxLength(ctx, metadataURL+"/instance/name", maxLength)
+		return nil
+	})
+	g.Go(func() error {
+		projectID, projectIDErr = getResponseWithMaxLength(ctx, metadataURL+"/project/project-id", maxLength)
+		return nil
+	})
+	g.Wait() //nolint:errcheck
+
 	aliases := []string{}
 
-	hostname, err := GetHostname()
-	if err == nil {
+	if hostnameErr == nil {
 		aliases = append(aliases, hostname)
 	} else {
-		log.Debugf("failed to get hostname to use as Host Alias: %s", err)
+		log.Debugf("failed to get hostname to use as Host Alias: %s", hostnameErr)
 	}
 
-	if instanceAlias, err := getInstanceAlias(hostname); err == nil {
+	if instanceAlias, err := getInstanceAlias(hostname, instanceName, instanceNameErr, projectID, projectIDErr); err == nil {
 		aliases = append(aliases, instanceAlias)
 	} else {
 		log.Debugf("failed to get Host Alias: %s", err)
@@ -71,34 +127,35 @@ func GetHostAliases() ([]string, error) {
 	return aliases, nil
 }
 
-func getInstanceAlias(hostname string) (string, error) {
-	instanceName, err := getResponseWithMaxLength(metadataURL+"/instance/name",
-		config.Datadog.GetInt("metadata_endpoints_max_hostname_size"))
-	if err != nil {
+func getInstanceAlias(hostname, instanceName string, instanceNameErr error, projectID string, projectIDErr error) (string, error) {
+	if instanceNameErr != nil {
 		// If the endpoint is not reachable, fallback on the old way to get the alias.
 		// For instance, it happens in GKE, where the metadata server is only a subset
 		// of the Compute Engine metadata server.
 		// See https://cloud.google.com/kubernetes-engine/docs/how-to/workload-identity#gke_mds
 		if hostname == "" {
-			return "", fmt.Errorf("unable to retrieve instance name and hostname from GCE: %s", err)
+			return "", fmt.Errorf("unable to retrieve instance name and hostname from GCE: %s", instanceNameErr)
 		}
 		instanceName = strings.SplitN(hostname, ".", 2)[0]
 	}
 
-	projectID, err := getResponseWithMaxLength(metadataURL+"/project/project-id",
-		config.Datadog.GetInt("metadata_endpoints_max_hostname_size"))
-	if err != nil {
-		return "", fmt.Errorf("unable to retrieve project ID from GCE: %s", err)
+	if projectIDErr != nil {
+		return "", fmt.Errorf("unable to retrieve project ID from GCE: %s", projectIDErr)
 	}
 	return fmt.Sprintf("%s.%s", instanceName, projectID), nil
 }
 
 // GetClusterName returns the name of the cluster containing the current GCE instance
 func GetClusterName() (string, error) {
+	return GetClusterNameWithContext(context.Background())
+}
+
+// GetClusterNameWithContext returns the name of the cluster containing the current GCE instance, the request is canceled with ctx
+func GetClusterNameWithContext(ctx context.Context) (string, error) {
 	if !config.IsCloudProviderEnabled(CloudProviderName) {
 		return "", fmt.Errorf("cloud provider is disabled by configuration")
 	}
-	clusterName, err := getResponseWithMaxLength(metadataURL+"/instance/attributes/cluster-name",
+	clusterName, err := getResponseWithMaxLength(ctx, metadataURL+"/instance/attributes/cluster-name",
 		config.Datadog.GetInt("metadata_endpoints_max_hostname_size"))
 	if err != nil {
 		return "", fmt.Errorf("unable to retrieve clustername from GCE: %s", err)
@@ -108,10 +165,15 @@ func GetClusterName() (string, error) {
 
 // GetPublicIPv4 returns the public IPv4 address of the current GCE instance
 func GetPublicIPv4() (string, error) {
+	return GetPublicIPv4WithContext(context.Background())
+}
+
+// GetPublicIPv4WithContext returns the public IPv4 address of the current GCE instance, the request is canceled with ctx
+func GetPublicIPv4WithContext(ctx context.Context) (string, error) {
 	if !config.IsCloudProviderEnabled(CloudProviderName) {
 		return "", fmt.Errorf("cloud provider is disabled by configuration")
 	}
-	publicIPv4, err := getResponseWithMaxLength(metadataURL+"/instance/network-interfaces/0/access-configs/0/external-ip",
+	publicIPv4, err := getResponseWithMaxLength(ctx, metadataURL+"/instance/network-interfaces/0/access-configs/0/external-ip",
 		config.Datadog.GetInt("metadata_endpoints_max_hostname_size"))
 	if err != nil {
 		return "", fmt.Errorf("unable to retrieve public IPv4 from GCE: %s", err)
@@ -119,31 +181,228 @@ func GetPublicIPv4() (string, error) {
 	return publicIPv4, nil
 }
 
+// GetZone returns the zone of the current GCE instance, e.g. us-central1-a
+func GetZone() (string, error) {
+	if !config.IsCloudProviderEnabled(CloudProviderName) {
+		return "", fmt.Errorf("cloud provider is disabled by configuration")
+	}
+	zone, err := getResponseWithMaxLength(context.Background(), metadataURL+"/instance/zone",
+		config.Datadog.GetInt("metadata_endpoints_max_hostname_size"))
+	if err != nil {
+		return "", fmt.Errorf("unable to retrieve zone from GCE: %s", err)
+	}
+	// the metadata server returns the fully-qualified zone: projects/<number>/zones/<zone>
+	zone = lastPathSegment(zone)
+	if zone == "" {
+		return "", fmt.Errorf("unable to retrieve zone from GCE: empty zone")
+	}
+	return zone, nil
+}
+
+// GetRegion returns the region of the current GCE instance, e.g. us-central1
+func GetRegion() (string, error) {
+	zone, err := GetZone()
+	if err != nil {
+		return "", err
+	}
+	return regionFromZone(zone)
+}
+
+// regionFromZone trims the zone letter, a zone always being the region followed by a dash and a letter
+func regionFromZone(zone string) (string, error) {
+	idx := strings.LastIndex(zone, "-")
+	if idx <= 0 {
+		return "", fmt.Errorf("unable to retrieve region from GCE zone %q", zone)
+	}
+	return zone[:idx], nil
+}
+
+// lastPathSegment returns the short name of a fully-qualified resource, e.g. projects/<number>/zones/<zone>
+func lastPathSegment(resource string) string {
+	resource = strings.TrimSpace(resource)
+	return resource[strings.LastIndex(resource, "/")+1:]
+}
+
+// GetInstanceID returns the numeric ID of the current GCE instance
+func GetInstanceID() (string, error) {
+	if !config.IsCloudProviderEnabled(CloudProviderName) {
+		return "", fmt.Errorf("cloud provider is disabled by configuration")
+	}
+	instanceID, err := getResponseWithMaxLength(context.Background(), metadataURL+"/instance/id",
+		config.Datadog.GetInt("metadata_endpoints_max_hostname_size"))
+	if err != nil {
+		return "", fmt.Errorf("unable to retrieve instance ID from GCE: %s", err)
+	}
+	return instanceID, nil
+}
+
+// GetMachineType returns the machine type of the current GCE instance, e.g. n1-standard-1
+func GetMachineType() (string, error) {
+	if !config.IsCloudProviderEnabled(CloudProviderName) {
+		return "", fmt.Errorf("cloud provider is disabled by configuration")
+	}
+	machineType, err := getResponseWithMaxLength(context.Background(), metadataURL+"/instance/machine-type",
+		config.Datadog.GetInt("metadata_endpoints_max_hostname_size"))
+	if err != nil {
+		return "", fmt.Errorf("unable to retrieve machine type from GCE: %s", err)
+	}
+	// the metadata server returns the fully-qualified type: projects/<number>/machineTypes/<type>
+	return lastPathSegment(machineType), nil
+}
+
+// GetPublicIPv6 returns the first IPv6 address of the current GCE instance, only dual-stack instances have one
+func GetPublicIPv6() (string, error) {
+	if !config.IsCloudProviderEnabled(CloudProviderName) {
+		return "", fmt.Errorf("cloud provider is disabled by configuration")
+	}
+	ipv6s, err := getResponseWithMaxLength(context.Background(), metadataURL+"/instance/network-interfaces/0/ipv6s",
+		config.Datadog.GetInt("metadata_endpoints_max_hostname_size"))
+	if isNotFound(err) {
+		return "", fmt.Errorf("unable to retrieve public IPv6 from GCE: the instance has no IPv6 address")
+	}
+	if err != nil {
+		return "", fmt.Errorf("unable to retrieve public IPv6 from GCE: %s", err)
+	}
+	// the addresses are listed one per line
+	publicIPv6 := strings.TrimSpace(strings.SplitN(strings.TrimSpace(ipv6s), "\n", 2)[0])
+	if publicIPv6 == "" {
+		return "", fmt.Errorf("unable to retrieve public IPv6 from GCE: the instance has no IPv6 address")
+	}
+	return publicIPv6, nil
+}
+
+// GetInstanceTags returns the network tags of the current GCE instance
+func GetInstanceTags() ([]string, error) {
+	if !config.IsCloudProviderEnabled(CloudProviderName) {
+		return nil, fmt.Errorf("cloud provider is disabled by configuration")
+	}
+	resp, err := getResponse(context.Background(), metadataURL+"/instance/tags")
+	if err != nil {
+		return nil, fmt.Errorf("unable to retrieve instance tags from GCE: %s", err)
+	}
+	// the tags are listed as a JSON array
+	tags := []string{}
+	if err := json.Unmarshal([]byte(resp), &tags); err != nil {
+		return nil, fmt.Errorf("unable to parse instance tags from GCE: %s", err)
+	}
+	return tags, nil
+}
+
+// GetInstanceLabels returns the labels of the current GCE instance
+func GetInstanceLabels() (map[string]string, error) {
+	if !config.IsCloudProviderEnabled(CloudProviderName) {
+		return nil, fmt.Errorf("cloud provider is disabled by configuration")
+	}
+	// the labels have no endpoint of their own, they are only part of the recursive instance metadata
+	resp, err := getResponse(context.Background(), metadataURL+"/instance/?recursive=true")
+	if err != nil {
+		return nil, fmt.Errorf("unable to retrieve instance labels from GCE: %s", err)
+	}
+	var instance struct {
+		Labels map[string]string `json:"labels"`
+	}
+	if err := json.Unmarshal([]byte(resp), &instance); err != nil {
+		return nil, fmt.Errorf("unable to parse instance labels from GCE: %s", err)
+	}
+	if instance.Labels == nil {
+		return map[string]string{}, nil
+	}
+	return instance.Labels, nil
+}
+
+// GetServiceAccountEmail returns the email of the default service account of the current GCE instance
+func GetServiceAccountEmail() (string, error) {
+	if !config.IsCloudProviderEnabled(CloudProviderName) {
+		return "", fmt.Errorf("cloud provider is disabled by configuration")
+	}
+	email, err := getResponseWithMaxLength(context.Background(), metadataURL+"/instance/service-accounts/default/email",
+		config.Datadog.GetInt("metadata_endpoints_max_hostname_size"))
+	if isNotFound(err) {
+		return "", fmt.Errorf("unable to retrieve service account email from GCE: the instance has no service account")
+	}
+	if err != nil {
+		return "", fmt.Errorf("unable to retrieve service account email from GCE: %s", err)
+	}
+	return strings.TrimSpace(email), nil
+}
+
+// GetServiceAccountScopes returns the scopes granted to the default service account of the current GCE instance
+func GetServiceAccountScopes() ([]string, error) {
+	if !config.IsCloudProviderEnabled(CloudProviderName) {
+		return nil, fmt.Errorf("cloud provider is disabled by configuration")
+	}
+	resp, err := getResponse(context.Background(), metadataURL+"/instance/service-accounts/default/scopes")
+	if isNotFound(err) {
+		return nil, fmt.Errorf("unable to retrieve service account scopes from GCE: the instance has no service account")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to retrieve service account scopes from GCE: %s", err)
+	}
+	// the scopes are listed one per line
+	scopes := []string{}
+	for _, scope := range strings.Split(resp, "\n") {
+		if scope = strings.TrimSpace(scope); scope != "" {
+			scopes = append(scopes, scope)
+		}
+	}
+	return scopes, nil
+}
+
+// IsPreemptible returns whether the current GCE instance is a preemptible or spot VM, which can be reclaimed at any time
+func IsPreemptible() (bool, error) {
+	if !config.IsCloudProviderEnabled(CloudProviderName) {
+		return false, fmt.Errorf("cloud provider is disabled by configuration")
+	}
+	preemptible, err := getResponse(context.Background(), metadataURL+"/instance/scheduling/preemptible")
+	if err != nil {
+		return false, fmt.Errorf("unable to retrieve preemptible status from GCE: %s", err)
+	}
+	switch strings.TrimSpace(preemptible) {
+	case "TRUE":
+		return true, nil
+	case "FALSE":
+		return false, nil
+	default:
+		return false, fmt.Errorf("unable to parse preemptible status from GCE: %q", preemptible)
+	}
+}
+
 // GetNetworkID retrieves the network ID using the metadata endpoint. For
 // GCE instances, the the network ID is the VPC ID, if the instance is found to
-// be a part of exactly one VPC.
+// be a part of exactly one VPC. When it is part of several VPCs, the VPC of the
+// primary interface is used unless gce_network_id_prefer_primary is disabled.
 func GetNetworkID() (string, error) {
+	return GetNetworkIDWithContext(context.Background())
+}
+
+// GetNetworkIDWithContext retrieves the network ID using the metadata endpoint, the requests are canceled with ctx
+func GetNetworkIDWithContext(ctx context.Context) (string, error) {
 	if !config.IsCloudProviderEnabled(CloudProviderName) {
 		return "", fmt.Errorf("cloud provider is disabled by configuration")
 	}
-	resp, err := getResponse(metadataURL + "/instance/network-interfaces/")
+	resp, err := getResponse(ctx, metadataURL+"/instance/network-interfaces/")
 	if err != nil {
 		return "", fmt.Errorf("unable to retrieve network-interfaces from GCE: %s", err)
 	}
 
 	interfaceIDs := strings.Split(strings.TrimSpace(resp), "\n")
 	vpcIDs := common.NewStringSet()
+	primaryVPCID := ""
 
 	for _, interfaceID := range interfaceIDs {
 		if interfaceID == "" {
 			continue
 		}
 		interfaceID = strings.TrimSuffix(interfaceID, "/")
-		id, err := getResponse(metadataURL + fmt.Sprintf("/instance/network-interfaces/%s/network", interfaceID))
+		id, err := getResponse(ctx, metadataURL+fmt.Sprintf("/instance/network-interfaces/%s/network", interfaceID))
 		if err != nil {
 			return "", err
 		}
 		vpcIDs.Add(id)
+		// the primary interface is nic0, fallback on the first interface listed otherwise
+		if interfaceID == "0" || primaryVPCID == "" {
+			primaryVPCID = id
+		}
 	}
 
 	switch len(vpcIDs) {
@@ -152,23 +411,33 @@ func GetNetworkID() (string, error) {
 	case 1:
 		return vpcIDs.GetAll()[0], nil
 	default:
+		if config.Datadog.GetBool("gce_network_id_prefer_primary") {
+			log.Debugf("more than one VPC detected, using the VPC of the primary network interface as network ID: %s", primaryVPCID)
+			return primaryVPCID, nil
+		}
 		return "", fmt.Errorf("more than one network interface detected, cannot get network ID")
 	}
 
 }
 
 // GetNTPHosts returns the NTP hosts for GCE if it is detected as the cloud provider, otherwise an empty array.
+// The metadata server is local to the instance so no region-specific host is needed,
+// Google's public NTP can be added as a fallback with gce_ntp_public_fallback.
 // Docs: https://cloud.google.com/compute/docs/instances/managing-instances
 func GetNTPHosts() []string {
-	if IsRunningOn() {
-		return []string{"metadata.google.internal"}
+	if !config.Datadog.GetBool("gce_ntp_enabled") || !IsRunningOn() {
+		return nil
 	}
 
-	return nil
+	hosts := []string{"metadata.google.internal"}
+	if config.Datadog.GetBool("gce_ntp_public_fallback") {
+		hosts = append(hosts, "time.google.com")
+	}
+	return hosts
 }
 
-func getResponseWithMaxLength(endpoint string, maxLength int) (string, error) {
-	result, err := getResponse(endpoint)
+func getResponseWithMaxLength(ctx context.Context, endpoint string, maxLength int) (string, error) {
+	result, err := getResponse(ctx, endpoint)
 	if err != nil {
 		return result, err
 	}
@@ -178,39 +447,92 @@ func getResponseWithMaxLength(endpoint string, maxLength int) (string, error) {
 	return result, err
 }
 
-func getResponse(url string) (string, error) {
-	client := http.Client{
-		Transport: httputils.CreateHTTPTransport(),
-		Timeout:   time.Duration(config.Datadog.GetInt("gce_metadata_timeout")) * time.Millisecond,
+// statusCodeError is returned when the metadata endpoint answers with a non-200 status code
+type statusCodeError struct {
+	statusCode int
+	url        string
+}
+
+func (e *statusCodeError) Error() string {
+	return fmt.Sprintf("status code %d trying to GET %s", e.statusCode, e.url)
+}
+
+// isNotFound returns whether the metadata endpoint doesn't exist, e.g. for an optional feature of the instance
+func isNotFound(err error) bool {
+	var statusErr *statusCodeError
+	return errors.As(err, &statusErr) && statusErr.statusCode == http.StatusNotFound
+}
+
+// getHTTPClient returns the client shared by the metadata calls so that connections
+// are reused. It is recreated when the configured timeout changes.
+func getHTTPClient(timeout time.Duration) *http.Client {
+	httpClientMutex.Lock()
+	defer httpClientMutex.Unlock()
+	if httpClient == nil || httpClient.Timeout != timeout {
+		httpClient = &http.Client{
+			Transport: httputils.CreateHTTPTransport(),
+			Timeout:   timeout,
+		}
 	}
+	return httpClient
+}
 
-	req, err := http.NewRequest("GET", url, nil)
+// getResponse queries the metadata endpoint, retrying with an exponential backoff on
+// connection errors and 5xx responses. All the attempts fit in the gce_metadata_timeout budget.
+func getResponse(ctx context.Context, url string) (string, error) {
+	timeout := time.Duration(config.Datadog.GetInt("gce_metadata_timeout")) * time.Millisecond
+	client := getHTTPClient(timeout)
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	retries := config.Datadog.GetInt("gce_metadata_retries")
+	delay := time.Duration(config.Datadog.GetInt("gce_metadata_retry_delay")) * time.Millisecond
+	for attempt := 0; ; attempt++ {
+		result, retryable, err := doRequest(ctx, client, url)
+		if err == nil || !retryable || attempt >= retries {
+			return result, err
+		}
+		log.Debugf("GCE metadata request to %s failed, retrying in %s: %s", url, delay, err)
+		select {
+		case <-ctx.Done():
+			return "", err
+		case <-time.After(delay):
+		}
+		delay *= 2
+	}
+}
+
+// doRequest performs a single metadata request and returns whether the error, if any, is transient.
+func doRequest(ctx context.Context, client *http.Client, url string) (string, bool, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
-		return "", err
+		return "", false, err
 	}
 
 	req.Header.Add("Metadata-Flavor", "Google")
 	res, err := client.Do(req)
 	if err != nil {
-		return "", err
+		// connection errors are transient, unless the request was canceled
+		return "", ctx.Err() == nil, err
 	}
+	defer res.Body.Close()
 
 	if res.StatusCode != 200 {
-		return "", fmt.Errorf("status code %d trying to GET %s", res.StatusCode, url)
+		return "", res.StatusCode >= 500, &statusCodeError{statusCode: res.StatusCode, url: url}
 	}
 
-	defer res.Body.Close()
 	all, err := ioutil.ReadAll(res.Body)
 	if err != nil {
-		return "", fmt.Errorf("GCE hostname, error reading response body: %s", err)
+		return "", false, fmt.Errorf("GCE hostname, error reading response body: %s", err)
 	}
 
 	// Some cloud platforms will respond with an empty body, causing the agent to assume a faulty hostname
 	if len(all) <= 0 {
-		return "", fmt.Errorf("empty response body")
+		return "", false, fmt.Errorf("empty response body")
 	}
 
-	return string(all), nil
+	return string(all), false, nil
 }
 
 // HostnameProvider GCE implementation of the HostnameProvider
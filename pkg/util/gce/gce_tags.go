@@ -8,6 +8,7 @@
 package gce
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"strings"
@@ -55,7 +56,7 @@ func GetTags() ([]string, error) {
 		return nil, fmt.Errorf("cloud provider is disabled by configuration")
 	}
 
-	metadataResponse, err := getResponse(metadataURL + "/?recursive=true")
+	metadataResponse, err := getResponse(context.Background(), metadataURL+"/?recursive=true")
 	if err != nil {
 		return getCachedTags(err)
 	}
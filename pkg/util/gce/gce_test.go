@@ -6,10 +6,15 @@
 package gce
 
 import (
+	"context"
 	"io"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -49,6 +54,125 @@ func TestGetHostnameEmptyBody(t *testing.T) {
 	assert.Equal(t, "/instance/hostname", lastRequest.URL.Path)
 }
 
+func TestGetHostnameWithContextCanceled(t *testing.T) {
+	done := make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-done:
+		case <-time.After(5 * time.Second):
+		}
+	}))
+	defer ts.Close()
+	defer close(done)
+	metadataURL = ts.URL
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(100*time.Millisecond, cancel)
+
+	start := time.Now()
+	val, err := GetHostnameWithContext(ctx)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), context.Canceled.Error())
+	assert.Empty(t, val)
+	assert.True(t, time.Since(start) < time.Second)
+}
+
+func TestGetHostnameRetry(t *testing.T) {
+	expected := "gke-cluster-massi-agent59-default-pool-6087cc76-9cfa"
+	mockConfig := config.Mock()
+	mockConfig.Set("gce_metadata_retry_delay", 10)
+	requests := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if requests <= 2 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain")
+		io.WriteString(w, expected)
+	}))
+	defer ts.Close()
+	metadataURL = ts.URL
+
+	val, err := GetHostname()
+	assert.Nil(t, err)
+	assert.Equal(t, expected, val)
+	assert.Equal(t, 3, requests)
+
+	// the retries are exhausted
+	requests = -2
+	val, err = GetHostname()
+	assert.Error(t, err)
+	assert.Empty(t, val)
+	assert.Equal(t, 2, requests)
+}
+
+func TestGetHostnameNoRetryOnNotFound(t *testing.T) {
+	mockConfig := config.Mock()
+	mockConfig.Set("gce_metadata_retry_delay", 10)
+	requests := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer ts.Close()
+	metadataURL = ts.URL
+
+	val, err := GetHostname()
+	assert.Error(t, err)
+	assert.Empty(t, val)
+	assert.Equal(t, 1, requests)
+}
+
+func TestGetHostnameRetryConnectionError(t *testing.T) {
+	mockConfig := config.Mock()
+	mockConfig.Set("gce_metadata_retry_delay", 10)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	ts.Close()
+	metadataURL = ts.URL
+
+	start := time.Now()
+	val, err := GetHostname()
+	assert.Error(t, err)
+	assert.Empty(t, val)
+	// 3 retries after 10, 20 and 40ms
+	assert.True(t, time.Since(start) >= 70*time.Millisecond)
+	assert.True(t, time.Since(start) < time.Second)
+}
+
+func TestGetHTTPClientReuse(t *testing.T) {
+	client := getHTTPClient(time.Second)
+	assert.Same(t, client, getHTTPClient(time.Second))
+	assert.Same(t, client.Transport, getHTTPClient(time.Second).Transport)
+
+	other := getHTTPClient(2 * time.Second)
+	assert.NotSame(t, client, other)
+	assert.Equal(t, 2*time.Second, other.Timeout)
+}
+
+func TestGetHostnameReusesConnection(t *testing.T) {
+	config.Mock()
+	newConnections := int32(0)
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		io.WriteString(w, "gke-cluster-massi-agent59-default-pool-6087cc76-9cfa")
+	}))
+	ts.Config.ConnState = func(conn net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			atomic.AddInt32(&newConnections, 1)
+		}
+	}
+	ts.Start()
+	defer ts.Close()
+	metadataURL = ts.URL
+
+	for i := 0; i < 3; i++ {
+		_, err := GetHostname()
+		require.NoError(t, err)
+	}
+	assert.Equal(t, int32(1), atomic.LoadInt32(&newConnections))
+}
+
 func TestGetHostAliases(t *testing.T) {
 	lastRequests := []*http.Request{}
 	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -73,6 +197,34 @@ func TestGetHostAliases(t *testing.T) {
 	assert.Equal(t, []string{"gce-custom-hostname.custom-domain.gce-project", "gce-instance-name.gce-project"}, val)
 }
 
+func TestGetHostAliasesConcurrent(t *testing.T) {
+	delay := 200 * time.Millisecond
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		time.Sleep(delay)
+		switch path := r.URL.Path; path {
+		case "/instance/hostname":
+			io.WriteString(w, "gce-custom-hostname.custom-domain.gce-project")
+		case "/instance/name":
+			io.WriteString(w, "gce-instance-name")
+		case "/project/project-id":
+			io.WriteString(w, "gce-project")
+		default:
+			t.Errorf("Unknown URL requested: %s", path)
+		}
+	}))
+	defer ts.Close()
+	metadataURL = ts.URL
+
+	start := time.Now()
+	val, err := GetHostAliases()
+	elapsed := time.Since(start)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"gce-custom-hostname.custom-domain.gce-project", "gce-instance-name.gce-project"}, val)
+	// the three lookups are issued concurrently
+	assert.True(t, elapsed < 3*delay, "lookups took %s", elapsed)
+}
+
 func TestGetHostAliasesInstanceNameError(t *testing.T) {
 	lastRequests := []*http.Request{}
 	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -114,6 +266,34 @@ func TestGetClusterName(t *testing.T) {
 	assert.Equal(t, "/instance/attributes/cluster-name", lastRequest.URL.Path)
 }
 
+func TestIsRunningOnGKE(t *testing.T) {
+	for name, attributes := range map[string]map[string]string{
+		"cluster-name":    {"/instance/attributes/cluster-name": "test-cluster-name"},
+		"kube-env":        {"/instance/attributes/kube-env": "KUBERNETES_MASTER: 'false'"},
+		"both":            {"/instance/attributes/cluster-name": "test-cluster-name", "/instance/attributes/kube-env": "KUBERNETES_MASTER: 'false'"},
+		"bare GCE":        {"/instance/hostname": "gce-hostname"},
+		"no GCE metadata": {},
+	} {
+		t.Run(name, func(t *testing.T) {
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				value, found := attributes[r.URL.Path]
+				if !found {
+					w.WriteHeader(http.StatusNotFound)
+					return
+				}
+				w.Header().Set("Content-Type", "text/plain")
+				io.WriteString(w, value)
+			}))
+			defer ts.Close()
+			metadataURL = ts.URL
+
+			_, clusterName := attributes["/instance/attributes/cluster-name"]
+			_, kubeEnv := attributes["/instance/attributes/kube-env"]
+			assert.Equal(t, clusterName || kubeEnv, IsRunningOnGKE())
+		})
+	}
+}
+
 func TestGetPublicIPv4(t *testing.T) {
 	expected := "10.0.0.2"
 	var lastRequest *http.Request
@@ -131,6 +311,307 @@ func TestGetPublicIPv4(t *testing.T) {
 	assert.Equal(t, "/instance/network-interfaces/0/access-configs/0/external-ip", lastRequest.URL.Path)
 }
 
+func TestGetZone(t *testing.T) {
+	var lastRequest *http.Request
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		io.WriteString(w, "projects/123456789/zones/us-central1-a")
+		lastRequest = r
+	}))
+	defer ts.Close()
+	metadataURL = ts.URL
+
+	val, err := GetZone()
+	assert.Nil(t, err)
+	assert.Equal(t, "us-central1-a", val)
+	assert.Equal(t, "/instance/zone", lastRequest.URL.Path)
+
+	val, err = GetRegion()
+	assert.Nil(t, err)
+	assert.Equal(t, "us-central1", val)
+}
+
+func TestGetRegionInvalidZone(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		io.WriteString(w, "projects/123456789/zones/invalid")
+	}))
+	defer ts.Close()
+	metadataURL = ts.URL
+
+	val, err := GetRegion()
+	assert.Error(t, err)
+	assert.Empty(t, val)
+}
+
+func TestGetZoneCloudProviderDisabled(t *testing.T) {
+	mockConfig := config.Mock()
+	mockConfig.Set("cloud_provider_metadata", []string{"aws"})
+	defer mockConfig.Set("cloud_provider_metadata", []string{"aws", "gcp", "azure", "alibaba"})
+
+	_, err := GetZone()
+	assert.Error(t, err)
+	_, err = GetRegion()
+	assert.Error(t, err)
+}
+
+func TestGetInstanceID(t *testing.T) {
+	expected := "4215065496416375958"
+	var lastRequest *http.Request
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		io.WriteString(w, expected)
+		lastRequest = r
+	}))
+	defer ts.Close()
+	metadataURL = ts.URL
+
+	val, err := GetInstanceID()
+	assert.Nil(t, err)
+	assert.Equal(t, expected, val)
+	assert.Equal(t, "/instance/id", lastRequest.URL.Path)
+}
+
+func TestGetMachineType(t *testing.T) {
+	var lastRequest *http.Request
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		io.WriteString(w, "projects/123456789/machineTypes/n1-standard-1")
+		lastRequest = r
+	}))
+	defer ts.Close()
+	metadataURL = ts.URL
+
+	val, err := GetMachineType()
+	assert.Nil(t, err)
+	assert.Equal(t, "n1-standard-1", val)
+	assert.Equal(t, "/instance/machine-type", lastRequest.URL.Path)
+}
+
+func TestGetMachineTypeTooLong(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		io.WriteString(w, "projects/123456789/machineTypes/"+strings.Repeat("a", 300))
+	}))
+	defer ts.Close()
+	metadataURL = ts.URL
+
+	val, err := GetMachineType()
+	assert.Error(t, err)
+	assert.Empty(t, val)
+}
+
+func TestGetPublicIPv6(t *testing.T) {
+	var lastRequest *http.Request
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		io.WriteString(w, "2600:1900:4000:8a3f:0:0:0:0\n2600:1900:4000:8a3f:0:1:0:0\n")
+		lastRequest = r
+	}))
+	defer ts.Close()
+	metadataURL = ts.URL
+
+	val, err := GetPublicIPv6()
+	assert.Nil(t, err)
+	assert.Equal(t, "2600:1900:4000:8a3f:0:0:0:0", val)
+	assert.Equal(t, "/instance/network-interfaces/0/ipv6s", lastRequest.URL.Path)
+}
+
+func TestGetPublicIPv6Absent(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer ts.Close()
+	metadataURL = ts.URL
+
+	val, err := GetPublicIPv6()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "the instance has no IPv6 address")
+	assert.Empty(t, val)
+}
+
+func TestGetInstanceTags(t *testing.T) {
+	var lastRequest *http.Request
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `["http-server","https-server"]`)
+		lastRequest = r
+	}))
+	defer ts.Close()
+	metadataURL = ts.URL
+
+	val, err := GetInstanceTags()
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"http-server", "https-server"}, val)
+	assert.Equal(t, "/instance/tags", lastRequest.URL.Path)
+}
+
+func TestGetInstanceTagsEmpty(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, "[]")
+	}))
+	defer ts.Close()
+	metadataURL = ts.URL
+
+	val, err := GetInstanceTags()
+	assert.Nil(t, err)
+	assert.Empty(t, val)
+}
+
+func TestGetInstanceTagsInvalid(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		io.WriteString(w, "http-server")
+	}))
+	defer ts.Close()
+	metadataURL = ts.URL
+
+	val, err := GetInstanceTags()
+	assert.Error(t, err)
+	assert.Nil(t, val)
+}
+
+func TestGetInstanceLabels(t *testing.T) {
+	var lastRequest *http.Request
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{"id":4215065496416375958,"labels":{"env":"prod","team":"agent"},"tags":["http-server"]}`)
+		lastRequest = r
+	}))
+	defer ts.Close()
+	metadataURL = ts.URL
+
+	val, err := GetInstanceLabels()
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]string{"env": "prod", "team": "agent"}, val)
+	assert.Equal(t, "/instance/", lastRequest.URL.Path)
+	assert.Equal(t, "recursive=true", lastRequest.URL.RawQuery)
+}
+
+func TestGetInstanceLabelsEmpty(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{"id":4215065496416375958,"tags":[]}`)
+	}))
+	defer ts.Close()
+	metadataURL = ts.URL
+
+	val, err := GetInstanceLabels()
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]string{}, val)
+}
+
+func TestGetInstanceTagsCloudProviderDisabled(t *testing.T) {
+	mockConfig := config.Mock()
+	mockConfig.Set("cloud_provider_metadata", []string{"aws"})
+	defer mockConfig.Set("cloud_provider_metadata", []string{"aws", "gcp", "azure", "alibaba"})
+
+	_, err := GetInstanceTags()
+	assert.Error(t, err)
+	_, err = GetInstanceLabels()
+	assert.Error(t, err)
+}
+
+func TestGetServiceAccount(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		switch r.URL.Path {
+		case "/instance/service-accounts/default/email":
+			io.WriteString(w, "123456789-compute@developer.gserviceaccount.com")
+		case "/instance/service-accounts/default/scopes":
+			io.WriteString(w, "https://www.googleapis.com/auth/devstorage.read_only\nhttps://www.googleapis.com/auth/logging.write\n")
+		default:
+			t.Errorf("unexpected request %s", r.RequestURI)
+		}
+	}))
+	defer ts.Close()
+	metadataURL = ts.URL
+
+	email, err := GetServiceAccountEmail()
+	assert.Nil(t, err)
+	assert.Equal(t, "123456789-compute@developer.gserviceaccount.com", email)
+
+	scopes, err := GetServiceAccountScopes()
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"https://www.googleapis.com/auth/devstorage.read_only", "https://www.googleapis.com/auth/logging.write"}, scopes)
+}
+
+func TestGetServiceAccountAbsent(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer ts.Close()
+	metadataURL = ts.URL
+
+	email, err := GetServiceAccountEmail()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "the instance has no service account")
+	assert.Empty(t, email)
+
+	scopes, err := GetServiceAccountScopes()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "the instance has no service account")
+	assert.Nil(t, scopes)
+}
+
+func TestGetServiceAccountCloudProviderDisabled(t *testing.T) {
+	mockConfig := config.Mock()
+	mockConfig.Set("cloud_provider_metadata", []string{"aws"})
+	defer mockConfig.Set("cloud_provider_metadata", []string{"aws", "gcp", "azure", "alibaba"})
+
+	_, err := GetServiceAccountEmail()
+	assert.Error(t, err)
+	_, err = GetServiceAccountScopes()
+	assert.Error(t, err)
+}
+
+func TestIsPreemptible(t *testing.T) {
+	for response, expected := range map[string]bool{"TRUE": true, "FALSE": false} {
+		t.Run(response, func(t *testing.T) {
+			var lastRequest *http.Request
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "text/plain")
+				io.WriteString(w, response)
+				lastRequest = r
+			}))
+			defer ts.Close()
+			metadataURL = ts.URL
+
+			val, err := IsPreemptible()
+			assert.Nil(t, err)
+			assert.Equal(t, expected, val)
+			assert.Equal(t, "/instance/scheduling/preemptible", lastRequest.URL.Path)
+		})
+	}
+}
+
+func TestIsPreemptibleInvalid(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		io.WriteString(w, "maybe")
+	}))
+	defer ts.Close()
+	metadataURL = ts.URL
+
+	val, err := IsPreemptible()
+	assert.Error(t, err)
+	assert.False(t, val)
+}
+
+func TestIsPreemptibleUnreachable(t *testing.T) {
+	mockConfig := config.Mock()
+	mockConfig.Set("gce_metadata_retry_delay", 10)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	ts.Close()
+	metadataURL = ts.URL
+
+	val, err := IsPreemptible()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "unable to retrieve preemptible status from GCE")
+	assert.False(t, val)
+}
+
 func TestGetNetwork(t *testing.T) {
 	expected := "projects/123456789/networks/my-network-name"
 
@@ -187,11 +668,70 @@ func TestGetNetworkMultipleVPC(t *testing.T) {
 	defer ts.Close()
 	metadataURL = ts.URL
 
-	_, err := GetNetworkID()
+	val, err := GetNetworkID()
+	assert.NoError(t, err)
+	assert.Equal(t, vpc, val)
+
+	mockConfig := config.Mock()
+	mockConfig.Set("gce_network_id_prefer_primary", false)
+	defer mockConfig.Set("gce_network_id_prefer_primary", true)
+	_, err = GetNetworkID()
 	require.Error(t, err)
 	assert.Contains(t, err.Error(), "more than one network interface")
 }
 
+func TestGetNetworkMultipleInterfacesSameVPC(t *testing.T) {
+	vpc := "projects/123456789/networks/my-network-name"
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		switch r.RequestURI {
+		case "/instance/network-interfaces/":
+			io.WriteString(w, "0/\n1/\n")
+		case "/instance/network-interfaces/0/network", "/instance/network-interfaces/1/network":
+			io.WriteString(w, vpc)
+		default:
+			t.Errorf("unexpected request %s", r.RequestURI)
+		}
+	}))
+	defer ts.Close()
+	metadataURL = ts.URL
+
+	mockConfig := config.Mock()
+	defer mockConfig.Set("gce_network_id_prefer_primary", true)
+	for _, preferPrimary := range []bool{true, false} {
+		mockConfig.Set("gce_network_id_prefer_primary", preferPrimary)
+		val, err := GetNetworkID()
+		assert.NoError(t, err)
+		assert.Equal(t, vpc, val)
+	}
+}
+
+func TestGetNetworkMultipleVPCPrimaryNotListedFirst(t *testing.T) {
+	vpc := "projects/123456789/networks/my-network-name"
+	vpcOther := "projects/123456789/networks/my-other-name"
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		switch r.RequestURI {
+		case "/instance/network-interfaces/":
+			io.WriteString(w, "1/\n0/\n")
+		case "/instance/network-interfaces/0/network":
+			io.WriteString(w, vpc)
+		case "/instance/network-interfaces/1/network":
+			io.WriteString(w, vpcOther)
+		default:
+			t.Errorf("unexpected request %s", r.RequestURI)
+		}
+	}))
+	defer ts.Close()
+	metadataURL = ts.URL
+
+	val, err := GetNetworkID()
+	assert.NoError(t, err)
+	assert.Equal(t, vpc, val)
+}
+
 func TestGetNTPHosts(t *testing.T) {
 	expectedHosts := []string{"metadata.google.internal"}
 
@@ -207,3 +747,34 @@ func TestGetNTPHosts(t *testing.T) {
 
 	assert.Equal(t, expectedHosts, actualHosts)
 }
+
+func TestGetNTPHostsPublicFallback(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		io.WriteString(w, "test")
+	}))
+	defer ts.Close()
+	metadataURL = ts.URL
+
+	mockConfig := config.Mock()
+	mockConfig.Set("gce_ntp_public_fallback", true)
+	defer mockConfig.Set("gce_ntp_public_fallback", false)
+	assert.Equal(t, []string{"metadata.google.internal", "time.google.com"}, GetNTPHosts())
+
+	mockConfig.Set("gce_ntp_enabled", false)
+	defer mockConfig.Set("gce_ntp_enabled", true)
+	assert.Nil(t, GetNTPHosts())
+}
+
+func TestGetNTPHostsNotOnGCE(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer ts.Close()
+	metadataURL = ts.URL
+
+	mockConfig := config.Mock()
+	mockConfig.Set("gce_ntp_public_fallback", true)
+	defer mockConfig.Set("gce_ntp_public_fallback", false)
+	assert.Nil(t, GetNTPHosts())
+}
@@ -0,0 +1,86 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016-present Datadog, Inc.
+
+package gce
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/DataDog/datadog-agent/pkg/config"
+)
+
+// InstanceMetadata is a snapshot of the instance metadata, retrieved with a single request
+type InstanceMetadata struct {
+	ID                json.Number        `json:"id"`
+	Hostname          string             `json:"hostname"`
+	Name              string             `json:"name"`
+	Zone              string             `json:"zone"`
+	MachineType       string             `json:"machineType"`
+	Tags              []string           `json:"tags"`
+	Attributes        map[string]string  `json:"attributes"`
+	NetworkInterfaces []NetworkInterface `json:"networkInterfaces"`
+}
+
+// NetworkInterface is a network interface of the instance metadata
+type NetworkInterface struct {
+	Network       string         `json:"network"`
+	IP            string         `json:"ip"`
+	AccessConfigs []AccessConfig `json:"accessConfigs"`
+}
+
+// AccessConfig is an external access configuration of a network interface
+type AccessConfig struct {
+	ExternalIP string `json:"externalIp"`
+}
+
+// GetAllMetadata returns the instance metadata querying the GCE Metadata api once,
+// the zone and the machine type are reduced to their short names, e.g. us-central1-a and n1-standard-1
+func GetAllMetadata() (*InstanceMetadata, error) {
+	return GetAllMetadataWithContext(context.Background())
+}
+
+// GetAllMetadataWithContext returns the instance metadata querying the GCE Metadata api once, the request is canceled with ctx
+func GetAllMetadataWithContext(ctx context.Context) (*InstanceMetadata, error) {
+	if !config.IsCloudProviderEnabled(CloudProviderName) {
+		return nil, fmt.Errorf("cloud provider is disabled by configuration")
+	}
+	resp, err := getResponse(ctx, metadataURL+"/instance/?recursive=true")
+	if err != nil {
+		return nil, fmt.Errorf("unable to retrieve instance metadata from GCE: %s", err)
+	}
+
+	metadata := &InstanceMetadata{}
+	if err := json.Unmarshal([]byte(resp), metadata); err != nil {
+		return nil, fmt.Errorf("unable to parse instance metadata from GCE: %s", err)
+	}
+	metadata.Zone = lastPathSegment(metadata.Zone)
+	metadata.MachineType = lastPathSegment(metadata.MachineType)
+	return metadata, nil
+}
+
+// Region returns the region of the instance, derived from its zone
+func (m *InstanceMetadata) Region() (string, error) {
+	return regionFromZone(m.Zone)
+}
+
+// ClusterName returns the name of the cluster containing the instance, if any
+func (m *InstanceMetadata) ClusterName() (string, error) {
+	clusterName, found := m.Attributes["cluster-name"]
+	if !found || clusterName == "" {
+		return "", fmt.Errorf("no cluster-name attribute in GCE instance metadata")
+	}
+	return clusterName, nil
+}
+
+// PublicIPv4 returns the public IPv4 address of the first network interface of the instance
+func (m *InstanceMetadata) PublicIPv4() (string, error) {
+	if len(m.NetworkInterfaces) == 0 || len(m.NetworkInterfaces[0].AccessConfigs) == 0 ||
+		m.NetworkInterfaces[0].AccessConfigs[0].ExternalIP == "" {
+		return "", fmt.Errorf("no public IPv4 in GCE instance metadata")
+	}
+	return m.NetworkInterfaces[0].AccessConfigs[0].ExternalIP, nil
+}
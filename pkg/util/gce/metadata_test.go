@@ -0,0 +1,108 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016-present Datadog, Inc.
+
+package gce
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const instanceMetadata = `{
+  "attributes": {
+    "cluster-name": "test-cluster-name",
+    "kube-env": "KUBERNETES_MASTER: 'false'"
+  },
+  "hostname": "gke-cluster-massi-agent59-default-pool-6087cc76-9cfa.c.datadog-test.internal",
+  "id": 4215065496416375958,
+  "machineType": "projects/123456789/machineTypes/n1-standard-1",
+  "name": "gke-cluster-massi-agent59-default-pool-6087cc76-9cfa",
+  "networkInterfaces": [
+    {
+      "accessConfigs": [
+        {
+          "externalIp": "10.0.0.2",
+          "type": "ONE_TO_ONE_NAT"
+        }
+      ],
+      "ip": "10.142.0.2",
+      "network": "projects/123456789/networks/my-network-name"
+    }
+  ],
+  "tags": ["gke-cluster-massi-agent59-node"],
+  "zone": "projects/123456789/zones/us-central1-a"
+}`
+
+func TestGetAllMetadata(t *testing.T) {
+	var lastRequest *http.Request
+	requests := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, instanceMetadata)
+		lastRequest = r
+		requests++
+	}))
+	defer ts.Close()
+	metadataURL = ts.URL
+
+	metadata, err := GetAllMetadata()
+	require.NoError(t, err)
+	assert.Equal(t, 1, requests)
+	assert.Equal(t, "/instance/", lastRequest.URL.Path)
+	assert.Equal(t, "true", lastRequest.URL.Query().Get("recursive"))
+
+	assert.Equal(t, "4215065496416375958", metadata.ID.String())
+	assert.Equal(t, "gke-cluster-massi-agent59-default-pool-6087cc76-9cfa.c.datadog-test.internal", metadata.Hostname)
+	assert.Equal(t, "us-central1-a", metadata.Zone)
+	assert.Equal(t, "n1-standard-1", metadata.MachineType)
+	assert.Equal(t, []string{"gke-cluster-massi-agent59-node"}, metadata.Tags)
+
+	region, err := metadata.Region()
+	assert.NoError(t, err)
+	assert.Equal(t, "us-central1", region)
+
+	clusterName, err := metadata.ClusterName()
+	assert.NoError(t, err)
+	assert.Equal(t, "test-cluster-name", clusterName)
+
+	publicIPv4, err := metadata.PublicIPv4()
+	assert.NoError(t, err)
+	assert.Equal(t, "10.0.0.2", publicIPv4)
+}
+
+func TestGetAllMetadataMissingFields(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{"hostname": "gce-hostname"}`)
+	}))
+	defer ts.Close()
+	metadataURL = ts.URL
+
+	metadata, err := GetAllMetadata()
+	require.NoError(t, err)
+	assert.Equal(t, "gce-hostname", metadata.Hostname)
+
+	_, err = metadata.ClusterName()
+	assert.Error(t, err)
+	_, err = metadata.PublicIPv4()
+	assert.Error(t, err)
+}
+
+func TestGetAllMetadataInvalidJSON(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "not json")
+	}))
+	defer ts.Close()
+	metadataURL = ts.URL
+
+	metadata, err := GetAllMetadata()
+	assert.Error(t, err)
+	assert.Nil(t, metadata)
+}
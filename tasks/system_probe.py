@@ -532,19 +532,31 @@ def build_network_ebpf_files(ctx, build_dir):
         "http",
     ]
 
+    # variants of the compiled programs, built from the same source with extra flags
+    program_variants = {
+        # captures larger HTTP request fragments, at the cost of larger maps
+        "http-large": ("http", ["-DHTTP_LARGE_BUFFER=1"]),
+    }
+
     network_flags = get_ebpf_build_flags()
     network_flags.append("-I{}".format(network_c_dir))
-    for p in compiled_programs:
+    programs = [(p, p, []) for p in compiled_programs]
+    programs.extend((name, src, flags) for name, (src, flags) in program_variants.items())
+    for p, src, extra_flags in programs:
         # Build both the standard and debug version
-        src_file = os.path.join(network_prebuilt_dir, "{}.c".format(p))
+        src_file = os.path.join(network_prebuilt_dir, "{}.c".format(src))
         bc_file = os.path.join(build_dir, "{}.bc".format(p))
         obj_file = os.path.join(build_dir, "{}.o".format(p))
-        ctx.run(CLANG_CMD.format(flags=" ".join(network_flags), bc_file=bc_file, c_file=src_file))
+        ctx.run(CLANG_CMD.format(flags=" ".join(network_flags + extra_flags), bc_file=bc_file, c_file=src_file))
         ctx.run(LLC_CMD.format(flags=" ".join(network_flags), bc_file=bc_file, obj_file=obj_file))
 
         debug_bc_file = os.path.join(build_dir, "{}-debug.bc".format(p))
         debug_obj_file = os.path.join(build_dir, "{}-debug.o".format(p))
-        ctx.run(CLANG_CMD.format(flags=" ".join(network_flags + ["-DDEBUG=1"]), bc_file=debug_bc_file, c_file=src_file))
+        ctx.run(
+            CLANG_CMD.format(
+                flags=" ".join(network_flags + extra_flags + ["-DDEBUG=1"]), bc_file=debug_bc_file, c_file=src_file
+            )
+        )
         ctx.run(LLC_CMD.format(flags=" ".join(network_flags), bc_file=debug_bc_file, obj_file=debug_obj_file))
 
         bindata_files.extend([obj_file, debug_obj_file])
@@ -59,7 +59,7 @@ func testUDSOriginDetection(t *testing.T) {
 	// Start DSD
 	packetsChannel := make(chan packets.Packets)
 	sharedPacketPool := packets.NewPool(32)
-	sharedPacketPoolManager := packets.NewPoolManager(sharedPacketPool)
+	sharedPacketPoolManager := packets.NewPoolManager(sharedPacketPool, 2)
 	s, err := listeners.NewUDSListener(packetsChannel, sharedPacketPoolManager, nil)
 	require.Nil(t, err)
 